@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"paymentSystem/internal/auth"
+	"paymentSystem/internal/export"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/services"
+	"paymentSystem/internal/storage"
+	"paymentSystem/internal/storage/migrate"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const usage = `usage: paymentSystem [command]
+
+Без команды запускается HTTP-сервер.
+
+Команды:
+  apikey issue [флаги]  выпустить API-ключ (apikey issue -h — список флагов)
+  apikey list           показать выпущенные API-ключи
+  apikey revoke ID      отозвать API-ключ
+  export [флаги]        выгрузить транзакции в CSV или NDJSON (export -h — список флагов)
+  ledger verify         сверить балансы кошельков с журналом проводок
+  migrate status        показать примененные и ожидающие миграции
+  migrate up            применить все ожидающие миграции
+  migrate down [N]      откатить N последних миграций (по умолчанию 1)
+`
+
+// migratable реализуют хранилища с версионной схемой (SQLite, PostgreSQL).
+type migratable interface {
+	Migrator() (*migrate.Migrator, error)
+}
+
+// runCommand выполняет подкоманду и возвращает код завершения процесса.
+func runCommand(args []string, storage storage.Storage, roles auth.Roles, logger *slog.Logger) int {
+	ctx := context.Background()
+	switch args[0] {
+	case "apikey":
+		if err := storage.Init(ctx); err != nil {
+			fmt.Fprintln(os.Stderr, "storage init:", err)
+			return 1
+		}
+		return apiKeyCommand(ctx, args[1:], services.NewAPIKeyService(storage, roles, logger))
+	case "export":
+		if err := storage.Init(ctx); err != nil {
+			fmt.Fprintln(os.Stderr, "storage init:", err)
+			return 1
+		}
+		return exportCommand(ctx, args[1:], services.NewTransactionService(storage, nil, nil, nil, logger))
+	case "ledger":
+		if err := storage.Init(ctx); err != nil {
+			fmt.Fprintln(os.Stderr, "storage init:", err)
+			return 1
+		}
+		return ledgerCommand(ctx, args[1:], services.NewLedgerService(storage, logger))
+	case "migrate":
+		return migrateCommand(ctx, args[1:], storage)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+}
+
+// apiKeyCommand управляет API-ключами без запуска сервера; так выпускается
+// первый ключ администратора.
+func apiKeyCommand(ctx context.Context, args []string, keys services.APIKeyService) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	switch args[0] {
+	case "issue":
+		flags := flag.NewFlagSet("apikey issue", flag.ContinueOnError)
+		name := flags.String("name", "", "название ключа")
+		wallets := flags.String("wallets", "", "кошельки через запятую, * — все")
+		roles := flags.String("roles", "", "роли через запятую: customer, auditor, operator, admin")
+		permissions := flags.String("permissions", "", "отдельные права через запятую")
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+		if flags.NArg() > 0 {
+			flags.Usage()
+			return 2
+		}
+
+		key, err := keys.IssueKey(ctx, *name, splitList(*wallets), splitList(*roles), splitList(*permissions))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "apikey issue:", err)
+			return 1
+		}
+		_ = enc.Encode(key)
+		return 0
+
+	case "list":
+		list, err := keys.ListKeys(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "apikey list:", err)
+			return 1
+		}
+		if list == nil {
+			list = []models.APIKey{}
+		}
+		_ = enc.Encode(list)
+		return 0
+
+	case "revoke":
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "apikey revoke: invalid id %q\n", args[1])
+			return 2
+		}
+		key, err := keys.RevokeKey(ctx, id)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "apikey revoke:", err)
+			return 1
+		}
+		_ = enc.Encode(key)
+		return 0
+
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+}
+
+// splitList разбирает список через запятую, пропуская пустые элементы.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// exportCommand выгружает транзакции с фильтрами истории в файл или stdout.
+func exportCommand(ctx context.Context, args []string, service services.TransactionService) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", export.FormatCSV, "формат выгрузки: csv или ndjson")
+	output := flags.String("o", "-", "файл для записи, - — stdout")
+	wallet := flags.String("wallet", "", "только переводы кошелька")
+	direction := flags.String("direction", "", "направление относительно -wallet: in или out")
+	fromTime := flags.String("from-time", "", "начало периода, RFC 3339")
+	toTime := flags.String("to-time", "", "конец периода (не включается), RFC 3339")
+	currency := flags.String("currency", money.DefaultCurrency, "валюта границ суммы")
+	minAmount := flags.String("min-amount", "", "минимальная сумма")
+	maxAmount := flags.String("max-amount", "", "максимальная сумма")
+	limit := flags.Int("limit", 0, "максимальное число транзакций, 0 — без ограничения")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	query := services.TransactionQuery{Wallet: *wallet, Direction: *direction, Limit: *limit}
+	var err error
+	for _, f := range []struct {
+		name  string
+		value string
+		dst   *time.Time
+	}{{"from-time", *fromTime, &query.FromTime}, {"to-time", *toTime, &query.ToTime}} {
+		if f.value == "" {
+			continue
+		}
+		if *f.dst, err = time.Parse(time.RFC3339, f.value); err != nil {
+			fmt.Fprintf(os.Stderr, "export: invalid -%s: %v\n", f.name, err)
+			return 2
+		}
+	}
+	for _, f := range []struct {
+		name  string
+		value string
+		dst   **money.Money
+	}{{"min-amount", *minAmount, &query.MinAmount}, {"max-amount", *maxAmount, &query.MaxAmount}} {
+		if f.value == "" {
+			continue
+		}
+		amount, err := money.Parse(f.value, *currency)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "export: invalid -%s: %v\n", f.name, err)
+			return 2
+		}
+		*f.dst = &amount
+	}
+
+	out := os.Stdout
+	if *output != "-" {
+		if out, err = os.Create(*output); err != nil {
+			fmt.Fprintln(os.Stderr, "export:", err)
+			return 1
+		}
+		defer out.Close()
+	}
+
+	w, err := export.NewWriter(*format, out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "export:", err)
+		return 2
+	}
+
+	count := 0
+	err = service.ExportTransactions(ctx, query, func(tx models.Transaction) error {
+		count++
+		return w.Write(tx)
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil && out != os.Stdout {
+		err = out.Close()
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "export:", err)
+		return 1
+	}
+
+	if out != os.Stdout {
+		fmt.Fprintf(os.Stderr, "exported %d transactions to %s\n", count, *output)
+	}
+	return 0
+}
+
+// ledgerCommand печатает отчет сверки журнала; код 1 означает найденные расхождения.
+func ledgerCommand(ctx context.Context, args []string, ledger services.LedgerService) int {
+	if len(args) != 1 || args[0] != "verify" {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	report, err := ledger.Verify(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ledger verify:", err)
+		return 1
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(report)
+
+	if !report.OK() {
+		return 1
+	}
+	return 0
+}
+
+// migrateCommand управляет версией схемы без запуска сервера.
+func migrateCommand(ctx context.Context, args []string, storage storage.Storage) int {
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	st, ok := storage.(migratable)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "migrate: storage driver has no schema migrations")
+		return 1
+	}
+	migrator, err := st.Migrator()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+
+	switch {
+	case args[0] == "status" && len(args) == 1:
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate status:", err)
+			return 1
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return 0
+
+	case args[0] == "up" && len(args) == 1:
+		err = migrator.Up(ctx)
+
+	case args[0] == "down":
+		steps := 1
+		if len(args) == 2 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				fmt.Fprintf(os.Stderr, "migrate down: invalid number of steps %q\n", args[1])
+				return 2
+			}
+		}
+		err = migrator.Down(ctx, steps)
+
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate %s: %v\n", args[0], err)
+		return 1
+	}
+
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+	fmt.Printf("schema version: %d (latest %d)\n", version, migrator.Latest())
+	return 0
+}
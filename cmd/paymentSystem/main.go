@@ -3,16 +3,36 @@ package main
 import (
 	"context"
 	"database/sql"
-	_ "github.com/mattn/go-sqlite3"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"paymentSystem/internal/auth"
+	"paymentSystem/internal/auth/jwt"
+	"paymentSystem/internal/auth/signature"
 	"paymentSystem/internal/config"
+	"paymentSystem/internal/fees"
+	"paymentSystem/internal/fx"
 	"paymentSystem/internal/handlers"
+	"paymentSystem/internal/handlers/apikey"
+	"paymentSystem/internal/handlers/hold"
+	"paymentSystem/internal/handlers/rates"
+	"paymentSystem/internal/handlers/schedule"
+	"paymentSystem/internal/handlers/wallet"
+	"paymentSystem/internal/limits"
 	logger2 "paymentSystem/internal/logger"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/ratelimit"
 	"paymentSystem/internal/services"
-	"paymentSystem/internal/storage/sqlite"
+	"paymentSystem/internal/storage"
+	"paymentSystem/internal/storage/memory"
+	"paymentSystem/internal/storage/postgres"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -28,21 +48,111 @@ func main() {
 	}
 
 	logger := logger2.Init(cfg.Env)
+	if len(os.Args) > 1 {
+		// вывод подкоманд (отчеты, выгрузки) идет в stdout
+		logger = logger2.New(cfg.Env, os.Stderr)
+	}
+
+	roles, err := auth.NewRoles(cfg.Auth.Roles)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	db, err := sql.Open("sqlite3", cfg.StoragePath)
+	closer, storage, err := openStorage(cfg, logger)
 	if err != nil {
 		log.Fatal("Database connection failed: ", err)
 	}
 
-	storage := sqlite.NewStorage(db, logger)
-	if err := storage.Init(); err != nil {
+	if len(os.Args) > 1 {
+		code := runCommand(os.Args[1:], storage, roles, logger)
+		closer.Close()
+		os.Exit(code)
+	}
+
+	if err := storage.Init(context.Background()); err != nil {
 		log.Fatal("Storage init failed: ", err)
 	}
 
-	service := services.NewTransactionService(storage, logger)
+	feeEngine, err := fees.New(cfg.Fees)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ensureFeeWallet(context.Background(), storage, feeEngine); err != nil {
+		log.Fatal("Fee wallet setup failed: ", err)
+	}
+
+	exchangeRates, err := fx.Load(cfg.FX.RatesPath)
+	if err != nil {
+		log.Fatal("Exchange rates load failed: ", err)
+	}
+
+	transferLimits, err := limits.New(cfg.Limits)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	transferLimiter := services.NewLimiter(transferLimits, logger)
+	service := services.NewTransactionService(storage, feeEngine, exchangeRates, transferLimiter, logger)
+
+	walletService := services.NewWalletService(storage, logger)
+	idempotencyService := services.NewIdempotencyService(storage, cfg.Idempotency.TTL, logger)
+	holdService := services.NewHoldService(storage, feeEngine, transferLimiter, cfg.Holds.MaxTTL, logger)
+	rateService := services.NewRateService(exchangeRates, logger)
+	scheduleService := services.NewScheduleService(storage, service, services.RetryPolicy{
+		MaxRetries: cfg.Schedules.MaxRetries,
+		Interval:   cfg.Schedules.RetryInterval,
+	}, logger)
+
+	tokenVerifier, err := jwt.New(cfg.Auth.JWT, roles)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	signatureVerifier, err := signature.New(cfg.Auth.Signing)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var signatures handlers.SignatureVerifier
+	if signatureVerifier.Enabled() {
+		signatures = signatureVerifier
+	}
+
+	trustedProxies, err := handlers.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	rateLimiter, err := ratelimit.New(cfg.RateLimit)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var limiter handlers.RateLimiter
+	if rateLimiter.Enabled() {
+		limiter = rateLimiter
+	}
+
+	apiKeyService := services.NewAPIKeyService(storage, roles, logger)
+	// без включенной аутентификации обработчик не проверяет ключи и токены
+	var authKeys services.APIKeyService
+	var authTokens handlers.TokenVerifier
+	if cfg.Auth.Enabled {
+		authKeys = apiKeyService
+		if tokenVerifier.Enabled() {
+			authTokens = tokenVerifier
+		}
+	} else {
+		logger.Warn("authentication is disabled, API is open to everyone")
+	}
 
-	handler := handlers.NewHandler(service, logger)
-	router := handlers.NewRouter(handler)
+	// планировщик выполняет переводы от имени сервера, в обход проверки прав
+	policy := services.NewTransactionPolicy(service, logger)
+	handler := handlers.NewHandler(policy, idempotencyService, authKeys, authTokens, signatures, limiter, cfg.MaxBodyBytes, trustedProxies, logger)
+	walletHandler := wallet.NewHandler(walletService, logger)
+	holdHandler := hold.NewHandler(holdService, logger)
+	scheduleHandler := schedule.NewHandler(scheduleService, logger)
+	rateHandler := rates.NewHandler(rateService, logger)
+	apiKeyHandler := apikey.NewHandler(apiKeyService, logger)
+	router := handlers.NewRouter(handler, walletHandler, holdHandler, scheduleHandler, rateHandler, apiKeyHandler)
 
 	srv := &http.Server{
 		Addr:        cfg.Address,
@@ -54,7 +164,55 @@ func main() {
 	go func() {
 		logger.Info("Starting server")
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Error("Server error: ", err)
+			logger.Error("Server error", "error", err)
+		}
+	}()
+
+	stopPurge := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(cfg.Idempotency.TTL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				_, _ = idempotencyService.PurgeExpired(context.Background())
+			case <-stopPurge:
+				return
+			}
+		}
+	}()
+
+	// доступный баланс учитывает только неистекшие блокировки и без этого цикла,
+	// он лишь переводит просроченные блокировки в статус expired
+	go func() {
+		ticker := time.NewTicker(cfg.Holds.ExpiryInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				_, _ = holdService.ExpireHolds(context.Background())
+			case <-stopPurge:
+				return
+			}
+		}
+	}()
+
+	// выполнение запланированных переводов; при остановке начатый перевод
+	// доводится до записи исхода, и хранилище закрывается только после этого
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	var scheduler sync.WaitGroup
+	scheduler.Add(1)
+	go func() {
+		defer scheduler.Done()
+		ticker := time.NewTicker(cfg.Schedules.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				_, _ = scheduleService.RunDue(schedulerCtx)
+			case <-schedulerCtx.Done():
+				return
+			}
 		}
 	}()
 
@@ -63,6 +221,8 @@ func main() {
 
 	<-quit
 	logger.Info("Shutting down server")
+	close(stopPurge)
+	stopScheduler()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
@@ -72,11 +232,58 @@ func main() {
 		srv.Close()
 	}
 
-	logger.Info("Closing database connection")
-	if err := db.Close(); err != nil {
-		logger.Error("Database close failed: ", err)
+	scheduler.Wait()
 
+	logger.Info("Closing storage")
+	if err := closer.Close(); err != nil {
+		logger.Error("Storage close failed", "error", err)
 	}
 
 	logger.Info("Server gracefully stopped")
 }
+
+// ensureFeeWallet создает кошелек комиссий, если комиссии включены, а кошелька
+// еще нет. Существующий кошелек должен быть открыт и вестись в валюте комиссий.
+func ensureFeeWallet(ctx context.Context, st storage.Storage, engine *fees.Engine) error {
+	address := engine.Wallet()
+	if address == "" {
+		return nil
+	}
+
+	wallet, err := st.GetWallet(ctx, address)
+	switch {
+	case errors.Is(err, storage.ErrWalletNotFound):
+		return st.CreateWallet(ctx, models.Wallet{
+			Address:   address,
+			Balance:   money.New(0, engine.Currency()),
+			Owner:     "system",
+			Label:     "fees",
+			CreatedAt: time.Now().UTC(),
+		})
+	case err != nil:
+		return err
+	case wallet.ClosedAt != nil:
+		return fmt.Errorf("fee wallet %q is closed", address)
+	case wallet.Balance.Currency != engine.Currency():
+		return fmt.Errorf("fee wallet %q is in %s, fees are in %s", address, wallet.Balance.Currency, engine.Currency())
+	}
+	return nil
+}
+
+// openStorage создает хранилище по storage.driver. Возвращаемый io.Closer
+// закрывает соединение с базой или сохраняет снимок хранилища в памяти.
+func openStorage(cfg *config.Config, logger *slog.Logger) (io.Closer, storage.Storage, error) {
+	switch cfg.Storage.Driver {
+	case config.DriverPostgres:
+		db, err := sql.Open(postgres.DriverName, cfg.Storage.DSN)
+		if err != nil {
+			return nil, nil, err
+		}
+		return db, postgres.NewStorage(db, logger), nil
+	case config.DriverMemory:
+		st := memory.NewStorage(cfg.Storage.SnapshotPath, logger)
+		return st, st, nil
+	default:
+		return openSQLite(cfg, logger)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build cgo
+
+package main
+
+import (
+	"io"
+	"log/slog"
+	"paymentSystem/internal/config"
+	"paymentSystem/internal/storage"
+	"paymentSystem/internal/storage/sqlite"
+)
+
+// openSQLite открывает SQLite-хранилище по storage_path.
+func openSQLite(cfg *config.Config, logger *slog.Logger) (io.Closer, storage.Storage, error) {
+	db, err := sqlite.Open(cfg.StoragePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, sqlite.NewStorage(db, logger), nil
+}
@@ -0,0 +1,17 @@
+//go:build !cgo
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"paymentSystem/internal/config"
+	"paymentSystem/internal/storage"
+)
+
+// openSQLite недоступен без cgo: драйвер go-sqlite3 написан на C.
+func openSQLite(cfg *config.Config, logger *slog.Logger) (io.Closer, storage.Storage, error) {
+	return nil, nil, fmt.Errorf("storage.driver %q requires a cgo build; use %q or %q",
+		cfg.Storage.Driver, config.DriverMemory, config.DriverPostgres)
+}
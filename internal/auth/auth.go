@@ -0,0 +1,205 @@
+// Пакет auth описывает вызывающего API и его права
+//
+// Вызывающий (Principal) определяется middleware аутентификации и кладется
+// в контекст запроса. Права задают, какие действия ему доступны, а список
+// кошельков — с какими кошельками он может работать. Если вызывающего
+// в контексте нет (аутентификация отключена), проверки проходят.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Права вызывающего. Права на чтение и переводы действуют только для
+// кошельков вызывающего, если не указано иное.
+const (
+	// PermissionBalanceRead — просмотр кошелька и его баланса.
+	PermissionBalanceRead = "balance:read"
+	// PermissionHistoryRead — история транзакций, выписки, блокировки
+	// и запланированные переводы.
+	PermissionHistoryRead = "history:read"
+	// PermissionHistoryReadAll — просмотр балансов и истории любых кошельков,
+	// а не только своих.
+	PermissionHistoryReadAll = "history:read_all"
+	// PermissionHistoryExport — выгрузка истории транзакций.
+	PermissionHistoryExport = "history:export"
+	// PermissionSend — переводы, возвраты, блокировки и расписания.
+	PermissionSend = "send"
+	// PermissionRefundsManage — возвраты по любым транзакциям.
+	PermissionRefundsManage = "refunds:manage"
+	// PermissionWalletsManage — создание, просмотр списка и закрытие кошельков.
+	PermissionWalletsManage = "wallets:manage"
+	// PermissionAdmin — управление курсами и ключами.
+	PermissionAdmin = "admin"
+)
+
+// AllWallets в списке кошельков дает доступ ко всем кошелькам.
+const AllWallets = "*"
+
+// KeyPrefix начинает каждый API-ключ; по нему ключ легко узнать в логах и конфигах.
+const KeyPrefix = "psk_"
+
+// keyBytes — число случайных байт в API-ключе
+const keyBytes = 32
+
+// displayPrefixLength — сколько первых символов ключа хранится для его опознания
+const displayPrefixLength = len(KeyPrefix) + 8
+
+// ErrForbidden возвращается, если вызывающему не хватает права или доступа
+// к кошельку; подробности — в *ForbiddenError.
+var ErrForbidden = errors.New("forbidden")
+
+// Permissions возвращает все известные права.
+func Permissions() []string {
+	return []string{
+		PermissionBalanceRead, PermissionHistoryRead, PermissionHistoryReadAll, PermissionHistoryExport,
+		PermissionSend, PermissionRefundsManage, PermissionWalletsManage, PermissionAdmin,
+	}
+}
+
+// ValidPermission сообщает, что право известно.
+func ValidPermission(permission string) bool {
+	return slices.Contains(Permissions(), permission)
+}
+
+// Principal — аутентифицированный вызывающий. Permissions включают права
+// его ролей (см. Roles.Grant).
+type Principal struct {
+	// Subject идентифицирует вызывающего в логах, например "apikey:12".
+	Subject     string
+	Wallets     []string
+	Roles       []string
+	Permissions []string
+}
+
+// HasPermission сообщает, что у вызывающего есть право permission.
+func (p Principal) HasPermission(permission string) bool {
+	return slices.Contains(p.Permissions, permission)
+}
+
+// OwnsWallet сообщает, что вызывающему доступен кошелек address. Пустой
+// address означает «все кошельки» и доступен только с AllWallets.
+func (p Principal) OwnsWallet(address string) bool {
+	if slices.Contains(p.Wallets, AllWallets) {
+		return true
+	}
+	return address != "" && slices.Contains(p.Wallets, address)
+}
+
+// ForbiddenError сообщает, какого права (Permission) или кошелька (Wallet)
+// не хватило вызывающему.
+type ForbiddenError struct {
+	Permission string
+	Wallet     string
+}
+
+func (e *ForbiddenError) Error() string {
+	switch {
+	case e.Permission != "":
+		return fmt.Sprintf("%v: missing permission %q", ErrForbidden, e.Permission)
+	case e.Wallet != "":
+		return fmt.Sprintf("%v: no access to wallet %q", ErrForbidden, e.Wallet)
+	default:
+		return fmt.Sprintf("%v: access to all wallets is required", ErrForbidden)
+	}
+}
+
+func (e *ForbiddenError) Unwrap() error {
+	return ErrForbidden
+}
+
+type principalKey struct{}
+
+// NewContext возвращает контекст с вызывающим p.
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext возвращает вызывающего из контекста.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// Check проверяет, что у вызывающего из ctx есть право permission.
+func Check(ctx context.Context, permission string) error {
+	p, ok := FromContext(ctx)
+	if !ok || p.HasPermission(permission) {
+		return nil
+	}
+	return &ForbiddenError{Permission: permission}
+}
+
+// CheckWallets проверяет, что вызывающему из ctx доступны все кошельки wallets.
+func CheckWallets(ctx context.Context, wallets ...string) error {
+	p, ok := FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	for _, address := range wallets {
+		if !p.OwnsWallet(address) {
+			return &ForbiddenError{Wallet: address}
+		}
+	}
+	return nil
+}
+
+// CheckWalletsRead проверяет, что вызывающий из ctx может читать данные
+// кошельков wallets: они ему доступны или у него есть PermissionHistoryReadAll.
+func CheckWalletsRead(ctx context.Context, wallets ...string) error {
+	if p, ok := FromContext(ctx); ok && p.HasPermission(PermissionHistoryReadAll) {
+		return nil
+	}
+	return CheckWallets(ctx, wallets...)
+}
+
+// CheckAnyWalletRead — CheckAnyWallet для чтения, например транзакции,
+// видимой отправителю и получателю.
+func CheckAnyWalletRead(ctx context.Context, wallets ...string) error {
+	if p, ok := FromContext(ctx); ok && p.HasPermission(PermissionHistoryReadAll) {
+		return nil
+	}
+	return CheckAnyWallet(ctx, wallets...)
+}
+
+// CheckAnyWallet проверяет, что вызывающему из ctx доступен хотя бы один
+// из кошельков wallets, например отправитель или получатель перевода.
+func CheckAnyWallet(ctx context.Context, wallets ...string) error {
+	p, ok := FromContext(ctx)
+	if !ok || slices.ContainsFunc(wallets, p.OwnsWallet) {
+		return nil
+	}
+	return &ForbiddenError{Wallet: wallets[0]}
+}
+
+// GenerateKey создает новый API-ключ.
+func GenerateKey() (string, error) {
+	b := make([]byte, keyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate key: %w", err)
+	}
+	return KeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashKey возвращает хеш API-ключа для хранения и поиска. Ключ содержит
+// 256 случайных бит, поэтому соль и медленный хеш не нужны.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// DisplayPrefix возвращает начало ключа, по которому его можно опознать,
+// не раскрывая.
+func DisplayPrefix(key string) string {
+	if len(key) <= displayPrefixLength {
+		return key
+	}
+	return key[:displayPrefixLength]
+}
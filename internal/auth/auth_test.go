@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withPrincipal(p Principal) context.Context {
+	return NewContext(context.Background(), p)
+}
+
+func TestCheck(t *testing.T) {
+	ctx := withPrincipal(Principal{Subject: "apikey:1", Permissions: []string{PermissionSend}})
+
+	assert.NoError(t, Check(ctx, PermissionSend))
+
+	err := Check(ctx, PermissionAdmin)
+	assert.ErrorIs(t, err, ErrForbidden)
+	assert.EqualError(t, err, `forbidden: missing permission "admin"`)
+}
+
+func TestCheckWallets(t *testing.T) {
+	ctx := withPrincipal(Principal{Wallets: []string{"wallet-1", "wallet-2"}})
+
+	assert.NoError(t, CheckWallets(ctx, "wallet-1", "wallet-2"))
+	assert.EqualError(t, CheckWallets(ctx, "wallet-1", "wallet-3"), `forbidden: no access to wallet "wallet-3"`)
+	// пустой адрес — все кошельки
+	assert.EqualError(t, CheckWallets(ctx, ""), "forbidden: access to all wallets is required")
+
+	assert.NoError(t, CheckAnyWallet(ctx, "wallet-3", "wallet-2"))
+	assert.ErrorIs(t, CheckAnyWallet(ctx, "wallet-3", "wallet-4"), ErrForbidden)
+}
+
+func TestCheck_AllWallets(t *testing.T) {
+	ctx := withPrincipal(Principal{Wallets: []string{AllWallets}})
+
+	assert.NoError(t, CheckWallets(ctx, "wallet-1", ""))
+}
+
+func TestCheck_WithoutPrincipal(t *testing.T) {
+	// аутентификация отключена: проверки проходят
+	ctx := context.Background()
+
+	assert.NoError(t, Check(ctx, PermissionAdmin))
+	assert.NoError(t, CheckWallets(ctx, "wallet-1"))
+	assert.NoError(t, CheckAnyWallet(ctx, "wallet-1"))
+}
+
+func TestGenerateKey(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+	other, err := GenerateKey()
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(key, KeyPrefix))
+	assert.NotEqual(t, key, other)
+	assert.Len(t, HashKey(key), 64)
+	assert.Equal(t, HashKey(key), HashKey(key))
+	assert.NotEqual(t, HashKey(key), HashKey(other))
+	assert.Equal(t, key[:12], DisplayPrefix(key))
+}
@@ -0,0 +1,425 @@
+// Пакет jwt проверяет bearer-токены, выпущенные шлюзом
+//
+// Поддерживаются подписи HS256, RS256 и EdDSA (Ed25519). Ключи задаются
+// в конфигурации или загружаются из локального JWKS-файла; алгоритм токена
+// должен совпадать с алгоритмом ключа. Проверяются exp, nbf, aud и iss,
+// а кошельки, роли и права вызывающего берутся из настраиваемых claim.
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"paymentSystem/internal/auth"
+	"paymentSystem/internal/config"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Поддерживаемые алгоритмы подписи
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Claim по умолчанию для кошельков, ролей и прав вызывающего
+const (
+	DefaultWalletsClaim     = "wallets"
+	DefaultRolesClaim       = "roles"
+	DefaultPermissionsClaim = "permissions"
+)
+
+// minSecretLength — минимальная длина секрета HS256 в байтах (RFC 7518, 3.2)
+const minSecretLength = 32
+
+var (
+	// ErrInvalidConfig возвращается для некорректных ключей и параметров проверки
+	ErrInvalidConfig = errors.New("invalid jwt config")
+
+	// ErrInvalidToken возвращается для токена, который не прошел проверку;
+	// причина — в тексте ошибки.
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Verifier проверяет токены. Нулевое значение не принимает ни одного токена.
+type Verifier struct {
+	keys             []key
+	issuer           string
+	audience         string
+	walletsClaim     string
+	rolesClaim       string
+	permissionsClaim string
+	roles            auth.Roles
+	leeway           time.Duration
+	now              func() time.Time
+}
+
+// key — ключ проверки подписи. Для HS256 заполнен secret, для RS256 и EdDSA — public.
+type key struct {
+	id     string
+	alg    string
+	secret []byte
+	public crypto.PublicKey
+}
+
+// New загружает ключи и параметры проверки; roles задают права ролей
+// из токена. Без ключей возвращается выключенный Verifier.
+func New(cfg config.JWT, roles auth.Roles) (*Verifier, error) {
+	v := &Verifier{
+		issuer:           cfg.Issuer,
+		audience:         cfg.Audience,
+		walletsClaim:     cfg.WalletsClaim,
+		rolesClaim:       cfg.RolesClaim,
+		permissionsClaim: cfg.PermissionsClaim,
+		roles:            roles,
+		leeway:           cfg.Leeway,
+		now:              time.Now,
+	}
+	if v.walletsClaim == "" {
+		v.walletsClaim = DefaultWalletsClaim
+	}
+	if v.rolesClaim == "" {
+		v.rolesClaim = DefaultRolesClaim
+	}
+	if v.permissionsClaim == "" {
+		v.permissionsClaim = DefaultPermissionsClaim
+	}
+	if v.leeway < 0 {
+		return nil, fmt.Errorf("%w: auth.jwt.leeway must not be negative", ErrInvalidConfig)
+	}
+
+	for i, k := range cfg.Keys {
+		parsed, err := parseConfigKey(k)
+		if err != nil {
+			return nil, fmt.Errorf("%w: auth.jwt.keys[%d]: %v", ErrInvalidConfig, i, err)
+		}
+		v.keys = append(v.keys, parsed)
+	}
+	if cfg.JWKSPath != "" {
+		keys, err := loadJWKS(cfg.JWKSPath)
+		if err != nil {
+			return nil, fmt.Errorf("%w: auth.jwt.jwks_path: %v", ErrInvalidConfig, err)
+		}
+		v.keys = append(v.keys, keys...)
+	}
+	return v, nil
+}
+
+// Enabled сообщает, что настроен хотя бы один ключ.
+func (v *Verifier) Enabled() bool {
+	return len(v.keys) > 0
+}
+
+// header — заголовок токена
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify проверяет подпись и claim токена и возвращает вызывающего
+// с правами его ролей. Subject вызывающего — "jwt:" и claim sub.
+func (v *Verifier) Verify(token string) (auth.Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return auth.Principal{}, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return auth.Principal{}, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return auth.Principal{}, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	if err := v.verifySignature(h, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return auth.Principal{}, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return auth.Principal{}, fmt.Errorf("%w: malformed claims", ErrInvalidToken)
+	}
+	if err := v.validateClaims(claims); err != nil {
+		return auth.Principal{}, err
+	}
+
+	sub, _ := claims["sub"].(string)
+	return v.roles.Grant(auth.Principal{
+		Subject:     "jwt:" + sub,
+		Wallets:     stringList(claims[v.walletsClaim]),
+		Roles:       stringList(claims[v.rolesClaim]),
+		Permissions: stringList(claims[v.permissionsClaim]),
+	}), nil
+}
+
+// verifySignature ищет ключ с алгоритмом токена (и его kid, если он указан)
+// и проверяет подпись.
+func (v *Verifier) verifySignature(h header, signed, signature []byte) error {
+	found := false
+	for _, k := range v.keys {
+		if k.alg != h.Alg || (h.Kid != "" && k.id != h.Kid) {
+			continue
+		}
+		found = true
+		if k.verify(signed, signature) {
+			return nil
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: no key for alg %q and kid %q", ErrInvalidToken, h.Alg, h.Kid)
+	}
+	return fmt.Errorf("%w: signature mismatch", ErrInvalidToken)
+}
+
+// verify проверяет подпись signature данных signed.
+func (k key) verify(signed, signature []byte) bool {
+	switch k.alg {
+	case AlgHS256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), signature)
+	case AlgRS256:
+		digest := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(k.public.(*rsa.PublicKey), crypto.SHA256, digest[:], signature) == nil
+	case AlgEdDSA:
+		return ed25519.Verify(k.public.(ed25519.PublicKey), signed, signature)
+	default:
+		return false
+	}
+}
+
+// validateClaims проверяет срок действия, издателя и аудиторию токена.
+// exp и sub обязательны.
+func (v *Verifier) validateClaims(claims map[string]interface{}) error {
+	now := v.now()
+
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return fmt.Errorf("%w: exp is required", ErrInvalidToken)
+	}
+	if !now.Before(exp.Add(v.leeway)) {
+		return fmt.Errorf("%w: token is expired", ErrInvalidToken)
+	}
+	if raw, ok := claims["nbf"]; ok {
+		nbf, valid := numericDate(raw)
+		if !valid {
+			return fmt.Errorf("%w: malformed nbf", ErrInvalidToken)
+		}
+		if now.Add(v.leeway).Before(nbf) {
+			return fmt.Errorf("%w: token is not valid yet", ErrInvalidToken)
+		}
+	}
+
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return fmt.Errorf("%w: sub is required", ErrInvalidToken)
+	}
+	if v.issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.issuer {
+			return fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+		}
+	}
+	if v.audience != "" && !slices.Contains(stringList(claims["aud"]), v.audience) {
+		return fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+	return nil
+}
+
+// decodeSegment декодирует base64url-сегмент токена как JSON.
+func decodeSegment(segment string, dst interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(dst)
+}
+
+// numericDate читает claim времени в секундах Unix (RFC 7519, NumericDate).
+func numericDate(value interface{}) (time.Time, bool) {
+	n, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	seconds, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))), true
+}
+
+// stringList читает claim-список: массив строк или строку, разделенную
+// пробелами (как scope в OAuth 2.0).
+func stringList(value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		list := make([]string, 0, len(value))
+		for _, item := range value {
+			if s, ok := item.(string); ok && s != "" {
+				list = append(list, s)
+			}
+		}
+		return list
+	default:
+		return nil
+	}
+}
+
+// parseConfigKey разбирает ключ из конфигурации: секрет для HS256
+// или открытый ключ в PEM (PKIX) для RS256 и EdDSA.
+func parseConfigKey(cfg config.JWTKey) (key, error) {
+	k := key{id: cfg.ID, alg: cfg.Algorithm}
+	switch cfg.Algorithm {
+	case AlgHS256:
+		if len(cfg.Secret) < minSecretLength {
+			return key{}, fmt.Errorf("secret must be at least %d bytes", minSecretLength)
+		}
+		k.secret = []byte(cfg.Secret)
+		return k, nil
+	case AlgRS256, AlgEdDSA:
+		block, _ := pem.Decode([]byte(cfg.PublicKey))
+		if block == nil {
+			return key{}, errors.New("public_key must be a PEM block")
+		}
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return key{}, fmt.Errorf("public_key: %v", err)
+		}
+		k.public = public
+		return k, checkKeyType(k)
+	default:
+		return key{}, fmt.Errorf("unsupported alg %q", cfg.Algorithm)
+	}
+}
+
+// checkKeyType проверяет, что тип открытого ключа подходит алгоритму.
+func checkKeyType(k key) error {
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		if k.alg != AlgRS256 {
+			return fmt.Errorf("rsa key cannot be used with %s", k.alg)
+		}
+		if public.N.BitLen() < 2048 {
+			return errors.New("rsa key must be at least 2048 bits")
+		}
+	case ed25519.PublicKey:
+		if k.alg != AlgEdDSA {
+			return fmt.Errorf("ed25519 key cannot be used with %s", k.alg)
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", public)
+	}
+	return nil
+}
+
+// jwk — ключ из JWKS (RFC 7517)
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// OKP (Ed25519)
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	// oct (HS256)
+	K string `json:"k"`
+}
+
+// loadJWKS читает ключи из JWKS-файла. Ключи, предназначенные не для
+// подписи (use: enc), пропускаются.
+func loadJWKS(path string) ([]key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("decode %s: %v", path, err)
+	}
+
+	var keys []key
+	for i, j := range set.Keys {
+		if j.Use != "" && j.Use != "sig" {
+			continue
+		}
+		k, err := parseJWK(j)
+		if err != nil {
+			return nil, fmt.Errorf("keys[%d]: %v", i, err)
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// parseJWK разбирает ключ JWKS. Без alg алгоритм выводится из типа ключа.
+func parseJWK(j jwk) (key, error) {
+	k := key{id: j.Kid, alg: j.Alg}
+	switch j.Kty {
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(j.K)
+		if err != nil {
+			return key{}, fmt.Errorf("k: %v", err)
+		}
+		if len(secret) < minSecretLength {
+			return key{}, fmt.Errorf("secret must be at least %d bytes", minSecretLength)
+		}
+		if k.alg == "" {
+			k.alg = AlgHS256
+		}
+		if k.alg != AlgHS256 {
+			return key{}, fmt.Errorf("oct key cannot be used with %s", k.alg)
+		}
+		k.secret = secret
+		return k, nil
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return key{}, fmt.Errorf("n: %v", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return key{}, errors.New("e: invalid exponent")
+		}
+		if k.alg == "" {
+			k.alg = AlgRS256
+		}
+		k.public = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return k, checkKeyType(k)
+	case "OKP":
+		if j.Crv != "Ed25519" {
+			return key{}, fmt.Errorf("unsupported curve %q", j.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return key{}, errors.New("x: invalid ed25519 public key")
+		}
+		if k.alg == "" {
+			k.alg = AlgEdDSA
+		}
+		k.public = ed25519.PublicKey(x)
+		return k, checkKeyType(k)
+	default:
+		return key{}, fmt.Errorf("unsupported kty %q", j.Kty)
+	}
+}
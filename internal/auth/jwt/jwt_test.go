@@ -0,0 +1,258 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"paymentSystem/internal/auth"
+	"paymentSystem/internal/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+var testNow = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// sign собирает токен с заголовком header и claims, подписывая его функцией signFn
+func sign(t *testing.T, header, claims map[string]interface{}, signFn func([]byte) []byte) string {
+	t.Helper()
+	h, err := json.Marshal(header)
+	require.NoError(t, err)
+	c, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signFn([]byte(signed)))
+}
+
+func hs256(secret string) func([]byte) []byte {
+	return func(data []byte) []byte {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(data)
+		return mac.Sum(nil)
+	}
+}
+
+// validClaims возвращает claims, которые проходят проверку в testNow
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub":         "merchant-42",
+		"iss":         "gateway",
+		"aud":         []string{"payments", "other"},
+		"exp":         testNow.Add(time.Hour).Unix(),
+		"nbf":         testNow.Add(-time.Minute).Unix(),
+		"wallets":     []string{"wallet-1", "wallet-2"},
+		"permissions": "send balance:read",
+	}
+}
+
+func newVerifier(t *testing.T, cfg config.JWT) *Verifier {
+	t.Helper()
+	cfg.Issuer = "gateway"
+	cfg.Audience = "payments"
+	v, err := New(cfg, auth.DefaultRoles())
+	require.NoError(t, err)
+	v.now = func() time.Time { return testNow }
+	return v
+}
+
+func TestVerify_HS256(t *testing.T) {
+	v := newVerifier(t, config.JWT{Keys: []config.JWTKey{{Algorithm: AlgHS256, Secret: testSecret}}})
+	token := sign(t, map[string]interface{}{"alg": AlgHS256, "typ": "JWT"}, validClaims(), hs256(testSecret))
+
+	principal, err := v.Verify(token)
+
+	require.NoError(t, err)
+	assert.Equal(t, auth.Principal{
+		Subject:     "jwt:merchant-42",
+		Wallets:     []string{"wallet-1", "wallet-2"},
+		Permissions: []string{auth.PermissionBalanceRead, auth.PermissionSend},
+	}, principal)
+}
+
+func TestVerify_CustomClaims(t *testing.T) {
+	v := newVerifier(t, config.JWT{
+		Keys:             []config.JWTKey{{Algorithm: AlgHS256, Secret: testSecret}},
+		WalletsClaim:     "accounts",
+		PermissionsClaim: "scope",
+	})
+	claims := validClaims()
+	claims["accounts"] = "wallet-3"
+	claims["scope"] = []string{"history:read"}
+
+	principal, err := v.Verify(sign(t, map[string]interface{}{"alg": AlgHS256}, claims, hs256(testSecret)))
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"wallet-3"}, principal.Wallets)
+	assert.Equal(t, []string{auth.PermissionHistoryRead}, principal.Permissions)
+}
+
+func TestVerify_Roles(t *testing.T) {
+	v := newVerifier(t, config.JWT{Keys: []config.JWTKey{{Algorithm: AlgHS256, Secret: testSecret}}})
+	claims := validClaims()
+	claims["roles"] = []string{auth.RoleAuditor, "unknown"}
+	delete(claims, "permissions")
+
+	principal, err := v.Verify(sign(t, map[string]interface{}{"alg": AlgHS256}, claims, hs256(testSecret)))
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{auth.RoleAuditor, "unknown"}, principal.Roles)
+	assert.Equal(t, []string{
+		auth.PermissionBalanceRead, auth.PermissionHistoryExport, auth.PermissionHistoryRead, auth.PermissionHistoryReadAll,
+	}, principal.Permissions)
+}
+
+func TestVerify_JWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	jwks, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "OKP", "kid": "ed-1", "crv": "Ed25519", "x": base64.RawURLEncoding.EncodeToString(edPublic)},
+		{"kty": "RSA", "kid": "enc-1", "use": "enc"},
+	}})
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, jwks, 0o600))
+
+	v := newVerifier(t, config.JWT{JWKSPath: path})
+
+	rs256 := sign(t, map[string]interface{}{"alg": AlgRS256, "kid": "rsa-1"}, validClaims(), func(data []byte) []byte {
+		digest := sha256.Sum256(data)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+		return signature
+	})
+	_, err = v.Verify(rs256)
+	assert.NoError(t, err)
+
+	eddsa := sign(t, map[string]interface{}{"alg": AlgEdDSA, "kid": "ed-1"}, validClaims(), func(data []byte) []byte {
+		return ed25519.Sign(edPrivate, data)
+	})
+	_, err = v.Verify(eddsa)
+	assert.NoError(t, err)
+
+	// kid другого ключа
+	wrongKid := sign(t, map[string]interface{}{"alg": AlgEdDSA, "kid": "rsa-1"}, validClaims(), func(data []byte) []byte {
+		return ed25519.Sign(edPrivate, data)
+	})
+	_, err = v.Verify(wrongKid)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestVerify_PEMKey(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(public)
+	require.NoError(t, err)
+	v := newVerifier(t, config.JWT{Keys: []config.JWTKey{{
+		Algorithm: AlgEdDSA,
+		PublicKey: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	}}})
+
+	token := sign(t, map[string]interface{}{"alg": AlgEdDSA}, validClaims(), func(data []byte) []byte {
+		return ed25519.Sign(private, data)
+	})
+	_, err = v.Verify(token)
+	assert.NoError(t, err)
+}
+
+func TestVerify_Rejects(t *testing.T) {
+	v := newVerifier(t, config.JWT{
+		Keys:   []config.JWTKey{{Algorithm: AlgHS256, Secret: testSecret}},
+		Leeway: 30 * time.Second,
+	})
+	hs := map[string]interface{}{"alg": AlgHS256}
+
+	tests := []struct {
+		name    string
+		header  map[string]interface{}
+		modify  func(map[string]interface{})
+		secret  string
+		message string
+	}{
+		{"expired", hs, func(c map[string]interface{}) { c["exp"] = testNow.Add(-time.Minute).Unix() }, testSecret, "invalid token: token is expired"},
+		{"not valid yet", hs, func(c map[string]interface{}) { c["nbf"] = testNow.Add(time.Minute).Unix() }, testSecret, "invalid token: token is not valid yet"},
+		{"no exp", hs, func(c map[string]interface{}) { delete(c, "exp") }, testSecret, "invalid token: exp is required"},
+		{"no sub", hs, func(c map[string]interface{}) { delete(c, "sub") }, testSecret, "invalid token: sub is required"},
+		{"wrong issuer", hs, func(c map[string]interface{}) { c["iss"] = "someone" }, testSecret, "invalid token: unexpected issuer"},
+		{"wrong audience", hs, func(c map[string]interface{}) { c["aud"] = "other" }, testSecret, "invalid token: unexpected audience"},
+		{"wrong secret", hs, func(map[string]interface{}) {}, testSecret + "x", "invalid token: signature mismatch"},
+		{"alg none", map[string]interface{}{"alg": "none"}, func(map[string]interface{}) {}, testSecret, `invalid token: no key for alg "none" and kid ""`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.modify(claims)
+
+			_, err := v.Verify(sign(t, tt.header, claims, hs256(tt.secret)))
+
+			assert.ErrorIs(t, err, ErrInvalidToken)
+			assert.EqualError(t, err, tt.message)
+		})
+	}
+
+	_, err := v.Verify("not-a-token")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestVerify_Leeway(t *testing.T) {
+	v := newVerifier(t, config.JWT{
+		Keys:   []config.JWTKey{{Algorithm: AlgHS256, Secret: testSecret}},
+		Leeway: 30 * time.Second,
+	})
+	claims := validClaims()
+	claims["exp"] = testNow.Add(-10 * time.Second).Unix()
+	claims["nbf"] = testNow.Add(10 * time.Second).Unix()
+
+	_, err := v.Verify(sign(t, map[string]interface{}{"alg": AlgHS256}, claims, hs256(testSecret)))
+
+	assert.NoError(t, err)
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	rsaPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	tests := []struct {
+		name string
+		cfg  config.JWT
+	}{
+		{"short secret", config.JWT{Keys: []config.JWTKey{{Algorithm: AlgHS256, Secret: "short"}}}},
+		{"unknown alg", config.JWT{Keys: []config.JWTKey{{Algorithm: "HS512", Secret: testSecret}}}},
+		{"not pem", config.JWT{Keys: []config.JWTKey{{Algorithm: AlgRS256, PublicKey: "key"}}}},
+		{"rsa key for eddsa", config.JWT{Keys: []config.JWTKey{{Algorithm: AlgEdDSA, PublicKey: rsaPEM}}}},
+		{"missing jwks", config.JWT{JWKSPath: filepath.Join(t.TempDir(), "missing.json")}},
+		{"negative leeway", config.JWT{Leeway: -time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg, auth.DefaultRoles())
+			assert.ErrorIs(t, err, ErrInvalidConfig)
+		})
+	}
+
+	v, err := New(config.JWT{}, auth.DefaultRoles())
+	require.NoError(t, err)
+	assert.False(t, v.Enabled())
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// Роли вызывающего
+const (
+	// RoleCustomer — владелец кошельков: баланс, история и переводы.
+	RoleCustomer = "customer"
+	// RoleAuditor — чтение и выгрузка истории всех кошельков.
+	RoleAuditor = "auditor"
+	// RoleOperator — поддержка: кошельки, возвраты и история всех кошельков.
+	RoleOperator = "operator"
+	// RoleAdmin — все права.
+	RoleAdmin = "admin"
+)
+
+// ErrInvalidRoles возвращается для некорректной карты ролей
+var ErrInvalidRoles = errors.New("invalid roles config")
+
+// Roles сопоставляет роль с ее правами.
+type Roles map[string][]string
+
+// DefaultRoles возвращает встроенные роли.
+func DefaultRoles() Roles {
+	return Roles{
+		RoleCustomer: {PermissionBalanceRead, PermissionHistoryRead, PermissionSend},
+		RoleAuditor:  {PermissionBalanceRead, PermissionHistoryRead, PermissionHistoryReadAll, PermissionHistoryExport},
+		RoleOperator: {
+			PermissionBalanceRead, PermissionHistoryRead, PermissionHistoryReadAll, PermissionHistoryExport,
+			PermissionRefundsManage, PermissionWalletsManage,
+		},
+		RoleAdmin: Permissions(),
+	}
+}
+
+// NewRoles дополняет встроенные роли ролями из конфигурации: роль
+// с известным именем заменяется целиком, с новым — добавляется.
+func NewRoles(cfg map[string][]string) (Roles, error) {
+	roles := DefaultRoles()
+	for role, permissions := range cfg {
+		if role == "" {
+			return nil, fmt.Errorf("%w: empty role name", ErrInvalidRoles)
+		}
+		for _, p := range permissions {
+			if !ValidPermission(p) {
+				return nil, fmt.Errorf("%w: role %q: unknown permission %q", ErrInvalidRoles, role, p)
+			}
+		}
+		roles[role] = slices.Clone(permissions)
+	}
+	return roles, nil
+}
+
+// Names возвращает имена ролей по алфавиту.
+func (r Roles) Names() []string {
+	names := make([]string, 0, len(r))
+	for role := range r {
+		names = append(names, role)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Valid сообщает, что роль известна.
+func (r Roles) Valid(role string) bool {
+	_, ok := r[role]
+	return ok
+}
+
+// Grant добавляет к правам p права его ролей. Неизвестные роли
+// ничего не дают.
+func (r Roles) Grant(p Principal) Principal {
+	permissions := slices.Clone(p.Permissions)
+	for _, role := range p.Roles {
+		permissions = append(permissions, r[role]...)
+	}
+	sort.Strings(permissions)
+	p.Permissions = slices.Compact(permissions)
+	return p
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRoles(t *testing.T) {
+	roles, err := NewRoles(map[string][]string{
+		RoleCustomer: {PermissionBalanceRead},
+		"reporter":   {PermissionHistoryRead, PermissionHistoryExport},
+	})
+	require.NoError(t, err)
+
+	// встроенная роль заменяется, новая добавляется, остальные сохраняются
+	assert.Equal(t, []string{PermissionBalanceRead}, roles[RoleCustomer])
+	assert.True(t, roles.Valid("reporter"))
+	assert.Equal(t, []string{RoleAdmin, RoleAuditor, RoleCustomer, RoleOperator, "reporter"}, roles.Names())
+
+	_, err = NewRoles(map[string][]string{"reporter": {"withdraw"}})
+	assert.ErrorIs(t, err, ErrInvalidRoles)
+	_, err = NewRoles(map[string][]string{"": {PermissionSend}})
+	assert.ErrorIs(t, err, ErrInvalidRoles)
+}
+
+func TestRoles_Grant(t *testing.T) {
+	roles := DefaultRoles()
+
+	p := roles.Grant(Principal{
+		Roles:       []string{RoleCustomer, "unknown"},
+		Permissions: []string{PermissionHistoryExport, PermissionSend},
+	})
+
+	assert.Equal(t, []string{PermissionBalanceRead, PermissionHistoryExport, PermissionHistoryRead, PermissionSend}, p.Permissions)
+	assert.ElementsMatch(t, Permissions(), roles.Grant(Principal{Roles: []string{RoleAdmin}}).Permissions)
+}
+
+func TestCheckWalletsRead(t *testing.T) {
+	own := withPrincipal(Principal{Wallets: []string{"wallet-1"}})
+	auditor := withPrincipal(Principal{Wallets: []string{"wallet-1"}, Permissions: []string{PermissionHistoryReadAll}})
+
+	assert.ErrorIs(t, CheckWalletsRead(own, "wallet-2"), ErrForbidden)
+	assert.ErrorIs(t, CheckAnyWalletRead(own, "wallet-2", "wallet-3"), ErrForbidden)
+	assert.NoError(t, CheckWalletsRead(auditor, "wallet-2", ""))
+	assert.NoError(t, CheckAnyWalletRead(auditor, "wallet-2"))
+	// чтение не дает права переводить с чужого кошелька
+	assert.ErrorIs(t, CheckWallets(auditor, "wallet-2"), ErrForbidden)
+}
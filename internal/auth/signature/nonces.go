@@ -0,0 +1,40 @@
+package signature
+
+import (
+	"sync"
+	"time"
+)
+
+// nonceCache запоминает использованные nonce до истечения их срока.
+// Кэш живет в памяти процесса: у нескольких экземпляров сервера он свой.
+type nonceCache struct {
+	mu        sync.Mutex
+	expires   map[string]time.Time
+	nextPurge time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{expires: make(map[string]time.Time)}
+}
+
+// add запоминает nonce до expires и сообщает, что он еще не использовался.
+// Просроченные nonce удаляются не чаще раза в минуту.
+func (c *nonceCache) add(nonce string, expires, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.After(c.nextPurge) {
+		for n, e := range c.expires {
+			if !e.After(now) {
+				delete(c.expires, n)
+			}
+		}
+		c.nextPurge = now.Add(time.Minute)
+	}
+
+	if e, ok := c.expires[nonce]; ok && e.After(now) {
+		return false
+	}
+	c.expires[nonce] = expires
+	return true
+}
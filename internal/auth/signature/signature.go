@@ -0,0 +1,160 @@
+// Пакет signature проверяет подпись запросов HMAC-SHA256
+//
+// Подпись защищает запросы межсерверных клиентов от подмены. Клиент
+// подписывает своим секретом метод, путь с query-строкой, время запроса,
+// одноразовое значение (nonce) и SHA-256 тела. Запрос со временем вне
+// допуска расхождения часов отклоняется, а повтор nonce в пределах этого
+// допуска считается повтором запроса.
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"paymentSystem/internal/config"
+	"strconv"
+	"time"
+)
+
+// Заголовки подписанного запроса
+const (
+	// HeaderClient — идентификатор клиента, по которому выбирается секрет.
+	HeaderClient = "X-Client-ID"
+	// HeaderTimestamp — время запроса в секундах Unix.
+	HeaderTimestamp = "X-Timestamp"
+	// HeaderNonce — одноразовое значение, уникальное для клиента.
+	HeaderNonce = "X-Nonce"
+	// HeaderSignature — HMAC-SHA256 строки подписи в hex.
+	HeaderSignature = "X-Signature"
+)
+
+// DefaultMaxSkew — допуск расхождения часов клиента и сервера по умолчанию
+const DefaultMaxSkew = 5 * time.Minute
+
+// minSecretLength — минимальная длина секрета клиента в байтах
+const minSecretLength = 32
+
+// maxNonceLength ограничивает длину nonce
+const maxNonceLength = 128
+
+var (
+	// ErrInvalidConfig возвращается для некорректных клиентов и параметров проверки
+	ErrInvalidConfig = errors.New("invalid signing config")
+
+	// ErrInvalidSignature возвращается для запроса, который не прошел
+	// проверку подписи; причина — в тексте ошибки.
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// Verifier проверяет подписи запросов.
+type Verifier struct {
+	secrets  map[string][]byte
+	required bool
+	maxSkew  time.Duration
+	nonces   *nonceCache
+	now      func() time.Time
+}
+
+// New загружает секреты клиентов. Без клиентов возвращается выключенный
+// Verifier; подпись без клиентов обязательной быть не может.
+func New(cfg config.Signing) (*Verifier, error) {
+	v := &Verifier{
+		secrets:  make(map[string][]byte, len(cfg.Clients)),
+		required: cfg.Required,
+		maxSkew:  cfg.MaxSkew,
+		nonces:   newNonceCache(),
+		now:      time.Now,
+	}
+	if v.maxSkew == 0 {
+		v.maxSkew = DefaultMaxSkew
+	}
+	if v.maxSkew < 0 {
+		return nil, fmt.Errorf("%w: auth.signing.max_skew must not be negative", ErrInvalidConfig)
+	}
+
+	for i, c := range cfg.Clients {
+		switch {
+		case c.ID == "":
+			return nil, fmt.Errorf("%w: auth.signing.clients[%d]: id is required", ErrInvalidConfig, i)
+		case len(c.Secret) < minSecretLength:
+			return nil, fmt.Errorf("%w: auth.signing.clients[%d]: secret must be at least %d bytes", ErrInvalidConfig, i, minSecretLength)
+		}
+		if _, ok := v.secrets[c.ID]; ok {
+			return nil, fmt.Errorf("%w: auth.signing.clients[%d]: duplicate id %q", ErrInvalidConfig, i, c.ID)
+		}
+		v.secrets[c.ID] = []byte(c.Secret)
+	}
+	if v.required && len(v.secrets) == 0 {
+		return nil, fmt.Errorf("%w: auth.signing.required needs at least one client", ErrInvalidConfig)
+	}
+	return v, nil
+}
+
+// Enabled сообщает, что настроен хотя бы один клиент.
+func (v *Verifier) Enabled() bool {
+	return len(v.secrets) > 0
+}
+
+// Verify проверяет подпись запроса с методом method, путем uri (вместе
+// с query-строкой), заголовками header и телом body и возвращает
+// идентификатор клиента. Запрос без HeaderSignature пропускается с пустым
+// идентификатором, если подпись не обязательна.
+func (v *Verifier) Verify(method, uri string, header http.Header, body []byte) (string, error) {
+	signature := header.Get(HeaderSignature)
+	if signature == "" {
+		if v.required {
+			return "", fmt.Errorf("%w: request must be signed", ErrInvalidSignature)
+		}
+		return "", nil
+	}
+
+	client := header.Get(HeaderClient)
+	secret, ok := v.secrets[client]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown client %q", ErrInvalidSignature, client)
+	}
+
+	timestamp := header.Get(HeaderTimestamp)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return client, fmt.Errorf("%w: malformed timestamp", ErrInvalidSignature)
+	}
+	signedAt := time.Unix(seconds, 0)
+	now := v.now()
+	if signedAt.Before(now.Add(-v.maxSkew)) || signedAt.After(now.Add(v.maxSkew)) {
+		return client, fmt.Errorf("%w: timestamp is outside the allowed clock skew", ErrInvalidSignature)
+	}
+
+	nonce := header.Get(HeaderNonce)
+	if nonce == "" || len(nonce) > maxNonceLength {
+		return client, fmt.Errorf("%w: nonce must be 1 to %d characters", ErrInvalidSignature, maxNonceLength)
+	}
+
+	expected := Sign(secret, method, uri, timestamp, nonce, body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return client, fmt.Errorf("%w: signature mismatch", ErrInvalidSignature)
+	}
+
+	// nonce запоминается только для верной подписи, иначе чужие запросы
+	// могли бы занять nonce клиента. Запрос с тем же временем будет
+	// отклонен по расхождению часов после signedAt + maxSkew, до тех пор
+	// nonce и хранится.
+	if !v.nonces.add(client+"/"+nonce, signedAt.Add(v.maxSkew), now) {
+		return client, fmt.Errorf("%w: nonce has already been used", ErrInvalidSignature)
+	}
+	return client, nil
+}
+
+// Sign возвращает подпись запроса в hex: HMAC-SHA256 с ключом secret от
+// строки подписи
+//
+//	METHOD\nURI\nTIMESTAMP\nNONCE\nhex(SHA-256(body))
+func Sign(secret []byte, method, uri, timestamp, nonce string, body []byte) string {
+	digest := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(method + "\n" + uri + "\n" + timestamp + "\n" + nonce + "\n" + hex.EncodeToString(digest[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,149 @@
+package signature
+
+import (
+	"net/http"
+	"paymentSystem/internal/config"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+var testNow = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+var testBody = []byte(`{"from": "wallet-1", "to": "wallet-2", "amount": 10}`)
+
+func newVerifier(t *testing.T, required bool) *Verifier {
+	t.Helper()
+	v, err := New(config.Signing{
+		Required: required,
+		Clients:  []config.SigningClient{{ID: "merchant", Secret: testSecret}},
+		MaxSkew:  time.Minute,
+	})
+	require.NoError(t, err)
+	v.now = func() time.Time { return testNow }
+	return v
+}
+
+// signedHeader возвращает заголовки запроса POST /api/send, подписанного в signedAt
+func signedHeader(signedAt time.Time, nonce string) http.Header {
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	header := http.Header{}
+	header.Set(HeaderClient, "merchant")
+	header.Set(HeaderTimestamp, timestamp)
+	header.Set(HeaderNonce, nonce)
+	header.Set(HeaderSignature, Sign([]byte(testSecret), http.MethodPost, "/api/send", timestamp, nonce, testBody))
+	return header
+}
+
+func TestVerify_Valid(t *testing.T) {
+	v := newVerifier(t, false)
+
+	client, err := v.Verify(http.MethodPost, "/api/send", signedHeader(testNow.Add(-30*time.Second), "n-1"), testBody)
+
+	require.NoError(t, err)
+	assert.Equal(t, "merchant", client)
+}
+
+func TestVerify_Unsigned(t *testing.T) {
+	client, err := newVerifier(t, false).Verify(http.MethodPost, "/api/send", http.Header{}, testBody)
+	assert.NoError(t, err)
+	assert.Empty(t, client)
+
+	_, err = newVerifier(t, true).Verify(http.MethodPost, "/api/send", http.Header{}, testBody)
+	assert.EqualError(t, err, "invalid signature: request must be signed")
+}
+
+func TestVerify_Replay(t *testing.T) {
+	v := newVerifier(t, false)
+	header := signedHeader(testNow, "n-1")
+
+	_, err := v.Verify(http.MethodPost, "/api/send", header, testBody)
+	require.NoError(t, err)
+
+	_, err = v.Verify(http.MethodPost, "/api/send", header, testBody)
+	assert.EqualError(t, err, "invalid signature: nonce has already been used")
+
+	// после допуска расхождения часов повтор отклоняется по времени
+	v.now = func() time.Time { return testNow.Add(2 * time.Minute) }
+	_, err = v.Verify(http.MethodPost, "/api/send", header, testBody)
+	assert.EqualError(t, err, "invalid signature: timestamp is outside the allowed clock skew")
+}
+
+func TestVerify_Rejects(t *testing.T) {
+	v := newVerifier(t, false)
+
+	tests := []struct {
+		name    string
+		method  string
+		uri     string
+		body    []byte
+		modify  func(http.Header)
+		message string
+	}{
+		{"tampered body", http.MethodPost, "/api/send", []byte(`{"amount": 1000}`), func(http.Header) {}, "invalid signature: signature mismatch"},
+		{"other path", http.MethodPost, "/api/send/batch", testBody, func(http.Header) {}, "invalid signature: signature mismatch"},
+		{"other method", http.MethodPut, "/api/send", testBody, func(http.Header) {}, "invalid signature: signature mismatch"},
+		{"unknown client", http.MethodPost, "/api/send", testBody, func(h http.Header) { h.Set(HeaderClient, "other") }, `invalid signature: unknown client "other"`},
+		{"malformed timestamp", http.MethodPost, "/api/send", testBody, func(h http.Header) { h.Set(HeaderTimestamp, "yesterday") }, "invalid signature: malformed timestamp"},
+		{"no nonce", http.MethodPost, "/api/send", testBody, func(h http.Header) { h.Del(HeaderNonce) }, "invalid signature: nonce must be 1 to 128 characters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := signedHeader(testNow, "n-"+tt.name)
+			tt.modify(header)
+
+			_, err := v.Verify(tt.method, tt.uri, header, tt.body)
+
+			assert.ErrorIs(t, err, ErrInvalidSignature)
+			assert.EqualError(t, err, tt.message)
+		})
+	}
+
+	for _, signedAt := range []time.Time{testNow.Add(-2 * time.Minute), testNow.Add(2 * time.Minute)} {
+		_, err := v.Verify(http.MethodPost, "/api/send", signedHeader(signedAt, "n-skew"), testBody)
+		assert.EqualError(t, err, "invalid signature: timestamp is outside the allowed clock skew")
+	}
+}
+
+func TestVerify_RejectedNonceNotConsumed(t *testing.T) {
+	v := newVerifier(t, false)
+	forged := signedHeader(testNow, "n-1")
+	forged.Set(HeaderSignature, "00")
+
+	_, err := v.Verify(http.MethodPost, "/api/send", forged, testBody)
+	require.ErrorIs(t, err, ErrInvalidSignature)
+
+	// запрос с неверной подписью не занимает nonce клиента
+	_, err = v.Verify(http.MethodPost, "/api/send", signedHeader(testNow, "n-1"), testBody)
+	assert.NoError(t, err)
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	client := config.SigningClient{ID: "merchant", Secret: testSecret}
+
+	tests := []struct {
+		name string
+		cfg  config.Signing
+	}{
+		{"no id", config.Signing{Clients: []config.SigningClient{{Secret: testSecret}}}},
+		{"short secret", config.Signing{Clients: []config.SigningClient{{ID: "merchant", Secret: "short"}}}},
+		{"duplicate id", config.Signing{Clients: []config.SigningClient{client, client}}},
+		{"negative skew", config.Signing{Clients: []config.SigningClient{client}, MaxSkew: -time.Second}},
+		{"required without clients", config.Signing{Required: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg)
+			assert.ErrorIs(t, err, ErrInvalidConfig)
+		})
+	}
+
+	v, err := New(config.Signing{})
+	require.NoError(t, err)
+	assert.False(t, v.Enabled())
+}
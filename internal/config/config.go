@@ -5,19 +5,236 @@ import (
 	"fmt"
 	"github.com/spf13/viper"
 	"os"
+	"paymentSystem/internal/money"
+	"strings"
 	"time"
 )
 
 type Config struct {
-	Env         string `mapstructure:"env"`
-	StoragePath string `mapstructure:"storage_path"`
+	Env         string  `mapstructure:"env"`
+	StoragePath string  `mapstructure:"storage_path"`
+	Storage     Storage `mapstructure:"storage"`
 	HTTPServer  `mapstructure:"http_server"`
+	Idempotency Idempotency `mapstructure:"idempotency"`
+	Holds       Holds       `mapstructure:"holds"`
+	Schedules   Schedules   `mapstructure:"schedules"`
+	Fees        Fees        `mapstructure:"fees"`
+	Limits      Limits      `mapstructure:"limits"`
+	FX          FX          `mapstructure:"fx"`
+	Auth        Auth        `mapstructure:"auth"`
+	RateLimit   RateLimit   `mapstructure:"rate_limit"`
 }
 
+// HTTPServer задает адрес и таймауты сервера. MaxBodyBytes ограничивает
+// тело запроса, которое middleware читают целиком (идемпотентность,
+// подпись, ограничение частоты по кошельку). TrustedProxies — адреса
+// и подсети (CIDR) прокси, которым можно верить в X-Forwarded-For
+// и X-Real-IP; без них адресом клиента считается адрес соединения.
 type HTTPServer struct {
-	Address     string        `mapstructure:"address"`
-	Timeout     time.Duration `mapstructure:"timeout"`
-	IdleTimeout time.Duration `mapstructure:"idle_timeout"`
+	Address        string        `mapstructure:"address"`
+	Timeout        time.Duration `mapstructure:"timeout"`
+	IdleTimeout    time.Duration `mapstructure:"idle_timeout"`
+	MaxBodyBytes   int64         `mapstructure:"max_body_bytes"`
+	TrustedProxies []string      `mapstructure:"trusted_proxies"`
+}
+
+// Драйверы хранилища
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory"
+)
+
+// Storage выбирает реализацию хранилища.
+// Для sqlite используется storage_path, для postgres — dsn,
+// для memory — необязательный snapshot_path.
+type Storage struct {
+	Driver       string `mapstructure:"driver"`
+	DSN          string `mapstructure:"dsn"`
+	SnapshotPath string `mapstructure:"snapshot_path"`
+}
+
+// Idempotency задает время хранения ключей идемпотентности.
+type Idempotency struct {
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+// Holds задает максимальный (и используемый по умолчанию) срок блокировки
+// средств и период фоновой проверки истекших блокировок.
+type Holds struct {
+	MaxTTL         time.Duration `mapstructure:"max_ttl"`
+	ExpiryInterval time.Duration `mapstructure:"expiry_interval"`
+}
+
+// Schedules задает период опроса запланированных переводов и повторы
+// переводов, которым не хватило средств.
+type Schedules struct {
+	PollInterval  time.Duration `mapstructure:"poll_interval"`
+	MaxRetries    int           `mapstructure:"max_retries"`
+	RetryInterval time.Duration `mapstructure:"retry_interval"`
+}
+
+// Fees задает комиссии за переводы. Комиссия списывается с отправителя сверх
+// суммы перевода и зачисляется на кошелек Wallet в валюте Currency; переводы
+// в других валютах комиссией не облагаются. Пустой Wallet отключает комиссии.
+// Overrides заменяют правило Default для переводов с указанных кошельков.
+type Fees struct {
+	Wallet    string        `mapstructure:"wallet"`
+	Currency  string        `mapstructure:"currency"`
+	Default   FeeRule       `mapstructure:"default"`
+	Overrides []FeeOverride `mapstructure:"overrides"`
+}
+
+// FeeRule — правило расчета комиссии. Суммы задаются десятичными строками
+// в валюте комиссий, проценты — от суммы перевода ("1.5" — полтора процента).
+// Комиссия равна Flat плюс Percent от суммы; если сумма попадает в один из
+// Tiers, вместо них берутся Flat и Percent ступени. Результат ограничивается
+// снизу Min и сверху Max (пустой Max — без ограничения).
+type FeeRule struct {
+	Flat    string    `mapstructure:"flat"`
+	Percent string    `mapstructure:"percent"`
+	Min     string    `mapstructure:"min"`
+	Max     string    `mapstructure:"max"`
+	Tiers   []FeeTier `mapstructure:"tiers"`
+}
+
+// FeeTier — ступень тарифа для переводов на сумму до UpTo включительно.
+// Ступени перечисляются по возрастанию UpTo; применяется первая подходящая.
+type FeeTier struct {
+	UpTo    string `mapstructure:"up_to"`
+	Flat    string `mapstructure:"flat"`
+	Percent string `mapstructure:"percent"`
+}
+
+// FeeOverride — индивидуальное правило для переводов с кошелька Wallet.
+// Правило без сумм и процентов освобождает кошелек от комиссии.
+type FeeOverride struct {
+	Wallet  string `mapstructure:"wallet"`
+	FeeRule `mapstructure:",squash"`
+}
+
+// Limits задает ограничения на исходящие переводы. Суммы задаются десятичными
+// строками в валюте правила (по умолчанию Currency) и применяются только
+// к переводам в этой валюте; число переводов ограничивается для любой валюты.
+// Overrides заменяют правило Default для переводов с указанных кошельков
+// целиком.
+type Limits struct {
+	Currency  string          `mapstructure:"currency"`
+	Default   LimitRule       `mapstructure:"default"`
+	Overrides []LimitOverride `mapstructure:"overrides"`
+}
+
+// LimitRule — ограничения для кошелька-отправителя. Пустая сумма и нулевое
+// число снимают соответствующее ограничение. MaxAmount ограничивает один
+// перевод, Daily и Monthly — сумму переводов за календарные сутки и месяц
+// (UTC), MaxCount — число переводов за последние Window. Currency — валюта
+// сумм правила; пустая — Limits.Currency.
+type LimitRule struct {
+	Currency  string        `mapstructure:"currency"`
+	MaxAmount string        `mapstructure:"max_amount"`
+	Daily     string        `mapstructure:"daily"`
+	Monthly   string        `mapstructure:"monthly"`
+	MaxCount  int           `mapstructure:"max_count"`
+	Window    time.Duration `mapstructure:"window"`
+}
+
+// LimitOverride — индивидуальные ограничения для переводов с кошелька Wallet.
+// Правило без сумм и числа переводов снимает с кошелька все ограничения.
+type LimitOverride struct {
+	Wallet    string `mapstructure:"wallet"`
+	LimitRule `mapstructure:",squash"`
+}
+
+// FX задает курсы валют для переводов между кошельками в разных валютах.
+// RatesPath — JSON-файл с курсами вида {"USD/RUB": "92.50"}; курсы, замененные
+// через API администратора, сохраняются в него. Пустой путь — курсы хранятся
+// только в памяти до перезапуска.
+type FX struct {
+	RatesPath string `mapstructure:"rates_path"`
+}
+
+// Auth задает аутентификацию запросов к API. С Enabled каждый запрос должен
+// нести API-ключ в заголовке X-API-Key или, если настроен JWT, bearer-токен
+// в заголовке Authorization; без Enabled API открыт всем. Roles задают права
+// ролей вызывающих: встроенные роли (customer, auditor, operator, admin)
+// можно переопределить и дополнить своими. Signing задает подпись запросов
+// и действует независимо от Enabled.
+type Auth struct {
+	Enabled bool                `mapstructure:"enabled"`
+	Roles   map[string][]string `mapstructure:"roles"`
+	JWT     JWT                 `mapstructure:"jwt"`
+	Signing Signing             `mapstructure:"signing"`
+}
+
+// JWT задает проверку bearer-токенов шлюза. Ключи берутся из Keys и из
+// JWKS-файла JWKSPath; без ключей токены не принимаются. Пустые Issuer
+// и Audience не проверяются. WalletsClaim, RolesClaim и PermissionsClaim
+// называют claim с кошельками, ролями и правами вызывающего, Leeway — допуск
+// расхождения часов при проверке exp и nbf.
+type JWT struct {
+	JWKSPath         string        `mapstructure:"jwks_path"`
+	Keys             []JWTKey      `mapstructure:"keys"`
+	Issuer           string        `mapstructure:"issuer"`
+	Audience         string        `mapstructure:"audience"`
+	WalletsClaim     string        `mapstructure:"wallets_claim"`
+	RolesClaim       string        `mapstructure:"roles_claim"`
+	PermissionsClaim string        `mapstructure:"permissions_claim"`
+	Leeway           time.Duration `mapstructure:"leeway"`
+}
+
+// JWTKey — ключ проверки подписи: Secret для HS256 или PublicKey в PEM
+// для RS256 и EdDSA. ID сопоставляется с kid из заголовка токена.
+type JWTKey struct {
+	ID        string `mapstructure:"kid"`
+	Algorithm string `mapstructure:"alg"`
+	Secret    string `mapstructure:"secret"`
+	PublicKey string `mapstructure:"public_key"`
+}
+
+// Signing задает проверку подписи запросов HMAC-SHA256. Подписанные
+// запросы проверяются, если задан хотя бы один клиент; с Required
+// неподписанные запросы отклоняются. MaxSkew — допуск расхождения часов
+// клиента и сервера, в течение которого nonce нельзя использовать повторно.
+type Signing struct {
+	Required bool            `mapstructure:"required"`
+	Clients  []SigningClient `mapstructure:"clients"`
+	MaxSkew  time.Duration   `mapstructure:"max_skew"`
+}
+
+// SigningClient — клиент, подписывающий запросы секретом Secret.
+type SigningClient struct {
+	ID     string `mapstructure:"id"`
+	Secret string `mapstructure:"secret"`
+}
+
+// Значения RateLimitRule.By
+const (
+	RateLimitByClient = "client"
+	RateLimitByIP     = "ip"
+	RateLimitByWallet = "wallet"
+)
+
+// RateLimit задает ограничение частоты запросов к API. Правила Rules
+// применяются к маршрутам независимо друг от друга: запрос проходит,
+// только если его пропускают все подходящие правила. Без правил частота
+// не ограничивается.
+type RateLimit struct {
+	Rules []RateLimitRule `mapstructure:"rules"`
+}
+
+// RateLimitRule — правило для маршрута Route вида "POST /api/send"
+// (шаблон маршрута как в роутере, "*" вместо метода или пути — любой).
+// By выбирает, кого ограничивать: вызывающего (client; без аутентификации —
+// по IP), IP-адрес (ip) или кошелек, с которого списываются средства,
+// после проверки доступа к нему (wallet).
+// Каждому ключу доступно Rate запросов за Period с запасом Burst
+// (по умолчанию Burst = Rate).
+type RateLimitRule struct {
+	Route  string        `mapstructure:"route"`
+	By     string        `mapstructure:"by"`
+	Rate   int           `mapstructure:"rate"`
+	Period time.Duration `mapstructure:"period"`
+	Burst  int           `mapstructure:"burst"`
 }
 
 // Load загружает конфигурацию из указанной директории
@@ -34,13 +251,39 @@ func Load(configPath string) (*Config, error) {
 	viper.SetConfigType("yaml")
 
 	viper.SetEnvPrefix("PAYMENT")
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
 	viper.AutomaticEnv()
 
 	viper.SetDefault("env", "development")
 	viper.SetDefault("http_server.address", "0.0.0.0:8080")
 	viper.SetDefault("http_server.timeout", "4s")
 	viper.SetDefault("http_server.idle_timeout", "60s")
+	viper.SetDefault("http_server.max_body_bytes", 1<<20)
+	viper.SetDefault("http_server.trusted_proxies", []string{})
 	viper.SetDefault("storage_path", "/app/data/app.db")
+	viper.SetDefault("storage.driver", DriverSQLite)
+	viper.SetDefault("storage.dsn", "")
+	viper.SetDefault("storage.snapshot_path", "")
+	viper.SetDefault("idempotency.ttl", "24h")
+	viper.SetDefault("holds.max_ttl", "168h")
+	viper.SetDefault("holds.expiry_interval", "1m")
+	viper.SetDefault("schedules.poll_interval", "30s")
+	viper.SetDefault("schedules.max_retries", 3)
+	viper.SetDefault("schedules.retry_interval", "1h")
+	viper.SetDefault("fees.wallet", "")
+	viper.SetDefault("fees.currency", money.DefaultCurrency)
+	viper.SetDefault("limits.currency", money.DefaultCurrency)
+	viper.SetDefault("fx.rates_path", "")
+	viper.SetDefault("auth.enabled", false)
+	viper.SetDefault("auth.jwt.jwks_path", "")
+	viper.SetDefault("auth.jwt.issuer", "")
+	viper.SetDefault("auth.jwt.audience", "")
+	viper.SetDefault("auth.jwt.wallets_claim", "wallets")
+	viper.SetDefault("auth.jwt.roles_claim", "roles")
+	viper.SetDefault("auth.jwt.permissions_claim", "permissions")
+	viper.SetDefault("auth.jwt.leeway", "30s")
+	viper.SetDefault("auth.signing.required", false)
+	viper.SetDefault("auth.signing.max_skew", "5m")
 
 	if err := viper.ReadInConfig(); err != nil {
 		viper.SetConfigName("config.example")
@@ -57,9 +300,32 @@ func Load(configPath string) (*Config, error) {
 		return nil, err
 	}
 
+	if err := validateStorage(&cfg.Storage); err != nil {
+		return nil, err
+	}
+
+	if cfg.HTTPServer.MaxBodyBytes <= 0 {
+		return nil, fmt.Errorf("http_server.max_body_bytes must be positive")
+	}
+
 	return &cfg, nil
 }
 
+// validateStorage проверяет выбранный драйвер хранилища.
+func validateStorage(cfg *Storage) error {
+	switch cfg.Driver {
+	case DriverSQLite, DriverMemory:
+		return nil
+	case DriverPostgres:
+		if cfg.DSN == "" {
+			return fmt.Errorf("storage.dsn is required for driver %q", cfg.Driver)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown storage.driver %q", cfg.Driver)
+	}
+}
+
 // parseDurations конвертирует строковые таймауты в time.Duration
 func parseDurations(cfg *Config) error {
 	timeout, err := time.ParseDuration(viper.GetString("http_server.timeout"))
@@ -71,7 +337,53 @@ func parseDurations(cfg *Config) error {
 		return fmt.Errorf("failed to parse http_server.idle_timeout: %w", err)
 	}
 
+	idempotencyTTL, err := time.ParseDuration(viper.GetString("idempotency.ttl"))
+	if err != nil {
+		return fmt.Errorf("failed to parse idempotency.ttl: %w", err)
+	}
+	if idempotencyTTL <= 0 {
+		return fmt.Errorf("idempotency.ttl must be positive")
+	}
+
+	holdMaxTTL, err := time.ParseDuration(viper.GetString("holds.max_ttl"))
+	if err != nil {
+		return fmt.Errorf("failed to parse holds.max_ttl: %w", err)
+	}
+	if holdMaxTTL <= 0 {
+		return fmt.Errorf("holds.max_ttl must be positive")
+	}
+	holdExpiryInterval, err := time.ParseDuration(viper.GetString("holds.expiry_interval"))
+	if err != nil {
+		return fmt.Errorf("failed to parse holds.expiry_interval: %w", err)
+	}
+	if holdExpiryInterval <= 0 {
+		return fmt.Errorf("holds.expiry_interval must be positive")
+	}
+
+	schedulePollInterval, err := time.ParseDuration(viper.GetString("schedules.poll_interval"))
+	if err != nil {
+		return fmt.Errorf("failed to parse schedules.poll_interval: %w", err)
+	}
+	if schedulePollInterval <= 0 {
+		return fmt.Errorf("schedules.poll_interval must be positive")
+	}
+	scheduleRetryInterval, err := time.ParseDuration(viper.GetString("schedules.retry_interval"))
+	if err != nil {
+		return fmt.Errorf("failed to parse schedules.retry_interval: %w", err)
+	}
+	if scheduleRetryInterval <= 0 {
+		return fmt.Errorf("schedules.retry_interval must be positive")
+	}
+	if cfg.Schedules.MaxRetries < 0 {
+		return fmt.Errorf("schedules.max_retries must not be negative")
+	}
+
 	cfg.HTTPServer.Timeout = timeout
 	cfg.HTTPServer.IdleTimeout = idleTimeout
+	cfg.Idempotency.TTL = idempotencyTTL
+	cfg.Holds.MaxTTL = holdMaxTTL
+	cfg.Holds.ExpiryInterval = holdExpiryInterval
+	cfg.Schedules.PollInterval = schedulePollInterval
+	cfg.Schedules.RetryInterval = scheduleRetryInterval
 	return nil
 }
@@ -0,0 +1,203 @@
+// Пакет cron разбирает cron-выражения и вычисляет время следующего запуска
+//
+// Поддерживается стандартный формат из пяти полей:
+//
+//	минута (0-59) час (0-23) день месяца (1-31) месяц (1-12) день недели (0-7, 0 и 7 — воскресенье)
+//
+// В поле допустимы *, числа, диапазоны a-b, шаги */n и a-b/n и списки через запятую.
+// Как и в классическом cron, если ограничены и день месяца, и день недели,
+// достаточно совпадения любого из них. Кроме того, поддерживаются сокращения
+// @hourly, @daily, @weekly, @monthly и @yearly.
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidExpression возвращается для выражения, которое не удалось разобрать
+var ErrInvalidExpression = errors.New("invalid cron expression")
+
+// searchLimit ограничивает поиск следующего запуска: выражения вроде
+// «30 февраля» не срабатывают никогда.
+const searchLimit = 5 * 366 * 24 * time.Hour
+
+var aliases = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// bounds — допустимые значения поля.
+type bounds struct {
+	name     string
+	min, max int
+}
+
+var fields = []bounds{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// Schedule — разобранное cron-выражение. Каждое поле хранится битовой маской
+// подходящих значений.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// domAny и dowAny отмечают поля, начинающиеся с * (как в классическом
+	// cron): тогда день определяется только другим полем.
+	domAny, dowAny bool
+}
+
+// Parse разбирает cron-выражение.
+func Parse(expr string) (*Schedule, error) {
+	spec := strings.TrimSpace(expr)
+	if alias, ok := aliases[spec]; ok {
+		spec = alias
+	}
+
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("%w %q: expected %d fields", ErrInvalidExpression, expr, len(fields))
+	}
+
+	masks := make([]uint64, len(fields))
+	for i, part := range parts {
+		mask, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w %q: %v", ErrInvalidExpression, expr, err)
+		}
+		masks[i] = mask
+	}
+
+	// воскресенье можно записать и как 0, и как 7
+	dow := masks[4]
+	if dow&(1<<7) != 0 {
+		dow = dow&^(1<<7) | 1
+	}
+
+	return &Schedule{
+		minute: masks[0],
+		hour:   masks[1],
+		dom:    masks[2],
+		month:  masks[3],
+		dow:    dow,
+		domAny: strings.HasPrefix(parts[2], "*"),
+		dowAny: strings.HasPrefix(parts[4], "*"),
+	}, nil
+}
+
+// parseField разбирает одно поле выражения в битовую маску.
+func parseField(field string, b bounds) (uint64, error) {
+	var mask uint64
+	for _, item := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+
+		lo, hi := b.min, b.max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			from, to, _ := strings.Cut(rangePart, "-")
+			var err error
+			if lo, err = parseValue(from, b); err != nil {
+				return 0, err
+			}
+			if hi, err = parseValue(to, b); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("%s: invalid range %q", b.name, rangePart)
+			}
+		default:
+			v, err := parseValue(rangePart, b)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			// «5/15» означает «с 5 до конца с шагом 15»
+			if !hasStep {
+				hi = v
+			}
+		}
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("%s: invalid step %q", b.name, stepPart)
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			mask |= 1 << v
+		}
+	}
+	return mask, nil
+}
+
+// parseValue разбирает число и проверяет, что оно входит в границы поля.
+func parseValue(s string, b bounds) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s: invalid value %q", b.name, s)
+	}
+	if v < b.min || v > b.max {
+		return 0, fmt.Errorf("%s: value %d out of range %d-%d", b.name, v, b.min, b.max)
+	}
+	return v, nil
+}
+
+// Next возвращает ближайший момент срабатывания строго после t с точностью
+// до минуты в часовом поясе t. Если выражение не срабатывает в ближайшие
+// пять лет, возвращается нулевое время.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+	limit := t.Add(searchLimit)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// dayMatches проверяет день месяца и день недели по правилам cron.
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.domAny && s.dowAny:
+		return true
+	case s.domAny:
+		return dow
+	case s.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
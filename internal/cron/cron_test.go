@@ -0,0 +1,71 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"* * * * *", "2024-01-01 10:00", "2024-01-01 10:01"},
+		{"@hourly", "2024-01-01 10:30", "2024-01-01 11:00"},
+		{"@daily", "2024-01-01 00:00", "2024-01-02 00:00"},
+		{"30 9 * * *", "2024-01-01 09:29", "2024-01-01 09:30"},
+		{"30 9 * * *", "2024-01-01 09:30", "2024-01-02 09:30"},
+		{"*/15 * * * *", "2024-01-01 10:16", "2024-01-01 10:30"},
+		{"0 9-17/4 * * *", "2024-01-01 14:00", "2024-01-01 17:00"},
+		{"0 0 * * 1", "2024-01-03 12:00", "2024-01-08 00:00"}, // понедельник
+		{"0 0 * * 7", "2024-01-01 00:00", "2024-01-07 00:00"}, // 7 — воскресенье
+		{"@monthly", "2024-01-31 12:00", "2024-02-01 00:00"},
+		{"0 0 31 * *", "2024-02-01 00:00", "2024-03-31 00:00"},
+		{"0 0 29 2 *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		{"0 12 1,15 * *", "2024-01-02 00:00", "2024-01-15 12:00"},
+		// при ограниченных дне месяца и дне недели достаточно любого совпадения
+		{"0 0 13 * 5", "2024-01-01 00:00", "2024-01-05 00:00"},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		require.NoError(t, err, tt.expr)
+		assert.Equal(t, date(tt.want), s.Next(date(tt.from)), tt.expr+" after "+tt.from)
+	}
+}
+
+func TestNext_Never(t *testing.T) {
+	s, err := Parse("0 0 30 2 *")
+	require.NoError(t, err)
+	assert.True(t, s.Next(date("2024-01-01 00:00")).IsZero())
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"@every 5m",
+	} {
+		_, err := Parse(expr)
+		assert.ErrorIs(t, err, ErrInvalidExpression, expr)
+	}
+}
@@ -0,0 +1,117 @@
+// Пакет export содержит построчную запись транзакций в форматы выгрузки
+//
+// - CSV с заголовком (для таблиц и бухгалтерии)
+// - NDJSON — по одному JSON-объекту транзакции в строке
+//
+// Используется HTTP-обработчиком выгрузки и подкомандой export.
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"paymentSystem/internal/models"
+	"strconv"
+)
+
+// Форматы выгрузки
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// ErrUnknownFormat возвращается для неподдерживаемого формата выгрузки
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// csvHeader — колонки CSV-выгрузки. Сумма записывается десятичной строкой
+// в единицах валюты, как в JSON API. Колонки конвертации добавлены в конец,
+// чтобы не сдвигать прежние; у переводов в одной валюте они пустые.
+var csvHeader = []string{"id", "from", "to", "amount", "currency", "timestamp",
+	"destination_amount", "destination_currency", "rate"}
+
+// Writer записывает транзакции по одной. Flush дописывает буферизованные
+// данные; его нужно вызвать после последней записи.
+type Writer interface {
+	Write(tx models.Transaction) error
+	Flush() error
+}
+
+// NewWriter создает Writer для формата format поверх w.
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case FormatNDJSON:
+		bw := bufio.NewWriter(w)
+		return &ndjsonWriter{w: bw, enc: json.NewEncoder(bw)}, nil
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownFormat, format)
+	}
+}
+
+// ContentType возвращает MIME-тип формата выгрузки.
+func ContentType(format string) string {
+	if format == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+type csvWriter struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func (c *csvWriter) Write(tx models.Transaction) error {
+	if err := c.header(); err != nil {
+		return err
+	}
+	var destAmount, destCurrency string
+	if tx.DestinationAmount != nil {
+		destAmount, destCurrency = tx.DestinationAmount.String(), tx.DestinationAmount.Currency
+	}
+	return c.w.Write([]string{
+		strconv.FormatInt(tx.ID, 10),
+		tx.From,
+		tx.To,
+		tx.Amount.String(),
+		tx.Amount.Currency,
+		tx.Timestamp,
+		destAmount,
+		destCurrency,
+		tx.Rate,
+	})
+}
+
+// Flush записывает заголовок даже для пустой выгрузки.
+func (c *csvWriter) Flush() error {
+	if err := c.header(); err != nil {
+		return err
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func (c *csvWriter) header() error {
+	if c.wroteHeader {
+		return nil
+	}
+	c.wroteHeader = true
+	return c.w.Write(csvHeader)
+}
+
+type ndjsonWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+func (n *ndjsonWriter) Write(tx models.Transaction) error {
+	return n.enc.Encode(tx)
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return n.w.Flush()
+}
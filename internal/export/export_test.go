@@ -0,0 +1,67 @@
+package export
+
+import (
+	"bytes"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testTransactions = []models.Transaction{
+	{ID: 2, From: "wallet-1", To: "wallet-2", Amount: money.New(1050, "RUB"), Timestamp: "2024-01-02T00:00:00Z"},
+	{ID: 1, From: "wallet-2", To: "wallet-1", Amount: money.New(5, "JPY"), Timestamp: "2024-01-01T00:00:00Z"},
+}
+
+var converted = money.New(1000, "USD")
+
+var testConversion = models.Transaction{
+	ID: 3, From: "wallet-1", To: "wallet-usd", Amount: money.New(92500, "RUB"),
+	DestinationAmount: &converted, Rate: "0.0108108108", Timestamp: "2024-01-03T00:00:00Z",
+}
+
+func write(t *testing.T, format string, transactions []models.Transaction) string {
+	var buf bytes.Buffer
+	w, err := NewWriter(format, &buf)
+	require.NoError(t, err)
+	for _, tx := range transactions {
+		require.NoError(t, w.Write(tx))
+	}
+	require.NoError(t, w.Flush())
+	return buf.String()
+}
+
+func TestCSV(t *testing.T) {
+	out := write(t, FormatCSV, testTransactions)
+
+	assert.Equal(t, "id,from,to,amount,currency,timestamp,destination_amount,destination_currency,rate\n"+
+		"2,wallet-1,wallet-2,10.50,RUB,2024-01-02T00:00:00Z,,,\n"+
+		"1,wallet-2,wallet-1,5,JPY,2024-01-01T00:00:00Z,,,\n", out)
+}
+
+func TestCSV_Conversion(t *testing.T) {
+	out := write(t, FormatCSV, []models.Transaction{testConversion})
+
+	assert.Equal(t, "id,from,to,amount,currency,timestamp,destination_amount,destination_currency,rate\n"+
+		"3,wallet-1,wallet-usd,925.00,RUB,2024-01-03T00:00:00Z,10.00,USD,0.0108108108\n", out)
+}
+
+func TestCSV_EmptyHasHeader(t *testing.T) {
+	assert.Equal(t, "id,from,to,amount,currency,timestamp,destination_amount,destination_currency,rate\n", write(t, FormatCSV, nil))
+}
+
+func TestNDJSON(t *testing.T) {
+	out := write(t, FormatNDJSON, testTransactions)
+
+	assert.Equal(t,
+		`{"id":2,"from":"wallet-1","to":"wallet-2","amount":{"value":"10.50","currency":"RUB"},"timestamp":"2024-01-02T00:00:00Z"}`+"\n"+
+			`{"id":1,"from":"wallet-2","to":"wallet-1","amount":{"value":"5","currency":"JPY"},"timestamp":"2024-01-01T00:00:00Z"}`+"\n",
+		out)
+}
+
+func TestNewWriter_UnknownFormat(t *testing.T) {
+	_, err := NewWriter("xml", &bytes.Buffer{})
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+}
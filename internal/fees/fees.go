@@ -0,0 +1,232 @@
+// Пакет fees рассчитывает комиссии за переводы по правилам из конфигурации
+//
+// Комиссия складывается из фиксированной части и процента от суммы перевода.
+// Ступени тарифа (tiers) задают свои фиксированную часть и процент для
+// переводов до указанной суммы. Итог ограничивается минимумом и максимумом
+// и округляется до минимальной единицы валюты (половина — вверх).
+// Для отдельных кошельков-отправителей правило можно переопределить.
+package fees
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"paymentSystem/internal/config"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"strings"
+)
+
+// ErrInvalidConfig возвращается для некорректных правил комиссий
+var ErrInvalidConfig = errors.New("invalid fee config")
+
+// Engine рассчитывает комиссии. Нулевое значение и Engine без кошелька
+// комиссий ничего не списывают.
+type Engine struct {
+	wallet    string
+	currency  string
+	rule      rule
+	overrides map[string]rule
+}
+
+// rule — разобранное config.FeeRule; суммы в минимальных единицах валюты.
+type rule struct {
+	flat    int64
+	percent *big.Rat
+	min     int64
+	// max < 0 означает отсутствие верхней границы.
+	max   int64
+	tiers []tier
+}
+
+type tier struct {
+	upTo    int64
+	flat    int64
+	percent *big.Rat
+}
+
+// New разбирает и проверяет правила комиссий.
+func New(cfg config.Fees) (*Engine, error) {
+	if cfg.Wallet == "" {
+		return &Engine{}, nil
+	}
+	currency := cfg.Currency
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	if _, err := money.Exponent(currency); err != nil {
+		return nil, fmt.Errorf("%w: fees.currency: %v", ErrInvalidConfig, err)
+	}
+
+	e := &Engine{
+		wallet:    cfg.Wallet,
+		currency:  currency,
+		overrides: make(map[string]rule, len(cfg.Overrides)),
+	}
+	var err error
+	if e.rule, err = parseRule(cfg.Default, currency); err != nil {
+		return nil, fmt.Errorf("%w: fees.default: %v", ErrInvalidConfig, err)
+	}
+	for i, o := range cfg.Overrides {
+		if o.Wallet == "" {
+			return nil, fmt.Errorf("%w: fees.overrides[%d]: wallet is required", ErrInvalidConfig, i)
+		}
+		if _, ok := e.overrides[o.Wallet]; ok {
+			return nil, fmt.Errorf("%w: fees.overrides[%d]: duplicate wallet %q", ErrInvalidConfig, i, o.Wallet)
+		}
+		if e.overrides[o.Wallet], err = parseRule(o.FeeRule, currency); err != nil {
+			return nil, fmt.Errorf("%w: fees.overrides[%d]: %v", ErrInvalidConfig, i, err)
+		}
+	}
+	return e, nil
+}
+
+// Wallet возвращает адрес кошелька комиссий; пустой, если комиссии отключены.
+func (e *Engine) Wallet() string {
+	return e.wallet
+}
+
+// Currency возвращает валюту комиссий.
+func (e *Engine) Currency() string {
+	return e.currency
+}
+
+// Fee рассчитывает комиссию за перевод amount с кошелька from. Возвращает nil,
+// если комиссии отключены, перевод идет с кошелька комиссий, валюта перевода
+// отличается от валюты комиссий или комиссия по правилу равна нулю.
+func (e *Engine) Fee(from string, amount money.Money) *models.Fee {
+	if e.wallet == "" || from == e.wallet || amount.Currency != e.currency {
+		return nil
+	}
+	r, ok := e.overrides[from]
+	if !ok {
+		r = e.rule
+	}
+	fee := r.apply(amount.Amount)
+	if fee <= 0 {
+		return nil
+	}
+	return &models.Fee{Wallet: e.wallet, Amount: money.New(fee, e.currency)}
+}
+
+// apply рассчитывает комиссию для суммы amount в минимальных единицах.
+func (r rule) apply(amount int64) int64 {
+	flat, percent := r.flat, r.percent
+	for _, t := range r.tiers {
+		if amount <= t.upTo {
+			flat, percent = t.flat, t.percent
+			break
+		}
+	}
+
+	fee := flat + percentOf(amount, percent)
+	if fee < r.min {
+		fee = r.min
+	}
+	if r.max >= 0 && fee > r.max {
+		fee = r.max
+	}
+	return fee
+}
+
+// percentOf возвращает percent процентов от amount, округляя половину вверх.
+func percentOf(amount int64, percent *big.Rat) int64 {
+	if percent.Sign() == 0 {
+		return 0
+	}
+	// amount * num / (den * 100), округление: (2x + y) / 2y
+	x := new(big.Int).Mul(big.NewInt(amount), percent.Num())
+	y := new(big.Int).Mul(percent.Denom(), big.NewInt(100))
+	x.Mul(x, big.NewInt(2)).Add(x, y)
+	y.Mul(y, big.NewInt(2))
+	return x.Quo(x, y).Int64()
+}
+
+// parseRule разбирает правило и проверяет его согласованность.
+func parseRule(cfg config.FeeRule, currency string) (rule, error) {
+	var r rule
+	var err error
+	if r.flat, err = parseAmount("flat", cfg.Flat, currency); err != nil {
+		return rule{}, err
+	}
+	if r.percent, err = parsePercent("percent", cfg.Percent); err != nil {
+		return rule{}, err
+	}
+	if r.min, err = parseAmount("min", cfg.Min, currency); err != nil {
+		return rule{}, err
+	}
+	r.max = -1
+	if cfg.Max != "" {
+		if r.max, err = parseAmount("max", cfg.Max, currency); err != nil {
+			return rule{}, err
+		}
+		if r.max < r.min {
+			return rule{}, errors.New("max is less than min")
+		}
+	}
+
+	for i, t := range cfg.Tiers {
+		var parsed tier
+		name := fmt.Sprintf("tiers[%d].", i)
+		if t.UpTo == "" {
+			return rule{}, fmt.Errorf("%sup_to is required", name)
+		}
+		if parsed.upTo, err = parseAmount(name+"up_to", t.UpTo, currency); err != nil {
+			return rule{}, err
+		}
+		if i > 0 && parsed.upTo <= r.tiers[i-1].upTo {
+			return rule{}, fmt.Errorf("%sup_to must be greater than the previous tier", name)
+		}
+		if parsed.flat, err = parseAmount(name+"flat", t.Flat, currency); err != nil {
+			return rule{}, err
+		}
+		if parsed.percent, err = parsePercent(name+"percent", t.Percent); err != nil {
+			return rule{}, err
+		}
+		r.tiers = append(r.tiers, parsed)
+	}
+	return r, nil
+}
+
+// parseAmount разбирает неотрицательную сумму; пустая строка — ноль.
+func parseAmount(name, s, currency string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	m, err := money.Parse(s, currency)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	if m.Amount < 0 {
+		return 0, fmt.Errorf("%s must not be negative", name)
+	}
+	return m.Amount, nil
+}
+
+// parsePercent разбирает процент от 0 до 100 в десятичной записи; пустая строка — ноль.
+func parsePercent(name, s string) (*big.Rat, error) {
+	if s == "" {
+		return new(big.Rat), nil
+	}
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" || !isDigits(intPart) || !isDigits(fracPart) {
+		return nil, fmt.Errorf("%s: invalid percent %q", name, s)
+	}
+	percent, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("%s: invalid percent %q", name, s)
+	}
+	if percent.Cmp(big.NewRat(100, 1)) > 0 {
+		return nil, fmt.Errorf("%s must not exceed 100", name)
+	}
+	return percent, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,146 @@
+package fees
+
+import (
+	"paymentSystem/internal/config"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rub(amount int64) money.Money {
+	return money.New(amount, "RUB")
+}
+
+func newEngine(t *testing.T, cfg config.Fees) *Engine {
+	t.Helper()
+	if cfg.Wallet == "" {
+		cfg.Wallet = "fees"
+	}
+	engine, err := New(cfg)
+	require.NoError(t, err)
+	return engine
+}
+
+// feeAmount возвращает сумму комиссии в копейках; 0, если комиссии нет
+func feeAmount(fee *models.Fee) int64 {
+	if fee == nil {
+		return 0
+	}
+	return fee.Amount.Amount
+}
+
+func TestFee_FlatAndPercent(t *testing.T) {
+	engine := newEngine(t, config.Fees{Default: config.FeeRule{Flat: "0.30", Percent: "1.5"}})
+
+	fee := engine.Fee("wallet-1", rub(10000))
+
+	require.NotNil(t, fee)
+	assert.Equal(t, "fees", fee.Wallet)
+	// 30 + 1.5% от 100.00
+	assert.Equal(t, rub(180), fee.Amount)
+}
+
+func TestFee_Rounding(t *testing.T) {
+	engine := newEngine(t, config.Fees{Default: config.FeeRule{Percent: "1"}})
+
+	tests := []struct {
+		amount int64
+		fee    int64
+	}{
+		{50, 1},  // 0.5 → 1
+		{49, 0},  // 0.49 → 0, комиссии нет
+		{150, 2}, // 1.5 → 2
+		{1234, 12},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.fee, feeAmount(engine.Fee("wallet-1", rub(tt.amount))), tt.amount)
+	}
+}
+
+func TestFee_Tiers(t *testing.T) {
+	engine := newEngine(t, config.Fees{Default: config.FeeRule{
+		Percent: "0.5",
+		Tiers: []config.FeeTier{
+			{UpTo: "100", Flat: "1"},
+			{UpTo: "1000", Percent: "1"},
+		},
+	}})
+
+	assert.Equal(t, int64(100), feeAmount(engine.Fee("wallet-1", rub(5000))))
+	assert.Equal(t, int64(100), feeAmount(engine.Fee("wallet-1", rub(10000))), "up_to включительно")
+	assert.Equal(t, int64(500), feeAmount(engine.Fee("wallet-1", rub(50000))))
+	// выше последней ступени действует базовое правило
+	assert.Equal(t, int64(1000), feeAmount(engine.Fee("wallet-1", rub(200000))))
+}
+
+func TestFee_MinMax(t *testing.T) {
+	engine := newEngine(t, config.Fees{Default: config.FeeRule{Percent: "2", Min: "1", Max: "50"}})
+
+	assert.Equal(t, int64(100), feeAmount(engine.Fee("wallet-1", rub(1000))))
+	assert.Equal(t, int64(400), feeAmount(engine.Fee("wallet-1", rub(20000))))
+	assert.Equal(t, int64(5000), feeAmount(engine.Fee("wallet-1", rub(1000000))))
+}
+
+func TestFee_Overrides(t *testing.T) {
+	engine := newEngine(t, config.Fees{
+		Default: config.FeeRule{Flat: "1"},
+		Overrides: []config.FeeOverride{
+			{Wallet: "partner", FeeRule: config.FeeRule{Percent: "0.1"}},
+			{Wallet: "exempt"},
+		},
+	})
+
+	assert.Equal(t, int64(100), feeAmount(engine.Fee("wallet-1", rub(100000))))
+	assert.Equal(t, int64(100), feeAmount(engine.Fee("partner", rub(100000))))
+	assert.Nil(t, engine.Fee("exempt", rub(100000)))
+}
+
+func TestFee_NotCharged(t *testing.T) {
+	engine := newEngine(t, config.Fees{Default: config.FeeRule{Flat: "1"}})
+
+	// переводы с кошелька комиссий и в другой валюте комиссией не облагаются
+	assert.Nil(t, engine.Fee("fees", rub(10000)))
+	assert.Nil(t, engine.Fee("wallet-1", money.New(10000, "USD")))
+
+	disabled, err := New(config.Fees{Default: config.FeeRule{Flat: "1"}})
+	require.NoError(t, err)
+	assert.Nil(t, disabled.Fee("wallet-1", rub(10000)))
+}
+
+func TestFee_Currency(t *testing.T) {
+	engine := newEngine(t, config.Fees{Currency: "JPY", Default: config.FeeRule{Flat: "10", Percent: "1"}})
+
+	fee := engine.Fee("wallet-1", money.New(1000, "JPY"))
+
+	require.NotNil(t, fee)
+	assert.Equal(t, money.New(20, "JPY"), fee.Amount)
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Fees
+	}{
+		{"unknown currency", config.Fees{Currency: "XXX"}},
+		{"bad flat", config.Fees{Default: config.FeeRule{Flat: "abc"}}},
+		{"too precise", config.Fees{Default: config.FeeRule{Flat: "0.001"}}},
+		{"negative", config.Fees{Default: config.FeeRule{Min: "-1"}}},
+		{"bad percent", config.Fees{Default: config.FeeRule{Percent: "1e2"}}},
+		{"percent over 100", config.Fees{Default: config.FeeRule{Percent: "101"}}},
+		{"max below min", config.Fees{Default: config.FeeRule{Min: "5", Max: "1"}}},
+		{"tier without up_to", config.Fees{Default: config.FeeRule{Tiers: []config.FeeTier{{Flat: "1"}}}}},
+		{"tiers out of order", config.Fees{Default: config.FeeRule{Tiers: []config.FeeTier{{UpTo: "100"}, {UpTo: "10"}}}}},
+		{"override without wallet", config.Fees{Overrides: []config.FeeOverride{{}}}},
+		{"duplicate override", config.Fees{Overrides: []config.FeeOverride{{Wallet: "a"}, {Wallet: "a"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Wallet = "fees"
+			_, err := New(tt.cfg)
+			assert.ErrorIs(t, err, ErrInvalidConfig)
+		})
+	}
+}
@@ -0,0 +1,243 @@
+// Пакет fx хранит курсы валют и конвертирует суммы между валютами
+//
+// Курс пары "USD/RUB" — сколько единиц RUB дается за одну единицу USD.
+// Для обратной конвертации используется обратный курс той же пары, если
+// отдельный курс для нее не задан. Курсы загружаются из JSON-файла вида
+// {"USD/RUB": "92.50"} и заменяются через API администратора; при заданном
+// пути файла новая таблица сохраняется в него.
+package fx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"paymentSystem/internal/money"
+	"strings"
+	"sync"
+)
+
+// rateScale — число знаков после запятой в записи вычисленного курса
+const rateScale = 10
+
+var (
+	// ErrRateNotFound возвращается, если курс для пары валют не задан
+	ErrRateNotFound = errors.New("exchange rate not found")
+
+	// ErrInvalidRate возвращается для некорректной пары или значения курса
+	ErrInvalidRate = errors.New("invalid exchange rate")
+
+	// ErrAmountTooSmall возвращается, если после конвертации сумма меньше
+	// минимальной единицы валюты получателя
+	ErrAmountTooSmall = errors.New("amount is too small to convert")
+)
+
+// Rates — таблица курсов; безопасна для конкурентного использования.
+type Rates struct {
+	mu    sync.RWMutex
+	path  string
+	rates map[string]*big.Rat
+}
+
+// Load создает таблицу курсов и заполняет ее из файла path. Пустой path
+// или отсутствующий файл дают пустую таблицу.
+func Load(path string) (*Rates, error) {
+	r := &Rates{path: path, rates: map[string]*big.Rat{}}
+	if path == "" {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read rates: %w", err)
+	}
+	var raw map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parse rates %s: %w", path, err)
+	}
+	if r.rates, err = parseRates(raw); err != nil {
+		return nil, fmt.Errorf("rates %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// All возвращает копию таблицы курсов.
+func (r *Rates) All() map[string]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	all := make(map[string]string, len(r.rates))
+	for pair, rate := range r.rates {
+		all[pair] = FormatRate(rate)
+	}
+	return all
+}
+
+// Replace проверяет и целиком заменяет таблицу курсов. Если таблица
+// загружена из файла, она сначала сохраняется в него.
+func (r *Rates) Replace(raw map[string]string) error {
+	rates, err := parseRates(raw)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.path != "" {
+		if err := save(r.path, rates); err != nil {
+			return err
+		}
+	}
+	r.rates = rates
+	return nil
+}
+
+// Convert переводит amount в валюту currency. Результат округляется вниз
+// до минимальной единицы; вместе с ним возвращается примененный курс.
+func (r *Rates) Convert(amount money.Money, currency string) (money.Money, string, error) {
+	rate, err := r.rate(amount.Currency, currency)
+	if err != nil {
+		return money.Money{}, "", err
+	}
+	converted, err := convert(amount, currency, rate)
+	if err != nil {
+		return money.Money{}, "", err
+	}
+	return converted, FormatRate(rate), nil
+}
+
+// rate ищет курс пары from/to, а при его отсутствии — обратный курс пары to/from.
+func (r *Rates) rate(from, to string) (*big.Rat, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if rate, ok := r.rates[from+"/"+to]; ok {
+		return rate, nil
+	}
+	if rate, ok := r.rates[to+"/"+from]; ok {
+		return new(big.Rat).Inv(rate), nil
+	}
+	return nil, fmt.Errorf("%w: %s/%s", ErrRateNotFound, from, to)
+}
+
+// convert пересчитывает сумму в минимальных единицах с учетом разной
+// точности валют: amount * rate * 10^(exp(currency) - exp(amount)).
+func convert(amount money.Money, currency string, rate *big.Rat) (money.Money, error) {
+	fromExp, err := money.Exponent(amount.Currency)
+	if err != nil {
+		return money.Money{}, err
+	}
+	toExp, err := money.Exponent(currency)
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	value := new(big.Rat).Mul(new(big.Rat).SetInt64(amount.Amount), rate)
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(toExp-fromExp))), nil))
+	if toExp >= fromExp {
+		value.Mul(value, scale)
+	} else {
+		value.Quo(value, scale)
+	}
+
+	result := new(big.Int).Quo(value.Num(), value.Denom())
+	if !result.IsInt64() {
+		return money.Money{}, money.ErrOverflow
+	}
+	if result.Sign() <= 0 {
+		return money.Money{}, ErrAmountTooSmall
+	}
+	return money.New(result.Int64(), currency), nil
+}
+
+// FormatRate записывает курс десятичной строкой не более чем с rateScale
+// знаками после запятой, без незначащих нулей.
+func FormatRate(rate *big.Rat) string {
+	s := rate.FloatString(rateScale)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// parseRates проверяет пары и значения курсов.
+func parseRates(raw map[string]string) (map[string]*big.Rat, error) {
+	rates := make(map[string]*big.Rat, len(raw))
+	for pair, value := range raw {
+		from, to, ok := strings.Cut(pair, "/")
+		if !ok || from == to {
+			return nil, fmt.Errorf("%w: pair %q must look like USD/RUB", ErrInvalidRate, pair)
+		}
+		for _, currency := range []string{from, to} {
+			if _, err := money.Exponent(currency); err != nil {
+				return nil, fmt.Errorf("%w: pair %q: %v", ErrInvalidRate, pair, err)
+			}
+		}
+		rate, ok := parseDecimal(value)
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("%w: %s must be a positive decimal, got %q", ErrInvalidRate, pair, value)
+		}
+		rates[pair] = rate
+	}
+	return rates, nil
+}
+
+// parseDecimal разбирает неотрицательное десятичное число без экспоненты.
+func parseDecimal(s string) (*big.Rat, bool) {
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" || !isDigits(intPart) || !isDigits(fracPart) {
+		return nil, false
+	}
+	return new(big.Rat).SetString(s)
+}
+
+// save атомарно записывает таблицу курсов в файл: через временный файл
+// в том же каталоге и переименование.
+func save(path string, rates map[string]*big.Rat) error {
+	raw := make(map[string]string, len(rates))
+	for pair, rate := range rates {
+		raw[pair] = FormatRate(rate)
+	}
+	// ключи map кодируются в порядке сортировки, файл удобно сравнивать
+	data, err := json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("save rates: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("save rates: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("save rates: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("save rates: %w", err)
+	}
+	return nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,125 @@
+package fx
+
+import (
+	"os"
+	"path/filepath"
+	"paymentSystem/internal/money"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newRates(t *testing.T, raw map[string]string) *Rates {
+	t.Helper()
+	r, err := Load("")
+	require.NoError(t, err)
+	require.NoError(t, r.Replace(raw))
+	return r
+}
+
+func TestConvert_DirectRate(t *testing.T) {
+	r := newRates(t, map[string]string{"USD/RUB": "92.50"})
+
+	converted, rate, err := r.Convert(money.New(1000, "USD"), "RUB")
+
+	require.NoError(t, err)
+	assert.Equal(t, money.New(92500, "RUB"), converted)
+	assert.Equal(t, "92.5", rate)
+}
+
+func TestConvert_InverseRate(t *testing.T) {
+	r := newRates(t, map[string]string{"USD/RUB": "92.50"})
+
+	// 100.00 RUB / 92.5 = 1.081... USD, округление вниз
+	converted, rate, err := r.Convert(money.New(10000, "RUB"), "USD")
+
+	require.NoError(t, err)
+	assert.Equal(t, money.New(108, "USD"), converted)
+	assert.Equal(t, "0.0108108108", rate)
+}
+
+func TestConvert_DirectRatePreferred(t *testing.T) {
+	r := newRates(t, map[string]string{"USD/RUB": "92.50", "RUB/USD": "0.01"})
+
+	converted, _, err := r.Convert(money.New(10000, "RUB"), "USD")
+
+	require.NoError(t, err)
+	assert.Equal(t, money.New(100, "USD"), converted)
+}
+
+func TestConvert_Exponents(t *testing.T) {
+	r := newRates(t, map[string]string{"JPY/RUB": "0.6", "BHD/RUB": "245"})
+
+	// у JPY нет дробной части, у RUB — две цифры, у BHD — три
+	converted, _, err := r.Convert(money.New(1000, "JPY"), "RUB")
+	require.NoError(t, err)
+	assert.Equal(t, money.New(60000, "RUB"), converted)
+
+	converted, _, err = r.Convert(money.New(60000, "RUB"), "JPY")
+	require.NoError(t, err)
+	assert.Equal(t, money.New(1000, "JPY"), converted)
+
+	converted, _, err = r.Convert(money.New(1500, "BHD"), "RUB")
+	require.NoError(t, err)
+	assert.Equal(t, money.New(36750, "RUB"), converted)
+}
+
+func TestConvert_Errors(t *testing.T) {
+	r := newRates(t, map[string]string{"USD/RUB": "92.50"})
+
+	_, _, err := r.Convert(money.New(100, "EUR"), "RUB")
+	assert.ErrorIs(t, err, ErrRateNotFound)
+
+	// 0.50 RUB меньше цента
+	_, _, err = r.Convert(money.New(50, "RUB"), "USD")
+	assert.ErrorIs(t, err, ErrAmountTooSmall)
+
+	_, _, err = r.Convert(money.New(1<<62, "USD"), "RUB")
+	assert.ErrorIs(t, err, money.ErrOverflow)
+}
+
+func TestReplace_Invalid(t *testing.T) {
+	r := newRates(t, map[string]string{"USD/RUB": "92.50"})
+
+	for _, raw := range []map[string]string{
+		{"USDRUB": "1"},
+		{"USD/USD": "1"},
+		{"USD/XXX": "1"},
+		{"USD/RUB": "0"},
+		{"USD/RUB": "-1"},
+		{"USD/RUB": "1e2"},
+		{"USD/RUB": "abc"},
+	} {
+		assert.ErrorIs(t, r.Replace(raw), ErrInvalidRate, raw)
+	}
+	// при ошибке прежняя таблица сохраняется
+	assert.Equal(t, map[string]string{"USD/RUB": "92.5"}, r.All())
+}
+
+func TestLoad_File(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+
+	// отсутствующий файл — пустая таблица
+	r, err := Load(path)
+	require.NoError(t, err)
+	assert.Empty(t, r.All())
+
+	// замена сохраняется в файл и читается при следующей загрузке
+	require.NoError(t, r.Replace(map[string]string{"EUR/RUB": "100.10"}))
+	restored, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"EUR/RUB": "100.1"}, restored.All())
+}
+
+func TestLoad_InvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"USD/RUB": 92.5}`), 0o600))
+	_, err := Load(path)
+	assert.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"USD/RUB": "-1"}`), 0o600))
+	_, err = Load(path)
+	assert.ErrorIs(t, err, ErrInvalidRate)
+}
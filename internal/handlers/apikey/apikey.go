@@ -0,0 +1,131 @@
+// Пакет apikey содержит HTTP-обработчики управления API-ключами
+//
+// - Выпуск ключа с доступом к кошелькам, ролями и правами
+// - Список выпущенных ключей
+// - Ротация ключа
+// - Отзыв ключа
+package apikey
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"paymentSystem/internal/handlers/respond"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/services"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type Handler struct {
+	service services.APIKeyService
+	logger  *slog.Logger
+}
+
+func NewHandler(service services.APIKeyService, logger *slog.Logger) *Handler {
+	return &Handler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// HandleIssue обрабатывает запрос на выпуск ключа. Значение ключа
+// возвращается только в этом ответе.
+func (h *Handler) HandleIssue(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name        string   `json:"name"`
+		Wallets     []string `json:"wallets"`
+		Roles       []string `json:"roles"`
+		Permissions []string `json:"permissions"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	key, err := h.service.IssueKey(r.Context(), req.Name, req.Wallets, req.Roles, req.Permissions)
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	respond.JSON(w, http.StatusCreated, key)
+}
+
+// HandleList обрабатывает запрос на получение списка ключей.
+func (h *Handler) HandleList(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.service.ListKeys(r.Context())
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+	if keys == nil {
+		keys = []models.APIKey{}
+	}
+
+	respond.JSON(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+// HandleRotate обрабатывает запрос на ротацию ключа. Новое значение
+// возвращается только в этом ответе.
+func (h *Handler) HandleRotate(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.keyID(w, r)
+	if !ok {
+		return
+	}
+
+	key, err := h.service.RotateKey(r.Context(), id)
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, key)
+}
+
+// HandleRevoke обрабатывает запрос на отзыв ключа.
+func (h *Handler) HandleRevoke(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.keyID(w, r)
+	if !ok {
+		return
+	}
+
+	key, err := h.service.RevokeKey(r.Context(), id)
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, key)
+}
+
+// keyID читает {id} из пути; при ошибке отвечает 400 и возвращает false.
+func (h *Handler) keyID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid api key id")
+		return 0, false
+	}
+	return id, true
+}
+
+// Правила преобразования:
+// - Пустое название, нет кошельков, нет ни ролей, ни прав, неизвестная
+//   роль или право → 400 Bad Request
+// - Кошелек или ключ не найдены → 404 Not Found
+// - Ключ уже отозван → 409 Conflict
+// - Клиент отменил запрос → 499 Client Closed Request
+// - Истек таймаут запроса → 504 Gateway Timeout
+// - Все остальные ошибки → 500 Internal Server Error
+
+// Формат запроса на выпуск ключа:
+// {
+//   "name": "merchant-42",
+//   "wallets": ["wallet-1", "wallet-2"],
+//   "roles": ["customer"],
+//   "permissions": ["history:export"]
+// }
+// Кошелек "*" дает доступ ко всем кошелькам. Ключ получает права своих
+// ролей и перечисленные права; нужно хотя бы одно из двух.
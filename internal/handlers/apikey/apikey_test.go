@@ -0,0 +1,169 @@
+package apikey
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"paymentSystem/internal/auth"
+	"paymentSystem/internal/handlers/respond"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/services"
+	"paymentSystem/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// mockService реализует интерфейс services.APIKeyService
+type mockService struct {
+	mock.Mock
+}
+
+func (m *mockService) IssueKey(ctx context.Context, name string, wallets, roles, permissions []string) (models.IssuedAPIKey, error) {
+	args := m.Called(name, wallets, roles, permissions)
+	return args.Get(0).(models.IssuedAPIKey), args.Error(1)
+}
+
+func (m *mockService) ListKeys(ctx context.Context) ([]models.APIKey, error) {
+	args := m.Called()
+	return args.Get(0).([]models.APIKey), args.Error(1)
+}
+
+func (m *mockService) RotateKey(ctx context.Context, id int64) (models.IssuedAPIKey, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.IssuedAPIKey), args.Error(1)
+}
+
+func (m *mockService) RevokeKey(ctx context.Context, id int64) (models.APIKey, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.APIKey), args.Error(1)
+}
+
+func (m *mockService) Authenticate(ctx context.Context, key string) (auth.Principal, error) {
+	args := m.Called(key)
+	return args.Get(0).(auth.Principal), args.Error(1)
+}
+
+// setupTestHandler создаёт обработчик с мок-сервисом
+func setupTestHandler() (*Handler, *mockService) {
+	mockSvc := new(mockService)
+	handler := NewHandler(mockSvc, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return handler, mockSvc
+}
+
+// withID добавляет параметр {id} в контекст chi
+func withID(req *http.Request, id string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+var testKey = models.APIKey{
+	ID:          1,
+	Name:        "merchant",
+	Prefix:      "psk_AbCdEfGh",
+	Wallets:     []string{"wallet-1"},
+	Roles:       []string{auth.RoleCustomer},
+	Permissions: []string{auth.PermissionHistoryExport},
+	CreatedAt:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+}
+
+func TestHandleIssue_Success(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("IssueKey", "merchant", []string{"wallet-1"}, []string{"customer"}, []string{"history:export"}).
+		Return(models.IssuedAPIKey{APIKey: testKey, Key: "psk_AbCdEfGhsecret"}, nil)
+
+	req := httptest.NewRequest("POST", "/api/admin/keys", bytes.NewBufferString(
+		`{"name": "merchant", "wallets": ["wallet-1"], "roles": ["customer"], "permissions": ["history:export"]}`))
+	w := httptest.NewRecorder()
+
+	handler.HandleIssue(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{
+		"id": 1,
+		"name": "merchant",
+		"prefix": "psk_AbCdEfGh",
+		"wallets": ["wallet-1"],
+		"roles": ["customer"],
+		"permissions": ["history:export"],
+		"created_at": "2024-01-01T00:00:00Z",
+		"key": "psk_AbCdEfGhsecret"
+	}`, w.Body.String())
+	mockSvc.AssertExpectations(t)
+}
+
+func TestHandleIssue_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{"invalid", services.ErrInvalidAPIKey, http.StatusBadRequest},
+		{"unknown wallet", storage.ErrWalletNotFound, http.StatusNotFound},
+		{"canceled", context.Canceled, respond.StatusClientClosedRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, mockSvc := setupTestHandler()
+			mockSvc.On("IssueKey", "k", []string{"wallet-1"}, []string(nil), []string{"send"}).Return(models.IssuedAPIKey{}, tt.err)
+
+			req := httptest.NewRequest("POST", "/api/admin/keys", bytes.NewBufferString(
+				`{"name": "k", "wallets": ["wallet-1"], "permissions": ["send"]}`))
+			w := httptest.NewRecorder()
+
+			handler.HandleIssue(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestHandleList_Empty(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+	mockSvc.On("ListKeys").Return([]models.APIKey(nil), nil)
+
+	req := httptest.NewRequest("GET", "/api/admin/keys", nil)
+	w := httptest.NewRecorder()
+
+	handler.HandleList(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"keys": []}`, w.Body.String())
+}
+
+func TestHandleRevoke(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     string
+		err    error
+		status int
+	}{
+		{"success", "1", nil, http.StatusOK},
+		{"invalid id", "abc", nil, http.StatusBadRequest},
+		{"not found", "1", storage.ErrAPIKeyNotFound, http.StatusNotFound},
+		{"already revoked", "1", storage.ErrAPIKeyRevoked, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, mockSvc := setupTestHandler()
+			mockSvc.On("RevokeKey", int64(1)).Return(testKey, tt.err)
+
+			req := withID(httptest.NewRequest("DELETE", "/api/admin/keys/"+tt.id, nil), tt.id)
+			w := httptest.NewRecorder()
+
+			handler.HandleRevoke(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
@@ -1,133 +1,342 @@
 // Пакет handlers содержит HTTP-обработчики
 //
-// - Выполнение переводов
+// - Выполнение переводов, в том числе пакетных, и возвратов по ним
 // - Просмотр баланса
-// - Получение истории переводов
+// - Получение истории переводов с фильтрами и отдельной транзакции
+// - Выгрузка истории в CSV и NDJSON
 package handlers
 
 import (
 	"encoding/json"
 	"errors"
 	"github.com/go-chi/chi/v5"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/netip"
+	"net/url"
+	"paymentSystem/internal/export"
+	"paymentSystem/internal/handlers/respond"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
 	"paymentSystem/internal/services"
 	"paymentSystem/internal/storage"
 	"strconv"
+	"time"
 )
 
+// StatusClientClosedRequest — нестандартный статус (nginx) для запросов,
+// клиент которых закрыл соединение до получения ответа.
+const StatusClientClosedRequest = respond.StatusClientClosedRequest
+
+// DefaultMaxBodyBytes — предельный размер тела запроса по умолчанию,
+// которое middleware читают целиком.
+const DefaultMaxBodyBytes = 1 << 20
+
 type Handler struct {
-	service services.TransactionService
-	logger  *slog.Logger
+	service     services.TransactionService
+	idempotency services.IdempotencyService
+	keys        services.APIKeyService
+	tokens      TokenVerifier
+	signatures  SignatureVerifier
+	limiter     RateLimiter
+	maxBodySize int64
+	// trustedProxies — прокси, которым RealIPMiddleware верит в заголовках
+	// с адресом клиента.
+	trustedProxies []netip.Prefix
+	logger         *slog.Logger
 }
 
-func NewHandler(service services.TransactionService, logger *slog.Logger) *Handler {
+// NewHandler создает обработчик. Без сервиса ключей (keys == nil)
+// и проверки токенов (tokens == nil) аутентификация отключена, без
+// проверки подписей (signatures == nil) подписи запросов не проверяются,
+// без limiter частота запросов не ограничивается. maxBodySize ограничивает
+// тело, которое читают middleware; 0 — DefaultMaxBodyBytes. Без
+// trustedProxies заголовки X-Forwarded-For и X-Real-IP не учитываются.
+func NewHandler(service services.TransactionService, idempotency services.IdempotencyService, keys services.APIKeyService, tokens TokenVerifier, signatures SignatureVerifier, limiter RateLimiter, maxBodySize int64, trustedProxies []netip.Prefix, logger *slog.Logger) *Handler {
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultMaxBodyBytes
+	}
 	return &Handler{
-		service: service,
-		logger:  logger,
+		service:        service,
+		idempotency:    idempotency,
+		keys:           keys,
+		tokens:         tokens,
+		signatures:     signatures,
+		limiter:        limiter,
+		maxBodySize:    maxBodySize,
+		trustedProxies: trustedProxies,
+		logger:         logger,
 	}
 }
 
-// respondJSON формирует JSON-ответ с указанным статусом.
-func (h *Handler) respondJSON(w http.ResponseWriter, status int, payload interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	if payload != nil {
-		_ = json.NewEncoder(w).Encode(payload)
+// HandleSend обрабатывает запрос на выполнение денежного перевода.
+func (h *Handler) HandleSend(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		From   string      `json:"from"`
+		To     string      `json:"to"`
+		Amount money.Money `json:"amount"`
 	}
-}
 
-// respondError формирует стандартный ответ об ошибке.
-func (h *Handler) respondError(w http.ResponseWriter, status int, message string) {
-	h.respondJSON(w, status, map[string]string{"error": message})
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respond.DecodeError(w, err, "invalid request body")
+		return
+	}
+
+	receipt, err := h.service.MakeTransaction(r.Context(), req.From, req.To, req.Amount)
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"receipt": receipt,
+	})
 }
 
-// HandleSend обрабатывает запрос на выполнение денежного перевода.
-func (h *Handler) HandleSend(w http.ResponseWriter, r *http.Request) {
+// HandleSendBatch обрабатывает запрос на пакетный перевод.
+// В атомарном режиме отказ всего пакета сообщается статусом ошибки
+// перевода и его индексом; иначе ответ 200 содержит исход каждого перевода.
+func (h *Handler) HandleSendBatch(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		From   string  `json:"from"`
-		To     string  `json:"to"`
-		Amount float64 `json:"amount"`
+		Atomic    bool                     `json:"atomic"`
+		Transfers []models.TransferRequest `json:"transfers"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.respondError(w, http.StatusBadRequest, "invalid request body")
+		respond.DecodeError(w, err, "invalid request body")
+		return
+	}
+
+	result, err := h.service.MakeBatch(r.Context(), req.Transfers, req.Atomic)
+	var batchErr *storage.BatchError
+	if errors.As(err, &batchErr) {
+		status, message := respond.Status(h.logger, batchErr.Err)
+		body := map[string]interface{}{
+			"error": message,
+			"index": batchErr.Index,
+		}
+		respond.Details(body, batchErr.Err)
+		respond.JSON(w, status, body)
+		return
+	}
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, result)
+}
+
+// HandleGetTransaction обрабатывает запрос на получение транзакции по ID.
+func (h *Handler) HandleGetTransaction(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid transaction id")
+		return
+	}
+
+	tx, err := h.service.GetTransaction(r.Context(), id)
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, tx)
+}
+
+// HandleRefund обрабатывает запрос на возврат по транзакции.
+// Без тела или без amount возвращается весь еще не возвращенный остаток.
+func (h *Handler) HandleRefund(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid transaction id")
+		return
+	}
+
+	var req struct {
+		Amount *money.Money `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respond.DecodeError(w, err, "invalid request body")
 		return
 	}
 
-	if err := h.service.MakeTransaction(req.From, req.To, req.Amount); err != nil {
-		h.handleError(w, err)
+	receipt, err := h.service.RefundTransaction(r.Context(), id, req.Amount)
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
 		return
 	}
 
-	h.respondJSON(w, http.StatusOK, map[string]string{"status": "success"})
+	respond.JSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "success",
+		"receipt": receipt,
+	})
 }
 
 // HandleGetBalance обрабатывает запрос на получение баланса кошелька.
 func (h *Handler) HandleGetBalance(w http.ResponseWriter, r *http.Request) {
 	address := chi.URLParam(r, "address")
 	if address == "" {
-		h.respondError(w, http.StatusBadRequest, "address is required")
+		respond.Error(w, http.StatusBadRequest, "address is required")
 		return
 	}
 
-	balance, err := h.service.GetBalance(address)
+	balance, err := h.service.GetBalance(r.Context(), address)
 	if err != nil {
-		h.handleError(w, err)
+		respond.ServiceError(w, h.logger, err)
 		return
 	}
 
-	h.respondJSON(w, http.StatusOK, map[string]float64{"balance": balance})
+	respond.JSON(w, http.StatusOK, balance)
 }
 
-// HandleGetLastTransactions обрабатывает запрос на получение последних транзакций.
-func (h *Handler) HandleGetLastTransactions(w http.ResponseWriter, r *http.Request) {
-	count := 0
-	n := r.URL.Query().Get("count")
+// HandleListTransactions обрабатывает запрос истории транзакций с фильтрами
+// и курсорной пагинацией. Параметр count сохранен как синоним limit.
+func (h *Handler) HandleListTransactions(w http.ResponseWriter, r *http.Request) {
+	query, ok := h.transactionQuery(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := h.service.ListTransactions(r.Context(), query)
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, page)
+}
+
+// HandleExportTransactions выгружает транзакции в CSV или NDJSON с теми же
+// фильтрами, что и история. Строки пишутся в ответ по мере чтения из
+// хранилища; без limit выгружается вся выборка.
+func (h *Handler) HandleExportTransactions(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = export.FormatCSV
+	}
+	query, ok := h.transactionQuery(w, r)
+	if !ok {
+		return
+	}
 
-	count, err := strconv.Atoi(n)
+	ew, err := export.NewWriter(format, w)
 	if err != nil {
-		h.respondError(w, http.StatusBadRequest, "invalid count")
+		respond.Error(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	transactions, err := h.service.GetRecentTransactions(count)
+	// Заголовки отправляются вместе с первой строкой: до нее ошибку
+	// фильтра еще можно вернуть обычным JSON-ответом.
+	started := false
+	start := func() {
+		if !started {
+			started = true
+			w.Header().Set("Content-Type", export.ContentType(format))
+			w.Header().Set("Content-Disposition", `attachment; filename="transactions.`+format+`"`)
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+
+	err = h.service.ExportTransactions(r.Context(), query, func(tx models.Transaction) error {
+		start()
+		return ew.Write(tx)
+	})
+	if err != nil && !started {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
 	if err != nil {
-		h.handleError(w, err)
+		// Статус уже отправлен: обрываем выгрузку, клиент увидит неполный ответ
+		h.logger.Error("export aborted", "error", err)
 		return
 	}
 
-	h.respondJSON(w, http.StatusOK, transactions)
+	start()
+	if err := ew.Flush(); err != nil {
+		h.logger.Error("export flush", "error", err)
+	}
 }
 
-// handleError обрабатывает ошибки от сервисного слоя.
-func (h *Handler) handleError(w http.ResponseWriter, err error) {
-	switch {
-	case errors.Is(err, services.ErrInvalidAmount),
-		errors.Is(err, services.ErrSelfTransfer):
-		h.respondError(w, http.StatusBadRequest, err.Error())
+// transactionQuery разбирает параметры фильтра истории. При ошибке
+// отвечает 400 и возвращает false. Без
+// параметра wallet история охватывает все кошельки.
+func (h *Handler) transactionQuery(w http.ResponseWriter, r *http.Request) (services.TransactionQuery, bool) {
+	q := r.URL.Query()
+	query := services.TransactionQuery{
+		Cursor:    q.Get("cursor"),
+		Wallet:    q.Get("wallet"),
+		Direction: q.Get("direction"),
+	}
 
-	case errors.Is(err, storage.ErrWalletNotFound):
-		h.respondError(w, http.StatusNotFound, err.Error())
+	var err error
+	if value := q.Get("limit"); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil {
+			respond.Error(w, http.StatusBadRequest, "invalid limit")
+			return query, false
+		}
+	} else if value := q.Get("count"); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil {
+			respond.Error(w, http.StatusBadRequest, "invalid count")
+			return query, false
+		}
+	}
 
-	case errors.Is(err, storage.ErrInsufficientFunds):
-		h.respondError(w, http.StatusPaymentRequired, err.Error())
+	if query.FromTime, err = queryTime(q, "from_time"); err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid from_time")
+		return query, false
+	}
+	if query.ToTime, err = queryTime(q, "to_time"); err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid to_time")
+		return query, false
+	}
 
-	default:
-		h.logger.Error("internal error", "error", err)
-		h.respondError(w, http.StatusInternalServerError, "internal error")
+	// Границы суммы задаются в валюте currency (по умолчанию — валюта системы)
+	currency := q.Get("currency")
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	if query.MinAmount, err = queryAmount(q, "min_amount", currency); err != nil {
+		respond.DecodeError(w, err, "invalid min_amount")
+		return query, false
 	}
+	if query.MaxAmount, err = queryAmount(q, "max_amount", currency); err != nil {
+		respond.DecodeError(w, err, "invalid max_amount")
+		return query, false
+	}
+
+	return query, true
+}
+
+// queryTime читает необязательный параметр времени в формате RFC 3339.
+func queryTime(q url.Values, name string) (time.Time, error) {
+	value := q.Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
 }
 
-// Правила преобразования:
-// - Ошибки валидации → 400 Bad Request
-// - Кошелек не найден → 404 Not Found
-// - Недостаточно средств → 402 Payment Required
-// - Все остальные ошибки → 500 Internal Server Error
+// queryAmount читает необязательный параметр суммы в указанной валюте.
+func queryAmount(q url.Values, name, currency string) (*money.Money, error) {
+	value := q.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	amount, err := money.Parse(value, currency)
+	if err != nil {
+		return nil, err
+	}
+	return &amount, nil
+}
 
 // Формат запроса:
 // {
 //   "from": "адрес_отправителя",
 //   "to": "адрес_получателя",
-//   "amount": число
+//   "amount": {"value": "10.50", "currency": "RUB"}
 // }
+// Сумма также может быть передана числом или строкой ("amount": 10.5),
+// тогда используется валюта по умолчанию.
@@ -4,18 +4,30 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"paymentSystem/internal/auth"
+	"paymentSystem/internal/auth/jwt"
+	"paymentSystem/internal/auth/signature"
+	"paymentSystem/internal/config"
+	"paymentSystem/internal/fx"
 	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/ratelimit"
+	"paymentSystem/internal/services"
+	"strings"
 	"testing"
+	"time"
 
 	"paymentSystem/internal/storage"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // mockService реализует интерфейс services.TransactionService
@@ -23,25 +35,50 @@ type mockService struct {
 	mock.Mock
 }
 
-func (m *mockService) MakeTransaction(from, to string, amount float64) error {
+func (m *mockService) MakeTransaction(ctx context.Context, from, to string, amount money.Money) (models.Receipt, error) {
 	args := m.Called(from, to, amount)
-	return args.Error(0)
+	return args.Get(0).(models.Receipt), args.Error(1)
+}
+
+func (m *mockService) GetTransaction(ctx context.Context, id int64) (models.Transaction, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.Transaction), args.Error(1)
+}
+
+func (m *mockService) RefundTransaction(ctx context.Context, id int64, amount *money.Money) (models.Receipt, error) {
+	args := m.Called(id, amount)
+	return args.Get(0).(models.Receipt), args.Error(1)
+}
+
+func (m *mockService) MakeBatch(ctx context.Context, transfers []models.TransferRequest, atomic bool) (services.BatchResult, error) {
+	args := m.Called(transfers, atomic)
+	return args.Get(0).(services.BatchResult), args.Error(1)
 }
 
-func (m *mockService) GetBalance(address string) (float64, error) {
+func (m *mockService) GetBalance(ctx context.Context, address string) (models.Balance, error) {
 	args := m.Called(address)
-	return args.Get(0).(float64), args.Error(1)
+	return args.Get(0).(models.Balance), args.Error(1)
+}
+
+func (m *mockService) ListTransactions(ctx context.Context, query services.TransactionQuery) (services.TransactionPage, error) {
+	args := m.Called(query)
+	return args.Get(0).(services.TransactionPage), args.Error(1)
 }
 
-func (m *mockService) GetRecentTransactions(n int) ([]models.Transaction, error) {
-	args := m.Called(n)
-	return args.Get(0).([]models.Transaction), args.Error(1)
+func (m *mockService) ExportTransactions(ctx context.Context, query services.TransactionQuery, fn func(models.Transaction) error) error {
+	args := m.Called(query)
+	for _, tx := range args.Get(0).([]models.Transaction) {
+		if err := fn(tx); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
 }
 
 // setupTestHandler создаёт обработчик с мок-сервисом
 func setupTestHandler() (*Handler, *mockService) {
 	mockSvc := new(mockService)
-	handler := NewHandler(mockSvc, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	handler := NewHandler(mockSvc, nil, nil, nil, nil, nil, 0, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
 	return handler, mockSvc
 }
 
@@ -49,7 +86,17 @@ func TestHandleSend_Success(t *testing.T) {
 	handler, mockSvc := setupTestHandler()
 
 	// Настраиваем мок
-	mockSvc.On("MakeTransaction", "wallet-01", "wallet-02", 10.0).Return(nil)
+	receipt := models.Receipt{
+		Transaction: models.Transaction{
+			ID:        42,
+			From:      "wallet-01",
+			To:        "wallet-02",
+			Amount:    money.New(1000, "RUB"),
+			Timestamp: "2024-01-01T00:00:00Z",
+		},
+		SenderBalance: money.New(9000, "RUB"),
+	}
+	mockSvc.On("MakeTransaction", "wallet-01", "wallet-02", money.New(1000, "RUB")).Return(receipt, nil)
 
 	// Формируем запрос
 	reqBody := `{"from": "wallet-01", "to": "wallet-02", "amount": 10.0}`
@@ -62,10 +109,164 @@ func TestHandleSend_Success(t *testing.T) {
 
 	// Проверяем результат
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.JSONEq(t, `{"status": "success"}`, w.Body.String())
+	assert.JSONEq(t, `{
+		"status": "success",
+		"receipt": {
+			"id": 42,
+			"from": "wallet-01",
+			"to": "wallet-02",
+			"amount": {"value": "10.00", "currency": "RUB"},
+			"timestamp": "2024-01-01T00:00:00Z",
+			"sender_balance": {"value": "90.00", "currency": "RUB"}
+		}
+	}`, w.Body.String())
 	mockSvc.AssertExpectations(t)
 }
 
+func TestHandleSend_WithFee(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	feeOf := int64(42)
+	receipt := models.Receipt{
+		Transaction: models.Transaction{
+			ID:        42,
+			From:      "wallet-01",
+			To:        "wallet-02",
+			Amount:    money.New(1000, "RUB"),
+			Timestamp: "2024-01-01T00:00:00Z",
+		},
+		Fee: &models.Transaction{
+			ID:        43,
+			From:      "wallet-01",
+			To:        "fees",
+			Amount:    money.New(30, "RUB"),
+			Timestamp: "2024-01-01T00:00:00Z",
+			FeeOf:     &feeOf,
+		},
+		SenderBalance: money.New(8970, "RUB"),
+	}
+	mockSvc.On("MakeTransaction", "wallet-01", "wallet-02", money.New(1000, "RUB")).Return(receipt, nil)
+
+	req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(`{"from": "wallet-01", "to": "wallet-02", "amount": 10}`))
+	w := httptest.NewRecorder()
+
+	handler.HandleSend(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"status": "success",
+		"receipt": {
+			"id": 42,
+			"from": "wallet-01",
+			"to": "wallet-02",
+			"amount": {"value": "10.00", "currency": "RUB"},
+			"timestamp": "2024-01-01T00:00:00Z",
+			"fee": {
+				"id": 43,
+				"from": "wallet-01",
+				"to": "fees",
+				"amount": {"value": "0.30", "currency": "RUB"},
+				"timestamp": "2024-01-01T00:00:00Z",
+				"fee_of": 42
+			},
+			"sender_balance": {"value": "89.70", "currency": "RUB"}
+		}
+	}`, w.Body.String())
+}
+
+func TestHandleSend_WithConversion(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	credit := money.New(1000, "USD")
+	receipt := models.Receipt{
+		Transaction: models.Transaction{
+			ID:                42,
+			From:              "wallet-01",
+			To:                "wallet-usd",
+			Amount:            money.New(92500, "RUB"),
+			DestinationAmount: &credit,
+			Rate:              "0.0108108108",
+			Timestamp:         "2024-01-01T00:00:00Z",
+		},
+		SenderBalance: money.New(7500, "RUB"),
+	}
+	mockSvc.On("MakeTransaction", "wallet-01", "wallet-usd", money.New(92500, "RUB")).Return(receipt, nil)
+
+	req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(`{"from": "wallet-01", "to": "wallet-usd", "amount": 925}`))
+	w := httptest.NewRecorder()
+
+	handler.HandleSend(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"status": "success",
+		"receipt": {
+			"id": 42,
+			"from": "wallet-01",
+			"to": "wallet-usd",
+			"amount": {"value": "925.00", "currency": "RUB"},
+			"destination_amount": {"value": "10.00", "currency": "USD"},
+			"rate": "0.0108108108",
+			"timestamp": "2024-01-01T00:00:00Z",
+			"sender_balance": {"value": "75.00", "currency": "RUB"}
+		}
+	}`, w.Body.String())
+}
+
+func TestHandleSend_RateNotFound(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("MakeTransaction", "wallet-01", "wallet-eur", money.New(1000, "RUB")).
+		Return(models.Receipt{}, fmt.Errorf("%w: RUB/EUR", fx.ErrRateNotFound))
+
+	req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(`{"from": "wallet-01", "to": "wallet-eur", "amount": 10}`))
+	w := httptest.NewRecorder()
+
+	handler.HandleSend(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error": "exchange rate not found: RUB/EUR"}`, w.Body.String())
+}
+
+func TestHandleSend_LimitExceeded(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("MakeTransaction", "wallet-01", "wallet-02", money.New(500000, "RUB")).
+		Return(models.Receipt{}, &services.LimitError{Limit: services.LimitDaily, Max: money.New(1000000, "RUB")})
+
+	req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(`{"from": "wallet-01", "to": "wallet-02", "amount": 5000}`))
+	w := httptest.NewRecorder()
+
+	handler.HandleSend(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{
+		"error": "transfer limit exceeded: daily outgoing total would exceed 10000.00 RUB",
+		"limit": "daily",
+		"max": {"value": "10000.00", "currency": "RUB"}
+	}`, w.Body.String())
+}
+
+func TestHandleSend_VelocityLimitExceeded(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("MakeTransaction", "wallet-01", "wallet-02", money.New(1000, "RUB")).
+		Return(models.Receipt{}, &services.LimitError{Limit: services.LimitVelocity, MaxCount: 10, Window: time.Hour})
+
+	req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(`{"from": "wallet-01", "to": "wallet-02", "amount": 10}`))
+	w := httptest.NewRecorder()
+
+	handler.HandleSend(w, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.JSONEq(t, `{
+		"error": "transfer limit exceeded: at most 10 transfers per 1h0m0s",
+		"limit": "velocity",
+		"max_count": 10,
+		"window": "1h0m0s"
+	}`, w.Body.String())
+}
+
 func TestHandleSend_InvalidJSON(t *testing.T) {
 	handler, _ := setupTestHandler()
 
@@ -85,7 +286,7 @@ func TestHandleSend_InsufficientFunds(t *testing.T) {
 	handler, mockSvc := setupTestHandler()
 
 	// Настраиваем мок для возврата ошибки
-	mockSvc.On("MakeTransaction", "wallet-01", "wallet-02", 50.0).Return(storage.ErrInsufficientFunds)
+	mockSvc.On("MakeTransaction", "wallet-01", "wallet-02", money.New(5000, "RUB")).Return(models.Receipt{}, storage.ErrInsufficientFunds)
 
 	reqBody := `{"from": "wallet-01", "to": "wallet-02", "amount": 50.0}`
 	req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(reqBody))
@@ -98,11 +299,43 @@ func TestHandleSend_InsufficientFunds(t *testing.T) {
 	assert.JSONEq(t, `{"error": "insufficient funds"}`, w.Body.String())
 }
 
+func TestHandleSend_ExplicitCurrency(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("MakeTransaction", "wallet-01", "wallet-02", money.New(1050, "USD")).Return(models.Receipt{}, nil)
+
+	reqBody := `{"from": "wallet-01", "to": "wallet-02", "amount": {"value": "10.50", "currency": "USD"}}`
+	req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(reqBody))
+	w := httptest.NewRecorder()
+
+	handler.HandleSend(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockSvc.AssertExpectations(t)
+}
+
+func TestHandleSend_TooPrecise(t *testing.T) {
+	handler, _ := setupTestHandler()
+
+	// В рублях не бывает долей копейки
+	reqBody := `{"from": "wallet-01", "to": "wallet-02", "amount": 10.005}`
+	req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(reqBody))
+	w := httptest.NewRecorder()
+
+	handler.HandleSend(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error": "amount has more precision than currency allows"}`, w.Body.String())
+}
+
 func TestHandleGetBalance_Success(t *testing.T) {
 	handler, mockSvc := setupTestHandler()
 
 	// Настраиваем мок
-	mockSvc.On("GetBalance", "wallet-01").Return(100.0, nil)
+	mockSvc.On("GetBalance", "wallet-01").Return(models.Balance{
+		Total:     money.New(10000, "RUB"),
+		Available: money.New(7500, "RUB"),
+	}, nil)
 
 	// Создаем запрос с параметром
 	req := httptest.NewRequest("GET", "/api/wallet/wallet-01/balance", nil)
@@ -114,14 +347,17 @@ func TestHandleGetBalance_Success(t *testing.T) {
 	handler.HandleGetBalance(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.JSONEq(t, `{"balance": 100}`, w.Body.String())
+	assert.JSONEq(t, `{
+		"balance": {"value": "100.00", "currency": "RUB"},
+		"available": {"value": "75.00", "currency": "RUB"}
+	}`, w.Body.String())
 }
 
 func TestHandleGetBalance_NotFound(t *testing.T) {
 	handler, mockSvc := setupTestHandler()
 
 	// Настраиваем мок
-	mockSvc.On("GetBalance", "invalid-wallet").Return(0.0, storage.ErrWalletNotFound)
+	mockSvc.On("GetBalance", "invalid-wallet").Return(models.Balance{}, storage.ErrWalletNotFound)
 
 	req := httptest.NewRequest("GET", "/api/wallet/invalid-wallet/balance", nil)
 	rctx := chi.NewRouteContext()
@@ -135,33 +371,1064 @@ func TestHandleGetBalance_NotFound(t *testing.T) {
 	assert.JSONEq(t, `{"error": "wallet not found"}`, w.Body.String())
 }
 
-func TestHandleGetLastTransactions_Success(t *testing.T) {
+func TestHandleGetBalance_Canceled(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("GetBalance", "wallet-01").Return(models.Balance{}, context.Canceled)
+
+	req := httptest.NewRequest("GET", "/api/wallet/wallet-01/balance", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("address", "wallet-01")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler.HandleGetBalance(w, req)
+
+	assert.Equal(t, StatusClientClosedRequest, w.Code)
+	assert.JSONEq(t, `{"error": "request canceled"}`, w.Body.String())
+}
+
+func TestHandleGetTransaction_DeadlineExceeded(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("GetTransaction", int64(7)).Return(models.Transaction{}, context.DeadlineExceeded)
+
+	req := httptest.NewRequest("GET", "/api/transactions/7", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "7")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler.HandleGetTransaction(w, req)
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.JSONEq(t, `{"error": "request timed out"}`, w.Body.String())
+}
+
+func TestHandleListTransactions_Success(t *testing.T) {
 	handler, mockSvc := setupTestHandler()
 
 	// Настраиваем мок
-	transactions := []models.Transaction{
-		{From: "wallet-01", To: "wallet-02", Amount: 10.0},
+	page := services.TransactionPage{
+		Transactions: []models.Transaction{
+			{From: "wallet-01", To: "wallet-02", Amount: money.New(1000, "RUB")},
+		},
+		NextCursor: "Mg",
 	}
-	mockSvc.On("GetRecentTransactions", 5).Return(transactions, nil)
+	mockSvc.On("ListTransactions", services.TransactionQuery{Limit: 5}).Return(page, nil)
 
 	req := httptest.NewRequest("GET", "/api/transactions?count=5", nil)
 	w := httptest.NewRecorder()
 
-	handler.HandleGetLastTransactions(w, req)
+	handler.HandleListTransactions(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
-	expected, _ := json.Marshal(transactions)
+	expected, _ := json.Marshal(page)
 	assert.JSONEq(t, string(expected), w.Body.String())
 }
 
-func TestHandleGetLastTransactions_InvalidCount(t *testing.T) {
+func TestHandleListTransactions_Filters(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	minAmount, maxAmount := money.New(1050, "USD"), money.New(2000, "USD")
+	query := services.TransactionQuery{
+		Cursor:    "Mg",
+		Limit:     10,
+		Wallet:    "wallet-01",
+		Direction: "out",
+		FromTime:  time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		ToTime:    time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		MinAmount: &minAmount,
+		MaxAmount: &maxAmount,
+	}
+	mockSvc.On("ListTransactions", query).Return(services.TransactionPage{Transactions: []models.Transaction{}}, nil)
+
+	req := httptest.NewRequest("GET", "/api/transactions?cursor=Mg&limit=10&wallet=wallet-01&direction=out"+
+		"&from_time=2024-01-01T00:00:00Z&to_time=2024-02-01T00:00:00Z&min_amount=10.50&max_amount=20&currency=USD", nil)
+	w := httptest.NewRecorder()
+
+	handler.HandleListTransactions(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"transactions": []}`, w.Body.String())
+	mockSvc.AssertExpectations(t)
+}
+
+func TestHandleListTransactions_InvalidParams(t *testing.T) {
+	tests := []struct {
+		query string
+		error string
+	}{
+		{"limit=abc", "invalid limit"},
+		{"from_time=yesterday", "invalid from_time"},
+		{"min_amount=abc", "invalid min_amount"},
+		{"max_amount=1.001", money.ErrTooPrecise.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			handler, _ := setupTestHandler()
+
+			req := httptest.NewRequest("GET", "/api/transactions?"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			handler.HandleListTransactions(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), tt.error)
+		})
+	}
+}
+
+func TestHandleListTransactions_InvalidCursor(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("ListTransactions", services.TransactionQuery{Cursor: "bad"}).
+		Return(services.TransactionPage{}, services.ErrInvalidCursor)
+
+	req := httptest.NewRequest("GET", "/api/transactions?cursor=bad", nil)
+	w := httptest.NewRecorder()
+
+	handler.HandleListTransactions(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error": "invalid cursor"}`, w.Body.String())
+}
+
+func TestHandleExportTransactions_CSV(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	transactions := []models.Transaction{
+		{ID: 2, From: "wallet-01", To: "wallet-02", Amount: money.New(1050, "RUB"), Timestamp: "2024-01-02T00:00:00Z"},
+	}
+	mockSvc.On("ExportTransactions", services.TransactionQuery{Wallet: "wallet-01"}).Return(transactions, nil)
+
+	req := httptest.NewRequest("GET", "/api/transactions/export?format=csv&wallet=wallet-01", nil)
+	w := httptest.NewRecorder()
+
+	handler.HandleExportTransactions(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "id,from,to,amount,currency,timestamp,destination_amount,destination_currency,rate\n2,wallet-01,wallet-02,10.50,RUB,2024-01-02T00:00:00Z,,,\n", w.Body.String())
+}
+
+func TestHandleExportTransactions_NDJSONEmpty(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("ExportTransactions", services.TransactionQuery{}).Return([]models.Transaction{}, nil)
+
+	req := httptest.NewRequest("GET", "/api/transactions/export?format=ndjson", nil)
+	w := httptest.NewRecorder()
+
+	handler.HandleExportTransactions(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Empty(t, w.Body.String())
+}
+
+func TestHandleExportTransactions_UnknownFormat(t *testing.T) {
+	handler, _ := setupTestHandler()
+
+	req := httptest.NewRequest("GET", "/api/transactions/export?format=xml", nil)
+	w := httptest.NewRecorder()
+
+	handler.HandleExportTransactions(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error": "unknown export format \"xml\""}`, w.Body.String())
+}
+
+func TestHandleExportTransactions_FilterError(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	query := services.TransactionQuery{Direction: "in"}
+	mockSvc.On("ExportTransactions", query).Return([]models.Transaction{}, services.ErrInvalidFilter)
+
+	req := httptest.NewRequest("GET", "/api/transactions/export?direction=in", nil)
+	w := httptest.NewRecorder()
+
+	handler.HandleExportTransactions(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error": "invalid filter"}`, w.Body.String())
+}
+
+func TestHandleGetTransaction_Success(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	tx := models.Transaction{ID: 7, From: "wallet-01", To: "wallet-02", Amount: money.New(1000, "RUB")}
+	mockSvc.On("GetTransaction", int64(7)).Return(tx, nil)
+
+	req := httptest.NewRequest("GET", "/api/transactions/7", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "7")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler.HandleGetTransaction(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	expected, _ := json.Marshal(tx)
+	assert.JSONEq(t, string(expected), w.Body.String())
+}
+
+func TestHandleGetTransaction_WithRefunds(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	refundOf := int64(7)
+	tx := models.Transaction{
+		ID: 7, From: "wallet-01", To: "wallet-02", Amount: money.New(1000, "RUB"), Timestamp: "2024-01-01T00:00:00Z",
+		Refunds: []models.Transaction{
+			{ID: 8, From: "wallet-02", To: "wallet-01", Amount: money.New(400, "RUB"), Timestamp: "2024-01-02T00:00:00Z", RefundOf: &refundOf},
+		},
+	}
+	mockSvc.On("GetTransaction", int64(7)).Return(tx, nil)
+
+	req := httptest.NewRequest("GET", "/api/transactions/7", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "7")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler.HandleGetTransaction(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{
+		"id": 7, "from": "wallet-01", "to": "wallet-02",
+		"amount": {"value": "10.00", "currency": "RUB"},
+		"timestamp": "2024-01-01T00:00:00Z",
+		"refunds": [{
+			"id": 8, "from": "wallet-02", "to": "wallet-01",
+			"amount": {"value": "4.00", "currency": "RUB"},
+			"timestamp": "2024-01-02T00:00:00Z",
+			"refund_of": 7
+		}]
+	}`, w.Body.String())
+}
+
+func TestHandleRefund_Partial(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	amount := money.New(400, "RUB")
+	mockSvc.On("RefundTransaction", int64(7), &amount).Return(models.Receipt{}, nil)
+
+	req := httptest.NewRequest("POST", "/api/transactions/7/refund", bytes.NewBufferString(`{"amount": 4}`))
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "7")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler.HandleRefund(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockSvc.AssertExpectations(t)
+}
+
+func TestHandleRefund_Errors(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{storage.ErrRefundInsufficientFunds, http.StatusPaymentRequired},
+		{storage.ErrRefundExceedsAmount, http.StatusConflict},
+		{storage.ErrRefundOfRefund, http.StatusConflict},
+		{storage.ErrRefundOfFee, http.StatusConflict},
+		{storage.ErrTransactionNotFound, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		handler, mockSvc := setupTestHandler()
+		mockSvc.On("RefundTransaction", int64(7), (*money.Money)(nil)).Return(models.Receipt{}, tt.err)
+
+		req := httptest.NewRequest("POST", "/api/transactions/7/refund", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", "7")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+
+		handler.HandleRefund(w, req)
+
+		assert.Equal(t, tt.status, w.Code, tt.err.Error())
+		assert.JSONEq(t, `{"error": "`+tt.err.Error()+`"}`, w.Body.String())
+	}
+}
+
+func TestHandleSendBatch_BestEffort(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	transfers := []models.TransferRequest{
+		{From: "wallet-01", To: "wallet-02", Amount: money.New(1000, "RUB")},
+		{From: "wallet-02", To: "wallet-03", Amount: money.New(500, "RUB")},
+	}
+	receipt := models.Receipt{Transaction: models.Transaction{ID: 1}}
+	mockSvc.On("MakeBatch", transfers, false).Return(services.BatchResult{
+		Succeeded: 1,
+		Failed:    1,
+		Results: []services.BatchItemResult{
+			{Index: 0, Receipt: &receipt},
+			{Index: 1, Error: storage.ErrInsufficientFunds.Error()},
+		},
+	}, nil)
+
+	body := `{"transfers": [
+		{"from": "wallet-01", "to": "wallet-02", "amount": 10},
+		{"from": "wallet-02", "to": "wallet-03", "amount": 5}
+	]}`
+	req := httptest.NewRequest("POST", "/api/send/batch", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	handler.HandleSendBatch(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var result services.BatchResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, 1, result.Failed)
+	assert.Equal(t, "insufficient funds", result.Results[1].Error)
+	mockSvc.AssertExpectations(t)
+}
+
+func TestHandleSendBatch_AtomicFailure(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("MakeBatch", mock.Anything, true).
+		Return(services.BatchResult{}, &storage.BatchError{Index: 1, Err: storage.ErrInsufficientFunds})
+
+	body := `{"atomic": true, "transfers": [
+		{"from": "wallet-01", "to": "wallet-02", "amount": 10},
+		{"from": "wallet-02", "to": "wallet-03", "amount": 500}
+	]}`
+	req := httptest.NewRequest("POST", "/api/send/batch", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	handler.HandleSendBatch(w, req)
+
+	assert.Equal(t, http.StatusPaymentRequired, w.Code)
+	assert.JSONEq(t, `{"error": "insufficient funds", "index": 1}`, w.Body.String())
+}
+
+func TestHandleSendBatch_AtomicLimitExceeded(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("MakeBatch", mock.Anything, true).
+		Return(services.BatchResult{}, &storage.BatchError{Index: 0, Err: &services.LimitError{
+			Limit: services.LimitPerTransfer, Max: money.New(10000, "RUB"),
+		}})
+
+	body := `{"atomic": true, "transfers": [{"from": "wallet-01", "to": "wallet-02", "amount": 500}]}`
+	req := httptest.NewRequest("POST", "/api/send/batch", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+
+	handler.HandleSendBatch(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{
+		"error": "transfer limit exceeded: amount exceeds per-transfer maximum of 100.00 RUB",
+		"index": 0,
+		"limit": "per_transfer",
+		"max": {"value": "100.00", "currency": "RUB"}
+	}`, w.Body.String())
+}
+
+func TestHandleSendBatch_InvalidBatch(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("MakeBatch", mock.Anything, false).Return(services.BatchResult{}, services.ErrInvalidBatch)
+
+	req := httptest.NewRequest("POST", "/api/send/batch", bytes.NewBufferString(`{"transfers": []}`))
+	w := httptest.NewRecorder()
+
+	handler.HandleSendBatch(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandleGetTransaction_NotFound(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("GetTransaction", int64(99)).Return(models.Transaction{}, storage.ErrTransactionNotFound)
+
+	req := httptest.NewRequest("GET", "/api/transactions/99", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "99")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler.HandleGetTransaction(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error": "transaction not found"}`, w.Body.String())
+}
+
+func TestHandleListTransactions_InvalidCount(t *testing.T) {
 	handler, _ := setupTestHandler()
 
 	req := httptest.NewRequest("GET", "/api/transactions?count=abc", nil)
 	w := httptest.NewRecorder()
 
-	handler.HandleGetLastTransactions(w, req)
+	handler.HandleListTransactions(w, req)
 
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 	assert.JSONEq(t, `{"error": "invalid count"}`, w.Body.String())
 }
+
+// mockIdempotency реализует интерфейс services.IdempotencyService
+type mockIdempotency struct {
+	mock.Mock
+}
+
+func (m *mockIdempotency) Begin(ctx context.Context, key, fingerprint string) (models.IdempotencyRecord, bool, error) {
+	args := m.Called(key, fingerprint)
+	return args.Get(0).(models.IdempotencyRecord), args.Bool(1), args.Error(2)
+}
+
+func (m *mockIdempotency) Complete(ctx context.Context, key string, status int, response []byte) error {
+	args := m.Called(key, status, response)
+	return args.Error(0)
+}
+
+func (m *mockIdempotency) Abort(ctx context.Context, key string) error {
+	return m.Called(key).Error(0)
+}
+
+func (m *mockIdempotency) PurgeExpired(ctx context.Context) (int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// setupIdempotentRouter создаёт роутер с мок-сервисами переводов и идемпотентности
+func setupIdempotentRouter() (http.Handler, *mockService, *mockIdempotency) {
+	mockSvc := new(mockService)
+	mockIdem := new(mockIdempotency)
+	handler := NewHandler(mockSvc, mockIdem, nil, nil, nil, nil, 0, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return NewRouter(handler, nil, nil, nil, nil, nil), mockSvc, mockIdem
+}
+
+func TestIdempotency_FirstRequestStoresResponse(t *testing.T) {
+	router, mockSvc, mockIdem := setupIdempotentRouter()
+
+	reqBody := `{"from": "wallet-01", "to": "wallet-02", "amount": 10}`
+	mockIdem.On("Begin", "key-1", mock.Anything).Return(models.IdempotencyRecord{}, false, nil)
+	mockSvc.On("MakeTransaction", "wallet-01", "wallet-02", money.New(1000, "RUB")).Return(models.Receipt{}, nil)
+	mockIdem.On("Complete", "key-1", http.StatusOK, mock.Anything).Return(nil)
+
+	req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(reqBody))
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockSvc.AssertExpectations(t)
+	mockIdem.AssertExpectations(t)
+	stored := mockIdem.Calls[1].Arguments.Get(2).([]byte)
+	assert.JSONEq(t, w.Body.String(), string(stored))
+}
+
+func TestIdempotency_ReplayReturnsStoredResponse(t *testing.T) {
+	router, mockSvc, mockIdem := setupIdempotentRouter()
+
+	mockIdem.On("Begin", "key-1", mock.Anything).Return(models.IdempotencyRecord{
+		Status:   http.StatusOK,
+		Response: []byte(`{"status":"success"}`),
+	}, true, nil)
+
+	req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(`{"from": "a", "to": "b", "amount": 10}`))
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"status":"success"}`, w.Body.String())
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	mockSvc.AssertNotCalled(t, "MakeTransaction", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestIdempotency_DifferentBodyRejected(t *testing.T) {
+	router, _, mockIdem := setupIdempotentRouter()
+
+	mockIdem.On("Begin", "key-1", mock.Anything).Return(models.IdempotencyRecord{}, false, services.ErrIdempotencyKeyReused)
+
+	req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(`{"from": "a", "to": "b", "amount": 20}`))
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestIdempotency_ServerErrorReleasesKey(t *testing.T) {
+	router, mockSvc, mockIdem := setupIdempotentRouter()
+
+	mockIdem.On("Begin", "key-1", mock.Anything).Return(models.IdempotencyRecord{}, false, nil)
+	mockSvc.On("MakeTransaction", "a", "b", money.New(1000, "RUB")).Return(models.Receipt{}, services.ErrInternalError)
+	mockIdem.On("Abort", "key-1").Return(nil)
+
+	req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(`{"from": "a", "to": "b", "amount": 10}`))
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	mockIdem.AssertExpectations(t)
+	mockIdem.AssertNotCalled(t, "Complete", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestIdempotency_CanceledRequestReleasesKey(t *testing.T) {
+	router, mockSvc, mockIdem := setupIdempotentRouter()
+
+	mockIdem.On("Begin", "key-1", mock.Anything).Return(models.IdempotencyRecord{}, false, nil)
+	mockSvc.On("MakeTransaction", "a", "b", money.New(1000, "RUB")).Return(models.Receipt{}, context.Canceled)
+	mockIdem.On("Abort", "key-1").Return(nil)
+
+	req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(`{"from": "a", "to": "b", "amount": 10}`))
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, StatusClientClosedRequest, w.Code)
+	mockIdem.AssertExpectations(t)
+	mockIdem.AssertNotCalled(t, "Complete", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestIdempotency_PanicReleasesKey(t *testing.T) {
+	router, mockSvc, mockIdem := setupIdempotentRouter()
+
+	mockIdem.On("Begin", "key-1", mock.Anything).Return(models.IdempotencyRecord{}, false, nil)
+	mockSvc.On("MakeTransaction", "a", "b", money.New(1000, "RUB")).Run(func(mock.Arguments) {
+		panic("boom")
+	}).Return(models.Receipt{}, nil)
+	mockIdem.On("Abort", "key-1").Return(nil)
+
+	req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(`{"from": "a", "to": "b", "amount": 10}`))
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	// паника доходит до RecoverMiddleware, ключ освобожден
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	mockIdem.AssertExpectations(t)
+	mockIdem.AssertNotCalled(t, "Complete", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestIdempotency_RateLimitedReleasesKey(t *testing.T) {
+	router, mockSvc, mockIdem := setupIdempotentRouter()
+
+	mockIdem.On("Begin", "key-1", mock.Anything).Return(models.IdempotencyRecord{}, false, nil)
+	mockSvc.On("MakeTransaction", "a", "b", money.New(1000, "RUB")).Return(models.Receipt{}, &ratelimit.LimitError{RetryAfter: time.Second})
+	mockIdem.On("Abort", "key-1").Return(nil)
+
+	req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(`{"from": "a", "to": "b", "amount": 10}`))
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	mockIdem.AssertExpectations(t)
+	mockIdem.AssertNotCalled(t, "Complete", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestIdempotency_BodyTooLarge(t *testing.T) {
+	router, mockSvc, mockIdem := setupIdempotentRouter()
+
+	body := `{"from": "a", "to": "b", "amount": 10, "memo": "` + strings.Repeat("x", DefaultMaxBodyBytes) + `"}`
+	req := httptest.NewRequest("POST", "/api/send", strings.NewReader(body))
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	mockIdem.AssertNotCalled(t, "Begin", mock.Anything, mock.Anything)
+	mockSvc.AssertNotCalled(t, "MakeTransaction", mock.Anything, mock.Anything, mock.Anything)
+}
+
+// mockKeys реализует интерфейс services.APIKeyService
+type mockKeys struct {
+	mock.Mock
+}
+
+func (m *mockKeys) IssueKey(ctx context.Context, name string, wallets, roles, permissions []string) (models.IssuedAPIKey, error) {
+	args := m.Called(name, wallets, roles, permissions)
+	return args.Get(0).(models.IssuedAPIKey), args.Error(1)
+}
+
+func (m *mockKeys) ListKeys(ctx context.Context) ([]models.APIKey, error) {
+	args := m.Called()
+	return args.Get(0).([]models.APIKey), args.Error(1)
+}
+
+func (m *mockKeys) RotateKey(ctx context.Context, id int64) (models.IssuedAPIKey, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.IssuedAPIKey), args.Error(1)
+}
+
+func (m *mockKeys) RevokeKey(ctx context.Context, id int64) (models.APIKey, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.APIKey), args.Error(1)
+}
+
+func (m *mockKeys) Authenticate(ctx context.Context, key string) (auth.Principal, error) {
+	args := m.Called(key)
+	return args.Get(0).(auth.Principal), args.Error(1)
+}
+
+// mockTokens реализует интерфейс TokenVerifier
+type mockTokens struct {
+	mock.Mock
+}
+
+func (m *mockTokens) Verify(token string) (auth.Principal, error) {
+	args := m.Called(token)
+	return args.Get(0).(auth.Principal), args.Error(1)
+}
+
+// mockSignatures реализует интерфейс SignatureVerifier
+type mockSignatures struct {
+	mock.Mock
+}
+
+func (m *mockSignatures) Verify(method, uri string, header http.Header, body []byte) (string, error) {
+	args := m.Called(method, uri, header.Get(signature.HeaderSignature), string(body))
+	return args.String(0), args.Error(1)
+}
+
+// mockLimiter реализует интерфейс RateLimiter
+type mockLimiter struct {
+	mock.Mock
+}
+
+func (m *mockLimiter) NeedsWallets(method, path string) bool {
+	return m.Called(method, path).Bool(0)
+}
+
+func (m *mockLimiter) Allow(req ratelimit.Request) ratelimit.Decision {
+	return m.Called(req).Get(0).(ratelimit.Decision)
+}
+
+// setupAuthRouter создаёт роутер с включенной аутентификацией. Ключ
+// "psk_merchant" и токен "jwt-merchant" дают право send на кошелек wallet-01.
+// Лог запросов пишется в logs.
+func setupAuthRouter() (http.Handler, *mockService, *mockIdempotency) {
+	return setupAuthRouterWithLog(io.Discard)
+}
+
+func setupAuthRouterWithLog(logs io.Writer) (http.Handler, *mockService, *mockIdempotency) {
+	mockSvc := new(mockService)
+	mockIdem := new(mockIdempotency)
+	merchant := auth.Principal{
+		Wallets:     []string{"wallet-01"},
+		Permissions: []string{auth.PermissionSend},
+	}
+	keys := new(mockKeys)
+	merchant.Subject = "apikey:1"
+	keys.On("Authenticate", "psk_merchant").Return(merchant, nil)
+	keys.On("Authenticate", "psk_auditor").Return(auth.DefaultRoles().Grant(auth.Principal{
+		Subject: "apikey:2",
+		Wallets: []string{"wallet-09"},
+		Roles:   []string{auth.RoleAuditor},
+	}), nil)
+	keys.On("Authenticate", mock.Anything).Return(auth.Principal{}, services.ErrUnauthenticated)
+	tokens := new(mockTokens)
+	merchant.Subject = "jwt:merchant"
+	tokens.On("Verify", "jwt-merchant").Return(merchant, nil)
+	tokens.On("Verify", mock.Anything).Return(auth.Principal{}, fmt.Errorf("%w: token is expired", jwt.ErrInvalidToken))
+	logger := slog.New(slog.NewTextHandler(logs, nil))
+	handler := NewHandler(services.NewTransactionPolicy(mockSvc, logger), mockIdem, keys, tokens, nil, nil, 0, nil, logger)
+	return NewRouter(handler, nil, nil, nil, nil, nil), mockSvc, mockIdem
+}
+
+func TestAuth_Unauthenticated(t *testing.T) {
+	router, mockSvc, _ := setupAuthRouter()
+
+	for _, key := range []string{"", "psk_unknown"} {
+		req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(`{"from": "wallet-01", "to": "wallet-02", "amount": 10}`))
+		if key != "" {
+			req.Header.Set(APIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code, key)
+		assert.JSONEq(t, `{"error": "missing or invalid api key"}`, w.Body.String())
+	}
+	mockSvc.AssertNotCalled(t, "MakeTransaction", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAuth_SendFromOwnWallet(t *testing.T) {
+	router, mockSvc, _ := setupAuthRouter()
+	mockSvc.On("MakeTransaction", "wallet-01", "wallet-02", money.New(1000, "RUB")).Return(models.Receipt{}, nil)
+
+	req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(`{"from": "wallet-01", "to": "wallet-02", "amount": 10}`))
+	req.Header.Set(APIKeyHeader, "psk_merchant")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockSvc.AssertExpectations(t)
+}
+
+func TestAuth_SendFromForeignWallet(t *testing.T) {
+	router, mockSvc, _ := setupAuthRouter()
+
+	req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(`{"from": "wallet-02", "to": "wallet-01", "amount": 10}`))
+	req.Header.Set(APIKeyHeader, "psk_merchant")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"error": "forbidden: no access to wallet \"wallet-02\"", "wallet": "wallet-02"}`, w.Body.String())
+	mockSvc.AssertNotCalled(t, "MakeTransaction", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAuth_BatchFromForeignWallet(t *testing.T) {
+	router, mockSvc, _ := setupAuthRouter()
+
+	req := httptest.NewRequest("POST", "/api/send/batch", bytes.NewBufferString(`{"transfers": [
+		{"from": "wallet-01", "to": "wallet-02", "amount": 10},
+		{"from": "wallet-03", "to": "wallet-02", "amount": 10}
+	]}`))
+	req.Header.Set(APIKeyHeader, "psk_merchant")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"error": "forbidden: no access to wallet \"wallet-03\"", "index": 1, "wallet": "wallet-03"}`, w.Body.String())
+	mockSvc.AssertNotCalled(t, "MakeBatch", mock.Anything, mock.Anything)
+}
+
+func TestAuth_MissingPermission(t *testing.T) {
+	router, mockSvc, _ := setupAuthRouter()
+
+	req := httptest.NewRequest("GET", "/api/wallet/wallet-01/balance", nil)
+	req.Header.Set(APIKeyHeader, "psk_merchant")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"error": "forbidden: missing permission \"balance:read\"", "missing_permission": "balance:read"}`, w.Body.String())
+	mockSvc.AssertNotCalled(t, "GetBalance", mock.Anything)
+}
+
+func TestAuth_AuditorReadsAnyWallet(t *testing.T) {
+	router, mockSvc, _ := setupAuthRouter()
+	mockSvc.On("GetBalance", "wallet-01").Return(models.Balance{Total: money.New(100, "RUB")}, nil)
+
+	req := httptest.NewRequest("GET", "/api/wallet/wallet-01/balance", nil)
+	req.Header.Set(APIKeyHeader, "psk_auditor")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// переводы роли auditor не разрешены
+	req = httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(`{"from": "wallet-09", "to": "wallet-01", "amount": 10}`))
+	req.Header.Set(APIKeyHeader, "psk_auditor")
+	w = httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"error": "forbidden: missing permission \"send\"", "missing_permission": "send"}`, w.Body.String())
+}
+
+func TestAuth_WalletsManagePermission(t *testing.T) {
+	router, _, _ := setupAuthRouter()
+
+	req := httptest.NewRequest("POST", "/api/wallets", bytes.NewBufferString(`{"address": "wallet-05"}`))
+	req.Header.Set(APIKeyHeader, "psk_auditor")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"error": "forbidden: missing permission \"wallets:manage\"", "missing_permission": "wallets:manage"}`, w.Body.String())
+}
+
+func TestAuth_IdempotencyKeyScopedToCaller(t *testing.T) {
+	router, mockSvc, mockIdem := setupAuthRouter()
+	mockIdem.On("Begin", "apikey:1/key-1", mock.Anything).Return(models.IdempotencyRecord{}, false, nil)
+	mockSvc.On("MakeTransaction", "wallet-01", "wallet-02", money.New(1000, "RUB")).Return(models.Receipt{}, nil)
+	mockIdem.On("Complete", "apikey:1/key-1", http.StatusOK, mock.Anything).Return(nil)
+
+	req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(`{"from": "wallet-01", "to": "wallet-02", "amount": 10}`))
+	req.Header.Set(APIKeyHeader, "psk_merchant")
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockIdem.AssertExpectations(t)
+}
+
+func TestAuth_BearerToken(t *testing.T) {
+	var logs bytes.Buffer
+	router, mockSvc, _ := setupAuthRouterWithLog(&logs)
+	mockSvc.On("MakeTransaction", "wallet-01", "wallet-02", money.New(1000, "RUB")).Return(models.Receipt{}, nil)
+
+	req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(`{"from": "wallet-01", "to": "wallet-02", "amount": 10}`))
+	req.Header.Set("Authorization", "Bearer jwt-merchant")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockSvc.AssertExpectations(t)
+	// вызывающий попадает в лог запроса
+	assert.Contains(t, logs.String(), "subject=jwt:merchant")
+}
+
+func TestAuth_InvalidBearerToken(t *testing.T) {
+	router, mockSvc, _ := setupAuthRouter()
+
+	req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(`{"from": "wallet-01", "to": "wallet-02", "amount": 10}`))
+	req.Header.Set("Authorization", "Bearer jwt-expired")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Bearer error="invalid_token"`, w.Header().Get("WWW-Authenticate"))
+	assert.JSONEq(t, `{"error": "invalid token: token is expired"}`, w.Body.String())
+	mockSvc.AssertNotCalled(t, "MakeTransaction", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestSignature(t *testing.T) {
+	mockSvc := new(mockService)
+	signatures := new(mockSignatures)
+	handler := NewHandler(mockSvc, nil, nil, nil, signatures, nil, 0, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	router := NewRouter(handler, nil, nil, nil, nil, nil)
+
+	body := `{"from": "wallet-01", "to": "wallet-02", "amount": 10}`
+	signatures.On("Verify", "POST", "/api/send?trace=1", "good", body).Return("merchant", nil)
+	signatures.On("Verify", "POST", "/api/send?trace=1", "bad", body).
+		Return("merchant", fmt.Errorf("%w: signature mismatch", signature.ErrInvalidSignature))
+	mockSvc.On("MakeTransaction", "wallet-01", "wallet-02", money.New(1000, "RUB")).Return(models.Receipt{}, nil).Once()
+
+	for _, tt := range []struct {
+		signature string
+		status    int
+	}{
+		{"good", http.StatusOK},
+		{"bad", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("POST", "/api/send?trace=1", bytes.NewBufferString(body))
+		req.Header.Set(signature.HeaderSignature, tt.signature)
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		// тело, прочитанное для проверки подписи, доходит до обработчика
+		assert.Equal(t, tt.status, w.Code, tt.signature)
+	}
+	mockSvc.AssertExpectations(t)
+}
+
+func TestSignature_BodyTooLarge(t *testing.T) {
+	mockSvc := new(mockService)
+	signatures := new(mockSignatures)
+	handler := NewHandler(mockSvc, nil, nil, nil, signatures, nil, 16, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	router := NewRouter(handler, nil, nil, nil, nil, nil)
+
+	req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(`{"from": "wallet-01", "to": "wallet-02", "amount": 10}`))
+	req.Header.Set(signature.HeaderSignature, "good")
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.JSONEq(t, `{"error": "request body is too large"}`, w.Body.String())
+	signatures.AssertNotCalled(t, "Verify", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	mockSvc.AssertNotCalled(t, "MakeTransaction", mock.Anything, mock.Anything, mock.Anything)
+}
+
+// chargingService — сервис переводов, который, как настоящий, расходует
+// корзины кошельков-отправителей перед переводом
+type chargingService struct {
+	*mockService
+}
+
+func (s chargingService) MakeTransaction(ctx context.Context, from, to string, amount money.Money) (models.Receipt, error) {
+	if err := ratelimit.AllowWallets(ctx, from); err != nil {
+		return models.Receipt{}, err
+	}
+	return s.mockService.MakeTransaction(ctx, from, to, amount)
+}
+
+func (s chargingService) MakeBatch(ctx context.Context, transfers []models.TransferRequest, atomic bool) (services.BatchResult, error) {
+	wallets := make([]string, len(transfers))
+	for i, t := range transfers {
+		wallets[i] = t.From
+	}
+	if err := ratelimit.AllowWallets(ctx, wallets...); err != nil {
+		return services.BatchResult{}, err
+	}
+	return s.mockService.MakeBatch(ctx, transfers, atomic)
+}
+
+func TestRateLimit(t *testing.T) {
+	mockSvc := new(mockService)
+	limiter := new(mockLimiter)
+	handler := NewHandler(chargingService{mockSvc}, nil, nil, nil, nil, limiter, 0, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	router := NewRouter(handler, nil, nil, nil, nil, nil)
+
+	ip := ratelimit.Request{Stage: ratelimit.BeforeAuth, Method: "POST", Path: "/api/send/batch", IP: "10.0.0.1"}
+	client := ratelimit.Request{Stage: ratelimit.AfterAuth, Method: "POST", Path: "/api/send/batch", IP: "10.0.0.1"}
+	wallets := ratelimit.Request{Stage: ratelimit.AfterOwnership, Method: "POST", Path: "/api/send/batch", IP: "10.0.0.1", Wallets: []string{"wallet-01", "wallet-03"}}
+	limiter.On("NeedsWallets", "POST", "/api/send/batch").Return(true)
+	limiter.On("Allow", ip).Return(ratelimit.Decision{Allowed: true, Limit: 100, Remaining: 99, Reset: time.Second}).Once()
+	limiter.On("Allow", client).Return(ratelimit.Decision{Allowed: true}).Once()
+	limiter.On("Allow", wallets).Return(ratelimit.Decision{
+		Allowed: false, Limit: 5, Remaining: 0, Reset: 4500 * time.Millisecond, RetryAfter: 300 * time.Millisecond,
+	}).Once()
+
+	req := httptest.NewRequest("POST", "/api/send/batch", bytes.NewBufferString(`{"transfers": [
+		{"from": "wallet-01", "to": "wallet-02", "amount": 10},
+		{"from": "wallet-03", "to": "wallet-02", "amount": 10}
+	]}`))
+	req.RemoteAddr = "10.0.0.1:52000"
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.JSONEq(t, `{"error": "rate limit exceeded", "retry_after": 1}`, w.Body.String())
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	// заголовки описывают самую исчерпанную корзину всех этапов
+	assert.Equal(t, "5", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "5", w.Header().Get("RateLimit-Reset"))
+	limiter.AssertExpectations(t)
+	mockSvc.AssertNotCalled(t, "MakeBatch", mock.Anything, mock.Anything)
+
+	// запрос вне правил проходит без заголовков
+	limiter.On("NeedsWallets", "GET", "/api/wallet/wallet-01/balance").Return(false)
+	limiter.On("Allow", mock.Anything).Return(ratelimit.Decision{Allowed: true})
+	mockSvc.On("GetBalance", "wallet-01").Return(models.Balance{}, nil)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/wallet/wallet-01/balance", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimit_SpoofedWallet(t *testing.T) {
+	limiter, err := ratelimit.New(config.RateLimit{Rules: []config.RateLimitRule{
+		{Route: "*", By: config.RateLimitByWallet, Rate: 1, Period: time.Minute},
+	}})
+	require.NoError(t, err)
+	keys := new(mockKeys)
+	keys.On("Authenticate", "psk_merchant").Return(auth.Principal{
+		Subject:     "apikey:1",
+		Wallets:     []string{"wallet-01"},
+		Permissions: []string{auth.PermissionSend},
+	}, nil)
+	mockSvc := new(mockService)
+	mockSvc.On("MakeTransaction", "wallet-01", "wallet-02", money.New(1000, "RUB")).Return(models.Receipt{}, nil).Once()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := NewHandler(services.NewTransactionPolicy(chargingService{mockSvc}, logger), nil, keys, nil, nil, limiter, 0, nil, logger)
+	router := NewRouter(handler, nil, nil, nil, nil, nil)
+
+	send := func(from, to string) int {
+		req := httptest.NewRequest("POST", "/api/send", bytes.NewBufferString(`{"from": "`+from+`", "to": "`+to+`", "amount": 10}`))
+		req.Header.Set(APIKeyHeader, "psk_merchant")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// чужой кошелек в from отклоняется проверкой доступа и не расходует
+	// корзину владельца
+	assert.Equal(t, http.StatusForbidden, send("wallet-02", "wallet-01"))
+	assert.Equal(t, http.StatusForbidden, send("wallet-02", "wallet-01"))
+	victim := limiter.Allow(ratelimit.Request{Stage: ratelimit.AfterOwnership, Method: "POST", Path: "/api/send", Wallets: []string{"wallet-02"}})
+	assert.True(t, victim.Allowed)
+
+	// свой кошелек расходует свою корзину
+	assert.Equal(t, http.StatusOK, send("wallet-01", "wallet-02"))
+	assert.Equal(t, http.StatusTooManyRequests, send("wallet-01", "wallet-02"))
+	mockSvc.AssertExpectations(t)
+}
+
+func TestRateLimit_IPBeforeAuth(t *testing.T) {
+	limiter, err := ratelimit.New(config.RateLimit{Rules: []config.RateLimitRule{
+		{Route: "*", By: config.RateLimitByIP, Rate: 1, Period: time.Minute},
+	}})
+	require.NoError(t, err)
+	keys := new(mockKeys)
+	keys.On("Authenticate", mock.Anything).Return(auth.Principal{}, services.ErrUnauthenticated)
+	handler := NewHandler(new(mockService), nil, keys, nil, nil, limiter, 0, nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	router := NewRouter(handler, nil, nil, nil, nil, nil)
+
+	// подбор ключей ограничивается, хотя каждый запрос отклоняется с 401
+	for _, status := range []int{http.StatusUnauthorized, http.StatusTooManyRequests} {
+		req := httptest.NewRequest("GET", "/api/wallet/wallet-01/balance", nil)
+		req.RemoteAddr = "203.0.113.7:52000"
+		req.Header.Set(APIKeyHeader, "psk_guess")
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, status, w.Code)
+	}
+	keys.AssertNumberOfCalls(t, "Authenticate", 1)
+}
+
+func TestRealIP(t *testing.T) {
+	proxies, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1", "::1"})
+	require.NoError(t, err)
+	handler := NewHandler(new(mockService), nil, nil, nil, nil, nil, 0, proxies, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded []string
+		realIP    string
+		want      string
+	}{
+		{"direct", "203.0.113.7:52000", nil, "", "203.0.113.7"},
+		{"spoofed by client", "203.0.113.7:52000", []string{"198.51.100.1"}, "198.51.100.2", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:52000", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"chain of proxies", "10.0.0.2:52000", []string{"1.1.1.1, 198.51.100.1", "192.168.1.1, 10.0.0.3"}, "", "198.51.100.1"},
+		{"client prepends", "10.0.0.2:52000", []string{"10.0.0.9, 198.51.100.1"}, "", "198.51.100.1"},
+		{"garbage hop", "10.0.0.2:52000", []string{"198.51.100.1, unknown, 10.0.0.3"}, "", "10.0.0.3"},
+		{"x-real-ip", "[::1]:52000", nil, "198.51.100.1", "198.51.100.1"},
+		{"no headers", "10.0.0.2:52000", nil, "", "10.0.0.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remote
+			for _, f := range tt.forwarded {
+				req.Header.Add("X-Forwarded-For", f)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			var got string
+			handler.RealIPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = remoteIP(r)
+			})).ServeHTTP(httptest.NewRecorder(), req)
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err = ParseTrustedProxies([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+}
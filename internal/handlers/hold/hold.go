@@ -0,0 +1,173 @@
+// Пакет hold содержит HTTP-обработчики двухфазных платежей
+//
+// - Блокировка суммы на кошельке
+// - Получение блокировки по ID
+// - Полное или частичное списание блокировки на кошелек назначения
+// - Снятие блокировки
+package hold
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"paymentSystem/internal/auth"
+	"paymentSystem/internal/handlers/respond"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/services"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type Handler struct {
+	service services.HoldService
+	logger  *slog.Logger
+}
+
+func NewHandler(service services.HoldService, logger *slog.Logger) *Handler {
+	return &Handler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// HandleCreate обрабатывает запрос на блокировку суммы.
+func (h *Handler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		From   string      `json:"from"`
+		To     string      `json:"to"`
+		Amount money.Money `json:"amount"`
+		TTL    string      `json:"ttl"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respond.DecodeError(w, err, "invalid request body")
+		return
+	}
+
+	if err := auth.CheckWallets(r.Context(), req.From); err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil {
+			respond.Error(w, http.StatusBadRequest, "invalid ttl")
+			return
+		}
+	}
+
+	hold, err := h.service.CreateHold(r.Context(), req.From, req.To, req.Amount, ttl)
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	respond.JSON(w, http.StatusCreated, hold)
+}
+
+// HandleGet обрабатывает запрос на получение блокировки.
+func (h *Handler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.holdID(w, r)
+	if !ok {
+		return
+	}
+
+	hold, err := h.service.GetHold(r.Context(), id)
+	if err == nil {
+		err = auth.CheckAnyWalletRead(r.Context(), hold.Wallet, hold.Destination)
+	}
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, hold)
+}
+
+// HandleCapture обрабатывает запрос на списание блокировки.
+// Без тела или без amount списывается вся заблокированная сумма.
+func (h *Handler) HandleCapture(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.holdID(w, r)
+	if !ok || !h.authorize(w, r, id) {
+		return
+	}
+
+	var req struct {
+		Amount *money.Money `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		respond.DecodeError(w, err, "invalid request body")
+		return
+	}
+
+	hold, err := h.service.CaptureHold(r.Context(), id, req.Amount)
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, hold)
+}
+
+// HandleVoid обрабатывает запрос на снятие блокировки.
+func (h *Handler) HandleVoid(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.holdID(w, r)
+	if !ok || !h.authorize(w, r, id) {
+		return
+	}
+
+	hold, err := h.service.VoidHold(r.Context(), id)
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, hold)
+}
+
+// holdID читает {id} из пути; при ошибке отвечает 400 и возвращает false.
+func (h *Handler) holdID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid hold id")
+		return 0, false
+	}
+	return id, true
+}
+
+// authorize проверяет, что вызывающему доступен кошелек блокировки id;
+// при отказе отвечает ошибкой и возвращает false.
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request, id int64) bool {
+	if _, ok := auth.FromContext(r.Context()); !ok {
+		return true
+	}
+	hold, err := h.service.GetHold(r.Context(), id)
+	if err == nil {
+		err = auth.CheckWallets(r.Context(), hold.Wallet)
+	}
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return false
+	}
+	return true
+}
+
+// Формат запроса на блокировку:
+// {
+//   "from": "адрес_кошелька",
+//   "to": "адрес_получателя",
+//   "amount": {"value": "10.50", "currency": "RUB"},
+//   "ttl": "15m"
+// }
+// ttl необязателен; по умолчанию используется максимальный срок из конфигурации.
+//
+// Формат запроса на списание (тело необязательно):
+// {
+//   "amount": {"value": "5.00", "currency": "RUB"}
+// }
@@ -0,0 +1,242 @@
+package hold
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"paymentSystem/internal/auth"
+	"paymentSystem/internal/handlers/respond"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/services"
+	"paymentSystem/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// mockService реализует интерфейс services.HoldService
+type mockService struct {
+	mock.Mock
+}
+
+func (m *mockService) CreateHold(ctx context.Context, from, to string, amount money.Money, ttl time.Duration) (models.Hold, error) {
+	args := m.Called(from, to, amount, ttl)
+	return args.Get(0).(models.Hold), args.Error(1)
+}
+
+func (m *mockService) GetHold(ctx context.Context, id int64) (models.Hold, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.Hold), args.Error(1)
+}
+
+func (m *mockService) CaptureHold(ctx context.Context, id int64, amount *money.Money) (models.Hold, error) {
+	args := m.Called(id, amount)
+	return args.Get(0).(models.Hold), args.Error(1)
+}
+
+func (m *mockService) VoidHold(ctx context.Context, id int64) (models.Hold, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.Hold), args.Error(1)
+}
+
+func (m *mockService) ExpireHolds(ctx context.Context) (int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// setupTestHandler создаёт обработчик с мок-сервисом
+func setupTestHandler() (*Handler, *mockService) {
+	mockSvc := new(mockService)
+	handler := NewHandler(mockSvc, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return handler, mockSvc
+}
+
+// withID добавляет параметр {id} в контекст chi
+func withID(req *http.Request, id string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+var testHold = models.Hold{
+	ID:             1,
+	Wallet:         "wallet-1",
+	Destination:    "wallet-2",
+	Amount:         money.New(1050, "RUB"),
+	Fee:            money.New(100, "RUB"),
+	CapturedAmount: money.New(0, "RUB"),
+	Status:         storage.HoldActive,
+	CreatedAt:      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	ExpiresAt:      time.Date(2024, 1, 1, 0, 15, 0, 0, time.UTC),
+}
+
+func TestHandleCreate_Success(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("CreateHold", "wallet-1", "wallet-2", money.New(1050, "RUB"), 15*time.Minute).Return(testHold, nil)
+
+	req := httptest.NewRequest("POST", "/api/holds", bytes.NewBufferString(
+		`{"from": "wallet-1", "to": "wallet-2", "amount": {"value": "10.50", "currency": "RUB"}, "ttl": "15m"}`))
+	w := httptest.NewRecorder()
+
+	handler.HandleCreate(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{
+		"id": 1,
+		"wallet": "wallet-1",
+		"destination": "wallet-2",
+		"amount": {"value": "10.50", "currency": "RUB"},
+		"fee": {"value": "1.00", "currency": "RUB"},
+		"captured_amount": {"value": "0.00", "currency": "RUB"},
+		"status": "active",
+		"created_at": "2024-01-01T00:00:00Z",
+		"expires_at": "2024-01-01T00:15:00Z"
+	}`, w.Body.String())
+	mockSvc.AssertExpectations(t)
+}
+
+func TestHandleCreate_InvalidTTL(t *testing.T) {
+	handler, _ := setupTestHandler()
+
+	req := httptest.NewRequest("POST", "/api/holds", bytes.NewBufferString(
+		`{"from": "wallet-1", "to": "wallet-2", "amount": 10, "ttl": "soon"}`))
+	w := httptest.NewRecorder()
+
+	handler.HandleCreate(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error": "invalid ttl"}`, w.Body.String())
+}
+
+func TestHandleCreate_InsufficientFunds(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("CreateHold", "wallet-1", "wallet-2", money.New(1000, "RUB"), time.Duration(0)).
+		Return(models.Hold{}, storage.ErrInsufficientFunds)
+
+	req := httptest.NewRequest("POST", "/api/holds", bytes.NewBufferString(
+		`{"from": "wallet-1", "to": "wallet-2", "amount": 10}`))
+	w := httptest.NewRecorder()
+
+	handler.HandleCreate(w, req)
+
+	assert.Equal(t, http.StatusPaymentRequired, w.Code)
+	assert.JSONEq(t, `{"error": "insufficient funds"}`, w.Body.String())
+}
+
+func TestHandleCreate_Forbidden(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("CreateHold", "wallet-1", "wallet-2", money.New(1000, "RUB"), time.Duration(0)).
+		Return(models.Hold{}, &auth.ForbiddenError{Wallet: "wallet-1"})
+
+	req := httptest.NewRequest("POST", "/api/holds", bytes.NewBufferString(
+		`{"from": "wallet-1", "to": "wallet-2", "amount": 10}`))
+	w := httptest.NewRecorder()
+
+	handler.HandleCreate(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"error": "forbidden: no access to wallet \"wallet-1\"", "wallet": "wallet-1"}`, w.Body.String())
+}
+
+func TestHandleGet_NotFound(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("GetHold", int64(9)).Return(models.Hold{}, storage.ErrHoldNotFound)
+
+	req := withID(httptest.NewRequest("GET", "/api/holds/9", nil), "9")
+	w := httptest.NewRecorder()
+
+	handler.HandleGet(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error": "hold not found"}`, w.Body.String())
+}
+
+func TestHandleGet_InvalidID(t *testing.T) {
+	handler, _ := setupTestHandler()
+
+	req := withID(httptest.NewRequest("GET", "/api/holds/abc", nil), "abc")
+	w := httptest.NewRecorder()
+
+	handler.HandleGet(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error": "invalid hold id"}`, w.Body.String())
+}
+
+func TestHandleCapture_FullWithoutBody(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("CaptureHold", int64(1), (*money.Money)(nil)).Return(testHold, nil)
+
+	req := withID(httptest.NewRequest("POST", "/api/holds/1/capture", nil), "1")
+	w := httptest.NewRecorder()
+
+	handler.HandleCapture(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockSvc.AssertExpectations(t)
+}
+
+func TestHandleCapture_Partial(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	partial := money.New(500, "RUB")
+	mockSvc.On("CaptureHold", int64(1), &partial).Return(testHold, nil)
+
+	req := withID(httptest.NewRequest("POST", "/api/holds/1/capture",
+		bytes.NewBufferString(`{"amount": {"value": "5.00", "currency": "RUB"}}`)), "1")
+	w := httptest.NewRecorder()
+
+	handler.HandleCapture(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockSvc.AssertExpectations(t)
+}
+
+func TestHandleCapture_Errors(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{storage.ErrCaptureExceedsHold, http.StatusBadRequest},
+		{storage.ErrHoldNotActive, http.StatusConflict},
+		{services.ErrInvalidAmount, http.StatusBadRequest},
+		{context.Canceled, respond.StatusClientClosedRequest},
+	}
+	for _, tt := range tests {
+		handler, mockSvc := setupTestHandler()
+		mockSvc.On("CaptureHold", int64(1), mock.Anything).Return(models.Hold{}, tt.err)
+
+		req := withID(httptest.NewRequest("POST", "/api/holds/1/capture", nil), "1")
+		w := httptest.NewRecorder()
+
+		handler.HandleCapture(w, req)
+
+		assert.Equal(t, tt.status, w.Code, tt.err.Error())
+	}
+}
+
+func TestHandleVoid_NotActive(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("VoidHold", int64(1)).Return(models.Hold{}, storage.ErrHoldNotActive)
+
+	req := withID(httptest.NewRequest("POST", "/api/holds/1/void", nil), "1")
+	w := httptest.NewRecorder()
+
+	handler.HandleVoid(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.JSONEq(t, `{"error": "hold is not active"}`, w.Body.String())
+}
@@ -1,16 +1,73 @@
 // Пакет handlers содержит middleware для обработки запросов
 //
+// - Определение адреса клиента с учетом доверенных прокси
 // - Логирование всех запросов с метриками
 // - Восстановление после паник (recovery)
+// - Идемпотентность запросов (Idempotency-Key)
+// - Проверка подписи запросов HMAC-SHA256
+// - Аутентификация по API-ключу (X-API-Key) или bearer-токену JWT и проверка прав
+// - Ограничение частоты запросов (RateLimit-*, Retry-After)
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"github.com/go-chi/chi/v5/middleware"
+	"io"
+	"math"
+	"net"
 	"net/http"
+	"net/netip"
+	"paymentSystem/internal/auth"
+	"paymentSystem/internal/handlers/respond"
+	"paymentSystem/internal/ratelimit"
+	"paymentSystem/internal/services"
 	"runtime/debug"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// IdempotencyKeyHeader — заголовок с ключом идемпотентности.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// APIKeyHeader — заголовок с API-ключом.
+const APIKeyHeader = "X-API-Key"
+
+// bearerPrefix начинает заголовок Authorization с bearer-токеном.
+const bearerPrefix = "Bearer "
+
+// TokenVerifier проверяет bearer-токен и возвращает вызывающего.
+type TokenVerifier interface {
+	Verify(token string) (auth.Principal, error)
+}
+
+// SignatureVerifier проверяет подпись запроса и возвращает идентификатор
+// клиента; для неподписанного запроса, если подпись не обязательна, —
+// пустую строку без ошибки.
+type SignatureVerifier interface {
+	Verify(method, uri string, header http.Header, body []byte) (string, error)
+}
+
+// RateLimiter ограничивает частоту запросов.
+type RateLimiter interface {
+	// NeedsWallets сообщает, что для проверки запроса нужны
+	// кошельки-отправители из его тела.
+	NeedsWallets(method, path string) bool
+	Allow(req ratelimit.Request) ratelimit.Decision
+}
+
+// subjectKey — ключ контекста, под которым LoggingMiddleware ждет от
+// AuthMiddleware вызывающего для записи в лог запроса.
+type subjectKey struct{}
+
+// maxIdempotencyKeyLength ограничивает длину ключа идемпотентности.
+const maxIdempotencyKeyLength = 255
+
 // LoggingMiddleware логирует информацию о каждом HTTP-запросе.
 func (h *Handler) LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -19,17 +76,22 @@ func (h *Handler) LoggingMiddleware(next http.Handler) http.Handler {
 			ww = middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 		}
 
+		subject := new(string)
 		start := time.Now()
 		defer func() {
-			h.logger.Info("request",
+			attrs := []any{
 				"method", r.Method,
 				"path", r.URL.Path,
 				"status", ww.Status(),
 				"duration", time.Since(start),
-			)
+			}
+			if *subject != "" {
+				attrs = append(attrs, "subject", *subject)
+			}
+			h.logger.Info("request", attrs...)
 		}()
 
-		next.ServeHTTP(ww, r)
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), subjectKey{}, subject)))
 	})
 }
 
@@ -40,10 +102,382 @@ func (h *Handler) RecoverMiddleware(next http.Handler) http.Handler {
 			if err := recover(); err != nil {
 				stack := string(debug.Stack())
 				h.logger.Error("panic", "error", err, "stack", stack)
-				h.respondError(w, http.StatusInternalServerError, "internal server error")
+				respond.Error(w, http.StatusInternalServerError, "internal server error")
 			}
 		}()
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// SignatureMiddleware проверяет подпись запроса до его аутентификации.
+// Запрос с неверной подписью, просроченным временем или повторным nonce
+// отклоняется с 401, тело длиннее maxBodySize — с 413 до проверки подписи.
+// Без SignatureVerifier подписи не проверяются.
+func (h *Handler) SignatureMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.signatures == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, ok := h.readBody(w, r)
+		if !ok {
+			return
+		}
+
+		client, err := h.signatures.Verify(r.Method, r.URL.RequestURI(), r.Header, body)
+		if err != nil {
+			h.logger.Warn("request signature rejected", "client", client, "error", err)
+			respond.ServiceError(w, h.logger, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AuthMiddleware аутентифицирует запрос и кладет вызывающего в контекст.
+// Запрос с заголовком "Authorization: Bearer" проверяется как JWT (если
+// настроен TokenVerifier), иначе — по API-ключу из X-API-Key. Без ключа
+// или с недействительным ключом либо токеном запрос отклоняется с 401.
+// Без сервиса ключей и TokenVerifier аутентификация отключена.
+func (h *Handler) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.keys == nil && h.tokens == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var principal auth.Principal
+		var err error
+		token, bearer := strings.CutPrefix(r.Header.Get("Authorization"), bearerPrefix)
+		switch {
+		case bearer && h.tokens != nil:
+			if principal, err = h.tokens.Verify(strings.TrimSpace(token)); err != nil {
+				h.logger.Warn("bearer token rejected", "error", err)
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			}
+		case h.keys != nil:
+			principal, err = h.keys.Authenticate(r.Context(), r.Header.Get(APIKeyHeader))
+		default:
+			err = services.ErrUnauthenticated
+		}
+		if err != nil {
+			respond.ServiceError(w, h.logger, err)
+			return
+		}
+
+		if subject, ok := r.Context().Value(subjectKey{}).(*string); ok {
+			*subject = principal.Subject
+		}
+		next.ServeHTTP(w, r.WithContext(auth.NewContext(r.Context(), principal)))
+	})
+}
+
+// RequirePermission пропускает запрос, только если у вызывающего есть право
+// permission; иначе отвечает 403 с названием недостающего права.
+func (h *Handler) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := auth.Check(r.Context(), permission); err != nil {
+				respond.ServiceError(w, h.logger, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// IPRateLimitMiddleware ограничивает частоту запросов с IP-адреса по
+// правилам RateLimiter. Middleware стоит до проверки подписи
+// и аутентификации, чтобы ограничивать и запросы, отклоненные с 401.
+func (h *Handler) IPRateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.limiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		req := ratelimit.Request{Stage: ratelimit.BeforeAuth, Method: r.Method, Path: r.URL.Path, IP: remoteIP(r)}
+		if h.rateLimited(w, req) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RateLimitMiddleware ограничивает частоту запросов вызывающего по правилам
+// RateLimiter. Middleware стоит после аутентификации, чтобы различать
+// вызывающих. Правила по кошельку middleware не проверяет: кошелек из тела
+// запроса еще не сверен с доступом вызывающего. Вместо этого в контекст
+// кладется проверка, которую сервис запускает через ratelimit.AllowWallets
+// после проверки доступа к кошельку-отправителю.
+func (h *Handler) RateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.limiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		req := ratelimit.Request{Stage: ratelimit.AfterAuth, Method: r.Method, Path: r.URL.Path, IP: remoteIP(r)}
+		if principal, ok := auth.FromContext(r.Context()); ok {
+			req.Client = principal.Subject
+		}
+		if h.rateLimited(w, req) {
+			return
+		}
+
+		if h.limiter.NeedsWallets(r.Method, r.URL.Path) {
+			ctx := ratelimit.WithWallets(r.Context(), func(wallets []string) error {
+				walletReq := req
+				walletReq.Stage = ratelimit.AfterOwnership
+				walletReq.Wallets = wallets
+				return h.allowRate(w, walletReq)
+			})
+			r = r.WithContext(ctx)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimited проверяет запрос по правилам его этапа и отвечает 429, если
+// запрос превысил ограничение.
+func (h *Handler) rateLimited(w http.ResponseWriter, req ratelimit.Request) bool {
+	if err := h.allowRate(w, req); err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return true
+	}
+	return false
+}
+
+// allowRate проверяет запрос по правилам его этапа. Ответ на запрос,
+// попавший под правило, несет заголовки RateLimit-Limit,
+// RateLimit-Remaining и RateLimit-Reset самой исчерпанной корзины всех
+// этапов; сверх лимита ставится Retry-After и возвращается
+// *ratelimit.LimitError.
+func (h *Handler) allowRate(w http.ResponseWriter, req ratelimit.Request) error {
+	decision := h.limiter.Allow(req)
+	if decision.Limit > 0 {
+		remaining, err := strconv.Atoi(w.Header().Get("RateLimit-Remaining"))
+		if err != nil || decision.Remaining < remaining {
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
+		}
+	}
+	if decision.Allowed {
+		return nil
+	}
+
+	h.logger.Warn("rate limit exceeded", "client", req.Client, "ip", req.IP, "wallets", req.Wallets)
+	w.Header().Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(decision.RetryAfter))))
+	return &ratelimit.LimitError{RetryAfter: decision.RetryAfter}
+}
+
+// RealIPMiddleware заменяет r.RemoteAddr адресом клиента. Заголовкам
+// X-Forwarded-For и X-Real-IP верим, только если соединение пришло
+// от доверенного прокси: клиентом считается последний адрес
+// X-Forwarded-For справа, который не принадлежит доверенным прокси.
+// Иначе адрес клиента — адрес соединения, и подделать его заголовком нельзя.
+func (h *Handler) RealIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.RemoteAddr = h.clientIP(r)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// clientIP возвращает адрес клиента запроса с учетом доверенных прокси.
+func (h *Handler) clientIP(r *http.Request) string {
+	remote := remoteIP(r)
+	addr, err := netip.ParseAddr(remote)
+	if err != nil || !h.trustedProxy(addr.Unmap()) {
+		return remote
+	}
+
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		client := addr.Unmap()
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+			if err != nil {
+				// за неразборчивым адресом цепочке верить нельзя
+				break
+			}
+			client = hop.Unmap()
+			if !h.trustedProxy(client) {
+				break
+			}
+		}
+		return client.String()
+	}
+	if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+		return realIP.Unmap().String()
+	}
+	return remote
+}
+
+// trustedProxy сообщает, что addr — адрес доверенного прокси.
+func (h *Handler) trustedProxy(addr netip.Addr) bool {
+	for _, p := range h.trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTrustedProxies разбирает адреса и подсети (CIDR) доверенных прокси.
+func ParseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, s := range proxies {
+		s = strings.TrimSpace(s)
+		if prefix, err := netip.ParsePrefix(s); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("http_server.trusted_proxies: invalid address or CIDR %q", s)
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// remoteIP возвращает IP-адрес клиента. RealIPMiddleware уже подставил
+// адрес из X-Forwarded-For или X-Real-IP, если запрос пришел через
+// доверенный прокси.
+func remoteIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// ceilSeconds округляет длительность вверх до целых секунд.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// IdempotencyMiddleware обеспечивает повторяемость запросов с заголовком Idempotency-Key.
+//
+// Первый запрос с ключом выполняется и его ответ сохраняется вместе с отпечатком
+// запроса (метод, путь, тело). Повтор с тем же телом возвращает сохраненный ответ,
+// повтор с другим телом — 422. Ответы 5xx, 429 (запрос можно повторить
+// позже) и 499 (клиент отменил запрос) не сохраняются, ключ освобождается;
+// так же ключ освобождается при панике обработчика. Ключи разных вызывающих не пересекаются.
+func (h *Handler) IdempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" || h.idempotency == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			respond.Error(w, http.StatusBadRequest, "idempotency key is too long")
+			return
+		}
+
+		body, ok := h.readBody(w, r)
+		if !ok {
+			return
+		}
+		if principal, ok := auth.FromContext(r.Context()); ok {
+			key = principal.Subject + "/" + key
+		}
+
+		record, replay, err := h.idempotency.Begin(r.Context(), key, requestFingerprint(r, body))
+		switch {
+		case errors.Is(err, services.ErrIdempotencyKeyReused):
+			respond.Error(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		case errors.Is(err, services.ErrIdempotencyInProgress):
+			respond.Error(w, http.StatusConflict, err.Error())
+			return
+		case err != nil:
+			respond.ServiceError(w, h.logger, err)
+			return
+		}
+
+		if replay {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.Status)
+			_, _ = w.Write(record.Response)
+			return
+		}
+
+		// Запрос мог быть отменен клиентом, но ключ все равно нужно закрыть.
+		ctx := context.WithoutCancel(r.Context())
+		defer func() {
+			// паника обработчика не должна оставлять ключ "в работе" до
+			// истечения TTL: ключ освобождается, паника идет дальше
+			// к RecoverMiddleware
+			if err := recover(); err != nil {
+				_ = h.idempotency.Abort(ctx, key)
+				panic(err)
+			}
+		}()
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		if rec.status >= http.StatusInternalServerError ||
+			rec.status == http.StatusTooManyRequests ||
+			rec.status == StatusClientClosedRequest {
+			_ = h.idempotency.Abort(ctx, key)
+			return
+		}
+		_ = h.idempotency.Complete(ctx, key, rec.status, rec.body.Bytes())
+	})
+}
+
+// readBody читает тело запроса не длиннее maxBodySize и подменяет r.Body
+// прочитанной копией для следующих обработчиков. Если тело длиннее,
+// отвечает 413, если его не удалось прочитать — 400; в обоих случаях
+// возвращает false.
+func (h *Handler) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBodySize))
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		respond.Error(w, http.StatusRequestEntityTooLarge, "request body is too large")
+		return nil, false
+	case err != nil:
+		respond.Error(w, http.StatusBadRequest, "invalid request body")
+		return nil, false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, true
+}
+
+// requestFingerprint вычисляет отпечаток запроса для сравнения повторов.
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// responseRecorder пропускает ответ клиенту, одновременно запоминая статус и тело.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.wroteHeader = true
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
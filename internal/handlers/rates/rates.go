@@ -0,0 +1,65 @@
+// Пакет rates содержит HTTP-обработчики курсов валют
+//
+// - Просмотр текущих курсов
+// - Замена таблицы курсов администратором
+package rates
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"paymentSystem/internal/handlers/respond"
+	"paymentSystem/internal/services"
+)
+
+type Handler struct {
+	service services.RateService
+	logger  *slog.Logger
+}
+
+func NewHandler(service services.RateService, logger *slog.Logger) *Handler {
+	return &Handler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// HandleList обрабатывает запрос на получение курсов.
+func (h *Handler) HandleList(w http.ResponseWriter, r *http.Request) {
+	respond.JSON(w, http.StatusOK, map[string]interface{}{
+		"rates": h.service.ListRates(),
+	})
+}
+
+// HandleReplace обрабатывает запрос на замену таблицы курсов.
+func (h *Handler) HandleReplace(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Rates map[string]string `json:"rates"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Rates == nil {
+		respond.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	rates, err := h.service.ReplaceRates(req.Rates)
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, map[string]interface{}{
+		"rates": rates,
+	})
+}
+
+// Правила преобразования:
+// - Некорректная пара или значение курса → 400 Bad Request
+// - Все остальные ошибки → 500 Internal Server Error
+
+// Формат запроса на замену курсов:
+// {
+//   "rates": {"USD/RUB": "92.50", "EUR/RUB": "100.10"}
+// }
+// Таблица заменяется целиком: пары, которых нет в запросе, удаляются.
+// Обратный курс (RUB/USD) задавать не нужно — он вычисляется из прямого.
@@ -0,0 +1,97 @@
+package rates
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"paymentSystem/internal/fx"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// mockService реализует интерфейс services.RateService
+type mockService struct {
+	mock.Mock
+}
+
+func (m *mockService) ListRates() map[string]string {
+	args := m.Called()
+	return args.Get(0).(map[string]string)
+}
+
+func (m *mockService) ReplaceRates(rates map[string]string) (map[string]string, error) {
+	args := m.Called(rates)
+	return args.Get(0).(map[string]string), args.Error(1)
+}
+
+// setupTestHandler создаёт обработчик с мок-сервисом
+func setupTestHandler() (*Handler, *mockService) {
+	mockSvc := new(mockService)
+	handler := NewHandler(mockSvc, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return handler, mockSvc
+}
+
+func TestHandleList(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+	mockSvc.On("ListRates").Return(map[string]string{"USD/RUB": "92.5"})
+
+	req := httptest.NewRequest("GET", "/api/rates", nil)
+	w := httptest.NewRecorder()
+
+	handler.HandleList(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"rates": {"USD/RUB": "92.5"}}`, w.Body.String())
+}
+
+func TestHandleReplace_Success(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+	rates := map[string]string{"USD/RUB": "92.50", "EUR/RUB": "100"}
+	mockSvc.On("ReplaceRates", rates).Return(map[string]string{"USD/RUB": "92.5", "EUR/RUB": "100"}, nil)
+
+	req := httptest.NewRequest("PUT", "/api/admin/rates", bytes.NewBufferString(
+		`{"rates": {"USD/RUB": "92.50", "EUR/RUB": "100"}}`))
+	w := httptest.NewRecorder()
+
+	handler.HandleReplace(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"rates": {"USD/RUB": "92.5", "EUR/RUB": "100"}}`, w.Body.String())
+	mockSvc.AssertExpectations(t)
+}
+
+func TestHandleReplace_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+	}{
+		{"invalid json", `{`, nil, http.StatusBadRequest},
+		{"missing rates", `{}`, nil, http.StatusBadRequest},
+		{"invalid rate", `{"rates": {"USD/RUB": "-1"}}`, fmt.Errorf("%w: USD/RUB", fx.ErrInvalidRate), http.StatusBadRequest},
+		{"internal", `{"rates": {"USD/RUB": "1"}}`, errors.New("disk full"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler, mockSvc := setupTestHandler()
+			if tt.err != nil {
+				mockSvc.On("ReplaceRates", mock.Anything).Return(map[string]string(nil), tt.err)
+			}
+
+			req := httptest.NewRequest("PUT", "/api/admin/rates", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+
+			handler.HandleReplace(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			mockSvc.AssertExpectations(t)
+		})
+	}
+}
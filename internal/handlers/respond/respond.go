@@ -0,0 +1,202 @@
+// Пакет respond формирует JSON-ответы API и преобразует ошибки сервисного
+// слоя в HTTP-ответы. Обработчики handlers и его подпакетов используют одно
+// преобразование, чтобы одна и та же ошибка везде давала одинаковый ответ.
+package respond
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"paymentSystem/internal/auth"
+	"paymentSystem/internal/auth/jwt"
+	"paymentSystem/internal/auth/signature"
+	"paymentSystem/internal/fx"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/ratelimit"
+	"paymentSystem/internal/services"
+	"paymentSystem/internal/storage"
+	"time"
+)
+
+// StatusClientClosedRequest — нестандартный статус (nginx) для запросов,
+// клиент которых закрыл соединение до получения ответа.
+const StatusClientClosedRequest = 499
+
+// JSON формирует JSON-ответ с указанным статусом.
+func JSON(w http.ResponseWriter, status int, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if payload != nil {
+		_ = json.NewEncoder(w).Encode(payload)
+	}
+}
+
+// Error формирует стандартный ответ об ошибке.
+func Error(w http.ResponseWriter, status int, message string) {
+	JSON(w, status, map[string]string{"error": message})
+}
+
+// DecodeError отвечает на ошибку разбора тела или параметра запроса.
+// Ошибки точности и валюты суммы сообщаются клиенту как есть, остальные —
+// сообщением message.
+func DecodeError(w http.ResponseWriter, err error, message string) {
+	switch {
+	case errors.Is(err, money.ErrTooPrecise),
+		errors.Is(err, money.ErrUnknownCurrency),
+		errors.Is(err, money.ErrOverflow):
+		Error(w, http.StatusBadRequest, err.Error())
+	default:
+		Error(w, http.StatusBadRequest, message)
+	}
+}
+
+// ServiceError отвечает на ошибку сервисного слоя статусом из Status
+// и подробностями из Details. Неизвестные ошибки пишутся в logger.
+func ServiceError(w http.ResponseWriter, logger *slog.Logger, err error) {
+	status, message := Status(logger, err)
+	body := map[string]interface{}{"error": message}
+	if Details(body, err) {
+		JSON(w, status, body)
+		return
+	}
+	Error(w, status, message)
+}
+
+// Details дополняет ответ об ошибке сведениями о нарушенном ограничении
+// (*services.LimitError), недостающем праве либо кошельке
+// (*auth.ForbiddenError) или сроком повтора (*ratelimit.LimitError)
+// и сообщает, что они добавлены.
+func Details(body map[string]interface{}, err error) bool {
+	var rateErr *ratelimit.LimitError
+	if errors.As(err, &rateErr) {
+		body["retry_after"] = retryAfterSeconds(rateErr.RetryAfter)
+		return true
+	}
+
+	var limitErr *services.LimitError
+	if errors.As(err, &limitErr) {
+		body["limit"] = limitErr.Limit
+		if limitErr.Limit == services.LimitVelocity {
+			body["max_count"] = limitErr.MaxCount
+			body["window"] = limitErr.Window.String()
+		} else {
+			body["max"] = limitErr.Max
+		}
+		return true
+	}
+
+	var forbiddenErr *auth.ForbiddenError
+	if errors.As(err, &forbiddenErr) {
+		switch {
+		case forbiddenErr.Permission != "":
+			body["missing_permission"] = forbiddenErr.Permission
+		case forbiddenErr.Wallet != "":
+			body["wallet"] = forbiddenErr.Wallet
+		}
+		return true
+	}
+	return false
+}
+
+// Status возвращает HTTP-статус и текст ответа для ошибки сервисного слоя.
+// Неизвестная ошибка пишется в logger и скрывается за "internal error".
+func Status(logger *slog.Logger, err error) (int, string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidAmount),
+		errors.Is(err, services.ErrSelfTransfer),
+		errors.Is(err, services.ErrInvalidPagination),
+		errors.Is(err, services.ErrInvalidCursor),
+		errors.Is(err, services.ErrInvalidFilter),
+		errors.Is(err, services.ErrInvalidBatch),
+		errors.Is(err, services.ErrInvalidHoldTTL),
+		errors.Is(err, services.ErrInvalidSchedule),
+		errors.Is(err, services.ErrInvalidAPIKey),
+		errors.Is(err, storage.ErrCaptureExceedsHold),
+		errors.Is(err, money.ErrUnknownCurrency),
+		errors.Is(err, money.ErrCurrencyMismatch),
+		errors.Is(err, money.ErrOverflow),
+		errors.Is(err, fx.ErrRateNotFound),
+		errors.Is(err, fx.ErrAmountTooSmall),
+		errors.Is(err, fx.ErrInvalidRate):
+		return http.StatusBadRequest, err.Error()
+
+	case errors.Is(err, storage.ErrWalletNotFound),
+		errors.Is(err, storage.ErrTransactionNotFound),
+		errors.Is(err, storage.ErrHoldNotFound),
+		errors.Is(err, storage.ErrScheduleNotFound),
+		errors.Is(err, storage.ErrAPIKeyNotFound):
+		return http.StatusNotFound, err.Error()
+
+	case errors.Is(err, storage.ErrInsufficientFunds),
+		errors.Is(err, storage.ErrRefundInsufficientFunds):
+		return http.StatusPaymentRequired, err.Error()
+
+	case isVelocityLimit(err),
+		errors.Is(err, ratelimit.ErrLimited):
+		return http.StatusTooManyRequests, err.Error()
+
+	case errors.Is(err, services.ErrLimitExceeded),
+		errors.Is(err, auth.ErrForbidden):
+		return http.StatusForbidden, err.Error()
+
+	case errors.Is(err, services.ErrUnauthenticated),
+		errors.Is(err, jwt.ErrInvalidToken),
+		errors.Is(err, signature.ErrInvalidSignature):
+		return http.StatusUnauthorized, err.Error()
+
+	case errors.Is(err, storage.ErrWalletClosed),
+		errors.Is(err, storage.ErrWalletExists),
+		errors.Is(err, storage.ErrWalletNotEmpty),
+		errors.Is(err, storage.ErrRefundExceedsAmount),
+		errors.Is(err, storage.ErrRefundOfRefund),
+		errors.Is(err, storage.ErrRefundOfFee),
+		errors.Is(err, storage.ErrHoldNotActive),
+		errors.Is(err, storage.ErrScheduleNotActive),
+		errors.Is(err, storage.ErrAPIKeyRevoked):
+		return http.StatusConflict, err.Error()
+
+	case errors.Is(err, context.Canceled):
+		return StatusClientClosedRequest, "request canceled"
+
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, "request timed out"
+
+	default:
+		logger.Error("internal error", "error", err)
+		return http.StatusInternalServerError, "internal error"
+	}
+}
+
+// retryAfterSeconds округляет срок повтора вверх до целых секунд, но не
+// меньше секунды.
+func retryAfterSeconds(d time.Duration) int {
+	return max(1, int(math.Ceil(d.Seconds())))
+}
+
+// isVelocityLimit сообщает, что перевод отклонен из-за числа переводов за окно.
+func isVelocityLimit(err error) bool {
+	var limitErr *services.LimitError
+	return errors.As(err, &limitErr) && limitErr.Limit == services.LimitVelocity
+}
+
+// Правила преобразования:
+// - Ошибки валидации (в т.ч. лишняя точность суммы, неизвестная валюта,
+//   некорректные курсор, фильтр истории и размер пакета, нет курса для
+//   перевода между валютами или сумма мала для конвертации, неверный срок
+//   блокировки и списание сверх блокировки) → 400 Bad Request
+// - Кошелек, транзакция или блокировка не найдены → 404 Not Found
+// - Недостаточно средств (в т.ч. у получателя при возврате) → 402 Payment Required
+// - Нет или неверен API-ключ, недействителен bearer-токен, неверна или
+//   повторена подпись запроса → 401 Unauthorized
+// - Превышен лимит суммы перевода, за сутки или за месяц, не хватает
+//   права или доступа к кошельку → 403 Forbidden
+// - Превышено число переводов за окно или ограничение частоты запросов
+//   → 429 Too Many Requests
+// - Кошелек закрыт, возврат превышает остаток, возвращается возврат
+//   либо комиссия, блокировка уже списана, снята или истекла → 409 Conflict
+// - Клиент отменил запрос → 499 Client Closed Request
+// - Истек таймаут запроса → 504 Gateway Timeout
+// - Все остальные ошибки → 500 Internal Server Error
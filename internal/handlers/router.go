@@ -4,27 +4,113 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"net/http"
+	"paymentSystem/internal/auth"
+	"paymentSystem/internal/handlers/apikey"
+	"paymentSystem/internal/handlers/hold"
+	"paymentSystem/internal/handlers/rates"
+	"paymentSystem/internal/handlers/schedule"
+	"paymentSystem/internal/handlers/wallet"
 	"time"
 )
 
 // NewRouter создает и настраивает маршрутизатор для приложения.
-func NewRouter(h *Handler) http.Handler {
+// Каждый маршрут требует права вызывающего; проверки действуют, только
+// если включена аутентификация. Права на переводы, баланс и историю
+// проверяет сервис переводов (services.NewTransactionPolicy), остальные
+// маршруты — middleware RequirePermission.
+func NewRouter(h *Handler, wh *wallet.Handler, hh *hold.Handler, sh *schedule.Handler, rh *rates.Handler, kh *apikey.Handler) http.Handler {
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(h.RealIPMiddleware)
 	r.Use(h.LoggingMiddleware)
 	r.Use(h.RecoverMiddleware)
 	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(h.IPRateLimitMiddleware)
+	r.Use(h.SignatureMiddleware)
+	r.Use(h.AuthMiddleware)
+	r.Use(h.RateLimitMiddleware)
 
-	// POST /api/send - выполнение денежного перевода
-	r.Post("/api/send", h.HandleSend)
+	send := h.RequirePermission(auth.PermissionSend)
+	readBalance := h.RequirePermission(auth.PermissionBalanceRead)
+	readHistory := h.RequirePermission(auth.PermissionHistoryRead)
+	manageWallets := h.RequirePermission(auth.PermissionWalletsManage)
+	admin := h.RequirePermission(auth.PermissionAdmin)
 
-	// GET /api/transactions?count=N - получение последних транзакций
-	r.Get("/api/transactions", h.HandleGetLastTransactions)
+	// POST /api/send - выполнение денежного перевода (поддерживает Idempotency-Key)
+	r.With(h.IdempotencyMiddleware).Post("/api/send", h.HandleSend)
+
+	// POST /api/send/batch - пакетный перевод, атомарный или поштучный (поддерживает Idempotency-Key)
+	r.With(h.IdempotencyMiddleware).Post("/api/send/batch", h.HandleSendBatch)
+
+	// GET /api/transactions?limit=N&cursor=...&wallet=... - история транзакций с фильтрами
+	r.Get("/api/transactions", h.HandleListTransactions)
+
+	// GET /api/transactions/export?format=csv|ndjson&... - потоковая выгрузка истории
+	r.Get("/api/transactions/export", h.HandleExportTransactions)
+
+	// GET /api/transactions/{id} - получение транзакции по ID
+	r.Get("/api/transactions/{id}", h.HandleGetTransaction)
+
+	// POST /api/transactions/{id}/refund - полный или частичный возврат (поддерживает Idempotency-Key)
+	r.With(h.IdempotencyMiddleware).Post("/api/transactions/{id}/refund", h.HandleRefund)
 
 	// GET /api/wallet/{address}/balance - получение баланса кошелька
 	r.Get("/api/wallet/{address}/balance", h.HandleGetBalance)
 
+	// GET /api/wallet/{address}/statement?from=...&to=... - выписка по кошельку
+	r.With(readHistory).Get("/api/wallet/{address}/statement", wh.HandleStatement)
+
+	// POST /api/wallets - создание кошелька
+	r.With(manageWallets).Post("/api/wallets", wh.HandleCreate)
+
+	// GET /api/wallets?limit=N&offset=M - список кошельков
+	r.With(manageWallets).Get("/api/wallets", wh.HandleList)
+
+	// GET /api/wallets/{address} - получение кошелька
+	r.With(readBalance).Get("/api/wallets/{address}", wh.HandleGet)
+
+	// DELETE /api/wallets/{address} - закрытие кошелька с нулевым балансом
+	r.With(manageWallets).Delete("/api/wallets/{address}", wh.HandleClose)
+
+	// POST /api/holds - блокировка суммы на кошельке (поддерживает Idempotency-Key)
+	r.With(send, h.IdempotencyMiddleware).Post("/api/holds", hh.HandleCreate)
+
+	// GET /api/holds/{id} - получение блокировки
+	r.With(readHistory).Get("/api/holds/{id}", hh.HandleGet)
+
+	// POST /api/holds/{id}/capture - полное или частичное списание (поддерживает Idempotency-Key)
+	r.With(send, h.IdempotencyMiddleware).Post("/api/holds/{id}/capture", hh.HandleCapture)
+
+	// POST /api/holds/{id}/void - снятие блокировки
+	r.With(send).Post("/api/holds/{id}/void", hh.HandleVoid)
+
+	// POST /api/schedules - разовый или повторяющийся перевод по расписанию (поддерживает Idempotency-Key)
+	r.With(send, h.IdempotencyMiddleware).Post("/api/schedules", sh.HandleCreate)
+
+	// GET /api/schedules/{id} - запланированный перевод с историей запусков
+	r.With(readHistory).Get("/api/schedules/{id}", sh.HandleGet)
+
+	// DELETE /api/schedules/{id} - отмена запланированного перевода
+	r.With(send).Delete("/api/schedules/{id}", sh.HandleCancel)
+
+	// GET /api/rates - текущие курсы валют
+	r.Get("/api/rates", rh.HandleList)
+
+	// PUT /api/admin/rates - замена таблицы курсов
+	r.With(admin).Put("/api/admin/rates", rh.HandleReplace)
+
+	// POST /api/admin/keys - выпуск API-ключа
+	r.With(admin).Post("/api/admin/keys", kh.HandleIssue)
+
+	// GET /api/admin/keys - список API-ключей
+	r.With(admin).Get("/api/admin/keys", kh.HandleList)
+
+	// POST /api/admin/keys/{id}/rotate - ротация API-ключа
+	r.With(admin).Post("/api/admin/keys/{id}/rotate", kh.HandleRotate)
+
+	// DELETE /api/admin/keys/{id} - отзыв API-ключа
+	r.With(admin).Delete("/api/admin/keys/{id}", kh.HandleRevoke)
+
 	return r
 }
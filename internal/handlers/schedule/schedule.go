@@ -0,0 +1,148 @@
+// Пакет schedule содержит HTTP-обработчики запланированных переводов
+//
+// - Планирование разового или повторяющегося перевода
+// - Получение запланированного перевода с историей запусков
+// - Отмена запланированного перевода
+package schedule
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"paymentSystem/internal/auth"
+	"paymentSystem/internal/handlers/respond"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/services"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type Handler struct {
+	service services.ScheduleService
+	logger  *slog.Logger
+}
+
+func NewHandler(service services.ScheduleService, logger *slog.Logger) *Handler {
+	return &Handler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// HandleCreate обрабатывает запрос на планирование перевода.
+func (h *Handler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		From   string      `json:"from"`
+		To     string      `json:"to"`
+		Amount money.Money `json:"amount"`
+		RunAt  *time.Time  `json:"run_at"`
+		Cron   string      `json:"cron"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respond.DecodeError(w, err, "invalid request body")
+		return
+	}
+
+	if err := auth.CheckWallets(r.Context(), req.From); err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	var runAt time.Time
+	if req.RunAt != nil {
+		runAt = *req.RunAt
+	}
+
+	schedule, err := h.service.CreateSchedule(r.Context(), req.From, req.To, req.Amount, runAt, req.Cron)
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	respond.JSON(w, http.StatusCreated, schedule)
+}
+
+// HandleGet обрабатывает запрос на получение запланированного перевода.
+func (h *Handler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.scheduleID(w, r)
+	if !ok {
+		return
+	}
+
+	schedule, err := h.service.GetSchedule(r.Context(), id)
+	if err == nil {
+		err = auth.CheckAnyWalletRead(r.Context(), schedule.From, schedule.To)
+	}
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, schedule)
+}
+
+// HandleCancel обрабатывает запрос на отмену запланированного перевода.
+func (h *Handler) HandleCancel(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.scheduleID(w, r)
+	if !ok || !h.authorize(w, r, id) {
+		return
+	}
+
+	schedule, err := h.service.CancelSchedule(r.Context(), id)
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, schedule)
+}
+
+// scheduleID читает {id} из пути; при ошибке отвечает 400 и возвращает false.
+func (h *Handler) scheduleID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid schedule id")
+		return 0, false
+	}
+	return id, true
+}
+
+// authorize проверяет, что вызывающему доступен кошелек-отправитель
+// перевода id; при отказе отвечает ошибкой и возвращает false.
+func (h *Handler) authorize(w http.ResponseWriter, r *http.Request, id int64) bool {
+	if _, ok := auth.FromContext(r.Context()); !ok {
+		return true
+	}
+	schedule, err := h.service.GetSchedule(r.Context(), id)
+	if err == nil {
+		err = auth.CheckWallets(r.Context(), schedule.From)
+	}
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return false
+	}
+	return true
+}
+
+// Правила преобразования:
+// - Ошибки валидации (в т.ч. некорректное cron-выражение) → 400 Bad Request
+// - Нет доступа к кошельку-отправителю → 403 Forbidden
+// - Кошелек или запланированный перевод не найдены → 404 Not Found
+// - Кошелек закрыт или перевод уже завершен, отменен или не удался → 409 Conflict
+// - Клиент отменил запрос → 499 Client Closed Request
+// - Истек таймаут запроса → 504 Gateway Timeout
+// - Все остальные ошибки → 500 Internal Server Error
+
+// Формат запроса на планирование:
+// {
+//   "from": "адрес_отправителя",
+//   "to": "адрес_получателя",
+//   "amount": {"value": "10.50", "currency": "RUB"},
+//   "run_at": "2024-01-01T09:00:00Z",
+//   "cron": "0 9 * * 1"
+// }
+// Без cron перевод разовый и run_at обязателен. С cron перевод повторяется;
+// run_at задает первый запуск и необязателен.
@@ -0,0 +1,199 @@
+package schedule
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/services"
+	"paymentSystem/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// mockService реализует интерфейс services.ScheduleService
+type mockService struct {
+	mock.Mock
+}
+
+func (m *mockService) CreateSchedule(ctx context.Context, from, to string, amount money.Money, runAt time.Time, cronExpr string) (models.Schedule, error) {
+	args := m.Called(from, to, amount, runAt, cronExpr)
+	return args.Get(0).(models.Schedule), args.Error(1)
+}
+
+func (m *mockService) GetSchedule(ctx context.Context, id int64) (models.Schedule, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.Schedule), args.Error(1)
+}
+
+func (m *mockService) CancelSchedule(ctx context.Context, id int64) (models.Schedule, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.Schedule), args.Error(1)
+}
+
+func (m *mockService) RunDue(ctx context.Context) (int, error) {
+	args := m.Called()
+	return args.Int(0), args.Error(1)
+}
+
+// setupTestHandler создаёт обработчик с мок-сервисом
+func setupTestHandler() (*Handler, *mockService) {
+	mockSvc := new(mockService)
+	handler := NewHandler(mockSvc, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return handler, mockSvc
+}
+
+// withID добавляет параметр {id} в контекст chi
+func withID(req *http.Request, id string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+var testSchedule = models.Schedule{
+	ID:        1,
+	From:      "wallet-1",
+	To:        "wallet-2",
+	Amount:    money.New(1050, "RUB"),
+	Cron:      "0 9 * * 1",
+	NextRunAt: time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC),
+	Status:    storage.ScheduleActive,
+	CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+}
+
+func TestHandleCreate_Recurring(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("CreateSchedule", "wallet-1", "wallet-2", money.New(1050, "RUB"), time.Time{}, "0 9 * * 1").
+		Return(testSchedule, nil)
+
+	req := httptest.NewRequest("POST", "/api/schedules", bytes.NewBufferString(
+		`{"from": "wallet-1", "to": "wallet-2", "amount": {"value": "10.50", "currency": "RUB"}, "cron": "0 9 * * 1"}`))
+	w := httptest.NewRecorder()
+
+	handler.HandleCreate(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{
+		"id": 1,
+		"from": "wallet-1",
+		"to": "wallet-2",
+		"amount": {"value": "10.50", "currency": "RUB"},
+		"cron": "0 9 * * 1",
+		"next_run_at": "2024-01-08T09:00:00Z",
+		"status": "active",
+		"attempts": 0,
+		"created_at": "2024-01-01T00:00:00Z"
+	}`, w.Body.String())
+	mockSvc.AssertExpectations(t)
+}
+
+func TestHandleCreate_OneOff(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	runAt := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+	mockSvc.On("CreateSchedule", "wallet-1", "wallet-2", money.New(1000, "RUB"), runAt, "").
+		Return(testSchedule, nil)
+
+	req := httptest.NewRequest("POST", "/api/schedules", bytes.NewBufferString(
+		`{"from": "wallet-1", "to": "wallet-2", "amount": 10, "run_at": "2024-01-01T09:00:00Z"}`))
+	w := httptest.NewRecorder()
+
+	handler.HandleCreate(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockSvc.AssertExpectations(t)
+}
+
+func TestHandleCreate_Errors(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{services.ErrInvalidSchedule, http.StatusBadRequest},
+		{storage.ErrWalletNotFound, http.StatusNotFound},
+		{storage.ErrWalletClosed, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		handler, mockSvc := setupTestHandler()
+		mockSvc.On("CreateSchedule", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).
+			Return(models.Schedule{}, tt.err)
+
+		req := httptest.NewRequest("POST", "/api/schedules", bytes.NewBufferString(
+			`{"from": "wallet-1", "to": "wallet-2", "amount": 10, "cron": "@daily"}`))
+		w := httptest.NewRecorder()
+
+		handler.HandleCreate(w, req)
+
+		assert.Equal(t, tt.status, w.Code, tt.err.Error())
+	}
+}
+
+func TestHandleCreate_InvalidRunAt(t *testing.T) {
+	handler, _ := setupTestHandler()
+
+	req := httptest.NewRequest("POST", "/api/schedules", bytes.NewBufferString(
+		`{"from": "wallet-1", "to": "wallet-2", "amount": 10, "run_at": "tomorrow"}`))
+	w := httptest.NewRecorder()
+
+	handler.HandleCreate(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error": "invalid request body"}`, w.Body.String())
+}
+
+func TestHandleGet_WithRuns(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	transactionID := int64(7)
+	schedule := testSchedule
+	schedule.Runs = []models.ScheduleRun{{
+		ID: 1, ScheduleID: 1, Status: storage.RunSucceeded, TransactionID: &transactionID,
+		ScheduledAt: time.Date(2024, 1, 8, 9, 0, 0, 0, time.UTC),
+		ExecutedAt:  time.Date(2024, 1, 8, 9, 0, 1, 0, time.UTC),
+	}}
+	mockSvc.On("GetSchedule", int64(1)).Return(schedule, nil)
+
+	req := withID(httptest.NewRequest("GET", "/api/schedules/1", nil), "1")
+	w := httptest.NewRecorder()
+
+	handler.HandleGet(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(),
+		`"runs":[{"id":1,"schedule_id":1,"status":"succeeded","transaction_id":7,"scheduled_at":"2024-01-08T09:00:00Z","executed_at":"2024-01-08T09:00:01Z"}]`)
+}
+
+func TestHandleGet_InvalidID(t *testing.T) {
+	handler, _ := setupTestHandler()
+
+	req := withID(httptest.NewRequest("GET", "/api/schedules/abc", nil), "abc")
+	w := httptest.NewRecorder()
+
+	handler.HandleGet(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error": "invalid schedule id"}`, w.Body.String())
+}
+
+func TestHandleCancel_NotActive(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("CancelSchedule", int64(1)).Return(models.Schedule{}, storage.ErrScheduleNotActive)
+
+	req := withID(httptest.NewRequest("DELETE", "/api/schedules/1", nil), "1")
+	w := httptest.NewRecorder()
+
+	handler.HandleCancel(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.JSONEq(t, `{"error": "schedule is not active"}`, w.Body.String())
+}
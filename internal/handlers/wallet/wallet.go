@@ -1 +1,182 @@
+// Пакет wallet содержит HTTP-обработчики управления кошельками
+//
+// - Создание кошелька
+// - Получение кошелька по адресу
+// - Постраничный список кошельков
+// - Закрытие кошелька с нулевым балансом
+// - Выписка по кошельку за период
 package wallet
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"paymentSystem/internal/auth"
+	"paymentSystem/internal/handlers/respond"
+	"paymentSystem/internal/services"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type Handler struct {
+	service services.WalletService
+	logger  *slog.Logger
+}
+
+func NewHandler(service services.WalletService, logger *slog.Logger) *Handler {
+	return &Handler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// HandleCreate обрабатывает запрос на создание кошелька.
+func (h *Handler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Owner    string `json:"owner"`
+		Label    string `json:"label"`
+		Currency string `json:"currency"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Owner == "" {
+		respond.Error(w, http.StatusBadRequest, "owner is required")
+		return
+	}
+
+	wallet, err := h.service.CreateWallet(r.Context(), req.Owner, req.Label, req.Currency)
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	respond.JSON(w, http.StatusCreated, wallet)
+}
+
+// HandleGet обрабатывает запрос на получение кошелька.
+func (h *Handler) HandleGet(w http.ResponseWriter, r *http.Request) {
+	address := chi.URLParam(r, "address")
+	if err := auth.CheckWalletsRead(r.Context(), address); err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	wallet, err := h.service.GetWallet(r.Context(), address)
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, wallet)
+}
+
+// HandleList обрабатывает запрос на получение списка кошельков.
+func (h *Handler) HandleList(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid limit")
+		return
+	}
+	offset, err := queryInt(r, "offset")
+	if err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid offset")
+		return
+	}
+
+	wallets, err := h.service.ListWallets(r.Context(), limit, offset)
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	pageSize := limit
+	if pageSize == 0 {
+		pageSize = services.DefaultPageSize
+	}
+
+	// next_offset отдается, только если страница заполнена целиком
+	resp := map[string]interface{}{"wallets": wallets}
+	if len(wallets) == pageSize {
+		resp["next_offset"] = offset + len(wallets)
+	}
+	respond.JSON(w, http.StatusOK, resp)
+}
+
+// HandleClose обрабатывает запрос на закрытие кошелька.
+func (h *Handler) HandleClose(w http.ResponseWriter, r *http.Request) {
+	wallet, err := h.service.CloseWallet(r.Context(), chi.URLParam(r, "address"))
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, wallet)
+}
+
+// HandleStatement обрабатывает запрос выписки по кошельку за период.
+// Границы from и to передаются в RFC 3339 и необязательны.
+func (h *Handler) HandleStatement(w http.ResponseWriter, r *http.Request) {
+	address := chi.URLParam(r, "address")
+	if err := auth.CheckWalletsRead(r.Context(), address); err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	from, err := queryTime(r, "from")
+	if err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid from")
+		return
+	}
+	to, err := queryTime(r, "to")
+	if err != nil {
+		respond.Error(w, http.StatusBadRequest, "invalid to")
+		return
+	}
+
+	statement, err := h.service.GetStatement(r.Context(), address, from, to)
+	if err != nil {
+		respond.ServiceError(w, h.logger, err)
+		return
+	}
+
+	respond.JSON(w, http.StatusOK, statement)
+}
+
+// queryTime читает необязательный параметр времени в формате RFC 3339.
+func queryTime(r *http.Request, name string) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// queryInt читает необязательный целочисленный параметр запроса.
+func queryInt(r *http.Request, name string) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// Правила преобразования:
+// - Ошибки валидации (в т.ч. некорректный период выписки) → 400 Bad Request
+// - Нет доступа к кошельку → 403 Forbidden
+// - Кошелек не найден → 404 Not Found
+// - Кошелек уже закрыт или баланс не нулевой → 409 Conflict
+// - Клиент отменил запрос → 499 Client Closed Request
+// - Истек таймаут запроса → 504 Gateway Timeout
+// - Все остальные ошибки → 500 Internal Server Error
+
+// Формат запроса на создание:
+// {
+//   "owner": "владелец",
+//   "label": "метка",
+//   "currency": "RUB"
+// }
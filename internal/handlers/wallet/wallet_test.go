@@ -0,0 +1,232 @@
+package wallet
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"paymentSystem/internal/auth"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// mockService реализует интерфейс services.WalletService
+type mockService struct {
+	mock.Mock
+}
+
+func (m *mockService) CreateWallet(ctx context.Context, owner, label, currency string) (models.Wallet, error) {
+	args := m.Called(owner, label, currency)
+	return args.Get(0).(models.Wallet), args.Error(1)
+}
+
+func (m *mockService) GetWallet(ctx context.Context, address string) (models.Wallet, error) {
+	args := m.Called(address)
+	return args.Get(0).(models.Wallet), args.Error(1)
+}
+
+func (m *mockService) ListWallets(ctx context.Context, limit, offset int) ([]models.Wallet, error) {
+	args := m.Called(limit, offset)
+	return args.Get(0).([]models.Wallet), args.Error(1)
+}
+
+func (m *mockService) CloseWallet(ctx context.Context, address string) (models.Wallet, error) {
+	args := m.Called(address)
+	return args.Get(0).(models.Wallet), args.Error(1)
+}
+
+func (m *mockService) GetStatement(ctx context.Context, address string, from, to time.Time) (models.Statement, error) {
+	args := m.Called(address, from, to)
+	return args.Get(0).(models.Statement), args.Error(1)
+}
+
+// setupTestHandler создаёт обработчик с мок-сервисом
+func setupTestHandler() (*Handler, *mockService) {
+	mockSvc := new(mockService)
+	handler := NewHandler(mockSvc, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	return handler, mockSvc
+}
+
+// withAddress добавляет параметр {address} в контекст chi
+func withAddress(req *http.Request, address string) *http.Request {
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("address", address)
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+var testWallet = models.Wallet{
+	Address:   "0b6b4c0a-4a34-4a8a-9d38-2a7e8f1c1d11",
+	Balance:   money.New(0, "RUB"),
+	Owner:     "alice",
+	Label:     "savings",
+	CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+}
+
+func TestHandleCreate_Success(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("CreateWallet", "alice", "savings", "").Return(testWallet, nil)
+
+	req := httptest.NewRequest("POST", "/api/wallets", bytes.NewBufferString(`{"owner": "alice", "label": "savings"}`))
+	w := httptest.NewRecorder()
+
+	handler.HandleCreate(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{
+		"address": "0b6b4c0a-4a34-4a8a-9d38-2a7e8f1c1d11",
+		"balance": {"value": "0.00", "currency": "RUB"},
+		"owner": "alice",
+		"label": "savings",
+		"created_at": "2024-01-01T00:00:00Z"
+	}`, w.Body.String())
+	mockSvc.AssertExpectations(t)
+}
+
+func TestHandleCreate_OwnerRequired(t *testing.T) {
+	handler, _ := setupTestHandler()
+
+	req := httptest.NewRequest("POST", "/api/wallets", bytes.NewBufferString(`{"label": "savings"}`))
+	w := httptest.NewRecorder()
+
+	handler.HandleCreate(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error": "owner is required"}`, w.Body.String())
+}
+
+func TestHandleGet_NotFound(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("GetWallet", "missing").Return(models.Wallet{}, storage.ErrWalletNotFound)
+
+	req := withAddress(httptest.NewRequest("GET", "/api/wallets/missing", nil), "missing")
+	w := httptest.NewRecorder()
+
+	handler.HandleGet(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.JSONEq(t, `{"error": "wallet not found"}`, w.Body.String())
+}
+
+func TestHandleGet_DeadlineExceeded(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("GetWallet", "wallet-1").Return(models.Wallet{}, context.DeadlineExceeded)
+
+	req := withAddress(httptest.NewRequest("GET", "/api/wallets/wallet-1", nil), "wallet-1")
+	w := httptest.NewRecorder()
+
+	handler.HandleGet(w, req)
+
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.JSONEq(t, `{"error": "request timed out"}`, w.Body.String())
+}
+
+func TestHandleGet_Forbidden(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	req := withAddress(httptest.NewRequest("GET", "/api/wallets/wallet-2", nil), "wallet-2")
+	req = req.WithContext(auth.NewContext(req.Context(), auth.Principal{Wallets: []string{"wallet-1"}}))
+	w := httptest.NewRecorder()
+
+	handler.HandleGet(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	// тело ответа то же, что у остальных обработчиков: с недоступным кошельком
+	assert.JSONEq(t, `{"error": "forbidden: no access to wallet \"wallet-2\"", "wallet": "wallet-2"}`, w.Body.String())
+	mockSvc.AssertNotCalled(t, "GetWallet", mock.Anything)
+}
+
+func TestHandleList_NextOffset(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("ListWallets", 1, 5).Return([]models.Wallet{testWallet}, nil)
+
+	req := httptest.NewRequest("GET", "/api/wallets?limit=1&offset=5", nil)
+	w := httptest.NewRecorder()
+
+	handler.HandleList(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"next_offset":6`)
+}
+
+func TestHandleList_InvalidLimit(t *testing.T) {
+	handler, _ := setupTestHandler()
+
+	req := httptest.NewRequest("GET", "/api/wallets?limit=abc", nil)
+	w := httptest.NewRecorder()
+
+	handler.HandleList(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error": "invalid limit"}`, w.Body.String())
+}
+
+func TestHandleClose_NotEmpty(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	mockSvc.On("CloseWallet", "wallet-1").Return(models.Wallet{}, storage.ErrWalletNotEmpty)
+
+	req := withAddress(httptest.NewRequest("DELETE", "/api/wallets/wallet-1", nil), "wallet-1")
+	w := httptest.NewRecorder()
+
+	handler.HandleClose(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.JSONEq(t, `{"error": "wallet balance is not zero"}`, w.Body.String())
+}
+
+func TestHandleStatement_Success(t *testing.T) {
+	handler, mockSvc := setupTestHandler()
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	statement := models.Statement{
+		Address:        "wallet-1",
+		From:           &from,
+		OpeningBalance: money.New(10000, "RUB"),
+		Lines: []models.StatementLine{{
+			EntryID:      3,
+			Kind:         storage.EntryTransfer,
+			Direction:    storage.DirectionOut,
+			Counterparty: "wallet-2",
+			Amount:       money.New(-2500, "RUB"),
+			Balance:      money.New(7500, "RUB"),
+			Timestamp:    from.Add(time.Hour),
+		}},
+		ClosingBalance: money.New(7500, "RUB"),
+	}
+	mockSvc.On("GetStatement", "wallet-1", from, time.Time{}).Return(statement, nil)
+
+	req := withAddress(httptest.NewRequest("GET", "/api/wallet/wallet-1/statement?from=2024-01-01T00:00:00Z", nil), "wallet-1")
+	w := httptest.NewRecorder()
+
+	handler.HandleStatement(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"opening_balance":{"value":"100.00","currency":"RUB"}`)
+	assert.Contains(t, w.Body.String(), `"direction":"out"`)
+	assert.Contains(t, w.Body.String(), `"closing_balance":{"value":"75.00","currency":"RUB"}`)
+}
+
+func TestHandleStatement_InvalidPeriod(t *testing.T) {
+	handler, _ := setupTestHandler()
+
+	req := withAddress(httptest.NewRequest("GET", "/api/wallet/wallet-1/statement?to=tomorrow", nil), "wallet-1")
+	w := httptest.NewRecorder()
+
+	handler.HandleStatement(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error": "invalid to"}`, w.Body.String())
+}
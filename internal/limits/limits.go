@@ -0,0 +1,108 @@
+// Пакет limits разбирает ограничения на исходящие переводы из конфигурации
+//
+// Ограничения задаются глобально и переопределяются для отдельных
+// кошельков-отправителей: максимальная сумма одного перевода, суммы
+// переводов за сутки и за месяц и число переводов за скользящее окно.
+// Проверку по истории переводов выполняет сервис транзакций.
+package limits
+
+import (
+	"errors"
+	"fmt"
+	"paymentSystem/internal/config"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+)
+
+// ErrInvalidConfig возвращается для некорректных ограничений
+var ErrInvalidConfig = errors.New("invalid limits config")
+
+// Policy хранит разобранные ограничения. Нулевое значение ничего не ограничивает.
+type Policy struct {
+	rule      models.Limits
+	overrides map[string]models.Limits
+}
+
+// New разбирает и проверяет ограничения.
+func New(cfg config.Limits) (*Policy, error) {
+	currency := cfg.Currency
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	if _, err := money.Exponent(currency); err != nil {
+		return nil, fmt.Errorf("%w: limits.currency: %v", ErrInvalidConfig, err)
+	}
+
+	p := &Policy{overrides: make(map[string]models.Limits, len(cfg.Overrides))}
+	var err error
+	if p.rule, err = parseRule(cfg.Default, currency); err != nil {
+		return nil, fmt.Errorf("%w: limits.default: %v", ErrInvalidConfig, err)
+	}
+	for i, o := range cfg.Overrides {
+		if o.Wallet == "" {
+			return nil, fmt.Errorf("%w: limits.overrides[%d]: wallet is required", ErrInvalidConfig, i)
+		}
+		if _, ok := p.overrides[o.Wallet]; ok {
+			return nil, fmt.Errorf("%w: limits.overrides[%d]: duplicate wallet %q", ErrInvalidConfig, i, o.Wallet)
+		}
+		if p.overrides[o.Wallet], err = parseRule(o.LimitRule, currency); err != nil {
+			return nil, fmt.Errorf("%w: limits.overrides[%d]: %v", ErrInvalidConfig, i, err)
+		}
+	}
+	return p, nil
+}
+
+// Limits возвращает ограничения для переводов с кошелька from.
+func (p *Policy) Limits(from string) models.Limits {
+	if l, ok := p.overrides[from]; ok {
+		return l
+	}
+	return p.rule
+}
+
+// parseRule разбирает правило и проверяет его согласованность. Суммы
+// разбираются в валюте правила, а без нее — в currency.
+func parseRule(cfg config.LimitRule, currency string) (models.Limits, error) {
+	if cfg.Currency != "" {
+		if _, err := money.Exponent(cfg.Currency); err != nil {
+			return models.Limits{}, fmt.Errorf("currency: %w", err)
+		}
+		currency = cfg.Currency
+	}
+	l := models.Limits{Currency: currency, MaxCount: cfg.MaxCount, Window: cfg.Window}
+	var err error
+	if l.MaxAmount, err = parseAmount("max_amount", cfg.MaxAmount, currency); err != nil {
+		return models.Limits{}, err
+	}
+	if l.Daily, err = parseAmount("daily", cfg.Daily, currency); err != nil {
+		return models.Limits{}, err
+	}
+	if l.Monthly, err = parseAmount("monthly", cfg.Monthly, currency); err != nil {
+		return models.Limits{}, err
+	}
+	if l.MaxCount < 0 {
+		return models.Limits{}, errors.New("max_count must not be negative")
+	}
+	if l.Window < 0 {
+		return models.Limits{}, errors.New("window must not be negative")
+	}
+	if l.MaxCount > 0 && l.Window == 0 {
+		return models.Limits{}, errors.New("window is required with max_count")
+	}
+	return l, nil
+}
+
+// parseAmount разбирает неотрицательную сумму; пустая строка — ноль.
+func parseAmount(name, s, currency string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	m, err := money.Parse(s, currency)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", name, err)
+	}
+	if m.Amount < 0 {
+		return 0, fmt.Errorf("%s must not be negative", name)
+	}
+	return m.Amount, nil
+}
@@ -0,0 +1,96 @@
+package limits
+
+import (
+	"paymentSystem/internal/config"
+	"paymentSystem/internal/models"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimits_Default(t *testing.T) {
+	policy, err := New(config.Limits{Default: config.LimitRule{
+		MaxAmount: "1000",
+		Daily:     "5000.50",
+		Monthly:   "100000",
+		MaxCount:  10,
+		Window:    time.Hour,
+	}})
+	require.NoError(t, err)
+
+	assert.Equal(t, models.Limits{
+		Currency:  "RUB",
+		MaxAmount: 100000,
+		Daily:     500050,
+		Monthly:   10000000,
+		MaxCount:  10,
+		Window:    time.Hour,
+	}, policy.Limits("wallet-1"))
+}
+
+func TestLimits_Overrides(t *testing.T) {
+	policy, err := New(config.Limits{
+		Currency: "USD",
+		Default:  config.LimitRule{MaxAmount: "100", Daily: "500"},
+		Overrides: []config.LimitOverride{
+			{Wallet: "merchant", LimitRule: config.LimitRule{Daily: "10000"}},
+			{Wallet: "unlimited"},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, models.Limits{Currency: "USD", MaxAmount: 10000, Daily: 50000}, policy.Limits("wallet-1"))
+	// правило кошелька заменяет глобальное целиком
+	assert.Equal(t, models.Limits{Currency: "USD", Daily: 1000000}, policy.Limits("merchant"))
+	assert.Equal(t, models.Limits{Currency: "USD"}, policy.Limits("unlimited"))
+}
+
+func TestLimits_OverrideCurrency(t *testing.T) {
+	policy, err := New(config.Limits{
+		Currency: "RUB",
+		Default:  config.LimitRule{Daily: "300000"},
+		Overrides: []config.LimitOverride{
+			{Wallet: "usd-wallet", LimitRule: config.LimitRule{Currency: "USD", MaxAmount: "1000.50"}},
+			{Wallet: "jpy-wallet", LimitRule: config.LimitRule{Currency: "JPY", Daily: "100000"}},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, models.Limits{Currency: "RUB", Daily: 30000000}, policy.Limits("wallet-1"))
+	assert.Equal(t, models.Limits{Currency: "USD", MaxAmount: 100050}, policy.Limits("usd-wallet"))
+	assert.Equal(t, models.Limits{Currency: "JPY", Daily: 100000}, policy.Limits("jpy-wallet"))
+}
+
+func TestLimits_Empty(t *testing.T) {
+	policy, err := New(config.Limits{})
+	require.NoError(t, err)
+
+	assert.Equal(t, models.Limits{Currency: "RUB"}, policy.Limits("wallet-1"))
+}
+
+func TestNew_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Limits
+	}{
+		{"unknown currency", config.Limits{Currency: "XXX"}},
+		{"bad amount", config.Limits{Default: config.LimitRule{MaxAmount: "abc"}}},
+		{"too precise", config.Limits{Default: config.LimitRule{Daily: "0.001"}}},
+		{"negative", config.Limits{Default: config.LimitRule{Monthly: "-1"}}},
+		{"negative count", config.Limits{Default: config.LimitRule{MaxCount: -1, Window: time.Hour}}},
+		{"count without window", config.Limits{Default: config.LimitRule{MaxCount: 5}}},
+		{"negative window", config.Limits{Default: config.LimitRule{Window: -time.Hour}}},
+		{"override without wallet", config.Limits{Overrides: []config.LimitOverride{{}}}},
+		{"unknown override currency", config.Limits{Overrides: []config.LimitOverride{{Wallet: "a", LimitRule: config.LimitRule{Currency: "XXX", Daily: "100"}}}}},
+		{"too precise for override currency", config.Limits{Overrides: []config.LimitOverride{{Wallet: "a", LimitRule: config.LimitRule{Currency: "JPY", Daily: "0.5"}}}}},
+		{"duplicate override", config.Limits{Overrides: []config.LimitOverride{{Wallet: "a"}, {Wallet: "a"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.cfg)
+			assert.ErrorIs(t, err, ErrInvalidConfig)
+		})
+	}
+}
@@ -2,6 +2,7 @@
 package logger
 
 import (
+	"io"
 	"log/slog"
 	"os"
 )
@@ -12,15 +13,21 @@ import (
 // - Формат вывода (текстовый для разработки, JSON для production)
 // - Уровень логирования (Debug для разработки, Info для production)
 func Init(env string) *slog.Logger {
+	return New(env, os.Stdout)
+}
+
+// New создает логгер для окружения env, пишущий в w. Подкоманды используют
+// его с os.Stderr, чтобы логи не смешивались с выводом команды.
+func New(env string, w io.Writer) *slog.Logger {
 	var logger *slog.Logger
 
 	switch env {
 	case "development":
 		logger = slog.New(
-			slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug}))
+			slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}))
 	case "production":
 		logger = slog.New(
-			slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
+			slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelInfo}))
 		//JSON для обработки в продакшене
 	}
 
@@ -1,14 +1,255 @@
 // Пакет models содержит структуры данных приложения
 package models
 
+import (
+	"paymentSystem/internal/money"
+	"time"
+)
+
 type Wallet struct {
-	Address string `json:"address"`
-	Balance int    `json:"balance"`
+	Address   string      `json:"address"`
+	Balance   money.Money `json:"balance"`
+	Owner     string      `json:"owner"`
+	Label     string      `json:"label"`
+	CreatedAt time.Time   `json:"created_at"`
+	ClosedAt  *time.Time  `json:"closed_at,omitempty"`
 }
 
 type Transaction struct {
-	From      string  `json:"from"`
-	To        string  `json:"to"`
-	Amount    float64 `json:"amount"`
-	Timestamp string  `json:"timestamp"`
+	ID   int64  `json:"id"`
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Amount — сумма, списанная с отправителя, в его валюте.
+	Amount money.Money `json:"amount"`
+	// DestinationAmount — сумма, зачисленная получателю в его валюте, и
+	// Rate — примененный курс; заполняются только при конвертации.
+	DestinationAmount *money.Money `json:"destination_amount,omitempty"`
+	Rate              string       `json:"rate,omitempty"`
+	Timestamp         string       `json:"timestamp"`
+	// RefundOf — ID возвращаемой транзакции, если это возврат.
+	RefundOf *int64 `json:"refund_of,omitempty"`
+	// FeeOf — ID перевода, за который списана комиссия, если это комиссия.
+	FeeOf *int64 `json:"fee_of,omitempty"`
+	// Refunds — возвраты по транзакции; заполняется только при запросе
+	// одной транзакции.
+	Refunds []Transaction `json:"refunds,omitempty"`
+}
+
+// Credit возвращает сумму, зачисленную получателю: DestinationAmount при
+// конвертации, иначе Amount.
+func (t Transaction) Credit() money.Money {
+	if t.DestinationAmount != nil {
+		return *t.DestinationAmount
+	}
+	return t.Amount
+}
+
+// Balance — остатки кошелька. Total — учетный баланс, совпадающий с журналом
+// проводок; Available — часть, не зарезервированная активными блокировками.
+type Balance struct {
+	Total     money.Money `json:"balance"`
+	Available money.Money `json:"available"`
+}
+
+// Hold — блокировка средств (двухфазный платеж). Пока блокировка активна,
+// сумма вместе с комиссией Fee недоступна для переводов, но остается
+// в учетном балансе кошелька. При списании (capture) создается перевод
+// на кошелек Destination и списывается комиссия за него; Fee списанной
+// блокировки — взятая комиссия.
+type Hold struct {
+	ID             int64       `json:"id"`
+	Wallet         string      `json:"wallet"`
+	Destination    string      `json:"destination"`
+	Amount         money.Money `json:"amount"`
+	Fee            money.Money `json:"fee"`
+	CapturedAmount money.Money `json:"captured_amount"`
+	Status         string      `json:"status"`
+	TransactionID  *int64      `json:"transaction_id,omitempty"`
+	CreatedAt      time.Time   `json:"created_at"`
+	ExpiresAt      time.Time   `json:"expires_at"`
+}
+
+// Schedule — запланированный перевод: разовый (Cron пуст) или повторяющийся
+// по cron-выражению. Фоновая задача выполняет его, когда наступает NextRunAt.
+type Schedule struct {
+	ID        int64       `json:"id"`
+	From      string      `json:"from"`
+	To        string      `json:"to"`
+	Amount    money.Money `json:"amount"`
+	Cron      string      `json:"cron,omitempty"`
+	NextRunAt time.Time   `json:"next_run_at"`
+	Status    string      `json:"status"`
+	// Attempts — число неудачных попыток текущего запуска (для повторов).
+	Attempts  int           `json:"attempts"`
+	CreatedAt time.Time     `json:"created_at"`
+	Runs      []ScheduleRun `json:"runs,omitempty"`
+}
+
+// ScheduleRun — исход одной попытки выполнить запланированный перевод.
+type ScheduleRun struct {
+	ID            int64  `json:"id"`
+	ScheduleID    int64  `json:"schedule_id"`
+	Status        string `json:"status"`
+	TransactionID *int64 `json:"transaction_id,omitempty"`
+	Error         string `json:"error,omitempty"`
+	// ScheduledAt — срабатывание, к которому относится запуск (NextRunAt
+	// перевода на момент запуска). У перевода не бывает двух запусков
+	// с одним ScheduledAt.
+	ScheduledAt time.Time `json:"scheduled_at"`
+	ExecutedAt  time.Time `json:"executed_at"`
+}
+
+// ScheduledTransfer — успешный запуск запланированного перевода, который
+// хранилище записывает в одной транзакции с самим переводом: Schedule —
+// состояние перевода после запуска, Run — запись о запуске без TransactionID.
+type ScheduledTransfer struct {
+	Schedule Schedule
+	Run      ScheduleRun
+}
+
+// TransferRequest — перевод, в том числе один из пакета. Fee и Conversion
+// заполняет сервис по правилам комиссий и курсам валют, Check — по
+// ограничениям отправителя, Schedule — сервис запланированных переводов;
+// из запроса они не читаются.
+type TransferRequest struct {
+	From       string             `json:"from"`
+	To         string             `json:"to"`
+	Amount     money.Money        `json:"amount"`
+	Fee        *Fee               `json:"-"`
+	Conversion *Conversion        `json:"-"`
+	Check      LimitCheck         `json:"-"`
+	Schedule   *ScheduledTransfer `json:"-"`
+}
+
+// Outgoing — сводка исходящих переводов кошелька за период.
+type Outgoing struct {
+	Count int
+	// Amount — сумма переводов в минимальных единицах валюты кошелька.
+	Amount int64
+}
+
+// LimitCheck проверяет списание с кошелька по истории его переводов.
+// Хранилище вызывает ее в транзакции списания после блокировки кошелька
+// отправителя, поэтому одновременные списания одного отправителя, в том
+// числе с разных экземпляров сервиса, проверяются по очереди. outgoing
+// считает исходящие переводы отправителя с since в той же транзакции,
+// включая предыдущие переводы пакета. Ошибка отменяет списание.
+type LimitCheck func(outgoing func(since time.Time) (Outgoing, error)) error
+
+// Conversion — зачисление получателю в другой валюте: Amount в валюте
+// получателя, рассчитанная по курсу Rate.
+type Conversion struct {
+	Amount money.Money
+	Rate   string
+}
+
+// Fee — комиссия за перевод, зачисляемая на кошелек Wallet.
+type Fee struct {
+	Wallet string
+	Amount money.Money
+}
+
+// Limits — ограничения на исходящие переводы кошелька. Суммы заданы
+// в минимальных единицах валюты Currency; нулевое значение снимает
+// соответствующее ограничение.
+type Limits struct {
+	Currency  string
+	MaxAmount int64
+	Daily     int64
+	Monthly   int64
+	// MaxCount — сколько переводов разрешено за последние Window.
+	MaxCount int
+	Window   time.Duration
+}
+
+// Receipt — квитанция о выполненном переводе. Fee — транзакция комиссии,
+// если она была списана; SenderBalance учитывает и ее.
+type Receipt struct {
+	Transaction
+	Fee           *Transaction `json:"fee,omitempty"`
+	SenderBalance money.Money  `json:"sender_balance"`
+}
+
+// APIKey — ключ доступа к API. Сам ключ не хранится: хранилище держит только
+// его хеш, а клиенту ключ выдается один раз — при выпуске или ротации.
+// Prefix — начало ключа для его опознания. Ключ дает права своих ролей
+// Roles и отдельные права Permissions.
+type APIKey struct {
+	ID          int64      `json:"id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	Wallets     []string   `json:"wallets"`
+	Roles       []string   `json:"roles"`
+	Permissions []string   `json:"permissions"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RotatedAt   *time.Time `json:"rotated_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
+
+// IssuedAPIKey — выпущенный или ротированный ключ вместе с его значением.
+type IssuedAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+// IdempotencyRecord хранит результат запроса, выполненного с заголовком Idempotency-Key.
+// Status == 0 означает, что запрос еще выполняется.
+type IdempotencyRecord struct {
+	Key         string
+	Fingerprint string
+	Status      int
+	Response    []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// Posting — проводка по счету в рамках записи журнала.
+// Положительная сумма увеличивает остаток счета (кредит кошелька),
+// отрицательная — уменьшает (дебет). Сумма проводок одной записи равна нулю.
+type Posting struct {
+	Account string      `json:"account"`
+	Amount  money.Money `json:"amount"`
+}
+
+// LedgerDiscrepancy описывает кошелек, баланс которого не совпадает с суммой проводок.
+type LedgerDiscrepancy struct {
+	Address     string      `json:"address"`
+	Balance     money.Money `json:"balance"`
+	PostingsSum money.Money `json:"postings_sum"`
+}
+
+// LedgerReport — результат сверки балансов с журналом проводок.
+type LedgerReport struct {
+	WalletsChecked    int                 `json:"wallets_checked"`
+	Discrepancies     []LedgerDiscrepancy `json:"discrepancies"`
+	UnbalancedEntries []int64             `json:"unbalanced_entries"`
+}
+
+// StatementLine — строка выписки по кошельку: одна запись журнала.
+// Amount положителен для поступлений и отрицателен для списаний.
+type StatementLine struct {
+	EntryID       int64       `json:"entry_id"`
+	Kind          string      `json:"kind"`
+	TransactionID *int64      `json:"transaction_id,omitempty"`
+	Direction     string      `json:"direction"`
+	Counterparty  string      `json:"counterparty"`
+	Amount        money.Money `json:"amount"`
+	Balance       money.Money `json:"balance"`
+	Timestamp     time.Time   `json:"timestamp"`
+}
+
+// Statement — выписка по кошельку за период: остаток на начало,
+// движения с остатком после каждого и остаток на конец.
+type Statement struct {
+	Address        string          `json:"address"`
+	From           *time.Time      `json:"from,omitempty"`
+	To             *time.Time      `json:"to,omitempty"`
+	OpeningBalance money.Money     `json:"opening_balance"`
+	Lines          []StatementLine `json:"lines"`
+	ClosingBalance money.Money     `json:"closing_balance"`
+}
+
+// OK сообщает, что расхождений не найдено.
+func (r LedgerReport) OK() bool {
+	return len(r.Discrepancies) == 0 && len(r.UnbalancedEntries) == 0
 }
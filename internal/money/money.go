@@ -0,0 +1,260 @@
+// Пакет money содержит денежный тип, хранящий сумму в минимальных единицах
+// валюты (копейках, центах) вместе с кодом валюты.
+//
+// Использование целых чисел вместо float64 исключает накопление ошибок
+// округления при большом количестве переводов.
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency используется, если валюта суммы не указана явно.
+const DefaultCurrency = "RUB"
+
+var (
+	// ErrUnknownCurrency возвращается для валют, отсутствующих в справочнике
+	ErrUnknownCurrency = errors.New("unknown currency")
+
+	// ErrInvalidFormat возвращается, если сумму не удалось разобрать
+	ErrInvalidFormat = errors.New("invalid amount format")
+
+	// ErrTooPrecise возвращается, если у суммы больше знаков после запятой, чем допускает валюта
+	ErrTooPrecise = errors.New("amount has more precision than currency allows")
+
+	// ErrOverflow возвращается, если сумма не помещается в int64
+	ErrOverflow = errors.New("amount is too large")
+
+	// ErrCurrencyMismatch возвращается при операциях над суммами в разных валютах
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+)
+
+// exponents содержит количество знаков после запятой для поддерживаемых валют (ISO 4217).
+var exponents = map[string]int{
+	"RUB": 2,
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"CHF": 2,
+	"CNY": 2,
+	"KZT": 2,
+	"BYN": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"BHD": 3,
+}
+
+// Money — сумма в минимальных единицах валюты.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// New создает сумму из минимальных единиц.
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Exponent возвращает количество знаков после запятой для валюты.
+func Exponent(currency string) (int, error) {
+	exp, ok := exponents[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownCurrency, currency)
+	}
+	return exp, nil
+}
+
+// Parse разбирает десятичную строку ("10.50") в сумму указанной валюты.
+// Суммы с большей точностью, чем допускает валюта, отклоняются.
+func Parse(s, currency string) (Money, error) {
+	exp, err := Exponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	s = strings.TrimSpace(s)
+	negative := false
+	switch {
+	case strings.HasPrefix(s, "-"):
+		negative = true
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return Money{}, ErrInvalidFormat
+	}
+	if !isDigits(intPart) || !isDigits(fracPart) {
+		return Money{}, ErrInvalidFormat
+	}
+
+	fracPart = strings.TrimRight(fracPart, "0")
+	if len(fracPart) > exp {
+		return Money{}, ErrTooPrecise
+	}
+	fracPart += strings.Repeat("0", exp-len(fracPart))
+
+	digits := strings.TrimLeft(intPart+fracPart, "0")
+	if digits == "" {
+		return Money{Currency: currency}, nil
+	}
+	amount, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Money{}, ErrOverflow
+	}
+	if negative {
+		amount = -amount
+	}
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// FromFloat переводит float64 в сумму без потерь: используется кратчайшее
+// десятичное представление числа, поэтому 0.1 превращается ровно в 10 копеек.
+func FromFloat(f float64, currency string) (Money, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Money{}, ErrInvalidFormat
+	}
+	return Parse(strconv.FormatFloat(f, 'f', -1, 64), currency)
+}
+
+// RoundFloat переводит float64 в сумму, округляя до минимальных единиц
+// валюты; точная середина округляется к четному. В отличие от FromFloat
+// не отклоняет значения с накопленной погрешностью вроде 0.1+0.2.
+func RoundFloat(f float64, currency string) (Money, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Money{}, ErrInvalidFormat
+	}
+	exp, err := Exponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	return Parse(strconv.FormatFloat(f, 'f', exp, 64), currency)
+}
+
+// String возвращает сумму в виде десятичной строки без кода валюты.
+func (m Money) String() string {
+	exp, ok := exponents[m.Currency]
+	if !ok || exp == 0 {
+		return strconv.FormatInt(m.Amount, 10)
+	}
+
+	sign := ""
+	abs := uint64(m.Amount)
+	if m.Amount < 0 {
+		sign = "-"
+		abs = uint64(-m.Amount)
+	}
+	digits := strconv.FormatUint(abs, 10)
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+}
+
+// IsPositive сообщает, что сумма больше нуля.
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+// Add складывает суммы одной валюты.
+func (m Money) Add(other Money) (Money, error) {
+	if m.Currency != other.Currency {
+		return Money{}, ErrCurrencyMismatch
+	}
+	sum := m.Amount + other.Amount
+	if (other.Amount > 0 && sum < m.Amount) || (other.Amount < 0 && sum > m.Amount) {
+		return Money{}, ErrOverflow
+	}
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+// Sub вычитает сумму той же валюты.
+func (m Money) Sub(other Money) (Money, error) {
+	return m.Add(Money{Amount: -other.Amount, Currency: other.Currency})
+}
+
+type jsonMoney struct {
+	Value    json.RawMessage `json:"value"`
+	Currency string          `json:"currency"`
+}
+
+// MarshalJSON кодирует сумму как {"value": "10.50", "currency": "RUB"}.
+// Значение передается строкой, чтобы клиенты не теряли точность на float.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Value    string `json:"value"`
+		Currency string `json:"currency"`
+	}{m.String(), m.Currency})
+}
+
+// UnmarshalJSON принимает объект {"value": ..., "currency": ...}, а также
+// число или строку — в этом случае используется DefaultCurrency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	currency := DefaultCurrency
+	raw := data
+
+	if len(data) > 0 && data[0] == '{' {
+		var obj jsonMoney
+		if err := json.Unmarshal(data, &obj); err != nil {
+			return ErrInvalidFormat
+		}
+		if obj.Currency != "" {
+			currency = strings.ToUpper(obj.Currency)
+		}
+		raw = obj.Value
+	}
+
+	value, err := decodeValue(raw)
+	if err != nil {
+		return err
+	}
+	parsed, err := Parse(value, currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// decodeValue извлекает десятичную запись из JSON-числа или JSON-строки.
+func decodeValue(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 {
+		return "", ErrInvalidFormat
+	}
+	if raw[0] == '"' {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return "", ErrInvalidFormat
+		}
+		return s, nil
+	}
+
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return "", ErrInvalidFormat
+	}
+	s := n.String()
+	if strings.ContainsAny(s, "eE") {
+		return "", ErrInvalidFormat
+	}
+	return s, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
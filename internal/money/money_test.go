@@ -0,0 +1,113 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    string
+		currency string
+		expected int64
+		err      error
+	}{
+		{"integer", "100", "RUB", 10000, nil},
+		{"fraction", "10.5", "RUB", 1050, nil},
+		{"trailing zeros", "10.500", "RUB", 1050, nil},
+		{"negative", "-0.01", "RUB", -1, nil},
+		{"zero exponent", "150", "JPY", 150, nil},
+		{"three digits", "1.234", "KWD", 1234, nil},
+		{"too precise", "10.005", "RUB", 0, ErrTooPrecise},
+		{"too precise for JPY", "1.5", "JPY", 0, ErrTooPrecise},
+		{"garbage", "ten", "RUB", 0, ErrInvalidFormat},
+		{"empty", "", "RUB", 0, ErrInvalidFormat},
+		{"unknown currency", "1", "XXX", 0, ErrUnknownCurrency},
+		{"overflow", "99999999999999999999", "RUB", 0, ErrOverflow},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := Parse(tc.input, tc.currency)
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, New(tc.expected, tc.currency), m)
+		})
+	}
+}
+
+func TestFromFloat_Lossless(t *testing.T) {
+	a, b := 0.1, 0.2
+	_, err := FromFloat(a+b, "RUB") // 0.30000000000000004
+	assert.ErrorIs(t, err, ErrTooPrecise)
+
+	m, err := FromFloat(33.33, "RUB")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3333), m.Amount)
+}
+
+func TestRoundFloat(t *testing.T) {
+	testCases := []struct {
+		name     string
+		input    float64
+		currency string
+		expected int64
+	}{
+		{"drift", 0.1 + 0.2, "RUB", 30},
+		{"below minor unit", 10.000000001, "RUB", 1000},
+		{"exact", 33.33, "RUB", 3333},
+		{"half to even", 0.125, "RUB", 12},
+		{"negative", -0.015000001, "RUB", -2},
+		{"zero exponent", 149.6, "JPY", 150},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m, err := RoundFloat(tc.input, tc.currency)
+			require.NoError(t, err)
+			assert.Equal(t, New(tc.expected, tc.currency), m)
+		})
+	}
+
+	_, err := RoundFloat(1e20, "RUB")
+	assert.ErrorIs(t, err, ErrOverflow)
+}
+
+func TestString(t *testing.T) {
+	assert.Equal(t, "100.00", New(10000, "RUB").String())
+	assert.Equal(t, "0.05", New(5, "RUB").String())
+	assert.Equal(t, "-1.50", New(-150, "RUB").String())
+	assert.Equal(t, "150", New(150, "JPY").String())
+	assert.Equal(t, "0.001", New(1, "KWD").String())
+}
+
+func TestJSON(t *testing.T) {
+	data, err := json.Marshal(New(1050, "RUB"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"value": "10.50", "currency": "RUB"}`, string(data))
+
+	var m Money
+	require.NoError(t, json.Unmarshal([]byte(`{"value": "10.50", "currency": "usd"}`), &m))
+	assert.Equal(t, New(1050, "USD"), m)
+
+	require.NoError(t, json.Unmarshal([]byte(`10.5`), &m))
+	assert.Equal(t, New(1050, DefaultCurrency), m)
+
+	require.NoError(t, json.Unmarshal([]byte(`"7"`), &m))
+	assert.Equal(t, New(700, DefaultCurrency), m)
+
+	assert.ErrorIs(t, json.Unmarshal([]byte(`1e3`), &m), ErrInvalidFormat)
+	assert.ErrorIs(t, json.Unmarshal([]byte(`0.001`), &m), ErrTooPrecise)
+}
+
+func TestAdd_CurrencyMismatch(t *testing.T) {
+	_, err := New(1, "RUB").Add(New(1, "USD"))
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+}
@@ -0,0 +1,347 @@
+// Пакет ratelimit ограничивает частоту запросов к API
+//
+// Ограничение — маркерная корзина (token bucket): каждому ключу доступно
+// burst запросов подряд, после чего корзина пополняется равномерно со
+// скоростью rate запросов за period. Правила задаются для маршрутов и
+// ограничивают вызывающего, IP-адрес или кошелек-отправитель. Правила по
+// IP проверяются до аутентификации (BeforeAuth), по вызывающему — после нее
+// (AfterAuth), по кошельку — после проверки доступа вызывающего к кошельку
+// (AfterOwnership): иначе чужой кошелек в теле запроса расходовал бы
+// корзину владельца. Корзины хранятся в памяти процесса.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"paymentSystem/internal/config"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidConfig возвращается для некорректных правил
+var ErrInvalidConfig = errors.New("invalid rate limit config")
+
+// ErrLimited возвращается для запроса сверх ограничения
+var ErrLimited = errors.New("rate limit exceeded")
+
+// LimitError — запрос отклонен ограничением частоты; повторить его можно
+// через RetryAfter.
+type LimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return ErrLimited.Error()
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimited
+}
+
+// purgeInterval — как часто удаляются заполненные корзины
+const purgeInterval = time.Minute
+
+// Stage — этап обработки запроса, на котором проверяются правила.
+type Stage int
+
+const (
+	// BeforeAuth — до проверки подписи и аутентификации: правила по IP,
+	// чтобы ограничивать и запросы, которые будут отклонены с 401.
+	BeforeAuth Stage = iota
+	// AfterAuth — после аутентификации: правила по вызывающему.
+	AfterAuth
+	// AfterOwnership — после проверки доступа вызывающего к кошелькам-
+	// отправителям: правила по кошельку. Проверку запускает сервис через
+	// AllowWallets.
+	AfterOwnership
+)
+
+// Request описывает запрос для проверки ограничений.
+type Request struct {
+	// Stage выбирает проверяемые правила.
+	Stage  Stage
+	Method string
+	Path   string
+	// Client — вызывающий; пустой без аутентификации.
+	Client string
+	IP     string
+	// Wallets — кошельки-отправители, доступ к которым уже проверен.
+	Wallets []string
+}
+
+// Decision — результат проверки. Limit, Remaining и Reset описывают
+// самую исчерпанную из корзин запроса; нулевой Limit означает, что
+// запрос не попал ни под одно правило.
+type Decision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset — через сколько корзина наполнится целиком.
+	Reset time.Duration
+	// RetryAfter — через сколько можно повторить отклоненный запрос.
+	RetryAfter time.Duration
+}
+
+// Limiter проверяет запросы по правилам. Нулевое значение ничего не ограничивает.
+type Limiter struct {
+	rules []rule
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	nextPurge time.Time
+	now       func() time.Time
+}
+
+// rule — разобранное правило. Пустой method — любой метод, nil segments —
+// любой путь.
+type rule struct {
+	method   string
+	segments []string
+	by       string
+	rate     float64 // запросов в секунду
+	burst    int
+}
+
+// bucket — корзина ключа на момент updated.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	rule    *rule
+}
+
+// New разбирает и проверяет правила.
+func New(cfg config.RateLimit) (*Limiter, error) {
+	l := &Limiter{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+	for i, c := range cfg.Rules {
+		r, err := parseRule(c)
+		if err != nil {
+			return nil, fmt.Errorf("%w: rate_limit.rules[%d]: %v", ErrInvalidConfig, i, err)
+		}
+		l.rules = append(l.rules, r)
+	}
+	return l, nil
+}
+
+// parseRule разбирает маршрут, ключ и скорость правила.
+func parseRule(cfg config.RateLimitRule) (rule, error) {
+	r := rule{by: cfg.By, burst: cfg.Burst}
+
+	method, path, ok := strings.Cut(strings.TrimSpace(cfg.Route), " ")
+	if !ok {
+		method, path = "*", method
+	}
+	path = strings.TrimSpace(path)
+	switch {
+	case path == "*":
+	case strings.HasPrefix(path, "/"):
+		r.segments = strings.Split(strings.Trim(path, "/"), "/")
+	default:
+		return rule{}, fmt.Errorf("route %q must be \"METHOD /path\" or \"*\"", cfg.Route)
+	}
+	if method != "*" {
+		r.method = strings.ToUpper(method)
+	}
+
+	switch {
+	case cfg.By != config.RateLimitByClient && cfg.By != config.RateLimitByIP && cfg.By != config.RateLimitByWallet:
+		return rule{}, fmt.Errorf("unknown by %q, expected client, ip or wallet", cfg.By)
+	case cfg.Rate <= 0:
+		return rule{}, errors.New("rate must be positive")
+	case cfg.Period <= 0:
+		return rule{}, errors.New("period must be positive")
+	case cfg.Burst < 0:
+		return rule{}, errors.New("burst must not be negative")
+	}
+	if r.burst == 0 {
+		r.burst = cfg.Rate
+	}
+	r.rate = float64(cfg.Rate) / cfg.Period.Seconds()
+	return r, nil
+}
+
+// Enabled сообщает, что задано хотя бы одно правило.
+func (l *Limiter) Enabled() bool {
+	return len(l.rules) > 0
+}
+
+// NeedsWallets сообщает, что к запросу method path применяется правило
+// по кошельку и сервису нужно передать AllowWallets.
+func (l *Limiter) NeedsWallets(method, path string) bool {
+	for i := range l.rules {
+		if l.rules[i].by == config.RateLimitByWallet && l.rules[i].matches(method, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allow проверяет запрос по подходящим правилам его этапа. Запрос расходует
+// по одному маркеру из каждой своей корзины и только если маркеров хватает
+// во всех; отклоненный запрос корзины не расходует.
+func (l *Limiter) Allow(req Request) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.purge(now)
+
+	var buckets []*bucket
+	for i := range l.rules {
+		r := &l.rules[i]
+		if r.stage() != req.Stage || !r.matches(req.Method, req.Path) {
+			continue
+		}
+		for _, key := range r.keys(req) {
+			key = strconv.Itoa(i) + "/" + key
+			b, ok := l.buckets[key]
+			if !ok {
+				b = &bucket{tokens: float64(r.burst), updated: now, rule: r}
+				l.buckets[key] = b
+			}
+			b.refill(now)
+			if !slices.Contains(buckets, b) {
+				buckets = append(buckets, b)
+			}
+		}
+	}
+	if len(buckets) == 0 {
+		return Decision{Allowed: true}
+	}
+
+	d := Decision{Allowed: true}
+	for _, b := range buckets {
+		if b.tokens < 1 {
+			d.Allowed = false
+			d.RetryAfter = max(d.RetryAfter, b.rule.duration(1-b.tokens))
+		}
+	}
+	if d.Allowed {
+		for _, b := range buckets {
+			b.tokens--
+		}
+	}
+
+	// заголовки описывают корзину с наименьшим остатком
+	tightest := buckets[0]
+	for _, b := range buckets[1:] {
+		if b.tokens < tightest.tokens {
+			tightest = b
+		}
+	}
+	d.Limit = tightest.rule.burst
+	d.Remaining = max(0, int(math.Floor(tightest.tokens)))
+	d.Reset = tightest.rule.duration(float64(tightest.rule.burst) - tightest.tokens)
+	return d
+}
+
+// purge удаляет корзины, которые уже наполнились: новая корзина
+// создается полной, поэтому они ничем от нее не отличаются.
+func (l *Limiter) purge(now time.Time) {
+	if now.Before(l.nextPurge) {
+		return
+	}
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.rule.burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.nextPurge = now.Add(purgeInterval)
+}
+
+// refill пополняет корзину за время с прошлого обращения.
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = min(float64(b.rule.burst), b.tokens+elapsed.Seconds()*b.rule.rate)
+		b.updated = now
+	}
+}
+
+// stage возвращает этап, на котором проверяется правило.
+func (r *rule) stage() Stage {
+	switch r.by {
+	case config.RateLimitByIP:
+		return BeforeAuth
+	case config.RateLimitByWallet:
+		return AfterOwnership
+	default:
+		return AfterAuth
+	}
+}
+
+// matches сообщает, что правило применяется к запросу method path.
+// Сегмент шаблона вида {id} совпадает с любым непустым сегментом пути.
+func (r *rule) matches(method, path string) bool {
+	if r.method != "" && r.method != method {
+		return false
+	}
+	if r.segments == nil {
+		return true
+	}
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) != len(r.segments) {
+		return false
+	}
+	for i, s := range r.segments {
+		isParam := strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}")
+		if (isParam && segments[i] == "") || (!isParam && s != segments[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// keys возвращает ключи корзин запроса по правилу: без кошельков правило
+// по кошельку к запросу не применяется.
+func (r *rule) keys(req Request) []string {
+	switch r.by {
+	case config.RateLimitByClient:
+		if req.Client != "" {
+			return []string{"client:" + req.Client}
+		}
+		return []string{"ip:" + req.IP}
+	case config.RateLimitByIP:
+		return []string{"ip:" + req.IP}
+	default:
+		keys := make([]string, 0, len(req.Wallets))
+		for _, w := range req.Wallets {
+			if w != "" {
+				keys = append(keys, "wallet:"+w)
+			}
+		}
+		return keys
+	}
+}
+
+// duration возвращает время, за которое в корзину поступит tokens маркеров.
+func (r *rule) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / r.rate * float64(time.Second))
+}
+
+type walletsKey struct{}
+
+// WithWallets возвращает контекст, в котором AllowWallets проверяет
+// кошельки-отправители функцией allow.
+func WithWallets(ctx context.Context, allow func(wallets []string) error) context.Context {
+	return context.WithValue(ctx, walletsKey{}, allow)
+}
+
+// AllowWallets проверяет кошельки-отправители по правилам этапа
+// AfterOwnership. Сервис вызывает ее, когда доступ вызывающего к кошелькам
+// уже проверен и перед тем, как списать средства. Без функции в контексте
+// (ограничения выключены, фоновая задача) возвращает nil.
+func AllowWallets(ctx context.Context, wallets ...string) error {
+	allow, ok := ctx.Value(walletsKey{}).(func(wallets []string) error)
+	if !ok || len(wallets) == 0 {
+		return nil
+	}
+	return allow(wallets)
+}
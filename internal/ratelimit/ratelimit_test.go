@@ -0,0 +1,188 @@
+package ratelimit
+
+import (
+	"context"
+	"paymentSystem/internal/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testNow = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func newLimiter(t *testing.T, rules ...config.RateLimitRule) (*Limiter, *time.Time) {
+	t.Helper()
+	l, err := New(config.RateLimit{Rules: rules})
+	require.NoError(t, err)
+	now := testNow
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func send(client string, wallets ...string) Request {
+	return Request{Stage: AfterAuth, Method: "POST", Path: "/api/send", Client: client, IP: "10.0.0.1", Wallets: wallets}
+}
+
+// sendFrom — перевод с кошельков, доступ к которым уже проверен
+func sendFrom(wallets ...string) Request {
+	return Request{Stage: AfterOwnership, Method: "POST", Path: "/api/send", Client: "apikey:1", IP: "10.0.0.1", Wallets: wallets}
+}
+
+func TestAllowWallets(t *testing.T) {
+	// без проверки в контексте кошельки не ограничиваются
+	assert.NoError(t, AllowWallets(context.Background(), "wallet-1"))
+
+	var got []string
+	ctx := WithWallets(context.Background(), func(wallets []string) error {
+		got = wallets
+		return &LimitError{RetryAfter: time.Second}
+	})
+	err := AllowWallets(ctx, "wallet-1", "wallet-2")
+	assert.ErrorIs(t, err, ErrLimited)
+	assert.Equal(t, []string{"wallet-1", "wallet-2"}, got)
+}
+
+func TestAllow_TokenBucket(t *testing.T) {
+	l, now := newLimiter(t, config.RateLimitRule{Route: "POST /api/send", By: config.RateLimitByClient, Rate: 2, Period: time.Second, Burst: 3})
+
+	for i := 2; i >= 0; i-- {
+		d := l.Allow(send("apikey:1"))
+		require.True(t, d.Allowed)
+		assert.Equal(t, 3, d.Limit)
+		assert.Equal(t, i, d.Remaining)
+	}
+
+	d := l.Allow(send("apikey:1"))
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 500*time.Millisecond, d.RetryAfter)
+	assert.Equal(t, 1500*time.Millisecond, d.Reset)
+
+	// у другого вызывающего своя корзина
+	assert.True(t, l.Allow(send("apikey:2")).Allowed)
+
+	// за полсекунды корзина пополняется одним маркером
+	*now = now.Add(500 * time.Millisecond)
+	assert.True(t, l.Allow(send("apikey:1")).Allowed)
+	assert.False(t, l.Allow(send("apikey:1")).Allowed)
+}
+
+func TestAllow_AllBucketsMustAllow(t *testing.T) {
+	l, _ := newLimiter(t,
+		config.RateLimitRule{Route: "POST /api/send", By: config.RateLimitByClient, Rate: 10, Period: time.Second},
+		config.RateLimitRule{Route: "POST /api/send", By: config.RateLimitByWallet, Rate: 1, Period: time.Minute},
+	)
+
+	assert.True(t, l.Allow(sendFrom("wallet-1")).Allowed)
+
+	d := l.Allow(sendFrom("wallet-1", "wallet-2"))
+	assert.False(t, d.Allowed)
+	assert.Equal(t, time.Minute, d.RetryAfter)
+	// отклоненный запрос не расходует корзины: wallet-2 еще доступен
+	assert.True(t, l.Allow(sendFrom("wallet-2")).Allowed)
+
+	// до проверки доступа правило по кошельку не применяется, а правило
+	// по вызывающему — после нее
+	d = l.Allow(send("apikey:1", "wallet-1"))
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 10, d.Limit)
+	assert.Equal(t, 9, d.Remaining)
+}
+
+func TestAllow_ClientFallsBackToIP(t *testing.T) {
+	l, _ := newLimiter(t, config.RateLimitRule{Route: "*", By: config.RateLimitByClient, Rate: 1, Period: time.Second})
+
+	assert.True(t, l.Allow(send("")).Allowed)
+	assert.False(t, l.Allow(send("")).Allowed)
+	assert.True(t, l.Allow(send("apikey:1")).Allowed)
+}
+
+func TestAllow_RouteMatching(t *testing.T) {
+	l, _ := newLimiter(t,
+		config.RateLimitRule{Route: "POST /api/transactions/{id}/refund", By: config.RateLimitByIP, Rate: 1, Period: time.Second},
+		config.RateLimitRule{Route: "/api/rates", By: config.RateLimitByIP, Rate: 1, Period: time.Second},
+	)
+
+	tests := []struct {
+		method, path string
+		limited      bool
+	}{
+		{"POST", "/api/transactions/42/refund", true},
+		{"GET", "/api/transactions/42/refund", false},
+		{"POST", "/api/transactions//refund", false},
+		{"POST", "/api/transactions/42", false},
+		{"GET", "/api/rates", true},
+		{"PUT", "/api/rates/", true},
+	}
+	for _, tt := range tests {
+		d := l.Allow(Request{Method: tt.method, Path: tt.path, IP: "10.0.0.1"})
+		assert.Equal(t, tt.limited, d.Limit > 0, tt.method+" "+tt.path)
+	}
+}
+
+func TestAllow_Stages(t *testing.T) {
+	l, _ := newLimiter(t,
+		config.RateLimitRule{Route: "*", By: config.RateLimitByIP, Rate: 1, Period: time.Second},
+		config.RateLimitRule{Route: "*", By: config.RateLimitByClient, Rate: 2, Period: time.Second},
+	)
+	ip := Request{Stage: BeforeAuth, Method: "POST", Path: "/api/send", IP: "10.0.0.1"}
+
+	// до аутентификации проверяется только правило по IP
+	d := l.Allow(ip)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 1, d.Limit)
+	assert.False(t, l.Allow(ip).Allowed)
+
+	// после — только по вызывающему: корзина IP уже пуста
+	d = l.Allow(send("apikey:1"))
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 2, d.Limit)
+}
+
+func TestNeedsWallets(t *testing.T) {
+	l, _ := newLimiter(t, config.RateLimitRule{Route: "POST /api/send/batch", By: config.RateLimitByWallet, Rate: 1, Period: time.Second})
+
+	assert.True(t, l.NeedsWallets("POST", "/api/send/batch"))
+	assert.False(t, l.NeedsWallets("POST", "/api/send"))
+}
+
+func TestPurge(t *testing.T) {
+	l, now := newLimiter(t, config.RateLimitRule{Route: "*", By: config.RateLimitByIP, Rate: 1, Period: time.Second})
+
+	l.Allow(Request{IP: "10.0.0.1"})
+	l.Allow(Request{IP: "10.0.0.2"})
+	require.Len(t, l.buckets, 2)
+
+	*now = now.Add(2 * purgeInterval)
+	l.Allow(Request{IP: "10.0.0.3"})
+	assert.Len(t, l.buckets, 1)
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	valid := config.RateLimitRule{Route: "POST /api/send", By: config.RateLimitByClient, Rate: 1, Period: time.Second}
+
+	tests := []struct {
+		name   string
+		modify func(*config.RateLimitRule)
+	}{
+		{"relative path", func(r *config.RateLimitRule) { r.Route = "POST api/send" }},
+		{"unknown by", func(r *config.RateLimitRule) { r.By = "user" }},
+		{"zero rate", func(r *config.RateLimitRule) { r.Rate = 0 }},
+		{"zero period", func(r *config.RateLimitRule) { r.Period = 0 }},
+		{"negative burst", func(r *config.RateLimitRule) { r.Burst = -1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := valid
+			tt.modify(&rule)
+			_, err := New(config.RateLimit{Rules: []config.RateLimitRule{rule}})
+			assert.ErrorIs(t, err, ErrInvalidConfig)
+		})
+	}
+
+	l, err := New(config.RateLimit{})
+	require.NoError(t, err)
+	assert.False(t, l.Enabled())
+	assert.True(t, l.Allow(send("apikey:1")).Allowed)
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"paymentSystem/internal/auth"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/storage"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxAPIKeyNameLength ограничивает длину названия API-ключа
+const maxAPIKeyNameLength = 100
+
+var (
+	// ErrInvalidAPIKey возвращается для некорректных параметров выпуска ключа
+	ErrInvalidAPIKey = errors.New("invalid api key request")
+
+	// ErrUnauthenticated возвращается для отсутствующего, неизвестного
+	// или отозванного ключа
+	ErrUnauthenticated = errors.New("missing or invalid api key")
+)
+
+type APIKeyService interface {
+	// IssueKey выпускает ключ с доступом к кошелькам wallets (auth.AllWallets —
+	// ко всем), ролями roles и правами permissions. Значение ключа
+	// возвращается только здесь.
+	IssueKey(ctx context.Context, name string, wallets, roles, permissions []string) (models.IssuedAPIKey, error)
+	ListKeys(ctx context.Context) ([]models.APIKey, error)
+	// RotateKey выпускает новое значение ключа; прежнее сразу перестает действовать.
+	RotateKey(ctx context.Context, id int64) (models.IssuedAPIKey, error)
+	RevokeKey(ctx context.Context, id int64) (models.APIKey, error)
+	// Authenticate находит действующий ключ по значению и возвращает
+	// вызывающего с правами его ролей.
+	Authenticate(ctx context.Context, key string) (auth.Principal, error)
+}
+
+type apiKeyService struct {
+	storage storage.Storage
+	roles   auth.Roles
+	logger  *slog.Logger
+}
+
+func NewAPIKeyService(storage storage.Storage, roles auth.Roles, logger *slog.Logger) APIKeyService {
+	return &apiKeyService{
+		storage: storage,
+		roles:   roles,
+		logger:  logger,
+	}
+}
+
+// IssueKey реализует метод интерфейса для выпуска API-ключа.
+func (s *apiKeyService) IssueKey(ctx context.Context, name string, wallets, roles, permissions []string) (models.IssuedAPIKey, error) {
+	if err := s.validateKey(ctx, name, wallets, roles, permissions); err != nil {
+		return models.IssuedAPIKey{}, err
+	}
+
+	value, err := auth.GenerateKey()
+	if err != nil {
+		s.logger.Error("failed to generate api key", "err", err)
+		return models.IssuedAPIKey{}, ErrInternalError
+	}
+	key, err := s.storage.CreateAPIKey(ctx, models.APIKey{
+		Name:        name,
+		Prefix:      auth.DisplayPrefix(value),
+		Wallets:     slices.Compact(slices.Sorted(slices.Values(wallets))),
+		Roles:       slices.Compact(slices.Sorted(slices.Values(roles))),
+		Permissions: slices.Compact(slices.Sorted(slices.Values(permissions))),
+		CreatedAt:   time.Now().UTC(),
+	}, auth.HashKey(value))
+	if err != nil {
+		return models.IssuedAPIKey{}, s.handleStorageError(err)
+	}
+
+	s.logger.Info("api key issued",
+		"id", key.ID,
+		"name", key.Name,
+		"prefix", key.Prefix,
+		"roles", strings.Join(key.Roles, ","),
+		"permissions", strings.Join(key.Permissions, ","),
+	)
+	return models.IssuedAPIKey{APIKey: key, Key: value}, nil
+}
+
+// validateKey проверяет название, кошельки, роли и права нового ключа.
+func (s *apiKeyService) validateKey(ctx context.Context, name string, wallets, roles, permissions []string) error {
+	var err error
+	switch {
+	case name == "" || len(name) > maxAPIKeyNameLength:
+		err = fmt.Errorf("%w: name must be 1 to %d characters", ErrInvalidAPIKey, maxAPIKeyNameLength)
+	case len(wallets) == 0:
+		err = fmt.Errorf("%w: at least one wallet is required", ErrInvalidAPIKey)
+	case len(roles) == 0 && len(permissions) == 0:
+		err = fmt.Errorf("%w: at least one role or permission is required", ErrInvalidAPIKey)
+	}
+	for _, r := range roles {
+		if err == nil && !s.roles.Valid(r) {
+			err = fmt.Errorf("%w: unknown role %q", ErrInvalidAPIKey, r)
+		}
+	}
+	for _, p := range permissions {
+		if err == nil && !auth.ValidPermission(p) {
+			err = fmt.Errorf("%w: unknown permission %q", ErrInvalidAPIKey, p)
+		}
+	}
+	if err != nil {
+		s.logger.Warn("invalid api key request", "err", err)
+		return err
+	}
+
+	for _, address := range wallets {
+		if address == auth.AllWallets {
+			continue
+		}
+		if _, err := s.storage.GetWallet(ctx, address); err != nil {
+			return s.handleStorageError(err)
+		}
+	}
+	return nil
+}
+
+// ListKeys реализует метод интерфейса для получения списка ключей.
+func (s *apiKeyService) ListKeys(ctx context.Context) ([]models.APIKey, error) {
+	keys, err := s.storage.ListAPIKeys(ctx)
+	if err != nil {
+		return nil, s.handleStorageError(err)
+	}
+	return keys, nil
+}
+
+// RotateKey реализует метод интерфейса для ротации ключа.
+func (s *apiKeyService) RotateKey(ctx context.Context, id int64) (models.IssuedAPIKey, error) {
+	value, err := auth.GenerateKey()
+	if err != nil {
+		s.logger.Error("failed to generate api key", "err", err)
+		return models.IssuedAPIKey{}, ErrInternalError
+	}
+	key, err := s.storage.RotateAPIKey(ctx, id, auth.HashKey(value), auth.DisplayPrefix(value), time.Now().UTC())
+	if err != nil {
+		return models.IssuedAPIKey{}, s.handleStorageError(err)
+	}
+
+	s.logger.Info("api key rotated", "id", key.ID, "name", key.Name, "prefix", key.Prefix)
+	return models.IssuedAPIKey{APIKey: key, Key: value}, nil
+}
+
+// RevokeKey реализует метод интерфейса для отзыва ключа.
+func (s *apiKeyService) RevokeKey(ctx context.Context, id int64) (models.APIKey, error) {
+	key, err := s.storage.RevokeAPIKey(ctx, id, time.Now().UTC())
+	if err != nil {
+		return models.APIKey{}, s.handleStorageError(err)
+	}
+
+	s.logger.Info("api key revoked", "id", key.ID, "name", key.Name)
+	return key, nil
+}
+
+// Authenticate реализует метод интерфейса для проверки ключа.
+func (s *apiKeyService) Authenticate(ctx context.Context, value string) (auth.Principal, error) {
+	if !strings.HasPrefix(value, auth.KeyPrefix) {
+		return auth.Principal{}, ErrUnauthenticated
+	}
+
+	key, err := s.storage.GetAPIKeyByHash(ctx, auth.HashKey(value))
+	if errors.Is(err, storage.ErrAPIKeyNotFound) {
+		s.logger.Warn("unknown api key", "prefix", auth.DisplayPrefix(value))
+		return auth.Principal{}, ErrUnauthenticated
+	}
+	if err != nil {
+		return auth.Principal{}, s.handleStorageError(err)
+	}
+	if key.RevokedAt != nil {
+		s.logger.Warn("revoked api key used", "id", key.ID, "prefix", key.Prefix)
+		return auth.Principal{}, ErrUnauthenticated
+	}
+
+	return s.roles.Grant(auth.Principal{
+		Subject:     "apikey:" + strconv.FormatInt(key.ID, 10),
+		Wallets:     key.Wallets,
+		Roles:       key.Roles,
+		Permissions: key.Permissions,
+	}), nil
+}
+
+// handleStorageError преобразует ошибки хранилища в бизнес-ошибки.
+func (s *apiKeyService) handleStorageError(err error) error {
+	switch {
+	case contextError(err) != nil:
+		s.logger.Warn("request aborted", "err", err)
+		return contextError(err)
+	case errors.Is(err, storage.ErrAPIKeyNotFound),
+		errors.Is(err, storage.ErrAPIKeyRevoked),
+		errors.Is(err, storage.ErrWalletNotFound):
+		s.logger.Warn("api key operation rejected", "err", err)
+		return err
+	default:
+		s.logger.Error("unexpected storage error", "err", err)
+		return ErrInternalError
+	}
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"bytes"
+	"log/slog"
+	"paymentSystem/internal/auth"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/storage"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupAPIKeyService создаёт сервис API-ключей с моком хранилища
+func setupAPIKeyService() (APIKeyService, *mockStorage) {
+	mock := &mockStorage{}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	return NewAPIKeyService(mock, auth.DefaultRoles(), logger), mock
+}
+
+func TestIssueKey_Success(t *testing.T) {
+	service, mock := setupAPIKeyService()
+	mock.getWalletFn = walletsIn(map[string]string{"wallet-1": "RUB"})
+	var storedHash string
+	mock.createAPIKeyFn = func(key models.APIKey, hash string) (models.APIKey, error) {
+		storedHash = hash
+		key.ID = 7
+		return key, nil
+	}
+
+	issued, err := service.IssueKey(ctx, "merchant", []string{"wallet-1"}, []string{auth.RoleCustomer}, []string{auth.PermissionSend, auth.PermissionBalanceRead, auth.PermissionSend})
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), issued.ID)
+	assert.True(t, strings.HasPrefix(issued.Key, auth.KeyPrefix))
+	assert.Equal(t, auth.DisplayPrefix(issued.Key), issued.Prefix)
+	// хранится только хеш ключа
+	assert.Equal(t, auth.HashKey(issued.Key), storedHash)
+	assert.Equal(t, []string{auth.RoleCustomer}, issued.Roles)
+	assert.Equal(t, []string{auth.PermissionBalanceRead, auth.PermissionSend}, issued.Permissions)
+}
+
+func TestIssueKey_Invalid(t *testing.T) {
+	service, mock := setupAPIKeyService()
+	mock.getWalletFn = walletsIn(map[string]string{"wallet-1": "RUB"})
+
+	tests := []struct {
+		name        string
+		keyName     string
+		wallets     []string
+		roles       []string
+		permissions []string
+		err         error
+	}{
+		{"no name", "", []string{"wallet-1"}, nil, []string{auth.PermissionSend}, ErrInvalidAPIKey},
+		{"no wallets", "k", nil, nil, []string{auth.PermissionSend}, ErrInvalidAPIKey},
+		{"no roles and permissions", "k", []string{"wallet-1"}, nil, nil, ErrInvalidAPIKey},
+		{"unknown role", "k", []string{"wallet-1"}, []string{"superuser"}, nil, ErrInvalidAPIKey},
+		{"unknown permission", "k", []string{"wallet-1"}, nil, []string{"withdraw"}, ErrInvalidAPIKey},
+		{"unknown wallet", "k", []string{"wallet-2"}, nil, []string{auth.PermissionSend}, storage.ErrWalletNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.IssueKey(ctx, tt.keyName, tt.wallets, tt.roles, tt.permissions)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	service, mock := setupAPIKeyService()
+	var storedHash string
+	mock.rotateAPIKeyFn = func(id int64, hash, prefix string) (models.APIKey, error) {
+		storedHash = hash
+		return models.APIKey{ID: id, Prefix: prefix}, nil
+	}
+
+	rotated, err := service.RotateKey(ctx, 7)
+
+	require.NoError(t, err)
+	assert.Equal(t, auth.HashKey(rotated.Key), storedHash)
+	assert.Equal(t, auth.DisplayPrefix(rotated.Key), rotated.Prefix)
+}
+
+func TestAuthenticate(t *testing.T) {
+	service, mock := setupAPIKeyService()
+	revokedAt := time.Now()
+	keys := map[string]models.APIKey{
+		auth.HashKey("psk_active"):  {ID: 1, Wallets: []string{"wallet-1"}, Roles: []string{auth.RoleAuditor}, Permissions: []string{auth.PermissionSend}},
+		auth.HashKey("psk_revoked"): {ID: 2, RevokedAt: &revokedAt},
+	}
+	mock.getAPIKeyByHashFn = func(hash string) (models.APIKey, error) {
+		key, ok := keys[hash]
+		if !ok {
+			return models.APIKey{}, storage.ErrAPIKeyNotFound
+		}
+		return key, nil
+	}
+
+	principal, err := service.Authenticate(ctx, "psk_active")
+	require.NoError(t, err)
+	// права роли добавляются к правам ключа
+	assert.Equal(t, auth.Principal{
+		Subject: "apikey:1",
+		Wallets: []string{"wallet-1"},
+		Roles:   []string{auth.RoleAuditor},
+		Permissions: []string{
+			auth.PermissionBalanceRead, auth.PermissionHistoryExport, auth.PermissionHistoryRead,
+			auth.PermissionHistoryReadAll, auth.PermissionSend,
+		},
+	}, principal)
+
+	for _, key := range []string{"", "not-a-key", "psk_unknown", "psk_revoked"} {
+		_, err := service.Authenticate(ctx, key)
+		assert.ErrorIs(t, err, ErrUnauthenticated, key)
+	}
+}
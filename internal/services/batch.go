@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/ratelimit"
+	"paymentSystem/internal/storage"
+)
+
+// MaxBatchSize ограничивает число переводов в одном пакете
+const MaxBatchSize = 1000
+
+// ErrInvalidBatch возвращается для пустого пакета или пакета больше MaxBatchSize
+var ErrInvalidBatch = errors.New("invalid batch")
+
+// BatchItemResult — исход одного перевода пакета: квитанция или текст ошибки.
+type BatchItemResult struct {
+	Index   int             `json:"index"`
+	Receipt *models.Receipt `json:"receipt,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// BatchResult — результат выполнения пакета переводов.
+// Results идут в порядке переводов в запросе.
+type BatchResult struct {
+	Atomic    bool              `json:"atomic"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+	Results   []BatchItemResult `json:"results"`
+}
+
+// MakeBatch реализует метод интерфейса для пакетного перевода.
+// В атомарном режиме ошибка возвращается как *storage.BatchError с индексом
+// перевода, из-за которого пакет отклонен.
+func (s *transactionService) MakeBatch(ctx context.Context, transfers []models.TransferRequest, atomic bool) (BatchResult, error) {
+	if len(transfers) == 0 || len(transfers) > MaxBatchSize {
+		s.logger.Warn("invalid batch size", "size", len(transfers))
+		return BatchResult{}, fmt.Errorf("%w: size must be between 1 and %d", ErrInvalidBatch, MaxBatchSize)
+	}
+
+	senders := make([]string, len(transfers))
+	for i, t := range transfers {
+		senders[i] = t.From
+	}
+	if err := ratelimit.AllowWallets(ctx, senders...); err != nil {
+		return BatchResult{}, err
+	}
+
+	s.logger.Info("batch initialized", "size", len(transfers), "atomic", atomic)
+
+	var (
+		result BatchResult
+		err    error
+	)
+	if atomic {
+		result, err = s.makeAtomicBatch(ctx, transfers)
+	} else {
+		result, err = s.makeBestEffortBatch(ctx, transfers)
+	}
+	if err != nil {
+		return BatchResult{}, err
+	}
+
+	s.logger.Info("batch completed",
+		"size", len(transfers),
+		"atomic", atomic,
+		"succeeded", result.Succeeded,
+		"failed", result.Failed,
+	)
+	return result, nil
+}
+
+// makeAtomicBatch проверяет все переводы, рассчитывает комиссии
+// и конвертацию и выполняет переводы одной транзакцией хранилища.
+// Ограничения отправителей по истории проверяет хранилище с учетом
+// предыдущих переводов пакета.
+func (s *transactionService) makeAtomicBatch(ctx context.Context, transfers []models.TransferRequest) (BatchResult, error) {
+	charged := make([]models.TransferRequest, len(transfers))
+	for i, t := range transfers {
+		if err := s.validateTransfer(t.From, t.To, t.Amount); err != nil {
+			return BatchResult{}, &storage.BatchError{Index: i, Err: err}
+		}
+		check, err := s.limits.check(t.From, t.Amount)
+		if err != nil {
+			return BatchResult{}, &storage.BatchError{Index: i, Err: err}
+		}
+		t.Check = check
+		prepared, err := s.prepareTransfer(ctx, t)
+		if err != nil {
+			return BatchResult{}, &storage.BatchError{Index: i, Err: err}
+		}
+		charged[i] = prepared
+	}
+
+	receipts, err := s.storage.TransferBatch(ctx, charged)
+	if err != nil {
+		var batchErr *storage.BatchError
+		if errors.As(err, &batchErr) && contextError(err) == nil {
+			amount := transfers[batchErr.Index].Amount
+			return BatchResult{}, &storage.BatchError{Index: batchErr.Index, Err: s.handleStorageError(batchErr.Err, amount)}
+		}
+		return BatchResult{}, s.handleStorageError(err, transfers[0].Amount)
+	}
+
+	result := BatchResult{Atomic: true, Succeeded: len(receipts), Results: make([]BatchItemResult, len(receipts))}
+	for i := range receipts {
+		result.Results[i] = BatchItemResult{Index: i, Receipt: &receipts[i]}
+	}
+	return result, nil
+}
+
+// makeBestEffortBatch выполняет переводы по одному; ошибка перевода попадает
+// в его результат и не мешает остальным. Отмена запроса прерывает пакет.
+func (s *transactionService) makeBestEffortBatch(ctx context.Context, transfers []models.TransferRequest) (BatchResult, error) {
+	result := BatchResult{Results: make([]BatchItemResult, len(transfers))}
+	for i, t := range transfers {
+		result.Results[i].Index = i
+
+		receipt, err := s.makeTransfer(ctx, t)
+		if cerr := contextError(err); cerr != nil {
+			return BatchResult{}, cerr
+		}
+		if err != nil {
+			result.Failed++
+			result.Results[i].Error = err.Error()
+			continue
+		}
+		result.Succeeded++
+		result.Results[i].Receipt = &receipt
+	}
+	return result, nil
+}
+
+// makeTransfer выполняет один перевод пакета без построчного логирования успеха.
+func (s *transactionService) makeTransfer(ctx context.Context, t models.TransferRequest) (models.Receipt, error) {
+	if err := s.validateTransfer(t.From, t.To, t.Amount); err != nil {
+		return models.Receipt{}, err
+	}
+	check, err := s.limits.check(t.From, t.Amount)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	t.Check = check
+	t, err = s.prepareTransfer(ctx, t)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	receipt, err := s.storage.Transfer(ctx, t)
+	if err != nil {
+		return models.Receipt{}, s.handleStorageError(err, t.Amount)
+	}
+	return receipt, nil
+}
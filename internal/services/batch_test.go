@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"paymentSystem/internal/fx"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/storage"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testBatch = []models.TransferRequest{
+	{From: "a", To: "b", Amount: money.New(100, "RUB")},
+	{From: "b", To: "c", Amount: money.New(200, "RUB")},
+}
+
+func TestMakeBatch_InvalidSize(t *testing.T) {
+	service, _ := setupTestService()
+
+	_, err := service.MakeBatch(ctx, nil, true)
+	assert.ErrorIs(t, err, ErrInvalidBatch)
+
+	_, err = service.MakeBatch(ctx, make([]models.TransferRequest, MaxBatchSize+1), false)
+	assert.ErrorIs(t, err, ErrInvalidBatch)
+}
+
+func TestMakeBatch_AtomicValidatesBeforeStorage(t *testing.T) {
+	service, _ := setupTestService()
+	transfers := append(testBatch[:1:1], models.TransferRequest{From: "c", To: "c", Amount: money.New(1, "RUB")})
+
+	// Хранилище не вызывается: мок без transferBatchFn запаниковал бы
+	_, err := service.MakeBatch(ctx, transfers, true)
+
+	var batchErr *storage.BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, 1, batchErr.Index)
+	assert.ErrorIs(t, err, ErrSelfTransfer)
+}
+
+func TestMakeBatch_AtomicStorageError(t *testing.T) {
+	service, mock := setupTestService()
+
+	mock.transferBatchFn = func(transfers []models.TransferRequest) ([]models.Receipt, error) {
+		return nil, &storage.BatchError{Index: 1, Err: storage.ErrInsufficientFunds}
+	}
+
+	_, err := service.MakeBatch(ctx, testBatch, true)
+
+	var batchErr *storage.BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, 1, batchErr.Index)
+	assert.ErrorIs(t, err, storage.ErrInsufficientFunds)
+}
+
+func TestMakeBatch_AtomicCanceled(t *testing.T) {
+	service, mock := setupTestService()
+
+	mock.transferBatchFn = func(transfers []models.TransferRequest) ([]models.Receipt, error) {
+		return nil, &storage.BatchError{Index: 0, Err: context.Canceled}
+	}
+
+	_, err := service.MakeBatch(ctx, testBatch, true)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestMakeBatch_AtomicSuccess(t *testing.T) {
+	service, mock := setupTestService()
+
+	mock.transferBatchFn = func(transfers []models.TransferRequest) ([]models.Receipt, error) {
+		assert.Equal(t, testBatch, transfers)
+		return []models.Receipt{
+			{Transaction: models.Transaction{ID: 1}},
+			{Transaction: models.Transaction{ID: 2}},
+		}, nil
+	}
+
+	result, err := service.MakeBatch(ctx, testBatch, true)
+	require.NoError(t, err)
+	assert.True(t, result.Atomic)
+	assert.Equal(t, 2, result.Succeeded)
+	assert.Equal(t, 0, result.Failed)
+	require.Len(t, result.Results, 2)
+	assert.Equal(t, int64(2), result.Results[1].Receipt.ID)
+}
+
+func TestMakeBatch_AtomicWithFees(t *testing.T) {
+	service, mock := setupFeeService(flatFee)
+
+	mock.transferBatchFn = func(transfers []models.TransferRequest) ([]models.Receipt, error) {
+		for _, transfer := range transfers {
+			assert.Equal(t, &models.Fee{Wallet: "fees", Amount: money.New(100, "RUB")}, transfer.Fee)
+		}
+		return make([]models.Receipt, len(transfers)), nil
+	}
+
+	_, err := service.MakeBatch(ctx, testBatch, true)
+	require.NoError(t, err)
+	// комиссии не попадают в пакет вызывающего
+	assert.Nil(t, testBatch[0].Fee)
+}
+
+func TestMakeBatch_AtomicConversionError(t *testing.T) {
+	service, mock := setupFXService(usdRate)
+	mock.getWalletFn = walletsIn(map[string]string{"b": "RUB", "c": "EUR"})
+
+	// до хранилища пакет не доходит: мок без transferBatchFn запаниковал бы
+	_, err := service.MakeBatch(ctx, testBatch, true)
+
+	var batchErr *storage.BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, 1, batchErr.Index)
+	assert.ErrorIs(t, batchErr.Err, fx.ErrRateNotFound)
+}
+
+func TestMakeBatch_BestEffort(t *testing.T) {
+	service, mock := setupTestService()
+	transfers := append(testBatch[:2:2], models.TransferRequest{From: "c", To: "d", Amount: money.New(-1, "RUB")})
+
+	mock.transferFn = func(transfer models.TransferRequest) (models.Receipt, error) {
+		if transfer.From == "b" {
+			return models.Receipt{}, storage.ErrInsufficientFunds
+		}
+		return models.Receipt{Transaction: models.Transaction{ID: 1, From: transfer.From, To: transfer.To, Amount: transfer.Amount}}, nil
+	}
+
+	result, err := service.MakeBatch(ctx, transfers, false)
+	require.NoError(t, err)
+	assert.False(t, result.Atomic)
+	assert.Equal(t, 1, result.Succeeded)
+	assert.Equal(t, 2, result.Failed)
+	require.Len(t, result.Results, 3)
+	assert.Equal(t, int64(1), result.Results[0].Receipt.ID)
+	assert.Equal(t, storage.ErrInsufficientFunds.Error(), result.Results[1].Error)
+	assert.Equal(t, ErrInvalidAmount.Error(), result.Results[2].Error)
+	assert.Equal(t, 2, result.Results[2].Index)
+}
+
+func TestMakeBatch_BestEffortCanceled(t *testing.T) {
+	service, mock := setupTestService()
+
+	mock.transferFn = func(transfer models.TransferRequest) (models.Receipt, error) {
+		return models.Receipt{}, context.DeadlineExceeded
+	}
+
+	_, err := service.MakeBatch(ctx, testBatch, false)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
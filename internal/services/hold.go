@@ -0,0 +1,234 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/ratelimit"
+	"paymentSystem/internal/storage"
+	"time"
+)
+
+// ErrInvalidHoldTTL возвращается, если срок блокировки неположителен или превышает максимальный
+var ErrInvalidHoldTTL = errors.New("invalid hold ttl")
+
+type HoldService interface {
+	// CreateHold блокирует amount на кошельке from для последующего перевода на to
+	// вместе с комиссией за перевод всей суммы. ttl == 0 означает максимальный
+	// срок блокировки.
+	CreateHold(ctx context.Context, from, to string, amount money.Money, ttl time.Duration) (models.Hold, error)
+	// GetHold возвращает блокировку; просроченная активная блокировка
+	// отдается со статусом expired, даже если ExpireHolds еще не отработал.
+	GetHold(ctx context.Context, id int64) (models.Hold, error)
+	// CaptureHold переводит amount (или всю сумму, если amount == nil)
+	// на кошелек назначения и списывает комиссию за этот перевод. Остаток
+	// блокировки освобождается.
+	CaptureHold(ctx context.Context, id int64, amount *money.Money) (models.Hold, error)
+	// VoidHold снимает блокировку без перевода.
+	VoidHold(ctx context.Context, id int64) (models.Hold, error)
+	// ExpireHolds помечает истекшими просроченные блокировки.
+	ExpireHolds(ctx context.Context) (int64, error)
+}
+
+type holdService struct {
+	storage storage.Storage
+	fees    FeePolicy
+	limits  *Limiter
+	maxTTL  time.Duration
+	logger  *slog.Logger
+}
+
+// NewHoldService создает сервис блокировок. Комиссии и ограничения
+// отправителя применяются к списаниям так же, как к переводам; fees == nil
+// отключает комиссии, limits == nil — ограничения.
+func NewHoldService(storage storage.Storage, fees FeePolicy, limits *Limiter, maxTTL time.Duration, logger *slog.Logger) HoldService {
+	return &holdService{
+		storage: storage,
+		fees:    fees,
+		limits:  limits,
+		maxTTL:  maxTTL,
+		logger:  logger,
+	}
+}
+
+// CreateHold реализует метод интерфейса для блокировки средств.
+func (s *holdService) CreateHold(ctx context.Context, from, to string, amount money.Money, ttl time.Duration) (models.Hold, error) {
+	if !amount.IsPositive() {
+		s.logger.Warn("invalid amount", "amount", amount.String())
+		return models.Hold{}, ErrInvalidAmount
+	}
+	if _, err := money.Exponent(amount.Currency); err != nil {
+		s.logger.Warn("unknown currency", "currency", amount.Currency)
+		return models.Hold{}, err
+	}
+	if from == to {
+		s.logger.Warn("self transfer attempt", "from", from, "to", to)
+		return models.Hold{}, ErrSelfTransfer
+	}
+	if ttl == 0 {
+		ttl = s.maxTTL
+	}
+	if ttl < 0 || ttl > s.maxTTL {
+		s.logger.Warn("invalid hold ttl", "ttl", ttl)
+		return models.Hold{}, ErrInvalidHoldTTL
+	}
+	if err := ratelimit.AllowWallets(ctx, from); err != nil {
+		return models.Hold{}, err
+	}
+	// суммы за сутки и месяц проверяются при списании, когда блокировка
+	// становится переводом
+	if err := s.limits.checkAmount(from, amount); err != nil {
+		return models.Hold{}, err
+	}
+
+	now := time.Now().UTC()
+	hold := models.Hold{
+		Wallet:      from,
+		Destination: to,
+		Amount:      amount,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+	}
+	// комиссия резервируется на всю сумму, чтобы списание не упиралось
+	// в недостаток средств на комиссию
+	if fee := s.fee(from, amount); fee != nil {
+		hold.Fee = fee.Amount
+	}
+	hold, err := s.storage.CreateHold(ctx, hold)
+	if err != nil {
+		return models.Hold{}, s.handleStorageError(err)
+	}
+
+	s.logger.Info("hold created",
+		"id", hold.ID,
+		"wallet", from,
+		"destination", to,
+		"amount", amount.String(),
+		"currency", amount.Currency,
+		"fee", hold.Fee.String(),
+		"expires_at", hold.ExpiresAt,
+	)
+
+	return hold, nil
+}
+
+// GetHold реализует метод интерфейса для получения блокировки.
+func (s *holdService) GetHold(ctx context.Context, id int64) (models.Hold, error) {
+	if id <= 0 {
+		return models.Hold{}, storage.ErrHoldNotFound
+	}
+
+	hold, err := s.storage.GetHold(ctx, id)
+	if err != nil {
+		return models.Hold{}, s.handleStorageError(err)
+	}
+	if hold.Status == storage.HoldActive && !hold.ExpiresAt.After(time.Now()) {
+		hold.Status = storage.HoldExpired
+	}
+	return hold, nil
+}
+
+// CaptureHold реализует метод интерфейса для списания блокировки.
+func (s *holdService) CaptureHold(ctx context.Context, id int64, amount *money.Money) (models.Hold, error) {
+	if id <= 0 {
+		return models.Hold{}, storage.ErrHoldNotFound
+	}
+
+	if amount != nil && !amount.IsPositive() {
+		s.logger.Warn("invalid amount", "amount", amount.String())
+		return models.Hold{}, ErrInvalidAmount
+	}
+
+	hold, err := s.storage.GetHold(ctx, id)
+	if err != nil {
+		return models.Hold{}, s.handleStorageError(err)
+	}
+	if err := ratelimit.AllowWallets(ctx, hold.Wallet); err != nil {
+		return models.Hold{}, err
+	}
+	capture := hold.Amount
+	if amount != nil {
+		capture = *amount
+	}
+	check, err := s.limits.check(hold.Wallet, capture)
+	if err != nil {
+		return models.Hold{}, err
+	}
+	fee := s.fee(hold.Wallet, capture)
+
+	hold, err = s.storage.CaptureHold(ctx, id, capture, fee, check)
+	if err != nil {
+		return models.Hold{}, s.handleStorageError(err)
+	}
+
+	s.logger.Info("hold captured",
+		"id", id,
+		"transaction_id", *hold.TransactionID,
+		"amount", capture.String(),
+		"currency", capture.Currency,
+		"fee", feeString(fee),
+	)
+
+	return hold, nil
+}
+
+// VoidHold реализует метод интерфейса для снятия блокировки.
+func (s *holdService) VoidHold(ctx context.Context, id int64) (models.Hold, error) {
+	if id <= 0 {
+		return models.Hold{}, storage.ErrHoldNotFound
+	}
+
+	hold, err := s.storage.VoidHold(ctx, id)
+	if err != nil {
+		return models.Hold{}, s.handleStorageError(err)
+	}
+
+	s.logger.Info("hold voided", "id", id)
+	return hold, nil
+}
+
+// ExpireHolds реализует метод интерфейса для истечения просроченных блокировок.
+func (s *holdService) ExpireHolds(ctx context.Context) (int64, error) {
+	n, err := s.storage.ExpireHolds(ctx, time.Now().UTC())
+	if err != nil {
+		return 0, s.handleStorageError(err)
+	}
+	if n > 0 {
+		s.logger.Info("holds expired", "count", n)
+	}
+	return n, nil
+}
+
+// fee рассчитывает комиссию за перевод amount с кошелька from.
+func (s *holdService) fee(from string, amount money.Money) *models.Fee {
+	if s.fees == nil {
+		return nil
+	}
+	return s.fees.Fee(from, amount)
+}
+
+// handleStorageError преобразует ошибки хранилища в бизнес-ошибки.
+func (s *holdService) handleStorageError(err error) error {
+	switch {
+	case contextError(err) != nil:
+		s.logger.Warn("request aborted", "err", err)
+		return contextError(err)
+	case errors.Is(err, storage.ErrInsufficientFunds),
+		errors.Is(err, storage.ErrWalletNotFound),
+		errors.Is(err, storage.ErrWalletClosed),
+		errors.Is(err, storage.ErrHoldNotFound),
+		errors.Is(err, storage.ErrHoldNotActive),
+		errors.Is(err, storage.ErrCaptureExceedsHold),
+		errors.Is(err, money.ErrCurrencyMismatch):
+		s.logger.Warn("hold operation rejected", "err", err)
+		return err
+	case errors.Is(err, ErrLimitExceeded):
+		// отказ уже залогирован Limiter
+		return err
+	default:
+		s.logger.Error("unexpected storage error", "err", err)
+		return ErrInternalError
+	}
+}
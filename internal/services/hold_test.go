@@ -0,0 +1,287 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/ratelimit"
+	"paymentSystem/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testMaxHoldTTL = 24 * time.Hour
+
+// setupHoldService создаёт сервис блокировок с моком хранилища
+func setupHoldService() (HoldService, *mockStorage) {
+	mock := &mockStorage{}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	return NewHoldService(mock, nil, nil, testMaxHoldTTL, logger), mock
+}
+
+// setupFeeHoldService создаёт сервис блокировок с политикой комиссий
+func setupFeeHoldService(fees FeePolicy) (HoldService, *mockStorage) {
+	mock := &mockStorage{}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	return NewHoldService(mock, fees, nil, testMaxHoldTTL, logger), mock
+}
+
+// setupLimitHoldService создаёт сервис блокировок с ограничениями на переводы
+func setupLimitHoldService(limits models.Limits) (HoldService, *mockStorage) {
+	mock := &mockStorage{}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	return NewHoldService(mock, nil, NewLimiter(fixedLimits(limits), logger), testMaxHoldTTL, logger), mock
+}
+
+// activeHold возвращает активную блокировку id на 500 копеек с кошелька "a"
+func activeHold(id int64) (models.Hold, error) {
+	return models.Hold{ID: id, Wallet: "a", Destination: "b", Amount: money.New(500, "RUB"), Status: storage.HoldActive}, nil
+}
+
+func TestCreateHold_Success(t *testing.T) {
+	service, mock := setupHoldService()
+
+	mock.createHoldFn = func(hold models.Hold) (models.Hold, error) {
+		assert.Equal(t, "a", hold.Wallet)
+		assert.Equal(t, "b", hold.Destination)
+		assert.Equal(t, time.Hour, hold.ExpiresAt.Sub(hold.CreatedAt))
+		hold.ID = 1
+		hold.Status = storage.HoldActive
+		return hold, nil
+	}
+
+	hold, err := service.CreateHold(ctx, "a", "b", money.New(500, "RUB"), time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), hold.ID)
+}
+
+func TestCreateHold_DefaultTTL(t *testing.T) {
+	service, mock := setupHoldService()
+
+	mock.createHoldFn = func(hold models.Hold) (models.Hold, error) {
+		assert.Equal(t, testMaxHoldTTL, hold.ExpiresAt.Sub(hold.CreatedAt))
+		return hold, nil
+	}
+
+	_, err := service.CreateHold(ctx, "a", "b", money.New(500, "RUB"), 0)
+	assert.NoError(t, err)
+}
+
+func TestCreateHold_Validation(t *testing.T) {
+	service, _ := setupHoldService()
+
+	_, err := service.CreateHold(ctx, "a", "b", money.New(0, "RUB"), 0)
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+	_, err = service.CreateHold(ctx, "a", "a", money.New(100, "RUB"), 0)
+	assert.ErrorIs(t, err, ErrSelfTransfer)
+	_, err = service.CreateHold(ctx, "a", "b", money.New(100, "RUB"), testMaxHoldTTL+time.Second)
+	assert.ErrorIs(t, err, ErrInvalidHoldTTL)
+	_, err = service.CreateHold(ctx, "a", "b", money.New(100, "RUB"), -time.Second)
+	assert.ErrorIs(t, err, ErrInvalidHoldTTL)
+}
+
+func TestCreateHold_StorageErrors(t *testing.T) {
+	tests := []struct {
+		storageErr error
+		want       error
+	}{
+		{storage.ErrInsufficientFunds, storage.ErrInsufficientFunds},
+		{storage.ErrWalletNotFound, storage.ErrWalletNotFound},
+		{context.DeadlineExceeded, context.DeadlineExceeded},
+		{errors.New("db error"), ErrInternalError},
+	}
+	for _, tt := range tests {
+		service, mock := setupHoldService()
+		mock.createHoldFn = func(models.Hold) (models.Hold, error) {
+			return models.Hold{}, tt.storageErr
+		}
+
+		_, err := service.CreateHold(ctx, "a", "b", money.New(100, "RUB"), 0)
+		assert.ErrorIs(t, err, tt.want)
+	}
+}
+
+func TestGetHold_ReportsExpired(t *testing.T) {
+	service, mock := setupHoldService()
+
+	mock.getHoldFn = func(id int64) (models.Hold, error) {
+		return models.Hold{ID: id, Status: storage.HoldActive, ExpiresAt: time.Now().Add(-time.Second)}, nil
+	}
+
+	hold, err := service.GetHold(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, storage.HoldExpired, hold.Status)
+
+	_, err = service.GetHold(ctx, 0)
+	assert.ErrorIs(t, err, storage.ErrHoldNotFound)
+}
+
+func TestCaptureHold_FullAmountByDefault(t *testing.T) {
+	service, mock := setupHoldService()
+	txID := int64(7)
+
+	mock.getHoldFn = func(id int64) (models.Hold, error) {
+		return models.Hold{ID: id, Amount: money.New(500, "RUB")}, nil
+	}
+	mock.captureHoldFn = func(id int64, amount money.Money, fee *models.Fee) (models.Hold, error) {
+		assert.Equal(t, money.New(500, "RUB"), amount)
+		return models.Hold{ID: id, Status: storage.HoldCaptured, CapturedAmount: amount, TransactionID: &txID}, nil
+	}
+
+	hold, err := service.CaptureHold(ctx, 3, nil)
+	require.NoError(t, err)
+	assert.Equal(t, storage.HoldCaptured, hold.Status)
+}
+
+func TestCaptureHold_Partial(t *testing.T) {
+	service, mock := setupHoldService()
+	txID := int64(7)
+	partial := money.New(200, "RUB")
+
+	mock.getHoldFn = activeHold
+	mock.captureHoldFn = func(id int64, amount money.Money, fee *models.Fee) (models.Hold, error) {
+		assert.Equal(t, partial, amount)
+		return models.Hold{ID: id, Status: storage.HoldCaptured, CapturedAmount: amount, TransactionID: &txID}, nil
+	}
+
+	hold, err := service.CaptureHold(ctx, 3, &partial)
+	require.NoError(t, err)
+	assert.Equal(t, partial, hold.CapturedAmount)
+
+	zero := money.New(0, "RUB")
+	_, err = service.CaptureHold(ctx, 3, &zero)
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+}
+
+func TestHold_WalletRateLimit(t *testing.T) {
+	service, mock := setupHoldService()
+	mock.createHoldFn = func(hold models.Hold) (models.Hold, error) {
+		return hold, nil
+	}
+	mock.getHoldFn = activeHold
+
+	var charged []string
+	_, err := service.CreateHold(walletLimit(&charged, nil), "a", "b", money.New(500, "RUB"), time.Hour)
+	require.NoError(t, err)
+	// списание расходует корзину кошелька блокировки; хранилище без подмены
+	// CaptureHold паникует, если ограничение не остановит списание
+	_, err = service.CaptureHold(walletLimit(&charged, &ratelimit.LimitError{}), 3, nil)
+	assert.ErrorIs(t, err, ratelimit.ErrLimited)
+	assert.Equal(t, []string{"a", "a"}, charged)
+}
+
+func TestCaptureHold_NotActive(t *testing.T) {
+	service, mock := setupHoldService()
+	amount := money.New(200, "RUB")
+
+	mock.getHoldFn = activeHold
+	mock.captureHoldFn = func(int64, money.Money, *models.Fee) (models.Hold, error) {
+		return models.Hold{}, storage.ErrHoldNotActive
+	}
+
+	_, err := service.CaptureHold(ctx, 3, &amount)
+	assert.ErrorIs(t, err, storage.ErrHoldNotActive)
+}
+
+func TestCreateHold_ReservesFee(t *testing.T) {
+	service, mock := setupFeeHoldService(flatFee)
+
+	mock.createHoldFn = func(hold models.Hold) (models.Hold, error) {
+		assert.Equal(t, money.New(500, "RUB"), hold.Amount)
+		assert.Equal(t, money.New(100, "RUB"), hold.Fee)
+		return hold, nil
+	}
+
+	hold, err := service.CreateHold(ctx, "a", "b", money.New(500, "RUB"), 0)
+	require.NoError(t, err)
+	assert.Equal(t, money.New(100, "RUB"), hold.Fee)
+}
+
+func TestCaptureHold_ChargesFee(t *testing.T) {
+	percentFee := feePolicyFunc(func(from string, amount money.Money) *models.Fee {
+		assert.Equal(t, "a", from)
+		return &models.Fee{Wallet: "fees", Amount: money.New(amount.Amount/10, amount.Currency)}
+	})
+	service, mock := setupFeeHoldService(percentFee)
+	txID := int64(7)
+	partial := money.New(200, "RUB")
+
+	mock.getHoldFn = activeHold
+	mock.captureHoldFn = func(id int64, amount money.Money, fee *models.Fee) (models.Hold, error) {
+		assert.Equal(t, partial, amount)
+		// комиссия считается от списанной, а не от заблокированной суммы
+		assert.Equal(t, &models.Fee{Wallet: "fees", Amount: money.New(20, "RUB")}, fee)
+		return models.Hold{ID: id, Status: storage.HoldCaptured, CapturedAmount: amount, Fee: fee.Amount, TransactionID: &txID}, nil
+	}
+
+	hold, err := service.CaptureHold(ctx, 3, &partial)
+	require.NoError(t, err)
+	assert.Equal(t, money.New(20, "RUB"), hold.Fee)
+}
+
+func TestCreateHold_PerTransferLimit(t *testing.T) {
+	service, _ := setupLimitHoldService(models.Limits{Currency: "RUB", MaxAmount: 400})
+
+	// хранилище не вызывается: мок паникует на любом обращении
+	_, err := service.CreateHold(ctx, "a", "b", money.New(500, "RUB"), 0)
+
+	limitErr := assertLimit(t, err, LimitPerTransfer)
+	assert.Equal(t, money.New(400, "RUB"), limitErr.Max)
+}
+
+func TestCaptureHold_PerTransferLimit(t *testing.T) {
+	service, mock := setupLimitHoldService(models.Limits{Currency: "RUB", MaxAmount: 400})
+
+	// блокировка создана до снижения лимита
+	mock.getHoldFn = activeHold
+
+	_, err := service.CaptureHold(ctx, 3, nil)
+
+	limitErr := assertLimit(t, err, LimitPerTransfer)
+	assert.Equal(t, money.New(400, "RUB"), limitErr.Max)
+}
+
+func TestCaptureHold_DailyLimit(t *testing.T) {
+	service, mock := setupLimitHoldService(models.Limits{Currency: "RUB", Daily: 10000})
+	partial := money.New(200, "RUB")
+
+	mock.getHoldFn = activeHold
+	mock.outgoingSinceFn = func(address string, since time.Time) (storage.Outgoing, error) {
+		assert.Equal(t, "a", address)
+		return storage.Outgoing{Count: 3, Amount: 9800}, nil
+	}
+
+	_, err := service.CaptureHold(ctx, 3, nil)
+	limitErr := assertLimit(t, err, LimitDaily)
+	assert.Equal(t, money.New(10000, "RUB"), limitErr.Max)
+
+	// частичное списание укладывается в остаток суточного лимита
+	txID := int64(7)
+	mock.captureHoldFn = func(id int64, amount money.Money, fee *models.Fee) (models.Hold, error) {
+		return models.Hold{ID: id, Status: storage.HoldCaptured, CapturedAmount: amount, TransactionID: &txID}, nil
+	}
+	_, err = service.CaptureHold(ctx, 3, &partial)
+	require.NoError(t, err)
+}
+
+func TestExpireHolds(t *testing.T) {
+	service, mock := setupHoldService()
+
+	mock.expireHoldsFn = func(before time.Time) (int64, error) {
+		assert.WithinDuration(t, time.Now(), before, time.Second)
+		return 2, nil
+	}
+
+	n, err := service.ExpireHolds(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/storage"
+	"time"
+)
+
+var (
+	// ErrIdempotencyKeyReused возвращается, если ключ повторно использован с другим телом запроса
+	ErrIdempotencyKeyReused = errors.New("idempotency key was used with a different request")
+
+	// ErrIdempotencyInProgress возвращается, если запрос с этим ключом еще выполняется
+	ErrIdempotencyInProgress = errors.New("request with this idempotency key is in progress")
+)
+
+type IdempotencyService interface {
+	// Begin резервирует ключ. Если запрос с ключом уже был выполнен,
+	// возвращает сохраненную запись и replay == true.
+	Begin(ctx context.Context, key, fingerprint string) (record models.IdempotencyRecord, replay bool, err error)
+	// Complete сохраняет ответ для последующих повторов.
+	Complete(ctx context.Context, key string, status int, response []byte) error
+	// Abort освобождает ключ, чтобы запрос можно было повторить.
+	Abort(ctx context.Context, key string) error
+	// PurgeExpired удаляет истекшие ключи.
+	PurgeExpired(ctx context.Context) (int64, error)
+}
+
+type idempotencyService struct {
+	storage storage.Storage
+	ttl     time.Duration
+	logger  *slog.Logger
+}
+
+func NewIdempotencyService(storage storage.Storage, ttl time.Duration, logger *slog.Logger) IdempotencyService {
+	return &idempotencyService{
+		storage: storage,
+		ttl:     ttl,
+		logger:  logger,
+	}
+}
+
+// Begin реализует метод интерфейса для резервирования ключа.
+func (s *idempotencyService) Begin(ctx context.Context, key, fingerprint string) (models.IdempotencyRecord, bool, error) {
+	now := time.Now().UTC()
+	record := models.IdempotencyRecord{
+		Key:         key,
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(s.ttl),
+	}
+
+	err := s.storage.CreateIdempotencyKey(ctx, record)
+	if err == nil {
+		return record, false, nil
+	}
+	if ctxErr := contextError(err); ctxErr != nil {
+		return models.IdempotencyRecord{}, false, ctxErr
+	}
+	if !errors.Is(err, storage.ErrIdempotencyKeyExists) {
+		s.logger.Error("failed to reserve idempotency key", "key", key, "err", err)
+		return models.IdempotencyRecord{}, false, ErrInternalError
+	}
+
+	existing, err := s.storage.GetIdempotencyKey(ctx, key)
+	if err != nil {
+		if errors.Is(err, storage.ErrIdempotencyKeyNotFound) {
+			// ключ удален параллельным запросом после ошибки — клиенту стоит повторить
+			return models.IdempotencyRecord{}, false, ErrIdempotencyInProgress
+		}
+		if ctxErr := contextError(err); ctxErr != nil {
+			return models.IdempotencyRecord{}, false, ctxErr
+		}
+		s.logger.Error("failed to load idempotency key", "key", key, "err", err)
+		return models.IdempotencyRecord{}, false, ErrInternalError
+	}
+
+	if existing.ExpiresAt.Before(now) {
+		s.logger.Info("idempotency key expired, reusing", "key", key)
+		if err := s.storage.DeleteIdempotencyKey(ctx, key); err != nil {
+			s.logger.Error("failed to delete expired idempotency key", "key", key, "err", err)
+			return models.IdempotencyRecord{}, false, ErrInternalError
+		}
+		return s.Begin(ctx, key, fingerprint)
+	}
+
+	if existing.Fingerprint != fingerprint {
+		s.logger.Warn("idempotency key reused with different request", "key", key)
+		return models.IdempotencyRecord{}, false, ErrIdempotencyKeyReused
+	}
+	if existing.Status == 0 {
+		return models.IdempotencyRecord{}, false, ErrIdempotencyInProgress
+	}
+
+	s.logger.Info("replaying idempotent request", "key", key, "status", existing.Status)
+	return existing, true, nil
+}
+
+// Complete реализует метод интерфейса для сохранения ответа.
+func (s *idempotencyService) Complete(ctx context.Context, key string, status int, response []byte) error {
+	if err := s.storage.CompleteIdempotencyKey(ctx, key, status, response); err != nil {
+		s.logger.Error("failed to store idempotent response", "key", key, "err", err)
+		return ErrInternalError
+	}
+	return nil
+}
+
+// Abort реализует метод интерфейса для освобождения ключа.
+func (s *idempotencyService) Abort(ctx context.Context, key string) error {
+	if err := s.storage.DeleteIdempotencyKey(ctx, key); err != nil {
+		s.logger.Error("failed to release idempotency key", "key", key, "err", err)
+		return ErrInternalError
+	}
+	return nil
+}
+
+// PurgeExpired реализует метод интерфейса для очистки истекших ключей.
+func (s *idempotencyService) PurgeExpired(ctx context.Context) (int64, error) {
+	n, err := s.storage.DeleteExpiredIdempotencyKeys(ctx, time.Now().UTC())
+	if err != nil {
+		s.logger.Error("failed to purge idempotency keys", "err", err)
+		return 0, ErrInternalError
+	}
+	if n > 0 {
+		s.logger.Info("purged expired idempotency keys", "count", n)
+	}
+	return n, nil
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"bytes"
+	"log/slog"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupIdempotencyService создаёт сервис идемпотентности с моком хранилища
+func setupIdempotencyService() (IdempotencyService, *mockStorage) {
+	mock := &mockStorage{}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	return NewIdempotencyService(mock, time.Hour, logger), mock
+}
+
+func TestIdempotencyBegin_NewKey(t *testing.T) {
+	service, mock := setupIdempotencyService()
+
+	mock.createIdempotencyKeyFn = func(record models.IdempotencyRecord) error {
+		assert.Equal(t, "key-1", record.Key)
+		assert.Equal(t, "fp", record.Fingerprint)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), record.ExpiresAt, time.Minute)
+		return nil
+	}
+
+	_, replay, err := service.Begin(ctx, "key-1", "fp")
+	require.NoError(t, err)
+	assert.False(t, replay)
+}
+
+func TestIdempotencyBegin_Replay(t *testing.T) {
+	service, mock := setupIdempotencyService()
+
+	stored := models.IdempotencyRecord{
+		Key:         "key-1",
+		Fingerprint: "fp",
+		Status:      200,
+		Response:    []byte(`{"status":"success"}`),
+		ExpiresAt:   time.Now().Add(time.Hour),
+	}
+	mock.createIdempotencyKeyFn = func(record models.IdempotencyRecord) error {
+		return storage.ErrIdempotencyKeyExists
+	}
+	mock.getIdempotencyKeyFn = func(key string) (models.IdempotencyRecord, error) {
+		return stored, nil
+	}
+
+	record, replay, err := service.Begin(ctx, "key-1", "fp")
+	require.NoError(t, err)
+	assert.True(t, replay)
+	assert.Equal(t, stored, record)
+}
+
+func TestIdempotencyBegin_DifferentBody(t *testing.T) {
+	service, mock := setupIdempotencyService()
+
+	mock.createIdempotencyKeyFn = func(record models.IdempotencyRecord) error {
+		return storage.ErrIdempotencyKeyExists
+	}
+	mock.getIdempotencyKeyFn = func(key string) (models.IdempotencyRecord, error) {
+		return models.IdempotencyRecord{Key: key, Fingerprint: "other", Status: 200, ExpiresAt: time.Now().Add(time.Hour)}, nil
+	}
+
+	_, _, err := service.Begin(ctx, "key-1", "fp")
+	assert.ErrorIs(t, err, ErrIdempotencyKeyReused)
+}
+
+func TestIdempotencyBegin_InProgress(t *testing.T) {
+	service, mock := setupIdempotencyService()
+
+	mock.createIdempotencyKeyFn = func(record models.IdempotencyRecord) error {
+		return storage.ErrIdempotencyKeyExists
+	}
+	mock.getIdempotencyKeyFn = func(key string) (models.IdempotencyRecord, error) {
+		return models.IdempotencyRecord{Key: key, Fingerprint: "fp", ExpiresAt: time.Now().Add(time.Hour)}, nil
+	}
+
+	_, _, err := service.Begin(ctx, "key-1", "fp")
+	assert.ErrorIs(t, err, ErrIdempotencyInProgress)
+}
+
+func TestIdempotencyBegin_ExpiredKeyIsReused(t *testing.T) {
+	service, mock := setupIdempotencyService()
+
+	deleted := false
+	mock.createIdempotencyKeyFn = func(record models.IdempotencyRecord) error {
+		if !deleted {
+			return storage.ErrIdempotencyKeyExists
+		}
+		return nil
+	}
+	mock.getIdempotencyKeyFn = func(key string) (models.IdempotencyRecord, error) {
+		return models.IdempotencyRecord{Key: key, Fingerprint: "other", Status: 200, ExpiresAt: time.Now().Add(-time.Minute)}, nil
+	}
+	mock.deleteIdempotencyKeyFn = func(key string) error {
+		deleted = true
+		return nil
+	}
+
+	_, replay, err := service.Begin(ctx, "key-1", "fp")
+	require.NoError(t, err)
+	assert.False(t, replay)
+	assert.True(t, deleted)
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/storage"
+)
+
+type LedgerService interface {
+	// Verify сверяет балансы кошельков с журналом проводок.
+	Verify(ctx context.Context) (models.LedgerReport, error)
+}
+
+type ledgerService struct {
+	storage storage.Storage
+	logger  *slog.Logger
+}
+
+func NewLedgerService(storage storage.Storage, logger *slog.Logger) LedgerService {
+	return &ledgerService{
+		storage: storage,
+		logger:  logger,
+	}
+}
+
+// Verify реализует метод интерфейса для сверки журнала.
+func (s *ledgerService) Verify(ctx context.Context) (models.LedgerReport, error) {
+	report, err := s.storage.VerifyLedger(ctx)
+	if err != nil {
+		if ctxErr := contextError(err); ctxErr != nil {
+			return models.LedgerReport{}, ctxErr
+		}
+		s.logger.Error("ledger verification failed", "err", err)
+		return models.LedgerReport{}, ErrInternalError
+	}
+
+	for _, d := range report.Discrepancies {
+		s.logger.Error("ledger discrepancy",
+			"address", d.Address,
+			"balance", d.Balance.String(),
+			"postings_sum", d.PostingsSum.String(),
+			"currency", d.Balance.Currency,
+		)
+	}
+	for _, id := range report.UnbalancedEntries {
+		s.logger.Error("unbalanced journal entry", "entry_id", id)
+	}
+
+	s.logger.Info("ledger verified",
+		"wallets", report.WalletsChecked,
+		"discrepancies", len(report.Discrepancies),
+		"unbalanced_entries", len(report.UnbalancedEntries),
+	)
+	return report, nil
+}
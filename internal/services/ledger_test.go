@@ -0,0 +1,47 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLedgerVerify_ReportsDiscrepancies(t *testing.T) {
+	mock := &mockStorage{}
+	var buf bytes.Buffer
+	service := NewLedgerService(mock, slog.New(slog.NewTextHandler(&buf, nil)))
+
+	mock.verifyLedgerFn = func() (models.LedgerReport, error) {
+		return models.LedgerReport{
+			WalletsChecked: 2,
+			Discrepancies: []models.LedgerDiscrepancy{
+				{Address: "wallet-1", Balance: money.New(101, "RUB"), PostingsSum: money.New(100, "RUB")},
+			},
+		}, nil
+	}
+
+	report, err := service.Verify(ctx)
+	require.NoError(t, err)
+	assert.False(t, report.OK())
+	assert.Contains(t, buf.String(), "ledger discrepancy")
+	assert.Contains(t, buf.String(), "wallet-1")
+}
+
+func TestLedgerVerify_StorageError(t *testing.T) {
+	mock := &mockStorage{}
+	var buf bytes.Buffer
+	service := NewLedgerService(mock, slog.New(slog.NewTextHandler(&buf, nil)))
+
+	mock.verifyLedgerFn = func() (models.LedgerReport, error) {
+		return models.LedgerReport{}, errors.New("db error")
+	}
+
+	_, err := service.Verify(ctx)
+	assert.ErrorIs(t, err, ErrInternalError)
+}
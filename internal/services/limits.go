@@ -0,0 +1,158 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"time"
+)
+
+// Виды ограничений, о превышении которых сообщает LimitError
+const (
+	LimitPerTransfer = "per_transfer"
+	LimitDaily       = "daily"
+	LimitMonthly     = "monthly"
+	LimitVelocity    = "velocity"
+)
+
+// ErrLimitExceeded возвращается, если перевод нарушает ограничения отправителя;
+// подробности — в *LimitError.
+var ErrLimitExceeded = errors.New("transfer limit exceeded")
+
+// LimitPolicy возвращает ограничения на переводы с кошелька from.
+type LimitPolicy interface {
+	Limits(from string) models.Limits
+}
+
+// LimitError сообщает, какое ограничение нарушил перевод.
+type LimitError struct {
+	// Limit — вид ограничения: LimitPerTransfer, LimitDaily, LimitMonthly
+	// или LimitVelocity.
+	Limit string
+	// Max — предельная сумма для ограничений на сумму.
+	Max money.Money
+	// MaxCount и Window — предельное число переводов за окно для LimitVelocity.
+	MaxCount int
+	Window   time.Duration
+}
+
+func (e *LimitError) Error() string {
+	switch e.Limit {
+	case LimitPerTransfer:
+		return fmt.Sprintf("%v: amount exceeds per-transfer maximum of %s %s", ErrLimitExceeded, e.Max, e.Max.Currency)
+	case LimitVelocity:
+		return fmt.Sprintf("%v: at most %d transfers per %s", ErrLimitExceeded, e.MaxCount, e.Window)
+	default:
+		return fmt.Sprintf("%v: %s outgoing total would exceed %s %s", ErrLimitExceeded, e.Limit, e.Max, e.Max.Currency)
+	}
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimitExceeded
+}
+
+// Limiter проверяет исходящие переводы и списания блокировок по ограничениям
+// отправителей. Предельная сумма одного перевода проверяется сразу, суммы
+// за сутки и месяц и число переводов за окно — проверкой models.LimitCheck,
+// которую хранилище выполняет в транзакции списания после блокировки
+// отправителя. Поэтому одновременные переводы не превышают ограничения,
+// даже если их выполняют разные экземпляры сервиса. Сервисы переводов
+// и блокировок используют один Limiter. nil-Limiter ничего не ограничивает.
+//
+// Комиссии в ограничения не входят ни при проверке, ни в истории переводов
+// (storage.Storage.OutgoingSince): ограничения задают, сколько клиент может
+// перевести третьим лицам, а комиссию назначает оператор, и ее изменение
+// не должно менять, пройдет ли перевод в пределах лимита.
+type Limiter struct {
+	policy LimitPolicy
+	logger *slog.Logger
+}
+
+// NewLimiter создает проверку ограничений policy.
+func NewLimiter(policy LimitPolicy, logger *slog.Logger) *Limiter {
+	return &Limiter{
+		policy: policy,
+		logger: logger,
+	}
+}
+
+// checkAmount проверяет только предельную сумму одного перевода amount
+// с кошелька from.
+func (l *Limiter) checkAmount(from string, amount money.Money) error {
+	if l == nil {
+		return nil
+	}
+	limits := l.policy.Limits(from)
+	if limits.Currency == amount.Currency && limits.MaxAmount > 0 && amount.Amount > limits.MaxAmount {
+		return l.exceeded(from, amount, &LimitError{Limit: LimitPerTransfer, Max: money.New(limits.MaxAmount, limits.Currency)})
+	}
+	return nil
+}
+
+// check проверяет предельную сумму перевода amount с кошелька from
+// и возвращает проверку сумм за сутки и месяц и числа переводов за окно,
+// которую хранилище выполнит в транзакции перевода (TransferRequest.Check),
+// или nil, если по истории отправитель не ограничен. Проверка возвращает
+// *LimitError.
+func (l *Limiter) check(from string, amount money.Money) (models.LimitCheck, error) {
+	if err := l.checkAmount(from, amount); err != nil {
+		return nil, err
+	}
+	if l == nil {
+		return nil, nil
+	}
+	limits := l.policy.Limits(from)
+	// суммы ограничиваются только в валюте ограничений, число переводов — всегда
+	amountLimited := limits.Currency == amount.Currency && (limits.Daily > 0 || limits.Monthly > 0)
+	if !amountLimited && limits.MaxCount == 0 {
+		return nil, nil
+	}
+
+	return func(outgoing func(since time.Time) (models.Outgoing, error)) error {
+		now := time.Now().UTC()
+		totals := []struct {
+			limit string
+			max   int64
+			since time.Time
+		}{
+			{LimitDaily, limits.Daily, time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)},
+			{LimitMonthly, limits.Monthly, time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)},
+		}
+		for _, total := range totals {
+			if !amountLimited || total.max == 0 {
+				continue
+			}
+			out, err := outgoing(total.since)
+			if err != nil {
+				return err
+			}
+			if amount.Amount > total.max-out.Amount {
+				return l.exceeded(from, amount, &LimitError{Limit: total.limit, Max: money.New(total.max, limits.Currency)})
+			}
+		}
+
+		if limits.MaxCount > 0 {
+			out, err := outgoing(now.Add(-limits.Window))
+			if err != nil {
+				return err
+			}
+			if out.Count >= limits.MaxCount {
+				return l.exceeded(from, amount, &LimitError{Limit: LimitVelocity, MaxCount: limits.MaxCount, Window: limits.Window})
+			}
+		}
+		return nil
+	}, nil
+}
+
+// exceeded логирует отказ по ограничению и возвращает err.
+func (l *Limiter) exceeded(from string, amount money.Money, err *LimitError) error {
+	l.logger.Warn("transfer limit exceeded",
+		"from", from,
+		"amount", amount.String(),
+		"currency", amount.Currency,
+		"limit", err.Limit,
+	)
+	return err
+}
@@ -0,0 +1,171 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixedLimits задает одни ограничения для всех отправителей
+type fixedLimits models.Limits
+
+func (l fixedLimits) Limits(from string) models.Limits {
+	return models.Limits(l)
+}
+
+// setupLimitService создаёт сервис с моком и ограничениями на переводы
+func setupLimitService(limits models.Limits) (TransactionService, *mockStorage) {
+	mock := &mockStorage{}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	return NewTransactionService(mock, nil, nil, NewLimiter(fixedLimits(limits), logger), logger), mock
+}
+
+// assertLimit проверяет, что err сообщает о нарушении ограничения limit
+func assertLimit(t *testing.T, err error, limit string) *LimitError {
+	t.Helper()
+	assert.ErrorIs(t, err, ErrLimitExceeded)
+	var limitErr *LimitError
+	require.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, limit, limitErr.Limit)
+	return limitErr
+}
+
+func TestMakeTransaction_PerTransferLimit(t *testing.T) {
+	service, _ := setupLimitService(models.Limits{Currency: "RUB", MaxAmount: 100000})
+
+	// хранилище не вызывается: мок паникует на любом обращении
+	_, err := service.MakeTransaction(ctx, "a", "b", money.New(100001, "RUB"))
+
+	limitErr := assertLimit(t, err, LimitPerTransfer)
+	assert.Equal(t, money.New(100000, "RUB"), limitErr.Max)
+	assert.EqualError(t, err, "transfer limit exceeded: amount exceeds per-transfer maximum of 1000.00 RUB")
+}
+
+func TestMakeTransaction_DailyLimit(t *testing.T) {
+	service, mock := setupLimitService(models.Limits{Currency: "RUB", Daily: 10000})
+	var since time.Time
+	mock.outgoingSinceFn = func(address string, s time.Time) (storage.Outgoing, error) {
+		assert.Equal(t, "a", address)
+		since = s
+		return storage.Outgoing{Count: 3, Amount: 9000}, nil
+	}
+
+	_, err := service.MakeTransaction(ctx, "a", "b", money.New(1500, "RUB"))
+
+	limitErr := assertLimit(t, err, LimitDaily)
+	assert.Equal(t, money.New(10000, "RUB"), limitErr.Max)
+	assert.EqualError(t, err, "transfer limit exceeded: daily outgoing total would exceed 100.00 RUB")
+	// сутки считаются с полуночи UTC
+	assert.Equal(t, time.Now().UTC().Truncate(24*time.Hour), since)
+}
+
+func TestMakeTransaction_MonthlyLimit(t *testing.T) {
+	service, mock := setupLimitService(models.Limits{Currency: "RUB", Monthly: 50000})
+	var since time.Time
+	mock.outgoingSinceFn = func(address string, s time.Time) (storage.Outgoing, error) {
+		since = s
+		return storage.Outgoing{Count: 10, Amount: 49000}, nil
+	}
+
+	_, err := service.MakeTransaction(ctx, "a", "b", money.New(1500, "RUB"))
+
+	assertLimit(t, err, LimitMonthly)
+	// месяц считается с первого числа, UTC
+	now := time.Now().UTC()
+	assert.Equal(t, time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC), since)
+}
+
+func TestMakeTransaction_VelocityLimit(t *testing.T) {
+	service, mock := setupLimitService(models.Limits{Currency: "RUB", MaxCount: 5, Window: time.Hour})
+	mock.outgoingSinceFn = func(address string, since time.Time) (storage.Outgoing, error) {
+		assert.WithinDuration(t, time.Now().Add(-time.Hour), since, time.Second)
+		return storage.Outgoing{Count: 5, Amount: 500}, nil
+	}
+
+	_, err := service.MakeTransaction(ctx, "a", "b", money.New(100, "RUB"))
+
+	limitErr := assertLimit(t, err, LimitVelocity)
+	assert.Equal(t, 5, limitErr.MaxCount)
+	assert.Equal(t, time.Hour, limitErr.Window)
+	assert.EqualError(t, err, "transfer limit exceeded: at most 5 transfers per 1h0m0s")
+}
+
+func TestMakeTransaction_WithinLimits(t *testing.T) {
+	service, mock := setupLimitService(models.Limits{
+		Currency: "RUB", MaxAmount: 5000, Daily: 10000, Monthly: 50000, MaxCount: 5, Window: time.Hour,
+	})
+	mock.outgoingSinceFn = func(address string, since time.Time) (storage.Outgoing, error) {
+		return storage.Outgoing{Count: 4, Amount: 5000}, nil
+	}
+	mock.transferFn = func(transfer models.TransferRequest) (models.Receipt, error) {
+		return models.Receipt{Transaction: models.Transaction{ID: 1, Amount: transfer.Amount}}, nil
+	}
+
+	// ровно до лимита: 5000 + 5000 = 10000 за сутки, пятый перевод за час
+	receipt, err := service.MakeTransaction(ctx, "a", "b", money.New(5000, "RUB"))
+
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), receipt.ID)
+}
+
+func TestMakeTransaction_LimitsInOtherCurrency(t *testing.T) {
+	service, mock := setupLimitService(models.Limits{Currency: "RUB", MaxAmount: 100, MaxCount: 1, Window: time.Hour})
+	mock.outgoingSinceFn = func(address string, since time.Time) (storage.Outgoing, error) {
+		return storage.Outgoing{Count: 1, Amount: 100}, nil
+	}
+
+	// суммы в другой валюте не ограничиваются, число переводов — ограничивается
+	_, err := service.MakeTransaction(ctx, "a", "b", money.New(100000, "USD"))
+
+	assertLimit(t, err, LimitVelocity)
+}
+
+func TestMakeTransaction_LimitsExcludeFee(t *testing.T) {
+	mock := &mockStorage{}
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	service := NewTransactionService(mock, flatFee, nil, NewLimiter(fixedLimits{Currency: "RUB", MaxAmount: 5000, Daily: 10000}, logger), logger)
+	mock.outgoingSinceFn = func(address string, since time.Time) (storage.Outgoing, error) {
+		return storage.Outgoing{Count: 1, Amount: 5000}, nil
+	}
+	mock.transferFn = func(transfer models.TransferRequest) (models.Receipt, error) {
+		require.NotNil(t, transfer.Fee)
+		return models.Receipt{Transaction: models.Transaction{ID: 1, Amount: transfer.Amount}}, nil
+	}
+
+	// перевод ровно до лимита проходит, хотя вместе с комиссией его превышает
+	_, err := service.MakeTransaction(ctx, "a", "b", money.New(5000, "RUB"))
+	require.NoError(t, err)
+
+	_, err = service.MakeTransaction(ctx, "a", "b", money.New(5001, "RUB"))
+	assertLimit(t, err, LimitPerTransfer)
+}
+
+func TestMakeBatch_AtomicLimitsCheckedByStorage(t *testing.T) {
+	service, mock := setupLimitService(models.Limits{Currency: "RUB", Daily: 10000})
+	mock.outgoingSinceFn = func(address string, since time.Time) (storage.Outgoing, error) {
+		if address == "a" {
+			return storage.Outgoing{Count: 1, Amount: 9000}, nil
+		}
+		return storage.Outgoing{}, nil
+	}
+
+	// хранилище проверяет каждый перевод пакета в транзакции пакета
+	_, err := service.MakeBatch(ctx, []models.TransferRequest{
+		{From: "c", To: "b", Amount: money.New(5000, "RUB")},
+		{From: "a", To: "b", Amount: money.New(1500, "RUB")},
+	}, true)
+
+	var batchErr *storage.BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, 1, batchErr.Index)
+	assertLimit(t, err, LimitDaily)
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"paymentSystem/internal/auth"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/storage"
+)
+
+// transactionPolicy проверяет права вызывающего из контекста перед вызовом
+// сервиса переводов. Без вызывающего (аутентификация отключена) вызовы
+// передаются как есть.
+type transactionPolicy struct {
+	next   TransactionService
+	logger *slog.Logger
+}
+
+// NewTransactionPolicy оборачивает сервис переводов проверкой прав.
+// Отказ возвращается как *auth.ForbiddenError с недостающим правом или кошельком.
+func NewTransactionPolicy(next TransactionService, logger *slog.Logger) TransactionService {
+	return &transactionPolicy{
+		next:   next,
+		logger: logger,
+	}
+}
+
+// MakeTransaction требует PermissionSend и доступа к кошельку отправителя.
+func (p *transactionPolicy) MakeTransaction(ctx context.Context, from, to string, amount money.Money) (models.Receipt, error) {
+	if err := p.check(ctx, "send", auth.Check(ctx, auth.PermissionSend), auth.CheckWallets(ctx, from)); err != nil {
+		return models.Receipt{}, err
+	}
+	return p.next.MakeTransaction(ctx, from, to, amount)
+}
+
+// MakeBatch требует PermissionSend и доступа ко всем отправителям пакета.
+// Пакет с чужим отправителем отклоняется целиком в любом режиме.
+func (p *transactionPolicy) MakeBatch(ctx context.Context, transfers []models.TransferRequest, atomic bool) (BatchResult, error) {
+	if err := p.check(ctx, "send batch", auth.Check(ctx, auth.PermissionSend)); err != nil {
+		return BatchResult{}, err
+	}
+	for i, t := range transfers {
+		if err := p.check(ctx, "send batch", auth.CheckWallets(ctx, t.From)); err != nil {
+			return BatchResult{}, &storage.BatchError{Index: i, Err: err}
+		}
+	}
+	return p.next.MakeBatch(ctx, transfers, atomic)
+}
+
+// GetTransaction требует PermissionHistoryRead и доступа к отправителю или
+// получателю транзакции.
+func (p *transactionPolicy) GetTransaction(ctx context.Context, id int64) (models.Transaction, error) {
+	if err := p.check(ctx, "get transaction", auth.Check(ctx, auth.PermissionHistoryRead)); err != nil {
+		return models.Transaction{}, err
+	}
+	tx, err := p.next.GetTransaction(ctx, id)
+	if err != nil {
+		return models.Transaction{}, err
+	}
+	if err := p.check(ctx, "get transaction", auth.CheckAnyWalletRead(ctx, tx.From, tx.To)); err != nil {
+		return models.Transaction{}, err
+	}
+	return tx, nil
+}
+
+// RefundTransaction разрешает возврат по любой транзакции с
+// PermissionRefundsManage; иначе требует PermissionSend и доступа
+// к получателю исходного перевода, с которого списывается возврат.
+func (p *transactionPolicy) RefundTransaction(ctx context.Context, id int64, amount *money.Money) (models.Receipt, error) {
+	principal, ok := auth.FromContext(ctx)
+	if ok && !principal.HasPermission(auth.PermissionRefundsManage) {
+		if err := p.check(ctx, "refund", auth.Check(ctx, auth.PermissionSend)); err != nil {
+			return models.Receipt{}, err
+		}
+		tx, err := p.next.GetTransaction(ctx, id)
+		if err != nil {
+			return models.Receipt{}, err
+		}
+		if err := p.check(ctx, "refund", auth.CheckWallets(ctx, tx.To)); err != nil {
+			return models.Receipt{}, err
+		}
+	}
+	return p.next.RefundTransaction(ctx, id, amount)
+}
+
+// GetBalance требует PermissionBalanceRead и доступа к кошельку на чтение.
+func (p *transactionPolicy) GetBalance(ctx context.Context, address string) (models.Balance, error) {
+	if err := p.check(ctx, "get balance", auth.Check(ctx, auth.PermissionBalanceRead), auth.CheckWalletsRead(ctx, address)); err != nil {
+		return models.Balance{}, err
+	}
+	return p.next.GetBalance(ctx, address)
+}
+
+// ListTransactions требует PermissionHistoryRead; история без фильтра по
+// кошельку доступна только с AllWallets или PermissionHistoryReadAll.
+func (p *transactionPolicy) ListTransactions(ctx context.Context, query TransactionQuery) (TransactionPage, error) {
+	if err := p.check(ctx, "list transactions", auth.Check(ctx, auth.PermissionHistoryRead), auth.CheckWalletsRead(ctx, query.Wallet)); err != nil {
+		return TransactionPage{}, err
+	}
+	return p.next.ListTransactions(ctx, query)
+}
+
+// ExportTransactions требует PermissionHistoryExport и тех же прав на
+// кошелек, что и ListTransactions.
+func (p *transactionPolicy) ExportTransactions(ctx context.Context, query TransactionQuery, fn func(models.Transaction) error) error {
+	if err := p.check(ctx, "export transactions", auth.Check(ctx, auth.PermissionHistoryExport), auth.CheckWalletsRead(ctx, query.Wallet)); err != nil {
+		return err
+	}
+	return p.next.ExportTransactions(ctx, query, fn)
+}
+
+// check возвращает первую ошибку проверок и записывает отказ в лог.
+func (p *transactionPolicy) check(ctx context.Context, action string, errs ...error) error {
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		principal, _ := auth.FromContext(ctx)
+		p.logger.Warn("access denied",
+			"action", action,
+			"subject", principal.Subject,
+			"roles", principal.Roles,
+			"err", err,
+		)
+		return err
+	}
+	return nil
+}
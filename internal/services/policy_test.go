@@ -0,0 +1,134 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"paymentSystem/internal/auth"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/storage"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupPolicyService создаёт сервис переводов с проверкой прав.
+// Вызовы, отклоненные политикой, не доходят до мока хранилища.
+func setupPolicyService() (TransactionService, *mockStorage) {
+	mock := &mockStorage{}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	return NewTransactionPolicy(NewTransactionService(mock, nil, nil, nil, logger), logger), mock
+}
+
+// withRoles возвращает контекст с вызывающим, получившим права ролей roles.
+func withRoles(wallets []string, roles ...string) context.Context {
+	return auth.NewContext(ctx, auth.DefaultRoles().Grant(auth.Principal{
+		Subject: "test",
+		Wallets: wallets,
+		Roles:   roles,
+	}))
+}
+
+func TestPolicy_NoPrincipal(t *testing.T) {
+	service, mock := setupPolicyService()
+	mock.getBalanceFn = func(address string) (models.Balance, error) {
+		return models.Balance{Total: money.New(100, "RUB")}, nil
+	}
+
+	_, err := service.GetBalance(ctx, "wallet-1")
+
+	assert.NoError(t, err)
+}
+
+func TestPolicy_Denied(t *testing.T) {
+	service, _ := setupPolicyService()
+	customer := withRoles([]string{"wallet-1"}, auth.RoleCustomer)
+	auditor := withRoles([]string{"wallet-1"}, auth.RoleAuditor)
+
+	tests := []struct {
+		name string
+		call func() error
+		want auth.ForbiddenError
+	}{
+		{"customer sends from foreign wallet", func() error {
+			_, err := service.MakeTransaction(customer, "wallet-2", "wallet-1", money.New(100, "RUB"))
+			return err
+		}, auth.ForbiddenError{Wallet: "wallet-2"}},
+		{"customer reads foreign balance", func() error {
+			_, err := service.GetBalance(customer, "wallet-2")
+			return err
+		}, auth.ForbiddenError{Wallet: "wallet-2"}},
+		{"customer exports history", func() error {
+			return service.ExportTransactions(customer, TransactionQuery{Wallet: "wallet-1"}, nil)
+		}, auth.ForbiddenError{Permission: auth.PermissionHistoryExport}},
+		{"auditor sends", func() error {
+			_, err := service.MakeTransaction(auditor, "wallet-1", "wallet-2", money.New(100, "RUB"))
+			return err
+		}, auth.ForbiddenError{Permission: auth.PermissionSend}},
+		{"auditor refunds", func() error {
+			_, err := service.RefundTransaction(auditor, 1, nil)
+			return err
+		}, auth.ForbiddenError{Permission: auth.PermissionSend}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+
+			var forbiddenErr *auth.ForbiddenError
+			require.ErrorAs(t, err, &forbiddenErr)
+			assert.Equal(t, tt.want, *forbiddenErr)
+		})
+	}
+}
+
+func TestPolicy_BatchForeignSender(t *testing.T) {
+	service, _ := setupPolicyService()
+
+	_, err := service.MakeBatch(withRoles([]string{"wallet-1"}, auth.RoleCustomer), []models.TransferRequest{
+		{From: "wallet-1", To: "wallet-2", Amount: money.New(100, "RUB")},
+		{From: "wallet-3", To: "wallet-2", Amount: money.New(100, "RUB")},
+	}, false)
+
+	var batchErr *storage.BatchError
+	require.ErrorAs(t, err, &batchErr)
+	assert.Equal(t, 1, batchErr.Index)
+	assert.ErrorIs(t, batchErr.Err, auth.ErrForbidden)
+}
+
+func TestPolicy_ReadAll(t *testing.T) {
+	service, mock := setupPolicyService()
+	mock.getBalanceFn = func(address string) (models.Balance, error) {
+		return models.Balance{Total: money.New(100, "RUB")}, nil
+	}
+	mock.listTransactionsFn = func(filter storage.TransactionFilter) ([]models.Transaction, error) {
+		return nil, nil
+	}
+	auditor := withRoles([]string{"wallet-1"}, auth.RoleAuditor)
+
+	_, err := service.GetBalance(auditor, "wallet-2")
+	assert.NoError(t, err)
+
+	// история по всем кошелькам без фильтра
+	_, err = service.ListTransactions(auditor, TransactionQuery{})
+	assert.NoError(t, err)
+}
+
+func TestPolicy_RefundOwnIncoming(t *testing.T) {
+	service, mock := setupPolicyService()
+	mock.getTransactionFn = func(id int64) (models.Transaction, error) {
+		return models.Transaction{ID: id, From: "wallet-2", To: "wallet-1", Amount: money.New(100, "RUB")}, nil
+	}
+	mock.listRefundsFn = func(id int64) ([]models.Transaction, error) {
+		return nil, nil
+	}
+
+	// возврат списывается с получателя: отправитель вернуть не может
+	_, err := service.RefundTransaction(withRoles([]string{"wallet-2"}, auth.RoleCustomer), 1, nil)
+
+	var forbiddenErr *auth.ForbiddenError
+	require.ErrorAs(t, err, &forbiddenErr)
+	assert.Equal(t, "wallet-1", forbiddenErr.Wallet)
+}
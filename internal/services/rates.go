@@ -0,0 +1,46 @@
+package services
+
+import (
+	"errors"
+	"log/slog"
+	"paymentSystem/internal/fx"
+)
+
+type RateService interface {
+	// ListRates возвращает текущую таблицу курсов: пара "USD/RUB" → курс.
+	ListRates() map[string]string
+	// ReplaceRates проверяет и целиком заменяет таблицу курсов.
+	ReplaceRates(rates map[string]string) (map[string]string, error)
+}
+
+type rateService struct {
+	rates  *fx.Rates
+	logger *slog.Logger
+}
+
+func NewRateService(rates *fx.Rates, logger *slog.Logger) RateService {
+	return &rateService{
+		rates:  rates,
+		logger: logger,
+	}
+}
+
+// ListRates реализует метод интерфейса для получения курсов.
+func (s *rateService) ListRates() map[string]string {
+	return s.rates.All()
+}
+
+// ReplaceRates реализует метод интерфейса для замены курсов.
+func (s *rateService) ReplaceRates(rates map[string]string) (map[string]string, error) {
+	if err := s.rates.Replace(rates); err != nil {
+		if errors.Is(err, fx.ErrInvalidRate) {
+			s.logger.Warn("invalid exchange rates", "err", err)
+			return nil, err
+		}
+		s.logger.Error("failed to replace exchange rates", "err", err)
+		return nil, ErrInternalError
+	}
+
+	s.logger.Info("exchange rates replaced", "pairs", len(rates))
+	return s.rates.All(), nil
+}
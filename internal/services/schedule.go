@@ -0,0 +1,315 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"paymentSystem/internal/cron"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/ratelimit"
+	"paymentSystem/internal/storage"
+	"time"
+)
+
+// scheduleBatchSize ограничивает число переводов, выполняемых за один вызов RunDue
+const scheduleBatchSize = 100
+
+// ErrInvalidSchedule возвращается для некорректного расписания перевода
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
+// RetryPolicy задает повторы запланированного перевода, которому не хватило
+// средств, который превысил ограничения отправителя или не выполнился
+// из-за внутренней ошибки.
+type RetryPolicy struct {
+	// MaxRetries — число повторов после первой неудачной попытки.
+	MaxRetries int
+	// Interval — пауза перед повтором.
+	Interval time.Duration
+}
+
+type ScheduleService interface {
+	// CreateSchedule планирует перевод. Без cronExpr перевод разовый и
+	// выполняется в runAt. С cronExpr перевод повторяется по расписанию;
+	// первый запуск — в runAt, если оно задано, иначе по расписанию.
+	CreateSchedule(ctx context.Context, from, to string, amount money.Money, runAt time.Time, cronExpr string) (models.Schedule, error)
+	// GetSchedule возвращает запланированный перевод вместе с историей запусков.
+	GetSchedule(ctx context.Context, id int64) (models.Schedule, error)
+	// CancelSchedule отменяет активный запланированный перевод.
+	CancelSchedule(ctx context.Context, id int64) (models.Schedule, error)
+	// RunDue выполняет наступившие переводы через TransactionService и
+	// возвращает число записанных запусков. Отмена ctx прекращает выбор
+	// следующих переводов, но начатый запуск доводится до записи исхода.
+	RunDue(ctx context.Context) (int, error)
+}
+
+type scheduleService struct {
+	storage      storage.Storage
+	transactions TransactionService
+	retry        RetryPolicy
+	logger       *slog.Logger
+}
+
+func NewScheduleService(storage storage.Storage, transactions TransactionService, retry RetryPolicy, logger *slog.Logger) ScheduleService {
+	return &scheduleService{
+		storage:      storage,
+		transactions: transactions,
+		retry:        retry,
+		logger:       logger,
+	}
+}
+
+// CreateSchedule реализует метод интерфейса для планирования перевода.
+func (s *scheduleService) CreateSchedule(ctx context.Context, from, to string, amount money.Money, runAt time.Time, cronExpr string) (models.Schedule, error) {
+	if !amount.IsPositive() {
+		s.logger.Warn("invalid amount", "amount", amount.String())
+		return models.Schedule{}, ErrInvalidAmount
+	}
+	if _, err := money.Exponent(amount.Currency); err != nil {
+		s.logger.Warn("unknown currency", "currency", amount.Currency)
+		return models.Schedule{}, err
+	}
+	if from == to {
+		s.logger.Warn("self transfer attempt", "from", from, "to", to)
+		return models.Schedule{}, ErrSelfTransfer
+	}
+
+	now := time.Now().UTC()
+	nextRunAt := runAt.UTC()
+	if cronExpr != "" {
+		schedule, err := cron.Parse(cronExpr)
+		if err != nil {
+			s.logger.Warn("invalid cron expression", "cron", cronExpr, "err", err)
+			return models.Schedule{}, fmt.Errorf("%w: %v", ErrInvalidSchedule, err)
+		}
+		if runAt.IsZero() {
+			nextRunAt = schedule.Next(now)
+			if nextRunAt.IsZero() {
+				return models.Schedule{}, fmt.Errorf("%w: cron expression never fires", ErrInvalidSchedule)
+			}
+		}
+	} else if runAt.IsZero() {
+		return models.Schedule{}, fmt.Errorf("%w: run_at or cron is required", ErrInvalidSchedule)
+	}
+
+	if err := ratelimit.AllowWallets(ctx, from); err != nil {
+		return models.Schedule{}, err
+	}
+
+	schedule, err := s.storage.CreateSchedule(ctx, models.Schedule{
+		From:      from,
+		To:        to,
+		Amount:    amount,
+		Cron:      cronExpr,
+		NextRunAt: nextRunAt,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return models.Schedule{}, s.handleStorageError(err)
+	}
+
+	s.logger.Info("schedule created",
+		"id", schedule.ID,
+		"from", from,
+		"to", to,
+		"amount", amount.String(),
+		"currency", amount.Currency,
+		"cron", cronExpr,
+		"next_run_at", schedule.NextRunAt,
+	)
+
+	return schedule, nil
+}
+
+// GetSchedule реализует метод интерфейса для получения запланированного перевода.
+func (s *scheduleService) GetSchedule(ctx context.Context, id int64) (models.Schedule, error) {
+	if id <= 0 {
+		return models.Schedule{}, storage.ErrScheduleNotFound
+	}
+
+	schedule, err := s.storage.GetSchedule(ctx, id)
+	if err != nil {
+		return models.Schedule{}, s.handleStorageError(err)
+	}
+	if schedule.Runs, err = s.storage.ListScheduleRuns(ctx, id); err != nil {
+		return models.Schedule{}, s.handleStorageError(err)
+	}
+	return schedule, nil
+}
+
+// CancelSchedule реализует метод интерфейса для отмены запланированного перевода.
+func (s *scheduleService) CancelSchedule(ctx context.Context, id int64) (models.Schedule, error) {
+	if id <= 0 {
+		return models.Schedule{}, storage.ErrScheduleNotFound
+	}
+
+	schedule, err := s.storage.CancelSchedule(ctx, id)
+	if err != nil {
+		return models.Schedule{}, s.handleStorageError(err)
+	}
+
+	s.logger.Info("schedule cancelled", "id", id)
+	return schedule, nil
+}
+
+// RunDue реализует метод интерфейса для выполнения наступивших переводов.
+func (s *scheduleService) RunDue(ctx context.Context) (int, error) {
+	due, err := s.storage.DueSchedules(ctx, time.Now().UTC(), scheduleBatchSize)
+	if err != nil {
+		return 0, s.handleStorageError(err)
+	}
+
+	runs := 0
+	for _, schedule := range due {
+		if err := ctx.Err(); err != nil {
+			return runs, err
+		}
+		// начатый запуск не прерывается остановкой, чтобы исход неудачной
+		// попытки тоже был записан
+		recorded, err := s.run(context.WithoutCancel(ctx), schedule)
+		if err != nil {
+			return runs, err
+		}
+		if recorded {
+			runs++
+		}
+	}
+	return runs, nil
+}
+
+// run выполняет один запланированный перевод и записывает исход.
+// Успешный запуск хранилище записывает в одной транзакции с переводом,
+// поэтому выполненный перевод не повторяется, даже если процесс
+// остановится сразу после него. Срабатывание, которое уже записал другой
+// экземпляр сервиса, пропускается.
+func (s *scheduleService) run(ctx context.Context, schedule models.Schedule) (bool, error) {
+	now := time.Now().UTC()
+	run := models.ScheduleRun{ScheduledAt: schedule.NextRunAt, ExecutedAt: now}
+
+	succeeded := schedule
+	succeeded.Attempts = 0
+	s.advance(&succeeded, now, storage.ScheduleCompleted)
+	scheduled := models.ScheduledTransfer{Schedule: succeeded, Run: run}
+	scheduled.Run.Status = storage.RunSucceeded
+	receipt, err := s.transactions.MakeTransaction(withScheduledTransfer(ctx, scheduled), schedule.From, schedule.To, schedule.Amount)
+
+	switch {
+	case err == nil:
+		s.logger.Info("scheduled transfer executed",
+			"id", schedule.ID,
+			"status", storage.RunSucceeded,
+			"transaction_id", receipt.ID,
+			"next_run_at", succeeded.NextRunAt,
+		)
+		return true, nil
+
+	case errors.Is(err, storage.ErrScheduleNotDue):
+		s.logger.Info("scheduled transfer skipped", "id", schedule.ID, "scheduled_at", run.ScheduledAt)
+		return false, nil
+
+	case errors.Is(err, storage.ErrInsufficientFunds),
+		errors.Is(err, ErrLimitExceeded),
+		errors.Is(err, ErrInternalError),
+		contextError(err) != nil:
+		// средств может стать достаточно, ограничение — освободиться,
+		// а хранилище — снова стать доступным
+		run.Error = err.Error()
+		schedule.Attempts++
+		if schedule.Attempts <= s.retry.MaxRetries {
+			run.Status = storage.RunRetrying
+			schedule.NextRunAt = now.Add(s.retry.Interval)
+		} else {
+			run.Status = storage.RunFailed
+			schedule.Attempts = 0
+			s.advance(&schedule, now, storage.ScheduleFailed)
+		}
+
+	default:
+		// кошелек не найден или закрыт, валюта не совпадает: повтор не поможет
+		run.Status = storage.RunFailed
+		run.Error = err.Error()
+		schedule.Status = storage.ScheduleFailed
+	}
+
+	if _, err := s.storage.RecordScheduleRun(ctx, schedule, run); err != nil {
+		if errors.Is(err, storage.ErrScheduleNotDue) {
+			s.logger.Info("scheduled transfer skipped", "id", schedule.ID, "scheduled_at", run.ScheduledAt)
+			return false, nil
+		}
+		s.logger.Error("failed to record schedule run",
+			"id", schedule.ID,
+			"status", run.Status,
+			"err", err,
+		)
+		return false, s.handleStorageError(err)
+	}
+
+	s.logger.Info("scheduled transfer executed",
+		"id", schedule.ID,
+		"status", run.Status,
+		"attempts", schedule.Attempts,
+		"next_run_at", schedule.NextRunAt,
+		"error", run.Error,
+	)
+	return true, nil
+}
+
+type scheduledTransferKey struct{}
+
+// withScheduledTransfer возвращает контекст, с которым MakeTransaction
+// записывает запуск st в одной транзакции с переводом.
+func withScheduledTransfer(ctx context.Context, st models.ScheduledTransfer) context.Context {
+	return context.WithValue(ctx, scheduledTransferKey{}, st)
+}
+
+// scheduledTransfer возвращает запуск из контекста или nil.
+func scheduledTransfer(ctx context.Context) *models.ScheduledTransfer {
+	st, ok := ctx.Value(scheduledTransferKey{}).(models.ScheduledTransfer)
+	if !ok {
+		return nil
+	}
+	return &st
+}
+
+// advance переводит повторяющийся перевод на следующее срабатывание после now;
+// пропущенные во время простоя срабатывания не наверстываются. Разовый перевод
+// и перевод, расписание которого больше не срабатывает, получают статус final.
+func (s *scheduleService) advance(schedule *models.Schedule, now time.Time, final string) {
+	if schedule.Cron == "" {
+		schedule.Status = final
+		return
+	}
+	expr, err := cron.Parse(schedule.Cron)
+	if err != nil {
+		s.logger.Error("stored cron expression is invalid", "id", schedule.ID, "cron", schedule.Cron, "err", err)
+		schedule.Status = storage.ScheduleFailed
+		return
+	}
+	next := expr.Next(now)
+	if next.IsZero() {
+		schedule.Status = final
+		return
+	}
+	schedule.NextRunAt = next
+}
+
+// handleStorageError преобразует ошибки хранилища в бизнес-ошибки.
+func (s *scheduleService) handleStorageError(err error) error {
+	switch {
+	case contextError(err) != nil:
+		s.logger.Warn("request aborted", "err", err)
+		return contextError(err)
+	case errors.Is(err, storage.ErrWalletNotFound),
+		errors.Is(err, storage.ErrWalletClosed),
+		errors.Is(err, storage.ErrScheduleNotFound),
+		errors.Is(err, storage.ErrScheduleNotActive),
+		errors.Is(err, storage.ErrScheduleNotDue),
+		errors.Is(err, money.ErrCurrencyMismatch):
+		s.logger.Warn("schedule operation rejected", "err", err)
+		return err
+	default:
+		s.logger.Error("unexpected storage error", "err", err)
+		return ErrInternalError
+	}
+}
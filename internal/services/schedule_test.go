@@ -0,0 +1,325 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/ratelimit"
+	"paymentSystem/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testRetryPolicy = RetryPolicy{MaxRetries: 2, Interval: time.Hour}
+
+// setupScheduleService создаёт сервис запланированных переводов поверх
+// настоящего сервиса переводов; оба работают с одним моком хранилища
+func setupScheduleService() (ScheduleService, *mockStorage) {
+	mock := &mockStorage{}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	transactions := NewTransactionService(mock, nil, nil, nil, logger)
+	return NewScheduleService(mock, transactions, testRetryPolicy, logger), mock
+}
+
+// recordRuns подменяет запись запусков и возвращает указатели на сохраненные значения
+func recordRuns(mock *mockStorage) (*models.Schedule, *[]models.ScheduleRun) {
+	var saved models.Schedule
+	var runs []models.ScheduleRun
+	mock.recordScheduleRunFn = func(schedule models.Schedule, run models.ScheduleRun) (models.ScheduleRun, error) {
+		saved = schedule
+		runs = append(runs, run)
+		return run, nil
+	}
+	return &saved, &runs
+}
+
+// executeScheduled подменяет перевод успешным и возвращает указатель на
+// запуски, которые хранилище записало вместе с переводами
+func executeScheduled(mock *mockStorage) *[]models.ScheduledTransfer {
+	var executed []models.ScheduledTransfer
+	mock.transferFn = func(transfer models.TransferRequest) (models.Receipt, error) {
+		if transfer.Schedule == nil {
+			return models.Receipt{}, errors.New("scheduled transfer without run")
+		}
+		executed = append(executed, *transfer.Schedule)
+		return models.Receipt{Transaction: models.Transaction{ID: 42}}, nil
+	}
+	return &executed
+}
+
+func dueOnce(mock *mockStorage, schedule models.Schedule) {
+	mock.dueSchedulesFn = func(now time.Time, limit int) ([]models.Schedule, error) {
+		return []models.Schedule{schedule}, nil
+	}
+}
+
+func TestCreateSchedule_Recurring(t *testing.T) {
+	service, mock := setupScheduleService()
+
+	mock.createScheduleFn = func(schedule models.Schedule) (models.Schedule, error) {
+		assert.Equal(t, "@daily", schedule.Cron)
+		// без run_at первый запуск — ближайшая полночь
+		assert.True(t, schedule.NextRunAt.After(time.Now()))
+		assert.Equal(t, 0, schedule.NextRunAt.Hour())
+		assert.Equal(t, 0, schedule.NextRunAt.Minute())
+		schedule.ID = 1
+		return schedule, nil
+	}
+
+	schedule, err := service.CreateSchedule(ctx, "a", "b", money.New(500, "RUB"), time.Time{}, "@daily")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), schedule.ID)
+}
+
+func TestCreateSchedule_WalletRateLimit(t *testing.T) {
+	service, _ := setupScheduleService()
+
+	var charged []string
+	_, err := service.CreateSchedule(walletLimit(&charged, &ratelimit.LimitError{}), "a", "b", money.New(500, "RUB"), time.Now().Add(time.Hour), "")
+	assert.ErrorIs(t, err, ratelimit.ErrLimited)
+	assert.Equal(t, []string{"a"}, charged)
+}
+
+func TestCreateSchedule_Invalid(t *testing.T) {
+	service, _ := setupScheduleService()
+	amount := money.New(500, "RUB")
+	runAt := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		from   string
+		amount money.Money
+		runAt  time.Time
+		cron   string
+		err    error
+	}{
+		{"no run_at and cron", "a", amount, time.Time{}, "", ErrInvalidSchedule},
+		{"bad cron", "a", amount, runAt, "every day", ErrInvalidSchedule},
+		{"never fires", "a", amount, time.Time{}, "0 0 30 2 *", ErrInvalidSchedule},
+		{"self transfer", "b", amount, runAt, "", ErrSelfTransfer},
+		{"zero amount", "a", money.New(0, "RUB"), runAt, "", ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.CreateSchedule(ctx, tt.from, "b", tt.amount, tt.runAt, tt.cron)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestRunDue_OneOffSuccess(t *testing.T) {
+	service, mock := setupScheduleService()
+	runAt := time.Now().Add(-time.Minute).UTC()
+	dueOnce(mock, models.Schedule{ID: 1, From: "a", To: "b", Amount: money.New(500, "RUB"), NextRunAt: runAt, Status: storage.ScheduleActive})
+	executed := executeScheduled(mock)
+
+	// успешный запуск записывается вместе с переводом, отдельной записи нет:
+	// мок без recordScheduleRunFn запаниковал бы
+	n, err := service.RunDue(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	require.Len(t, *executed, 1)
+	assert.Equal(t, storage.ScheduleCompleted, (*executed)[0].Schedule.Status)
+	assert.Equal(t, storage.RunSucceeded, (*executed)[0].Run.Status)
+	assert.Equal(t, runAt, (*executed)[0].Run.ScheduledAt)
+}
+
+func TestRunDue_RecurringAdvances(t *testing.T) {
+	service, mock := setupScheduleService()
+	dueOnce(mock, models.Schedule{
+		ID: 1, From: "a", To: "b", Amount: money.New(500, "RUB"), Cron: "@hourly",
+		Status: storage.ScheduleActive, NextRunAt: time.Now().Add(-3 * time.Hour),
+	})
+	executed := executeScheduled(mock)
+
+	_, err := service.RunDue(ctx)
+
+	// пропущенные срабатывания не наверстываются: следующий запуск — в ближайший час
+	require.NoError(t, err)
+	require.Len(t, *executed, 1)
+	saved := (*executed)[0].Schedule
+	assert.Equal(t, storage.ScheduleActive, saved.Status)
+	assert.True(t, saved.NextRunAt.After(time.Now()))
+	assert.WithinDuration(t, time.Now().Truncate(time.Hour).Add(time.Hour), saved.NextRunAt, time.Second)
+}
+
+func TestRunDue_SkipsRecordedFire(t *testing.T) {
+	service, mock := setupScheduleService()
+	dueOnce(mock, models.Schedule{ID: 1, From: "a", To: "b", Amount: money.New(500, "RUB"), Status: storage.ScheduleActive})
+	// срабатывание уже выполнил другой экземпляр сервиса
+	mock.transferFn = func(transfer models.TransferRequest) (models.Receipt, error) {
+		return models.Receipt{}, storage.ErrScheduleNotDue
+	}
+
+	n, err := service.RunDue(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestRunDue_RetriesInsufficientFunds(t *testing.T) {
+	service, mock := setupScheduleService()
+	schedule := models.Schedule{ID: 1, From: "a", To: "b", Amount: money.New(500, "RUB"), Status: storage.ScheduleActive}
+	mock.transferFn = func(transfer models.TransferRequest) (models.Receipt, error) {
+		return models.Receipt{}, storage.ErrInsufficientFunds
+	}
+	saved, runs := recordRuns(mock)
+
+	// MaxRetries = 2: первая попытка и два повтора, затем перевод считается неудачным
+	for i := 0; i < 3; i++ {
+		dueOnce(mock, schedule)
+		_, err := service.RunDue(ctx)
+		require.NoError(t, err)
+		schedule = *saved
+	}
+
+	require.Len(t, *runs, 3)
+	assert.Equal(t, storage.RunRetrying, (*runs)[0].Status)
+	assert.Equal(t, storage.RunRetrying, (*runs)[1].Status)
+	assert.Equal(t, storage.RunFailed, (*runs)[2].Status)
+	assert.Equal(t, "insufficient funds", (*runs)[2].Error)
+	assert.Equal(t, storage.ScheduleFailed, saved.Status)
+}
+
+func TestRunDue_RetryDelay(t *testing.T) {
+	service, mock := setupScheduleService()
+	dueOnce(mock, models.Schedule{ID: 1, From: "a", To: "b", Amount: money.New(500, "RUB"), Status: storage.ScheduleActive})
+	mock.transferFn = func(transfer models.TransferRequest) (models.Receipt, error) {
+		return models.Receipt{}, storage.ErrInsufficientFunds
+	}
+	saved, _ := recordRuns(mock)
+
+	_, err := service.RunDue(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, storage.ScheduleActive, saved.Status)
+	assert.Equal(t, 1, saved.Attempts)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), saved.NextRunAt, time.Second)
+}
+
+func TestRunDue_PermanentFailure(t *testing.T) {
+	service, mock := setupScheduleService()
+	dueOnce(mock, models.Schedule{
+		ID: 1, From: "a", To: "b", Amount: money.New(500, "RUB"), Cron: "@daily", Status: storage.ScheduleActive,
+	})
+	mock.transferFn = func(transfer models.TransferRequest) (models.Receipt, error) {
+		return models.Receipt{}, storage.ErrWalletClosed
+	}
+	saved, runs := recordRuns(mock)
+
+	_, err := service.RunDue(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, storage.ScheduleFailed, saved.Status)
+	assert.Equal(t, storage.RunFailed, (*runs)[0].Status)
+}
+
+func TestRunDue_RetriesInternalError(t *testing.T) {
+	service, mock := setupScheduleService()
+	runAt := time.Now().Add(-time.Minute).UTC()
+	dueOnce(mock, models.Schedule{ID: 1, From: "a", To: "b", Amount: money.New(500, "RUB"), NextRunAt: runAt, Status: storage.ScheduleActive})
+	mock.transferFn = func(transfer models.TransferRequest) (models.Receipt, error) {
+		return models.Receipt{}, errors.New("disk I/O error")
+	}
+	saved, runs := recordRuns(mock)
+
+	n, err := service.RunDue(ctx)
+
+	// внутренняя ошибка повторяется по RetryPolicy, а не на каждом вызове RunDue
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 1, saved.Attempts)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), saved.NextRunAt, time.Second)
+	require.Len(t, *runs, 1)
+	assert.Equal(t, storage.RunRetrying, (*runs)[0].Status)
+	assert.Equal(t, runAt, (*runs)[0].ScheduledAt)
+}
+
+func TestRunDue_FailureAlreadyRecorded(t *testing.T) {
+	service, mock := setupScheduleService()
+	dueOnce(mock, models.Schedule{ID: 1, From: "a", To: "b", Amount: money.New(500, "RUB"), Status: storage.ScheduleActive})
+	mock.transferFn = func(transfer models.TransferRequest) (models.Receipt, error) {
+		return models.Receipt{}, storage.ErrInsufficientFunds
+	}
+	mock.recordScheduleRunFn = func(schedule models.Schedule, run models.ScheduleRun) (models.ScheduleRun, error) {
+		return models.ScheduleRun{}, storage.ErrScheduleNotDue
+	}
+
+	n, err := service.RunDue(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestRunDue_StopsOnCancel(t *testing.T) {
+	service, mock := setupScheduleService()
+	canceled, cancel := context.WithCancel(ctx)
+	mock.dueSchedulesFn = func(now time.Time, limit int) ([]models.Schedule, error) {
+		return []models.Schedule{
+			{ID: 1, From: "a", To: "b", Amount: money.New(500, "RUB")},
+			{ID: 2, From: "a", To: "b", Amount: money.New(500, "RUB")},
+		}, nil
+	}
+	// остановка приходит во время первого перевода: он доводится до конца,
+	// второй не начинается
+	transfers := 0
+	mock.transferFn = func(transfer models.TransferRequest) (models.Receipt, error) {
+		transfers++
+		cancel()
+		return models.Receipt{Transaction: models.Transaction{ID: 42}}, nil
+	}
+
+	n, err := service.RunDue(canceled)
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, 1, transfers)
+}
+
+func TestGetSchedule_WithRuns(t *testing.T) {
+	service, mock := setupScheduleService()
+
+	mock.getScheduleFn = func(id int64) (models.Schedule, error) {
+		return models.Schedule{ID: id}, nil
+	}
+	mock.listScheduleRunsFn = func(id int64) ([]models.ScheduleRun, error) {
+		return []models.ScheduleRun{{ID: 1, ScheduleID: id, Status: storage.RunSucceeded}}, nil
+	}
+
+	schedule, err := service.GetSchedule(ctx, 3)
+	require.NoError(t, err)
+	assert.Len(t, schedule.Runs, 1)
+
+	_, err = service.GetSchedule(ctx, 0)
+	assert.ErrorIs(t, err, storage.ErrScheduleNotFound)
+}
+
+func TestRunDue_RetriesLimitExceeded(t *testing.T) {
+	mock := &mockStorage{}
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	transactions := NewTransactionService(mock, nil, nil, NewLimiter(fixedLimits{Currency: "RUB", Daily: 1000}, logger), logger)
+	service := NewScheduleService(mock, transactions, testRetryPolicy, logger)
+	dueOnce(mock, models.Schedule{ID: 1, From: "a", To: "b", Amount: money.New(500, "RUB"), Status: storage.ScheduleActive})
+	mock.outgoingSinceFn = func(address string, since time.Time) (storage.Outgoing, error) {
+		return storage.Outgoing{Count: 2, Amount: 900}, nil
+	}
+	saved, runs := recordRuns(mock)
+
+	_, err := service.RunDue(ctx)
+
+	// суточный лимит освободится, поэтому перевод повторяется, а не отменяется
+	require.NoError(t, err)
+	assert.Equal(t, storage.ScheduleActive, saved.Status)
+	assert.Equal(t, 1, saved.Attempts)
+	require.Len(t, *runs, 1)
+	assert.Equal(t, storage.RunRetrying, (*runs)[0].Status)
+	assert.Contains(t, (*runs)[0].Error, "daily outgoing total")
+}
@@ -8,10 +8,18 @@
 package services
 
 import (
+	"context"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"log/slog"
+	"paymentSystem/internal/fx"
 	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/ratelimit"
 	"paymentSystem/internal/storage"
+	"strconv"
+	"time"
 )
 
 // Ошибки, возникающие на уровне сервиса
@@ -24,111 +32,473 @@ var (
 
 	// ErrInternalError возвращается при неожиданных ошибках
 	ErrInternalError = errors.New("internal error")
+
+	// ErrInvalidCursor возвращается, если курсор истории не удалось разобрать
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	// ErrInvalidFilter возвращается при противоречивых параметрах фильтра истории
+	ErrInvalidFilter = errors.New("invalid filter")
 )
 
+// TransactionQuery — параметры запроса истории транзакций.
+// Пустые поля выборку не ограничивают.
+type TransactionQuery struct {
+	// Cursor — значение NextCursor предыдущей страницы.
+	Cursor string
+	// Limit — размер страницы; 0 означает DefaultPageSize.
+	// При выгрузке 0 снимает ограничение.
+	Limit int
+	// Wallet оставляет переводы кошелька; Direction (in/out) уточняет направление.
+	Wallet    string
+	Direction string
+	// FromTime и ToTime ограничивают время создания: FromTime <= t < ToTime.
+	FromTime time.Time
+	ToTime   time.Time
+	// MinAmount и MaxAmount ограничивают сумму; при указании обеих валюта должна совпадать.
+	MinAmount *money.Money
+	MaxAmount *money.Money
+}
+
+// TransactionPage — страница истории транзакций.
+// NextCursor пуст, если страница последняя.
+type TransactionPage struct {
+	Transactions []models.Transaction `json:"transactions"`
+	NextCursor   string               `json:"next_cursor,omitempty"`
+}
+
 type TransactionService interface {
-	MakeTransaction(from, to string, amount float64) error
-	GetBalance(address string) (float64, error)
-	GetRecentTransactions(n int) ([]models.Transaction, error)
+	MakeTransaction(ctx context.Context, from, to string, amount money.Money) (models.Receipt, error)
+	// GetTransaction возвращает транзакцию вместе с возвратами по ней.
+	GetTransaction(ctx context.Context, id int64) (models.Transaction, error)
+	// RefundTransaction возвращает amount по транзакции id; amount == nil
+	// означает весь еще не возвращенный остаток.
+	RefundTransaction(ctx context.Context, id int64, amount *money.Money) (models.Receipt, error)
+	// MakeBatch выполняет пакет переводов. При atomic пакет применяется
+	// целиком или не применяется вовсе; иначе каждый перевод выполняется
+	// отдельно, а результат содержит исход каждого из них.
+	MakeBatch(ctx context.Context, transfers []models.TransferRequest, atomic bool) (BatchResult, error)
+	GetBalance(ctx context.Context, address string) (models.Balance, error)
+	ListTransactions(ctx context.Context, query TransactionQuery) (TransactionPage, error)
+	ExportTransactions(ctx context.Context, query TransactionQuery, fn func(models.Transaction) error) error
+}
+
+// FeePolicy рассчитывает комиссию за перевод; nil означает перевод без комиссии.
+type FeePolicy interface {
+	Fee(from string, amount money.Money) *models.Fee
+}
+
+// Converter пересчитывает сумму в другую валюту по текущему курсу
+// и возвращает ее вместе с примененным курсом.
+type Converter interface {
+	Convert(amount money.Money, currency string) (money.Money, string, error)
 }
 
 type transactionService struct {
 	storage storage.Storage
+	fees    FeePolicy
+	rates   Converter
+	limits  *Limiter
 	logger  *slog.Logger
 }
 
-func NewTransactionService(storage storage.Storage, logger *slog.Logger) TransactionService {
+// NewTransactionService создает сервис переводов. fees == nil отключает
+// комиссии, rates == nil — переводы между валютами, limits == nil —
+// ограничения на исходящие переводы.
+func NewTransactionService(storage storage.Storage, fees FeePolicy, rates Converter, limits *Limiter, logger *slog.Logger) TransactionService {
 	return &transactionService{
 		storage: storage,
+		fees:    fees,
+		rates:   rates,
+		limits:  limits,
 		logger:  logger,
 	}
 }
 
 // MakeTransaction реализует метод интерфейса для выполнения перевода.
-func (s *transactionService) MakeTransaction(from, to string, amount float64) error {
-	if amount <= 0 {
-		s.logger.Warn("invalid amount", "amount", amount)
-		return ErrInvalidAmount
-	}
-	if from == to {
-		s.logger.Warn("self transfer attempt", "from", from, "to", to)
-		return ErrSelfTransfer
+func (s *transactionService) MakeTransaction(ctx context.Context, from, to string, amount money.Money) (models.Receipt, error) {
+	if err := s.validateTransfer(from, to, amount); err != nil {
+		return models.Receipt{}, err
 	}
 
 	s.logger.Info("transaction initialized",
 		"from", from,
 		"to", to,
-		"amount", amount,
+		"amount", amount.String(),
+		"currency", amount.Currency,
 	)
 
-	if err := s.storage.Transfer(from, to, amount); err != nil {
-		return s.handleStorageError(err, amount)
+	if err := ratelimit.AllowWallets(ctx, from); err != nil {
+		return models.Receipt{}, err
+	}
+	check, err := s.limits.check(from, amount)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	transfer, err := s.prepareTransfer(ctx, models.TransferRequest{From: from, To: to, Amount: amount, Check: check})
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	transfer.Schedule = scheduledTransfer(ctx)
+	receipt, err := s.storage.Transfer(ctx, transfer)
+	if err != nil {
+		return models.Receipt{}, s.handleStorageError(err, amount)
 	}
 
 	s.logger.Info("transaction completed",
+		"id", receipt.ID,
 		"from", from,
 		"to", to,
-		"amount", amount,
+		"amount", amount.String(),
+		"currency", amount.Currency,
+		"credit", receipt.Credit().String(),
+		"rate", receipt.Rate,
+		"fee", feeString(transfer.Fee),
 	)
 
+	return receipt, nil
+}
+
+// prepareTransfer рассчитывает комиссию за перевод и, если получатель ведет
+// кошелек в другой валюте, сумму зачисления по текущему курсу.
+func (s *transactionService) prepareTransfer(ctx context.Context, t models.TransferRequest) (models.TransferRequest, error) {
+	if s.fees != nil {
+		t.Fee = s.fees.Fee(t.From, t.Amount)
+	}
+	if s.rates == nil {
+		return t, nil
+	}
+
+	receiver, err := s.storage.GetWallet(ctx, t.To)
+	if err != nil {
+		return models.TransferRequest{}, s.handleStorageError(err, t.Amount)
+	}
+	if receiver.Balance.Currency == t.Amount.Currency {
+		return t, nil
+	}
+	credit, rate, err := s.rates.Convert(t.Amount, receiver.Balance.Currency)
+	if err != nil {
+		return models.TransferRequest{}, s.handleStorageError(err, t.Amount)
+	}
+	t.Conversion = &models.Conversion{Amount: credit, Rate: rate}
+	return t, nil
+}
+
+// feeString форматирует комиссию для логов.
+func feeString(fee *models.Fee) string {
+	if fee == nil {
+		return "0"
+	}
+	return fee.Amount.String()
+}
+
+// validateTransfer проверяет перевод до обращения к хранилищу:
+// сумма положительна, валюта известна, отправитель и получатель различны.
+func (s *transactionService) validateTransfer(from, to string, amount money.Money) error {
+	if !amount.IsPositive() {
+		s.logger.Warn("invalid amount", "amount", amount.String())
+		return ErrInvalidAmount
+	}
+	if _, err := money.Exponent(amount.Currency); err != nil {
+		s.logger.Warn("unknown currency", "currency", amount.Currency)
+		return err
+	}
+	if from == to {
+		s.logger.Warn("self transfer attempt", "from", from, "to", to)
+		return ErrSelfTransfer
+	}
 	return nil
 }
 
+// GetTransaction реализует метод интерфейса для получения транзакции по ID.
+func (s *transactionService) GetTransaction(ctx context.Context, id int64) (models.Transaction, error) {
+	if id <= 0 {
+		s.logger.Warn("invalid transaction id", "id", id)
+		return models.Transaction{}, storage.ErrTransactionNotFound
+	}
+
+	tx, err := s.storage.GetTransaction(ctx, id)
+	if err != nil {
+		return models.Transaction{}, s.handleStorageError(err, money.Money{})
+	}
+	if tx.Refunds, err = s.storage.ListRefunds(ctx, id); err != nil {
+		return models.Transaction{}, s.handleStorageError(err, money.Money{})
+	}
+	return tx, nil
+}
+
+// RefundTransaction реализует метод интерфейса для возврата по транзакции.
+func (s *transactionService) RefundTransaction(ctx context.Context, id int64, amount *money.Money) (models.Receipt, error) {
+	if id <= 0 {
+		s.logger.Warn("invalid transaction id", "id", id)
+		return models.Receipt{}, storage.ErrTransactionNotFound
+	}
+
+	if amount != nil && !amount.IsPositive() {
+		s.logger.Warn("invalid amount", "amount", amount.String())
+		return models.Receipt{}, ErrInvalidAmount
+	}
+
+	tx, err := s.GetTransaction(ctx, id)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	// возврат списывается с получателя исходного перевода
+	if err := ratelimit.AllowWallets(ctx, tx.To); err != nil {
+		return models.Receipt{}, err
+	}
+
+	var refund money.Money
+	if amount != nil {
+		refund = *amount
+	} else {
+		refund = tx.Amount
+		for _, r := range tx.Refunds {
+			refund.Amount -= r.Credit().Amount
+		}
+		if !refund.IsPositive() {
+			s.logger.Warn("transaction already refunded", "id", id)
+			return models.Receipt{}, storage.ErrRefundExceedsAmount
+		}
+	}
+
+	receipt, err := s.storage.Refund(ctx, id, refund)
+	if err != nil {
+		return models.Receipt{}, s.handleStorageError(err, refund)
+	}
+
+	s.logger.Info("transaction refunded",
+		"id", receipt.ID,
+		"refund_of", id,
+		"amount", refund.String(),
+		"currency", refund.Currency,
+	)
+
+	return receipt, nil
+}
+
 // GetBalance реализует метод интерфейса для получения баланса.
-func (s *transactionService) GetBalance(address string) (float64, error) {
+func (s *transactionService) GetBalance(ctx context.Context, address string) (models.Balance, error) {
 	s.logger.Info("get balance",
 		"address", address,
 	)
 
-	balance, err := s.storage.GetBalance(address)
+	balance, err := s.storage.GetBalance(ctx, address)
 	if err != nil {
 		s.logger.Error("failed to get balance", "address", address, "error", err)
-		return 0, s.handleStorageError(err, 0)
+		return models.Balance{}, s.handleStorageError(err, money.Money{})
 	}
 
 	s.logger.Info("get balance",
 		"address", address,
-		"balance", balance,
+		"balance", balance.Total.String(),
+		"available", balance.Available.String(),
+		"currency", balance.Total.Currency,
 	)
 
 	return balance, nil
 }
 
-// GetRecentTransactions реализует метод интерфейса для получения транзакций.
-func (s *transactionService) GetRecentTransactions(n int) ([]models.Transaction, error) {
-	if n <= 0 {
-		s.logger.Warn("invalid amount", "amount", n)
-		return nil, ErrInvalidAmount
+// ListTransactions реализует метод интерфейса для постраничного получения истории.
+// Запрашивает у хранилища на одну транзакцию больше страницы, чтобы понять,
+// есть ли следующая, и кодирует ID последней транзакции страницы в курсор.
+func (s *transactionService) ListTransactions(ctx context.Context, query TransactionQuery) (TransactionPage, error) {
+	pageSize := query.Limit
+	if pageSize == 0 {
+		pageSize = DefaultPageSize
+	}
+	if pageSize < 0 || pageSize > MaxPageSize {
+		s.logger.Warn("invalid pagination", "limit", query.Limit)
+		return TransactionPage{}, ErrInvalidPagination
 	}
 
-	s.logger.Info("get recent transactions",
-		"count", n,
-	)
+	filter, err := s.transactionFilter(query)
+	if err != nil {
+		return TransactionPage{}, err
+	}
+	filter.Limit = pageSize + 1
 
-	transactions, err := s.storage.GetLastNTransactions(n)
+	s.logger.Info("list transactions", "filter", filter)
+
+	transactions, err := s.storage.ListTransactions(ctx, filter)
 	if err != nil {
-		return nil, err
+		return TransactionPage{}, s.handleStorageError(err, money.Money{})
 	}
 
-	s.logger.Info("get recent transactions",
-		"count", n,
-		"transactions", transactions,
-	)
+	page := TransactionPage{Transactions: transactions}
+	if len(transactions) > pageSize {
+		page.Transactions = transactions[:pageSize]
+		page.NextCursor = encodeCursor(page.Transactions[pageSize-1].ID)
+	}
+	if page.Transactions == nil {
+		page.Transactions = []models.Transaction{}
+	}
+	return page, nil
+}
+
+// ExportTransactions передает fn все транзакции по фильтру запроса, читая их
+// из хранилища потоком. Ошибка fn прерывает выгрузку и возвращается как есть.
+func (s *transactionService) ExportTransactions(ctx context.Context, query TransactionQuery, fn func(models.Transaction) error) error {
+	if query.Limit < 0 {
+		s.logger.Warn("invalid pagination", "limit", query.Limit)
+		return ErrInvalidPagination
+	}
+
+	filter, err := s.transactionFilter(query)
+	if err != nil {
+		return err
+	}
+	filter.Limit = query.Limit
+
+	s.logger.Info("export transactions", "filter", filter)
+
+	var fnErr error
+	count := 0
+	err = s.storage.EachTransaction(ctx, filter, func(tx models.Transaction) error {
+		if fnErr = fn(tx); fnErr != nil {
+			return fnErr
+		}
+		count++
+		return nil
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	if err != nil {
+		return s.handleStorageError(err, money.Money{})
+	}
+
+	s.logger.Info("export transactions completed", "count", count)
+	return nil
+}
+
+// transactionFilter проверяет параметры запроса (кроме лимита)
+// и переводит их в фильтр хранилища.
+func (s *transactionService) transactionFilter(query TransactionQuery) (storage.TransactionFilter, error) {
+	filter := storage.TransactionFilter{
+		Wallet:    query.Wallet,
+		Direction: query.Direction,
+		FromTime:  query.FromTime,
+		ToTime:    query.ToTime,
+	}
+
+	if query.Cursor != "" {
+		id, err := decodeCursor(query.Cursor)
+		if err != nil {
+			s.logger.Warn("invalid cursor", "cursor", query.Cursor)
+			return storage.TransactionFilter{}, ErrInvalidCursor
+		}
+		filter.BeforeID = id
+	}
+
+	switch filter.Direction {
+	case "":
+	case storage.DirectionIn, storage.DirectionOut:
+		if filter.Wallet == "" {
+			return storage.TransactionFilter{}, fmt.Errorf("%w: direction requires wallet", ErrInvalidFilter)
+		}
+	default:
+		return storage.TransactionFilter{}, fmt.Errorf("%w: unknown direction %q", ErrInvalidFilter, filter.Direction)
+	}
+
+	if !filter.FromTime.IsZero() && !filter.ToTime.IsZero() && !filter.FromTime.Before(filter.ToTime) {
+		return storage.TransactionFilter{}, fmt.Errorf("%w: from_time must be before to_time", ErrInvalidFilter)
+	}
+
+	if query.MinAmount != nil {
+		filter.Currency = query.MinAmount.Currency
+		filter.MinAmount = query.MinAmount.Amount
+	}
+	if query.MaxAmount != nil {
+		if filter.Currency != "" && filter.Currency != query.MaxAmount.Currency {
+			return storage.TransactionFilter{}, money.ErrCurrencyMismatch
+		}
+		filter.Currency = query.MaxAmount.Currency
+		filter.MaxAmount = query.MaxAmount.Amount
+	}
+	if filter.MinAmount < 0 || filter.MaxAmount < 0 {
+		return storage.TransactionFilter{}, ErrInvalidAmount
+	}
+	if filter.MaxAmount > 0 && filter.MinAmount > filter.MaxAmount {
+		return storage.TransactionFilter{}, fmt.Errorf("%w: min_amount exceeds max_amount", ErrInvalidFilter)
+	}
 
-	return transactions, nil
+	return filter, nil
+}
+
+// encodeCursor кодирует ID последней транзакции страницы в непрозрачный курсор.
+func encodeCursor(id int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(id, 10)))
+}
+
+// decodeCursor извлекает ID транзакции из курсора.
+func decodeCursor(cursor string) (int64, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if id <= 0 {
+		return 0, errors.New("cursor id must be positive")
+	}
+	return id, nil
 }
 
 // handleStorageError преобразует ошибки хранилища в бизнес-ошибки.
-func (s *transactionService) handleStorageError(err error, amount float64) error {
+func (s *transactionService) handleStorageError(err error, amount money.Money) error {
 	switch {
+	case contextError(err) != nil:
+		s.logger.Warn("request aborted", "err", err)
+		return contextError(err)
 	case errors.Is(err, storage.ErrInsufficientFunds):
-		s.logger.Warn("insufficient funds", "amount", amount, "err", err)
+		s.logger.Warn("insufficient funds", "amount", amount.String(), "err", err)
 		return storage.ErrInsufficientFunds
+	case errors.Is(err, ErrLimitExceeded):
+		// отказ уже залогирован Limiter
+		return err
+	case errors.Is(err, storage.ErrRefundInsufficientFunds),
+		errors.Is(err, storage.ErrRefundExceedsAmount),
+		errors.Is(err, storage.ErrRefundOfRefund),
+		errors.Is(err, storage.ErrRefundOfFee):
+		s.logger.Warn("refund rejected", "amount", amount.String(), "err", err)
+		return err
 	case errors.Is(err, storage.ErrWalletNotFound):
 		s.logger.Warn("wallet not found", "err", err)
 		return storage.ErrWalletNotFound
+	case errors.Is(err, storage.ErrTransactionNotFound):
+		s.logger.Warn("transaction not found", "err", err)
+		return storage.ErrTransactionNotFound
+	case errors.Is(err, storage.ErrScheduleNotDue):
+		s.logger.Warn("scheduled transfer already recorded", "err", err)
+		return storage.ErrScheduleNotDue
+	case errors.Is(err, storage.ErrWalletClosed):
+		s.logger.Warn("wallet closed", "err", err)
+		return storage.ErrWalletClosed
+	case errors.Is(err, money.ErrCurrencyMismatch):
+		s.logger.Warn("currency mismatch", "currency", amount.Currency, "err", err)
+		return money.ErrCurrencyMismatch
+	case errors.Is(err, fx.ErrRateNotFound),
+		errors.Is(err, fx.ErrAmountTooSmall),
+		errors.Is(err, money.ErrOverflow):
+		s.logger.Warn("conversion failed", "amount", amount.String(), "err", err)
+		return err
 	default:
 		s.logger.Error("unexpected storage error", "err", err)
 		return ErrInternalError
 	}
 }
+
+// contextError возвращает context.Canceled или context.DeadlineExceeded,
+// если операция прервана отменой запроса или истечением дедлайна, иначе nil.
+func contextError(err error) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return context.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return context.DeadlineExceeded
+	default:
+		return nil
+	}
+}
@@ -3,44 +3,340 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"log/slog"
+	"paymentSystem/internal/fx"
 	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/ratelimit"
 	"paymentSystem/internal/storage"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-// mockStorage реализует интерфейс storage.Storage для тестов
+var ctx = context.Background()
+
+// mockStorage реализует интерфейс storage.Storage для тестов.
+// Методы без подмены обращаются к nil-интерфейсу и паникуют.
 type mockStorage struct {
-	transferFn             func(from, to string, amount float64) error
-	getBalanceFn           func(address string) (float64, error)
-	getLastNTransactionsFn func(n int) ([]models.Transaction, error)
+	storage.Storage
+
+	transferFn         func(transfer models.TransferRequest) (models.Receipt, error)
+	transferBatchFn    func(transfers []models.TransferRequest) ([]models.Receipt, error)
+	getTransactionFn   func(id int64) (models.Transaction, error)
+	refundFn           func(id int64, amount money.Money) (models.Receipt, error)
+	listRefundsFn      func(id int64) ([]models.Transaction, error)
+	getBalanceFn       func(address string) (models.Balance, error)
+	listTransactionsFn func(filter storage.TransactionFilter) ([]models.Transaction, error)
+	eachTransactionFn  func(filter storage.TransactionFilter, fn func(models.Transaction) error) error
+	outgoingSinceFn    func(address string, since time.Time) (storage.Outgoing, error)
+	createWalletFn     func(wallet models.Wallet) error
+	getWalletFn        func(address string) (models.Wallet, error)
+	listWalletsFn      func(limit, offset int) ([]models.Wallet, error)
+	closeWalletFn      func(address string) error
+
+	verifyLedgerFn         func() (models.LedgerReport, error)
+	getStatementFn         func(address string, from, to time.Time) (models.Statement, error)
+	createIdempotencyKeyFn func(record models.IdempotencyRecord) error
+	getIdempotencyKeyFn    func(key string) (models.IdempotencyRecord, error)
+	deleteIdempotencyKeyFn func(key string) error
+
+	createHoldFn  func(hold models.Hold) (models.Hold, error)
+	getHoldFn     func(id int64) (models.Hold, error)
+	captureHoldFn func(id int64, amount money.Money, fee *models.Fee) (models.Hold, error)
+	voidHoldFn    func(id int64) (models.Hold, error)
+	expireHoldsFn func(before time.Time) (int64, error)
+
+	createScheduleFn    func(schedule models.Schedule) (models.Schedule, error)
+	getScheduleFn       func(id int64) (models.Schedule, error)
+	cancelScheduleFn    func(id int64) (models.Schedule, error)
+	dueSchedulesFn      func(now time.Time, limit int) ([]models.Schedule, error)
+	recordScheduleRunFn func(schedule models.Schedule, run models.ScheduleRun) (models.ScheduleRun, error)
+	listScheduleRunsFn  func(id int64) ([]models.ScheduleRun, error)
+
+	createAPIKeyFn    func(key models.APIKey, hash string) (models.APIKey, error)
+	getAPIKeyByHashFn func(hash string) (models.APIKey, error)
+	listAPIKeysFn     func() ([]models.APIKey, error)
+	rotateAPIKeyFn    func(id int64, hash, prefix string) (models.APIKey, error)
+	revokeAPIKeyFn    func(id int64) (models.APIKey, error)
 }
 
-func (m *mockStorage) Init() error {
+func (m *mockStorage) Init(ctx context.Context) error {
 	panic("not implemented")
 }
 
-func (m *mockStorage) GetBalance(address string) (float64, error) {
+func (m *mockStorage) GetBalance(ctx context.Context, address string) (models.Balance, error) {
 	if m.getBalanceFn != nil {
 		return m.getBalanceFn(address)
 	}
 	panic("not implemented")
 }
 
-func (m *mockStorage) Transfer(from, to string, amount float64) error {
+func (m *mockStorage) Transfer(ctx context.Context, transfer models.TransferRequest) (models.Receipt, error) {
+	if err := m.checkLimits(transfer.From, transfer.Check); err != nil {
+		return models.Receipt{}, err
+	}
 	if m.transferFn != nil {
-		return m.transferFn(from, to, amount)
+		return m.transferFn(transfer)
+	}
+	panic("not implemented")
+}
+
+// checkLimits выполняет проверку ограничений, как хранилище в транзакции
+// перевода: история переводов отправителя берется из outgoingSinceFn
+func (m *mockStorage) checkLimits(from string, check models.LimitCheck) error {
+	if check == nil {
+		return nil
+	}
+	return check(func(since time.Time) (storage.Outgoing, error) {
+		return m.OutgoingSince(ctx, from, since)
+	})
+}
+
+func (m *mockStorage) TransferBatch(ctx context.Context, transfers []models.TransferRequest) ([]models.Receipt, error) {
+	for i, t := range transfers {
+		if err := m.checkLimits(t.From, t.Check); err != nil {
+			return nil, &storage.BatchError{Index: i, Err: err}
+		}
+	}
+	if m.transferBatchFn != nil {
+		return m.transferBatchFn(transfers)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) GetTransaction(ctx context.Context, id int64) (models.Transaction, error) {
+	if m.getTransactionFn != nil {
+		return m.getTransactionFn(id)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) Refund(ctx context.Context, id int64, amount money.Money) (models.Receipt, error) {
+	if m.refundFn != nil {
+		return m.refundFn(id, amount)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) ListRefunds(ctx context.Context, id int64) ([]models.Transaction, error) {
+	if m.listRefundsFn != nil {
+		return m.listRefundsFn(id)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) ListTransactions(ctx context.Context, filter storage.TransactionFilter) ([]models.Transaction, error) {
+	if m.listTransactionsFn != nil {
+		return m.listTransactionsFn(filter)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) EachTransaction(ctx context.Context, filter storage.TransactionFilter, fn func(models.Transaction) error) error {
+	if m.eachTransactionFn != nil {
+		return m.eachTransactionFn(filter, fn)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) OutgoingSince(ctx context.Context, address string, since time.Time) (storage.Outgoing, error) {
+	if m.outgoingSinceFn != nil {
+		return m.outgoingSinceFn(address, since)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) CreateWallet(ctx context.Context, wallet models.Wallet) error {
+	if m.createWalletFn != nil {
+		return m.createWalletFn(wallet)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) GetWallet(ctx context.Context, address string) (models.Wallet, error) {
+	if m.getWalletFn != nil {
+		return m.getWalletFn(address)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) ListWallets(ctx context.Context, limit, offset int) ([]models.Wallet, error) {
+	if m.listWalletsFn != nil {
+		return m.listWalletsFn(limit, offset)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) CloseWallet(ctx context.Context, address string) error {
+	if m.closeWalletFn != nil {
+		return m.closeWalletFn(address)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) VerifyLedger(ctx context.Context) (models.LedgerReport, error) {
+	if m.verifyLedgerFn != nil {
+		return m.verifyLedgerFn()
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) GetStatement(ctx context.Context, address string, from, to time.Time) (models.Statement, error) {
+	if m.getStatementFn != nil {
+		return m.getStatementFn(address, from, to)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) CreateIdempotencyKey(ctx context.Context, record models.IdempotencyRecord) error {
+	if m.createIdempotencyKeyFn != nil {
+		return m.createIdempotencyKeyFn(record)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) GetIdempotencyKey(ctx context.Context, key string) (models.IdempotencyRecord, error) {
+	if m.getIdempotencyKeyFn != nil {
+		return m.getIdempotencyKeyFn(key)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	if m.deleteIdempotencyKeyFn != nil {
+		return m.deleteIdempotencyKeyFn(key)
 	}
 	panic("not implemented")
 }
 
-func (m *mockStorage) GetLastNTransactions(n int) ([]models.Transaction, error) {
-	if m.getLastNTransactionsFn != nil {
-		return m.getLastNTransactionsFn(n)
+func (m *mockStorage) CreateHold(ctx context.Context, hold models.Hold) (models.Hold, error) {
+	if m.createHoldFn != nil {
+		return m.createHoldFn(hold)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) GetHold(ctx context.Context, id int64) (models.Hold, error) {
+	if m.getHoldFn != nil {
+		return m.getHoldFn(id)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) CaptureHold(ctx context.Context, id int64, amount money.Money, fee *models.Fee, check models.LimitCheck) (models.Hold, error) {
+	if check != nil {
+		hold, err := m.GetHold(ctx, id)
+		if err != nil {
+			return models.Hold{}, err
+		}
+		if err := m.checkLimits(hold.Wallet, check); err != nil {
+			return models.Hold{}, err
+		}
+	}
+	if m.captureHoldFn != nil {
+		return m.captureHoldFn(id, amount, fee)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) VoidHold(ctx context.Context, id int64) (models.Hold, error) {
+	if m.voidHoldFn != nil {
+		return m.voidHoldFn(id)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) ExpireHolds(ctx context.Context, before time.Time) (int64, error) {
+	if m.expireHoldsFn != nil {
+		return m.expireHoldsFn(before)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) CreateSchedule(ctx context.Context, schedule models.Schedule) (models.Schedule, error) {
+	if m.createScheduleFn != nil {
+		return m.createScheduleFn(schedule)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) GetSchedule(ctx context.Context, id int64) (models.Schedule, error) {
+	if m.getScheduleFn != nil {
+		return m.getScheduleFn(id)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) CancelSchedule(ctx context.Context, id int64) (models.Schedule, error) {
+	if m.cancelScheduleFn != nil {
+		return m.cancelScheduleFn(id)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) DueSchedules(ctx context.Context, now time.Time, limit int) ([]models.Schedule, error) {
+	if m.dueSchedulesFn != nil {
+		return m.dueSchedulesFn(now, limit)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) RecordScheduleRun(ctx context.Context, schedule models.Schedule, run models.ScheduleRun) (models.ScheduleRun, error) {
+	if m.recordScheduleRunFn != nil {
+		return m.recordScheduleRunFn(schedule, run)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) ListScheduleRuns(ctx context.Context, id int64) ([]models.ScheduleRun, error) {
+	if m.listScheduleRunsFn != nil {
+		return m.listScheduleRunsFn(id)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) CreateAPIKey(ctx context.Context, key models.APIKey, hash string) (models.APIKey, error) {
+	if m.createAPIKeyFn != nil {
+		return m.createAPIKeyFn(key, hash)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) GetAPIKey(ctx context.Context, id int64) (models.APIKey, error) {
+	panic("not implemented")
+}
+
+func (m *mockStorage) GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	if m.getAPIKeyByHashFn != nil {
+		return m.getAPIKeyByHashFn(hash)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	if m.listAPIKeysFn != nil {
+		return m.listAPIKeysFn()
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) RotateAPIKey(ctx context.Context, id int64, hash, prefix string, at time.Time) (models.APIKey, error) {
+	if m.rotateAPIKeyFn != nil {
+		return m.rotateAPIKeyFn(id, hash, prefix)
+	}
+	panic("not implemented")
+}
+
+func (m *mockStorage) RevokeAPIKey(ctx context.Context, id int64, at time.Time) (models.APIKey, error) {
+	if m.revokeAPIKeyFn != nil {
+		return m.revokeAPIKeyFn(id)
 	}
 	panic("not implemented")
 }
@@ -50,43 +346,66 @@ func setupTestService() (TransactionService, *mockStorage) {
 	mock := &mockStorage{}
 	var buf bytes.Buffer
 	logger := slog.New(slog.NewTextHandler(&buf, nil))
-	service := NewTransactionService(mock, logger)
+	service := NewTransactionService(mock, nil, nil, nil, logger)
 	return service, mock
 }
 
+// setupFXService создаёт сервис с моком и курсами валют
+func setupFXService(rates Converter) (TransactionService, *mockStorage) {
+	mock := &mockStorage{}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	return NewTransactionService(mock, nil, rates, nil, logger), mock
+}
+
+// setupFeeService создаёт сервис с моком и политикой комиссий
+func setupFeeService(fees FeePolicy) (TransactionService, *mockStorage) {
+	mock := &mockStorage{}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	return NewTransactionService(mock, fees, nil, nil, logger), mock
+}
+
 func TestMakeTransaction_InvalidAmount(t *testing.T) {
 	service, _ := setupTestService()
 
-	err := service.MakeTransaction("a", "b", -100)
+	_, err := service.MakeTransaction(ctx, "a", "b", money.New(-100, "RUB"))
 	assert.ErrorIs(t, err, ErrInvalidAmount)
 }
 
 func TestMakeTransaction_SelfTransfer(t *testing.T) {
 	service, _ := setupTestService()
 
-	err := service.MakeTransaction("a", "a", 100)
+	_, err := service.MakeTransaction(ctx, "a", "a", money.New(100, "RUB"))
 	assert.ErrorIs(t, err, ErrSelfTransfer)
 }
 
+func TestMakeTransaction_UnknownCurrency(t *testing.T) {
+	service, _ := setupTestService()
+
+	_, err := service.MakeTransaction(ctx, "a", "b", money.New(100, "XXX"))
+	assert.ErrorIs(t, err, money.ErrUnknownCurrency)
+}
+
 func TestMakeTransaction_InsufficientFunds(t *testing.T) {
 	service, mock := setupTestService()
 
-	mock.transferFn = func(from, to string, amount float64) error {
-		return storage.ErrInsufficientFunds
+	mock.transferFn = func(transfer models.TransferRequest) (models.Receipt, error) {
+		return models.Receipt{}, storage.ErrInsufficientFunds
 	}
 
-	err := service.MakeTransaction(uuid.NewString(), uuid.NewString(), 100)
+	_, err := service.MakeTransaction(ctx, uuid.NewString(), uuid.NewString(), money.New(100, "RUB"))
 	assert.ErrorIs(t, err, storage.ErrInsufficientFunds)
 }
 
 func TestMakeTransaction_WalletNotFound(t *testing.T) {
 	service, mock := setupTestService()
 
-	mock.transferFn = func(from, to string, amount float64) error {
-		return storage.ErrWalletNotFound
+	mock.transferFn = func(transfer models.TransferRequest) (models.Receipt, error) {
+		return models.Receipt{}, storage.ErrWalletNotFound
 	}
 
-	err := service.MakeTransaction(uuid.NewString(), uuid.NewString(), 100)
+	_, err := service.MakeTransaction(ctx, uuid.NewString(), uuid.NewString(), money.New(100, "RUB"))
 	assert.ErrorIs(t, err, storage.ErrWalletNotFound)
 }
 
@@ -95,26 +414,315 @@ func TestMakeTransaction_Success(t *testing.T) {
 	validUUID_1 := uuid.NewString()
 	validUUID_2 := uuid.NewString()
 
-	mock.transferFn = func(from, to string, amount float64) error {
-		assert.Equal(t, validUUID_1, from)
-		assert.Equal(t, validUUID_2, to)
-		assert.Equal(t, 50.0, amount)
-		return nil
+	mock.transferFn = func(transfer models.TransferRequest) (models.Receipt, error) {
+		assert.Equal(t, validUUID_1, transfer.From)
+		assert.Equal(t, validUUID_2, transfer.To)
+		assert.Equal(t, money.New(5000, "RUB"), transfer.Amount)
+		assert.Nil(t, transfer.Conversion)
+		return models.Receipt{Transaction: models.Transaction{ID: 1, From: transfer.From, To: transfer.To, Amount: transfer.Amount}}, nil
+	}
+
+	receipt, err := service.MakeTransaction(ctx, validUUID_1, validUUID_2, money.New(5000, "RUB"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), receipt.ID)
+}
+
+// feePolicyFunc позволяет задать политику комиссий функцией
+type feePolicyFunc func(from string, amount money.Money) *models.Fee
+
+func (f feePolicyFunc) Fee(from string, amount money.Money) *models.Fee {
+	return f(from, amount)
+}
+
+// flatFee берет 1 рубль с каждого перевода
+var flatFee = feePolicyFunc(func(from string, amount money.Money) *models.Fee {
+	return &models.Fee{Wallet: "fees", Amount: money.New(100, amount.Currency)}
+})
+
+func TestMakeTransaction_WithFee(t *testing.T) {
+	service, mock := setupFeeService(flatFee)
+
+	mock.transferFn = func(transfer models.TransferRequest) (models.Receipt, error) {
+		fee := transfer.Fee
+		assert.Equal(t, &models.Fee{Wallet: "fees", Amount: money.New(100, "RUB")}, fee)
+		return models.Receipt{
+			Transaction: models.Transaction{ID: 1},
+			Fee:         &models.Transaction{ID: 2, To: fee.Wallet, Amount: fee.Amount},
+		}, nil
+	}
+
+	receipt, err := service.MakeTransaction(ctx, "a", "b", money.New(5000, "RUB"))
+	require.NoError(t, err)
+	require.NotNil(t, receipt.Fee)
+	assert.Equal(t, int64(2), receipt.Fee.ID)
+}
+
+func TestMakeTransaction_FeeWalletUnavailable(t *testing.T) {
+	service, mock := setupFeeService(flatFee)
+
+	mock.transferFn = func(transfer models.TransferRequest) (models.Receipt, error) {
+		return models.Receipt{}, storage.ErrFeeWallet
+	}
+
+	// ошибка конфигурации не раскрывается клиенту
+	_, err := service.MakeTransaction(ctx, "a", "b", money.New(5000, "RUB"))
+	assert.ErrorIs(t, err, ErrInternalError)
+}
+
+// converterFunc позволяет задать конвертацию функцией
+type converterFunc func(amount money.Money, currency string) (money.Money, string, error)
+
+func (f converterFunc) Convert(amount money.Money, currency string) (money.Money, string, error) {
+	return f(amount, currency)
+}
+
+// usdRate продает доллар за 100 рублей
+var usdRate = converterFunc(func(amount money.Money, currency string) (money.Money, string, error) {
+	if amount.Currency != "RUB" || currency != "USD" {
+		return money.Money{}, "", fx.ErrRateNotFound
+	}
+	return money.New(amount.Amount/100, currency), "0.01", nil
+})
+
+// walletsIn отвечает кошельком в валюте из таблицы по адресу
+func walletsIn(currencies map[string]string) func(address string) (models.Wallet, error) {
+	return func(address string) (models.Wallet, error) {
+		currency, ok := currencies[address]
+		if !ok {
+			return models.Wallet{}, storage.ErrWalletNotFound
+		}
+		return models.Wallet{Address: address, Balance: money.New(0, currency)}, nil
+	}
+}
+
+func TestMakeTransaction_WithConversion(t *testing.T) {
+	service, mock := setupFXService(usdRate)
+	mock.getWalletFn = walletsIn(map[string]string{"usd": "USD"})
+
+	mock.transferFn = func(transfer models.TransferRequest) (models.Receipt, error) {
+		assert.Equal(t, money.New(50000, "RUB"), transfer.Amount)
+		assert.Equal(t, &models.Conversion{Amount: money.New(500, "USD"), Rate: "0.01"}, transfer.Conversion)
+		return models.Receipt{Transaction: models.Transaction{ID: 1}}, nil
+	}
+
+	_, err := service.MakeTransaction(ctx, "a", "usd", money.New(50000, "RUB"))
+	require.NoError(t, err)
+}
+
+func TestMakeTransaction_SameCurrencyNotConverted(t *testing.T) {
+	service, mock := setupFXService(usdRate)
+	mock.getWalletFn = walletsIn(map[string]string{"b": "RUB"})
+
+	mock.transferFn = func(transfer models.TransferRequest) (models.Receipt, error) {
+		assert.Nil(t, transfer.Conversion)
+		return models.Receipt{Transaction: models.Transaction{ID: 1}}, nil
+	}
+
+	_, err := service.MakeTransaction(ctx, "a", "b", money.New(50000, "RUB"))
+	require.NoError(t, err)
+}
+
+func TestMakeTransaction_ConversionErrors(t *testing.T) {
+	service, mock := setupFXService(usdRate)
+	mock.getWalletFn = walletsIn(map[string]string{"eur": "EUR"})
+
+	// до хранилища перевод не доходит: мок без transferFn запаниковал бы
+	_, err := service.MakeTransaction(ctx, "a", "eur", money.New(50000, "RUB"))
+	assert.ErrorIs(t, err, fx.ErrRateNotFound)
+
+	_, err = service.MakeTransaction(ctx, "a", "nonexistent", money.New(50000, "RUB"))
+	assert.ErrorIs(t, err, storage.ErrWalletNotFound)
+}
+
+func TestGetTransaction_NotFound(t *testing.T) {
+	service, mock := setupTestService()
+
+	mock.getTransactionFn = func(id int64) (models.Transaction, error) {
+		return models.Transaction{}, storage.ErrTransactionNotFound
+	}
+
+	_, err := service.GetTransaction(ctx, 5)
+	assert.ErrorIs(t, err, storage.ErrTransactionNotFound)
+}
+
+func TestGetTransaction_WithRefunds(t *testing.T) {
+	service, mock := setupTestService()
+	refundOf := int64(5)
+
+	mock.getTransactionFn = func(id int64) (models.Transaction, error) {
+		return models.Transaction{ID: id, Amount: money.New(3000, "RUB")}, nil
+	}
+	mock.listRefundsFn = func(id int64) ([]models.Transaction, error) {
+		assert.Equal(t, int64(5), id)
+		return []models.Transaction{{ID: 6, Amount: money.New(1000, "RUB"), RefundOf: &refundOf}}, nil
+	}
+
+	tx, err := service.GetTransaction(ctx, 5)
+	assert.NoError(t, err)
+	assert.Len(t, tx.Refunds, 1)
+}
+
+func TestRefundTransaction_RemainingByDefault(t *testing.T) {
+	service, mock := setupTestService()
+	refundOf := int64(5)
+
+	mock.getTransactionFn = func(id int64) (models.Transaction, error) {
+		return models.Transaction{ID: id, Amount: money.New(3000, "RUB")}, nil
+	}
+	mock.listRefundsFn = func(id int64) ([]models.Transaction, error) {
+		return []models.Transaction{{ID: 6, Amount: money.New(1000, "RUB"), RefundOf: &refundOf}}, nil
+	}
+	mock.refundFn = func(id int64, amount money.Money) (models.Receipt, error) {
+		assert.Equal(t, int64(5), id)
+		assert.Equal(t, money.New(2000, "RUB"), amount)
+		return models.Receipt{Transaction: models.Transaction{ID: 7, Amount: amount, RefundOf: &refundOf}}, nil
 	}
 
-	err := service.MakeTransaction(validUUID_1, validUUID_2, 50)
+	receipt, err := service.RefundTransaction(ctx, 5, nil)
 	assert.NoError(t, err)
+	assert.Equal(t, int64(7), receipt.ID)
+}
+
+func TestRefundTransaction_RemainingAfterConvertedRefund(t *testing.T) {
+	service, mock := setupTestService()
+	refundOf := int64(5)
+	credit := money.New(1000, "RUB")
+
+	mock.getTransactionFn = func(id int64) (models.Transaction, error) {
+		return models.Transaction{ID: id, Amount: money.New(3000, "RUB")}, nil
+	}
+	// возврат перевода в доллары списан в долларах, остаток считается в рублях
+	mock.listRefundsFn = func(id int64) ([]models.Transaction, error) {
+		return []models.Transaction{{ID: 6, Amount: money.New(10, "USD"), DestinationAmount: &credit, RefundOf: &refundOf}}, nil
+	}
+	mock.refundFn = func(id int64, amount money.Money) (models.Receipt, error) {
+		assert.Equal(t, money.New(2000, "RUB"), amount)
+		return models.Receipt{Transaction: models.Transaction{ID: 7}}, nil
+	}
+
+	_, err := service.RefundTransaction(ctx, 5, nil)
+	assert.NoError(t, err)
+}
+
+func TestRefundTransaction_FullyRefunded(t *testing.T) {
+	service, mock := setupTestService()
+	refundOf := int64(5)
+
+	mock.getTransactionFn = func(id int64) (models.Transaction, error) {
+		return models.Transaction{ID: id, Amount: money.New(3000, "RUB")}, nil
+	}
+	mock.listRefundsFn = func(id int64) ([]models.Transaction, error) {
+		return []models.Transaction{{ID: 6, Amount: money.New(3000, "RUB"), RefundOf: &refundOf}}, nil
+	}
+
+	_, err := service.RefundTransaction(ctx, 5, nil)
+	assert.ErrorIs(t, err, storage.ErrRefundExceedsAmount)
+}
+
+func TestRefundTransaction_Errors(t *testing.T) {
+	service, mock := setupTestService()
+	amount := money.New(500, "RUB")
+
+	zero := money.New(0, "RUB")
+	_, err := service.RefundTransaction(ctx, 5, &zero)
+	assert.ErrorIs(t, err, ErrInvalidAmount)
+
+	mock.getTransactionFn = func(id int64) (models.Transaction, error) {
+		return models.Transaction{ID: id, From: "a", To: "b", Amount: money.New(3000, "RUB")}, nil
+	}
+	mock.listRefundsFn = func(id int64) ([]models.Transaction, error) {
+		return nil, nil
+	}
+	mock.refundFn = func(id int64, amount money.Money) (models.Receipt, error) {
+		return models.Receipt{}, storage.ErrRefundInsufficientFunds
+	}
+	_, err = service.RefundTransaction(ctx, 5, &amount)
+	assert.ErrorIs(t, err, storage.ErrRefundInsufficientFunds)
+
+	mock.refundFn = func(id int64, amount money.Money) (models.Receipt, error) {
+		return models.Receipt{}, storage.ErrRefundOfFee
+	}
+	_, err = service.RefundTransaction(ctx, 5, &amount)
+	assert.ErrorIs(t, err, storage.ErrRefundOfFee)
+}
+
+// walletLimit возвращает контекст, в котором ограничение частоты по
+// кошельку записывает проверенные кошельки в charged и отвечает err
+func walletLimit(charged *[]string, err error) context.Context {
+	return ratelimit.WithWallets(ctx, func(wallets []string) error {
+		*charged = append(*charged, wallets...)
+		return err
+	})
+}
+
+func TestWalletRateLimit_ChargesSourceWallets(t *testing.T) {
+	service, mock := setupTestService()
+	mock.transferFn = func(transfer models.TransferRequest) (models.Receipt, error) {
+		return models.Receipt{}, nil
+	}
+	mock.transferBatchFn = func(transfers []models.TransferRequest) ([]models.Receipt, error) {
+		return make([]models.Receipt, len(transfers)), nil
+	}
+	mock.getTransactionFn = func(id int64) (models.Transaction, error) {
+		return models.Transaction{ID: id, From: "a", To: "b", Amount: money.New(3000, "RUB")}, nil
+	}
+	mock.listRefundsFn = func(id int64) ([]models.Transaction, error) {
+		return nil, nil
+	}
+	mock.refundFn = func(id int64, amount money.Money) (models.Receipt, error) {
+		return models.Receipt{}, nil
+	}
+
+	var charged []string
+	limited := walletLimit(&charged, nil)
+	_, err := service.MakeTransaction(limited, "a", "b", money.New(100, "RUB"))
+	require.NoError(t, err)
+	_, err = service.MakeBatch(limited, []models.TransferRequest{
+		{From: "a", To: "b", Amount: money.New(100, "RUB")},
+		{From: "c", To: "b", Amount: money.New(100, "RUB")},
+	}, true)
+	require.NoError(t, err)
+	// возврат списывается с получателя исходного перевода
+	_, err = service.RefundTransaction(limited, 5, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"a", "a", "c", "b"}, charged)
+}
+
+func TestWalletRateLimit_Exceeded(t *testing.T) {
+	service, mock := setupTestService()
+	mock.getTransactionFn = func(id int64) (models.Transaction, error) {
+		return models.Transaction{ID: id, From: "a", To: "b", Amount: money.New(3000, "RUB")}, nil
+	}
+	mock.listRefundsFn = func(id int64) ([]models.Transaction, error) {
+		return nil, nil
+	}
+
+	// хранилище без подмен паникует: средства не двигаются
+	var charged []string
+	limited := walletLimit(&charged, &ratelimit.LimitError{RetryAfter: time.Second})
+	_, err := service.MakeTransaction(limited, "a", "b", money.New(100, "RUB"))
+	assert.ErrorIs(t, err, ratelimit.ErrLimited)
+	_, err = service.MakeBatch(limited, []models.TransferRequest{{From: "a", To: "b", Amount: money.New(100, "RUB")}}, false)
+	assert.ErrorIs(t, err, ratelimit.ErrLimited)
+	_, err = service.RefundTransaction(limited, 5, nil)
+	assert.ErrorIs(t, err, ratelimit.ErrLimited)
+
+	// проверка, отклоненная до ограничения, корзину не расходует
+	_, err = service.MakeTransaction(limited, "a", "a", money.New(100, "RUB"))
+	assert.ErrorIs(t, err, ErrSelfTransfer)
+	assert.Equal(t, []string{"a", "a", "b"}, charged)
 }
 
 func TestGetBalance_WalletNotFound(t *testing.T) {
 	service, mock := setupTestService()
 	wallet := uuid.NewString()
 
-	mock.getBalanceFn = func(address string) (float64, error) {
-		return 0, storage.ErrWalletNotFound
+	mock.getBalanceFn = func(address string) (models.Balance, error) {
+		return models.Balance{}, storage.ErrWalletNotFound
 	}
 
-	_, err := service.GetBalance(wallet)
+	_, err := service.GetBalance(ctx, wallet)
 	assert.ErrorIs(t, err, storage.ErrWalletNotFound)
 }
 
@@ -122,23 +730,139 @@ func TestGetBalance_Success(t *testing.T) {
 	service, mock := setupTestService()
 	validUUID := uuid.NewString()
 
-	mock.getBalanceFn = func(address string) (float64, error) {
+	expected := models.Balance{Total: money.New(10000, "RUB"), Available: money.New(7000, "RUB")}
+	mock.getBalanceFn = func(address string) (models.Balance, error) {
 		assert.Equal(t, validUUID, address)
-		return 100.0, nil
+		return expected, nil
 	}
 
-	balance, err := service.GetBalance(validUUID)
+	balance, err := service.GetBalance(ctx, validUUID)
 	assert.NoError(t, err)
-	assert.Equal(t, 100.0, balance)
+	assert.Equal(t, expected, balance)
 }
 
-func TestGetRecentTransactions_Error(t *testing.T) {
+func TestListTransactions_Error(t *testing.T) {
 	service, mock := setupTestService()
 
-	mock.getLastNTransactionsFn = func(n int) ([]models.Transaction, error) {
+	mock.listTransactionsFn = func(filter storage.TransactionFilter) ([]models.Transaction, error) {
 		return nil, errors.New("db error")
 	}
 
-	_, err := service.GetRecentTransactions(10)
-	assert.Error(t, err)
+	_, err := service.ListTransactions(ctx, TransactionQuery{})
+	assert.ErrorIs(t, err, ErrInternalError)
+}
+
+func TestListTransactions_NextCursor(t *testing.T) {
+	service, mock := setupTestService()
+
+	var got []storage.TransactionFilter
+	mock.listTransactionsFn = func(filter storage.TransactionFilter) ([]models.Transaction, error) {
+		got = append(got, filter)
+		all := []models.Transaction{{ID: 5}, {ID: 4}, {ID: 3}}
+		var page []models.Transaction
+		for _, tx := range all {
+			if (filter.BeforeID == 0 || tx.ID < filter.BeforeID) && len(page) < filter.Limit {
+				page = append(page, tx)
+			}
+		}
+		return page, nil
+	}
+
+	page, err := service.ListTransactions(ctx, TransactionQuery{Limit: 2, Wallet: "wallet-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Transaction{{ID: 5}, {ID: 4}}, page.Transactions)
+	assert.NotEmpty(t, page.NextCursor)
+	assert.Equal(t, storage.TransactionFilter{Wallet: "wallet-1", Limit: 3}, got[0])
+
+	page, err = service.ListTransactions(ctx, TransactionQuery{Limit: 2, Cursor: page.NextCursor})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Transaction{{ID: 3}}, page.Transactions)
+	assert.Empty(t, page.NextCursor)
+	assert.Equal(t, int64(4), got[1].BeforeID)
+}
+
+func TestListTransactions_AmountFilter(t *testing.T) {
+	service, mock := setupTestService()
+
+	var got storage.TransactionFilter
+	mock.listTransactionsFn = func(filter storage.TransactionFilter) ([]models.Transaction, error) {
+		got = filter
+		return nil, nil
+	}
+
+	minAmount, maxAmount := money.New(100, "USD"), money.New(500, "USD")
+	page, err := service.ListTransactions(ctx, TransactionQuery{MinAmount: &minAmount, MaxAmount: &maxAmount})
+	assert.NoError(t, err)
+	assert.NotNil(t, page.Transactions)
+	assert.Equal(t, "USD", got.Currency)
+	assert.Equal(t, int64(100), got.MinAmount)
+	assert.Equal(t, int64(500), got.MaxAmount)
+	assert.Equal(t, DefaultPageSize+1, got.Limit)
+}
+
+func TestExportTransactions_Unlimited(t *testing.T) {
+	service, mock := setupTestService()
+
+	var got storage.TransactionFilter
+	mock.eachTransactionFn = func(filter storage.TransactionFilter, fn func(models.Transaction) error) error {
+		got = filter
+		for id := int64(3); id > 0; id-- {
+			if err := fn(models.Transaction{ID: id}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var ids []int64
+	err := service.ExportTransactions(ctx, TransactionQuery{Wallet: "wallet-1"}, func(tx models.Transaction) error {
+		ids = append(ids, tx.ID)
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{3, 2, 1}, ids)
+	assert.Equal(t, storage.TransactionFilter{Wallet: "wallet-1"}, got)
+}
+
+func TestExportTransactions_WriterError(t *testing.T) {
+	service, mock := setupTestService()
+
+	mock.eachTransactionFn = func(filter storage.TransactionFilter, fn func(models.Transaction) error) error {
+		return fmt.Errorf("scan: %w", fn(models.Transaction{ID: 1}))
+	}
+
+	errWrite := errors.New("broken pipe")
+	err := service.ExportTransactions(ctx, TransactionQuery{}, func(models.Transaction) error {
+		return errWrite
+	})
+
+	assert.Equal(t, errWrite, err)
+}
+
+func TestListTransactions_InvalidQuery(t *testing.T) {
+	service, _ := setupTestService()
+
+	rub, usd := money.New(100, "RUB"), money.New(500, "USD")
+	now := time.Now()
+	tests := []struct {
+		name  string
+		query TransactionQuery
+		err   error
+	}{
+		{"limit too large", TransactionQuery{Limit: MaxPageSize + 1}, ErrInvalidPagination},
+		{"negative limit", TransactionQuery{Limit: -1}, ErrInvalidPagination},
+		{"garbage cursor", TransactionQuery{Cursor: "not a cursor"}, ErrInvalidCursor},
+		{"direction without wallet", TransactionQuery{Direction: storage.DirectionIn}, ErrInvalidFilter},
+		{"unknown direction", TransactionQuery{Wallet: "w", Direction: "sideways"}, ErrInvalidFilter},
+		{"empty time range", TransactionQuery{FromTime: now, ToTime: now}, ErrInvalidFilter},
+		{"currency mismatch", TransactionQuery{MinAmount: &rub, MaxAmount: &usd}, money.ErrCurrencyMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.ListTransactions(ctx, tt.query)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
 }
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/storage"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultPageSize используется, если размер страницы не указан
+	DefaultPageSize = 50
+
+	// MaxPageSize ограничивает размер страницы в списках
+	MaxPageSize = 100
+)
+
+// ErrInvalidPagination возвращается при некорректных limit/offset
+var ErrInvalidPagination = errors.New("invalid pagination parameters")
+
+type WalletService interface {
+	CreateWallet(ctx context.Context, owner, label, currency string) (models.Wallet, error)
+	GetWallet(ctx context.Context, address string) (models.Wallet, error)
+	ListWallets(ctx context.Context, limit, offset int) ([]models.Wallet, error)
+	CloseWallet(ctx context.Context, address string) (models.Wallet, error)
+	GetStatement(ctx context.Context, address string, from, to time.Time) (models.Statement, error)
+}
+
+type walletService struct {
+	storage storage.Storage
+	logger  *slog.Logger
+}
+
+func NewWalletService(storage storage.Storage, logger *slog.Logger) WalletService {
+	return &walletService{
+		storage: storage,
+		logger:  logger,
+	}
+}
+
+// CreateWallet создает пустой кошелек с адресом, сгенерированным сервером.
+func (s *walletService) CreateWallet(ctx context.Context, owner, label, currency string) (models.Wallet, error) {
+	if currency == "" {
+		currency = money.DefaultCurrency
+	}
+	if _, err := money.Exponent(currency); err != nil {
+		s.logger.Warn("unknown currency", "currency", currency)
+		return models.Wallet{}, err
+	}
+
+	wallet := models.Wallet{
+		Address:   uuid.NewString(),
+		Balance:   money.New(0, currency),
+		Owner:     owner,
+		Label:     label,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := s.storage.CreateWallet(ctx, wallet); err != nil {
+		return models.Wallet{}, s.handleStorageError(err)
+	}
+
+	s.logger.Info("wallet created",
+		"address", wallet.Address,
+		"owner", owner,
+		"currency", currency,
+	)
+
+	return wallet, nil
+}
+
+// GetWallet возвращает кошелек по адресу.
+func (s *walletService) GetWallet(ctx context.Context, address string) (models.Wallet, error) {
+	wallet, err := s.storage.GetWallet(ctx, address)
+	if err != nil {
+		return models.Wallet{}, s.handleStorageError(err)
+	}
+	return wallet, nil
+}
+
+// ListWallets возвращает страницу кошельков.
+func (s *walletService) ListWallets(ctx context.Context, limit, offset int) ([]models.Wallet, error) {
+	if limit == 0 {
+		limit = DefaultPageSize
+	}
+	if limit < 0 || limit > MaxPageSize || offset < 0 {
+		s.logger.Warn("invalid pagination", "limit", limit, "offset", offset)
+		return nil, ErrInvalidPagination
+	}
+
+	wallets, err := s.storage.ListWallets(ctx, limit, offset)
+	if err != nil {
+		return nil, s.handleStorageError(err)
+	}
+	return wallets, nil
+}
+
+// CloseWallet закрывает кошелек с нулевым балансом.
+func (s *walletService) CloseWallet(ctx context.Context, address string) (models.Wallet, error) {
+	if err := s.storage.CloseWallet(ctx, address); err != nil {
+		return models.Wallet{}, s.handleStorageError(err)
+	}
+
+	s.logger.Info("wallet closed", "address", address)
+
+	return s.GetWallet(ctx, address)
+}
+
+// GetStatement формирует выписку по кошельку за период from <= t < to:
+// к каждой проводке добавляет направление и остаток после нее.
+// Нулевые from и to период не ограничивают.
+func (s *walletService) GetStatement(ctx context.Context, address string, from, to time.Time) (models.Statement, error) {
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		s.logger.Warn("invalid statement period", "from", from, "to", to)
+		return models.Statement{}, fmt.Errorf("%w: from must be before to", ErrInvalidFilter)
+	}
+
+	statement, err := s.storage.GetStatement(ctx, address, from, to)
+	if err != nil {
+		return models.Statement{}, s.handleStorageError(err)
+	}
+
+	if !from.IsZero() {
+		statement.From = &from
+	}
+	if !to.IsZero() {
+		statement.To = &to
+	}
+
+	balance := statement.OpeningBalance
+	for i := range statement.Lines {
+		line := &statement.Lines[i]
+		line.Direction = storage.DirectionIn
+		if line.Amount.Amount < 0 {
+			line.Direction = storage.DirectionOut
+		}
+		if balance, err = balance.Add(line.Amount); err != nil {
+			s.logger.Error("statement balance", "address", address, "err", err)
+			return models.Statement{}, ErrInternalError
+		}
+		line.Balance = balance
+	}
+	statement.ClosingBalance = balance
+	if statement.Lines == nil {
+		statement.Lines = []models.StatementLine{}
+	}
+
+	return statement, nil
+}
+
+// handleStorageError преобразует ошибки хранилища в бизнес-ошибки.
+func (s *walletService) handleStorageError(err error) error {
+	switch {
+	case contextError(err) != nil:
+		s.logger.Warn("request aborted", "err", err)
+		return contextError(err)
+	case errors.Is(err, storage.ErrWalletNotFound),
+		errors.Is(err, storage.ErrWalletExists),
+		errors.Is(err, storage.ErrWalletClosed),
+		errors.Is(err, storage.ErrWalletNotEmpty):
+		s.logger.Warn("wallet operation rejected", "err", err)
+		return err
+	default:
+		s.logger.Error("unexpected storage error", "err", err)
+		return ErrInternalError
+	}
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"bytes"
+	"log/slog"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/storage"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupWalletService создаёт сервис кошельков с моком хранилища
+func setupWalletService() (WalletService, *mockStorage) {
+	mock := &mockStorage{}
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+	return NewWalletService(mock, logger), mock
+}
+
+func TestCreateWallet_Success(t *testing.T) {
+	service, mock := setupWalletService()
+
+	var stored models.Wallet
+	mock.createWalletFn = func(wallet models.Wallet) error {
+		stored = wallet
+		return nil
+	}
+
+	wallet, err := service.CreateWallet(ctx, "alice", "savings", "")
+	require.NoError(t, err)
+
+	_, err = uuid.Parse(wallet.Address)
+	assert.NoError(t, err, "address must be generated by the server")
+	assert.Equal(t, stored, wallet)
+	assert.Equal(t, money.New(0, money.DefaultCurrency), wallet.Balance)
+	assert.Equal(t, "alice", wallet.Owner)
+	assert.False(t, wallet.CreatedAt.IsZero())
+	assert.Nil(t, wallet.ClosedAt)
+}
+
+func TestCreateWallet_UnknownCurrency(t *testing.T) {
+	service, _ := setupWalletService()
+
+	_, err := service.CreateWallet(ctx, "alice", "", "XXX")
+	assert.ErrorIs(t, err, money.ErrUnknownCurrency)
+}
+
+func TestListWallets_DefaultLimit(t *testing.T) {
+	service, mock := setupWalletService()
+
+	mock.listWalletsFn = func(limit, offset int) ([]models.Wallet, error) {
+		assert.Equal(t, DefaultPageSize, limit)
+		assert.Equal(t, 0, offset)
+		return []models.Wallet{}, nil
+	}
+
+	_, err := service.ListWallets(ctx, 0, 0)
+	assert.NoError(t, err)
+}
+
+func TestListWallets_InvalidPagination(t *testing.T) {
+	service, _ := setupWalletService()
+
+	_, err := service.ListWallets(ctx, MaxPageSize+1, 0)
+	assert.ErrorIs(t, err, ErrInvalidPagination)
+
+	_, err = service.ListWallets(ctx, 10, -1)
+	assert.ErrorIs(t, err, ErrInvalidPagination)
+}
+
+func TestCloseWallet_NotEmpty(t *testing.T) {
+	service, mock := setupWalletService()
+
+	mock.closeWalletFn = func(address string) error {
+		return storage.ErrWalletNotEmpty
+	}
+
+	_, err := service.CloseWallet(ctx, "wallet-1")
+	assert.ErrorIs(t, err, storage.ErrWalletNotEmpty)
+}
+
+func TestGetStatement_RunningBalance(t *testing.T) {
+	service, mock := setupWalletService()
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.getStatementFn = func(address string, gotFrom, to time.Time) (models.Statement, error) {
+		assert.Equal(t, from, gotFrom)
+		assert.True(t, to.IsZero())
+		return models.Statement{
+			Address:        address,
+			OpeningBalance: money.New(10000, "RUB"),
+			Lines: []models.StatementLine{
+				{EntryID: 3, Kind: storage.EntryTransfer, Counterparty: "wallet-2", Amount: money.New(-2500, "RUB")},
+				{EntryID: 4, Kind: storage.EntryTransfer, Counterparty: "wallet-3", Amount: money.New(500, "RUB")},
+			},
+		}, nil
+	}
+
+	statement, err := service.GetStatement(ctx, "wallet-1", from, time.Time{})
+
+	assert.NoError(t, err)
+	assert.Equal(t, &from, statement.From)
+	assert.Nil(t, statement.To)
+	assert.Equal(t, storage.DirectionOut, statement.Lines[0].Direction)
+	assert.Equal(t, money.New(7500, "RUB"), statement.Lines[0].Balance)
+	assert.Equal(t, storage.DirectionIn, statement.Lines[1].Direction)
+	assert.Equal(t, money.New(8000, "RUB"), statement.Lines[1].Balance)
+	assert.Equal(t, money.New(8000, "RUB"), statement.ClosingBalance)
+}
+
+func TestGetStatement_InvalidPeriod(t *testing.T) {
+	service, _ := setupWalletService()
+
+	now := time.Now()
+	_, err := service.GetStatement(ctx, "wallet-1", now, now.Add(-time.Hour))
+
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+}
+
+func TestGetStatement_WalletNotFound(t *testing.T) {
+	service, mock := setupWalletService()
+
+	mock.getStatementFn = func(address string, from, to time.Time) (models.Statement, error) {
+		return models.Statement{}, storage.ErrWalletNotFound
+	}
+
+	_, err := service.GetStatement(ctx, "missing", time.Time{}, time.Time{})
+
+	assert.ErrorIs(t, err, storage.ErrWalletNotFound)
+}
@@ -0,0 +1,137 @@
+package memory
+
+import (
+	"context"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/storage"
+	"slices"
+	"time"
+)
+
+// apiKey — API-ключ вместе с хешем значения.
+type apiKey struct {
+	Key  models.APIKey `json:"key"`
+	Hash string        `json:"hash"`
+}
+
+// CreateAPIKey сохраняет API-ключ.
+func (s *Storage) CreateAPIKey(ctx context.Context, key models.APIKey, hash string) (models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return models.APIKey{}, err
+	}
+
+	// идентификаторы совпадают с позицией в срезе + 1
+	key.ID = int64(len(s.apiKeys)) + 1
+	key.Wallets = slices.Clone(key.Wallets)
+	key.Roles = slices.Clone(key.Roles)
+	key.Permissions = slices.Clone(key.Permissions)
+	key.CreatedAt = key.CreatedAt.UTC()
+	key.RotatedAt = nil
+	key.RevokedAt = nil
+	s.apiKeys = append(s.apiKeys, apiKey{Key: key, Hash: hash})
+	return key, nil
+}
+
+// GetAPIKey возвращает API-ключ по идентификатору.
+func (s *Storage) GetAPIKey(ctx context.Context, id int64) (models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return models.APIKey{}, err
+	}
+
+	key, ok := s.apiKey(id)
+	if !ok {
+		return models.APIKey{}, storage.ErrAPIKeyNotFound
+	}
+	return key.Key, nil
+}
+
+// GetAPIKeyByHash возвращает API-ключ по хешу.
+func (s *Storage) GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return models.APIKey{}, err
+	}
+
+	for _, key := range s.apiKeys {
+		if key.Hash == hash {
+			return key.Key, nil
+		}
+	}
+	return models.APIKey{}, storage.ErrAPIKeyNotFound
+}
+
+// ListAPIKeys возвращает все API-ключи в порядке выпуска.
+func (s *Storage) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var keys []models.APIKey
+	for _, key := range s.apiKeys {
+		keys = append(keys, key.Key)
+	}
+	return keys, nil
+}
+
+// RotateAPIKey заменяет хеш действующего API-ключа.
+func (s *Storage) RotateAPIKey(ctx context.Context, id int64, hash, prefix string, at time.Time) (models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return models.APIKey{}, err
+	}
+
+	key, ok := s.apiKey(id)
+	if !ok {
+		return models.APIKey{}, storage.ErrAPIKeyNotFound
+	}
+	if key.Key.RevokedAt != nil {
+		return models.APIKey{}, storage.ErrAPIKeyRevoked
+	}
+	at = at.UTC()
+	key.Hash = hash
+	key.Key.Prefix = prefix
+	key.Key.RotatedAt = &at
+	return key.Key, nil
+}
+
+// RevokeAPIKey отзывает API-ключ.
+func (s *Storage) RevokeAPIKey(ctx context.Context, id int64, at time.Time) (models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return models.APIKey{}, err
+	}
+
+	key, ok := s.apiKey(id)
+	if !ok {
+		return models.APIKey{}, storage.ErrAPIKeyNotFound
+	}
+	if key.Key.RevokedAt != nil {
+		return models.APIKey{}, storage.ErrAPIKeyRevoked
+	}
+	at = at.UTC()
+	key.Key.RevokedAt = &at
+	return key.Key, nil
+}
+
+// apiKey ищет ключ по ID. Вызывается под s.mu.
+func (s *Storage) apiKey(id int64) (*apiKey, bool) {
+	if id < 1 || id > int64(len(s.apiKeys)) {
+		return nil, false
+	}
+	return &s.apiKeys[id-1], true
+}
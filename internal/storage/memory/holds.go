@@ -0,0 +1,199 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/storage"
+	"time"
+)
+
+// heldAmount возвращает сумму активных неистекших блокировок кошелька
+// вместе с зарезервированными комиссиями. Вызывается под s.mu.
+func (s *Storage) heldAmount(address string, now time.Time) int64 {
+	var held int64
+	for _, hold := range s.holds {
+		if hold.Wallet == address && hold.Status == storage.HoldActive && hold.ExpiresAt.After(now) {
+			held += hold.Amount.Amount + hold.Fee.Amount
+		}
+	}
+	return held
+}
+
+// CreateHold блокирует сумму на кошельке.
+func (s *Storage) CreateHold(ctx context.Context, hold models.Hold) (models.Hold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return models.Hold{}, err
+	}
+
+	if hold.Fee.Currency == "" {
+		hold.Fee = money.New(0, hold.Amount.Currency)
+	}
+	if hold.Fee.Currency != hold.Amount.Currency {
+		return models.Hold{}, money.ErrCurrencyMismatch
+	}
+	reserve := money.New(hold.Amount.Amount+hold.Fee.Amount, hold.Amount.Currency)
+	if err := s.checkSender(hold.Wallet, reserve, time.Now().UTC()); err != nil {
+		return models.Hold{}, err
+	}
+	if err := s.checkWallet(hold.Destination, hold.Amount.Currency); err != nil {
+		return models.Hold{}, err
+	}
+
+	// идентификаторы блокировок совпадают с позицией в срезе + 1
+	hold.ID = int64(len(s.holds)) + 1
+	hold.Status = storage.HoldActive
+	hold.CapturedAmount = money.New(0, hold.Amount.Currency)
+	hold.TransactionID = nil
+	hold.CreatedAt = hold.CreatedAt.UTC()
+	hold.ExpiresAt = hold.ExpiresAt.UTC()
+	s.holds = append(s.holds, hold)
+	return hold, nil
+}
+
+// GetHold возвращает блокировку по идентификатору.
+func (s *Storage) GetHold(ctx context.Context, id int64) (models.Hold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return models.Hold{}, err
+	}
+
+	hold, ok := s.hold(id)
+	if !ok {
+		return models.Hold{}, storage.ErrHoldNotFound
+	}
+	return *hold, nil
+}
+
+// CaptureHold списывает блокировку переводом на кошелек назначения
+// и комиссией за него.
+func (s *Storage) CaptureHold(ctx context.Context, id int64, amount money.Money, fee *models.Fee, check models.LimitCheck) (models.Hold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return models.Hold{}, err
+	}
+
+	now := time.Now().UTC()
+	hold, err := s.activeHold(id, now)
+	if err != nil {
+		return models.Hold{}, err
+	}
+	if amount.Currency != hold.Amount.Currency {
+		return models.Hold{}, money.ErrCurrencyMismatch
+	}
+	if amount.Amount > hold.Amount.Amount {
+		return models.Hold{}, storage.ErrCaptureExceedsHold
+	}
+	charged := money.New(0, amount.Currency)
+	if fee != nil {
+		if fee.Amount.Currency != amount.Currency {
+			return models.Hold{}, money.ErrCurrencyMismatch
+		}
+		charged = fee.Amount
+	}
+	if err := s.checkLimits(hold.Wallet, check); err != nil {
+		return models.Hold{}, err
+	}
+
+	// резерв блокировки освобождается вместе со списанием, поэтому
+	// с доступным балансом сравнивается только превышение над резервом
+	reserved := hold.Amount.Amount + hold.Fee.Amount
+	if err := s.checkSender(hold.Wallet, money.New(amount.Amount+charged.Amount-reserved, amount.Currency), now); err != nil {
+		return models.Hold{}, err
+	}
+	if err := s.checkWallet(hold.Destination, amount.Currency); err != nil {
+		return models.Hold{}, err
+	}
+	if fee != nil {
+		if err := s.checkWallet(fee.Wallet, fee.Amount.Currency); err != nil {
+			return models.Hold{}, fmt.Errorf("%w: %s: %v", storage.ErrFeeWallet, fee.Wallet, err)
+		}
+	}
+
+	tx, err := s.moveFunds(models.Transaction{From: hold.Wallet, To: hold.Destination, Amount: amount}, now)
+	if err != nil {
+		return models.Hold{}, err
+	}
+	if fee != nil {
+		_, err = s.moveFunds(models.Transaction{
+			From:   hold.Wallet,
+			To:     fee.Wallet,
+			Amount: fee.Amount,
+			FeeOf:  &tx.ID,
+		}, now)
+		if err != nil {
+			return models.Hold{}, err
+		}
+	}
+
+	hold.Status = storage.HoldCaptured
+	hold.CapturedAmount = amount
+	hold.Fee = charged
+	hold.TransactionID = &tx.ID
+	return *hold, nil
+}
+
+// VoidHold снимает активную блокировку.
+func (s *Storage) VoidHold(ctx context.Context, id int64) (models.Hold, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return models.Hold{}, err
+	}
+
+	hold, err := s.activeHold(id, time.Now().UTC())
+	if err != nil {
+		return models.Hold{}, err
+	}
+	hold.Status = storage.HoldVoided
+	return *hold, nil
+}
+
+// ExpireHolds помечает истекшими активные блокировки с expires_at <= before.
+func (s *Storage) ExpireHolds(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	var expired int64
+	for i := range s.holds {
+		if s.holds[i].Status == storage.HoldActive && !s.holds[i].ExpiresAt.After(before) {
+			s.holds[i].Status = storage.HoldExpired
+			expired++
+		}
+	}
+	return expired, nil
+}
+
+// hold возвращает указатель на блокировку в срезе. Вызывается под s.mu.
+func (s *Storage) hold(id int64) (*models.Hold, bool) {
+	if id < 1 || id > int64(len(s.holds)) {
+		return nil, false
+	}
+	return &s.holds[id-1], true
+}
+
+// activeHold возвращает блокировку, если она активна и не истекла.
+// Вызывается под s.mu.
+func (s *Storage) activeHold(id int64, now time.Time) (*models.Hold, error) {
+	hold, ok := s.hold(id)
+	if !ok {
+		return nil, storage.ErrHoldNotFound
+	}
+	if hold.Status != storage.HoldActive || !hold.ExpiresAt.After(now) {
+		return nil, storage.ErrHoldNotActive
+	}
+	return hold, nil
+}
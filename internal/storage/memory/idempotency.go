@@ -0,0 +1,94 @@
+package memory
+
+import (
+	"context"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/storage"
+	"time"
+)
+
+// CreateIdempotencyKey резервирует ключ идемпотентности.
+func (s *Storage) CreateIdempotencyKey(ctx context.Context, record models.IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if _, ok := s.idempotency[record.Key]; ok {
+		return storage.ErrIdempotencyKeyExists
+	}
+	record.CreatedAt = record.CreatedAt.UTC()
+	record.ExpiresAt = record.ExpiresAt.UTC()
+	s.idempotency[record.Key] = record
+	return nil
+}
+
+// GetIdempotencyKey возвращает сохраненную запись по ключу.
+func (s *Storage) GetIdempotencyKey(ctx context.Context, key string) (models.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return models.IdempotencyRecord{}, err
+	}
+
+	record, ok := s.idempotency[key]
+	if !ok {
+		return models.IdempotencyRecord{}, storage.ErrIdempotencyKeyNotFound
+	}
+	return record, nil
+}
+
+// CompleteIdempotencyKey сохраняет статус и тело ответа.
+func (s *Storage) CompleteIdempotencyKey(ctx context.Context, key string, status int, response []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	record, ok := s.idempotency[key]
+	if !ok {
+		return storage.ErrIdempotencyKeyNotFound
+	}
+	record.Status = status
+	record.Response = append([]byte(nil), response...)
+	s.idempotency[key] = record
+	return nil
+}
+
+// DeleteIdempotencyKey удаляет ключ, например после внутренней ошибки,
+// чтобы клиент мог повторить запрос.
+func (s *Storage) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	delete(s.idempotency, key)
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys удаляет истекшие ключи.
+func (s *Storage) DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	var n int64
+	for key, record := range s.idempotency {
+		if record.ExpiresAt.Before(before) {
+			delete(s.idempotency, key)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,168 @@
+package memory
+
+import (
+	"context"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/storage"
+	"sort"
+	"time"
+)
+
+// journalEntry — запись журнала вместе с ее проводками.
+type journalEntry struct {
+	ID            int64            `json:"id"`
+	Kind          string           `json:"kind"`
+	TransactionID *int64           `json:"transaction_id,omitempty"`
+	CreatedAt     time.Time        `json:"created_at"`
+	Postings      []models.Posting `json:"postings"`
+}
+
+// postEntry записывает в журнал запись с проводками. Вызывается под s.mu;
+// баланс проводок обеспечивают вызывающие функции.
+func (s *Storage) postEntry(kind string, transactionID *int64, at time.Time, postings ...models.Posting) {
+	var id int64 = 1
+	if len(s.entries) > 0 {
+		id = s.entries[len(s.entries)-1].ID + 1
+	}
+	s.entries = append(s.entries, journalEntry{
+		ID:            id,
+		Kind:          kind,
+		TransactionID: transactionID,
+		CreatedAt:     at,
+		Postings:      postings,
+	})
+}
+
+// postOpeningEntry проводит начальный остаток кошелька против системного счета.
+func (s *Storage) postOpeningEntry(address string, balance money.Money, at time.Time) {
+	if balance.Amount == 0 {
+		return
+	}
+	s.postEntry(storage.EntryOpening, nil, at,
+		models.Posting{Account: address, Amount: balance},
+		models.Posting{Account: storage.EquityAccount, Amount: money.New(-balance.Amount, balance.Currency)},
+	)
+}
+
+// backfillOpeningEntries создает записи начальных остатков для кошельков,
+// по которым еще нет ни одной проводки (например, тестовых кошельков).
+func (s *Storage) backfillOpeningEntries() {
+	posted := map[string]bool{}
+	for _, e := range s.entries {
+		for _, p := range e.Postings {
+			posted[p.Account] = true
+		}
+	}
+
+	now := time.Now().UTC()
+	count := 0
+	for _, w := range s.sortedWallets() {
+		if w.Balance.Amount == 0 || posted[w.Address] {
+			continue
+		}
+		s.postOpeningEntry(w.Address, w.Balance, now)
+		count++
+	}
+	if count > 0 {
+		s.logger.Info("ledger opening entries created", "wallets", count)
+	}
+}
+
+// VerifyLedger сверяет хранимые балансы с суммами проводок.
+func (s *Storage) VerifyLedger(ctx context.Context) (models.LedgerReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return models.LedgerReport{}, err
+	}
+
+	report := models.LedgerReport{
+		WalletsChecked:    len(s.wallets),
+		Discrepancies:     []models.LedgerDiscrepancy{},
+		UnbalancedEntries: []int64{},
+	}
+
+	type accountKey struct{ account, currency string }
+	sums := map[accountKey]int64{}
+	for _, e := range s.entries {
+		entrySums := map[string]int64{}
+		for _, p := range e.Postings {
+			sums[accountKey{p.Account, p.Amount.Currency}] += p.Amount.Amount
+			entrySums[p.Amount.Currency] += p.Amount.Amount
+		}
+		for _, sum := range entrySums {
+			if sum != 0 {
+				report.UnbalancedEntries = append(report.UnbalancedEntries, e.ID)
+				break
+			}
+		}
+	}
+
+	for _, w := range s.wallets {
+		sum := sums[accountKey{w.Address, w.Balance.Currency}]
+		if sum != w.Balance.Amount {
+			report.Discrepancies = append(report.Discrepancies, models.LedgerDiscrepancy{
+				Address:     w.Address,
+				Balance:     w.Balance,
+				PostingsSum: money.New(sum, w.Balance.Currency),
+			})
+		}
+	}
+	sort.Slice(report.Discrepancies, func(i, j int) bool {
+		return report.Discrepancies[i].Address < report.Discrepancies[j].Address
+	})
+	return report, nil
+}
+
+// GetStatement возвращает остаток кошелька на начало периода и проводки за период.
+func (s *Storage) GetStatement(ctx context.Context, address string, from, to time.Time) (models.Statement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return models.Statement{}, err
+	}
+
+	wallet, ok := s.wallets[address]
+	if !ok {
+		return models.Statement{}, storage.ErrWalletNotFound
+	}
+	currency := wallet.Balance.Currency
+
+	statement := models.Statement{Address: address, OpeningBalance: money.New(0, currency)}
+	for _, e := range s.entries {
+		for i, p := range e.Postings {
+			if p.Account != address || p.Amount.Currency != currency {
+				continue
+			}
+			if !from.IsZero() && e.CreatedAt.Before(from) {
+				statement.OpeningBalance.Amount += p.Amount.Amount
+				continue
+			}
+			if !to.IsZero() && !e.CreatedAt.Before(to) {
+				continue
+			}
+			statement.Lines = append(statement.Lines, models.StatementLine{
+				EntryID:       e.ID,
+				Kind:          e.Kind,
+				TransactionID: e.TransactionID,
+				Counterparty:  counterparty(e.Postings, i),
+				Amount:        p.Amount,
+				Timestamp:     e.CreatedAt.UTC(),
+			})
+		}
+	}
+	return statement, nil
+}
+
+// counterparty возвращает счет первой проводки записи, отличный от счета проводки i.
+func counterparty(postings []models.Posting, i int) string {
+	for _, p := range postings {
+		if p.Account != postings[i].Account {
+			return p.Account
+		}
+	}
+	return ""
+}
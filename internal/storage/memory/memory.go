@@ -0,0 +1,480 @@
+// Пакет memory содержит реализацию интерфейса storage.Storage в памяти процесса
+// Реализует:
+//   - Хранение кошельков, транзакций, блокировок, запланированных переводов,
+//     API-ключей и журнала проводок под одним мьютексом
+//   - Сидирование тестовых кошельков при первом запуске
+//   - Сохранение снимка в JSON-файл при остановке и загрузку при старте
+//
+// Не требует cgo и внешних сервисов, поэтому подходит для тестов и демонстраций.
+// Операции выполняются мгновенно, поэтому контекст проверяется один раз —
+// перед началом операции.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/storage"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Storage struct {
+	mu sync.Mutex
+
+	wallets      map[string]models.Wallet
+	transactions []models.Transaction // в порядке создания
+	entries      []journalEntry
+	idempotency  map[string]models.IdempotencyRecord
+	holds        []models.Hold        // в порядке создания
+	schedules    []models.Schedule    // в порядке создания
+	scheduleRuns []models.ScheduleRun // в порядке выполнения
+	apiKeys      []apiKey             // в порядке выпуска
+
+	initialized  bool
+	snapshotPath string
+	logger       *slog.Logger
+}
+
+// NewStorage создает пустое хранилище. Если snapshotPath не пуст,
+// Init загружает из него состояние, а Close сохраняет его обратно.
+func NewStorage(snapshotPath string, logger *slog.Logger) *Storage {
+	return &Storage{
+		wallets:      map[string]models.Wallet{},
+		idempotency:  map[string]models.IdempotencyRecord{},
+		snapshotPath: snapshotPath,
+		logger:       logger,
+	}
+}
+
+// Init загружает снимок (при первом вызове) и создает тестовые кошельки.
+func (s *Storage) Init(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if !s.initialized {
+		if err := s.loadSnapshot(); err != nil {
+			return fmt.Errorf("load snapshot: %w", err)
+		}
+		s.initialized = true
+	}
+
+	if err := s.seedWallets(); err != nil {
+		return err
+	}
+	s.backfillOpeningEntries()
+	return nil
+}
+
+// seedWallets создает тестовые кошельки, если хранилище пустое.
+func (s *Storage) seedWallets() error {
+	const count = 10
+	if len(s.wallets) > 0 {
+		return nil
+	}
+
+	balance, err := money.Parse("100", money.DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	for i := 1; i <= count; i++ {
+		address := "wallet-" + strconv.Itoa(i)
+		s.wallets[address] = models.Wallet{
+			Address:   address,
+			Balance:   balance,
+			CreatedAt: time.Now().UTC(),
+		}
+	}
+	return nil
+}
+
+// Transfer выполняет денежный перевод между кошельками.
+func (s *Storage) Transfer(ctx context.Context, transfer models.TransferRequest) (models.Receipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return models.Receipt{}, err
+	}
+	if transfer.Schedule != nil {
+		if err := s.checkScheduleDue(transfer.Schedule.Schedule.ID, transfer.Schedule.Run.ScheduledAt); err != nil {
+			return models.Receipt{}, err
+		}
+	}
+	receipt, err := s.transfer(transfer, time.Now().UTC())
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	if transfer.Schedule != nil {
+		run := transfer.Schedule.Run
+		run.TransactionID = &receipt.ID
+		s.recordScheduleRun(transfer.Schedule.Schedule, run)
+	}
+	return receipt, nil
+}
+
+// TransferBatch выполняет пакет переводов атомарно: при ошибке состояние
+// кошельков, транзакций и журнала возвращается к началу пакета.
+func (s *Storage) TransferBatch(ctx context.Context, transfers []models.TransferRequest) ([]models.Receipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// транзакции и записи журнала только дописываются, поэтому для отката
+	// достаточно длины срезов и исходных строк затронутых кошельков
+	wallets := map[string]models.Wallet{}
+	for _, t := range transfers {
+		addresses := []string{t.From, t.To}
+		if t.Fee != nil {
+			addresses = append(addresses, t.Fee.Wallet)
+		}
+		for _, address := range addresses {
+			if w, ok := s.wallets[address]; ok {
+				wallets[address] = w
+			}
+		}
+	}
+	transactions, entries := len(s.transactions), len(s.entries)
+	rollback := func() {
+		for address, w := range wallets {
+			s.wallets[address] = w
+		}
+		s.transactions = s.transactions[:transactions]
+		s.entries = s.entries[:entries]
+	}
+
+	now := time.Now().UTC()
+	receipts := make([]models.Receipt, 0, len(transfers))
+	for i, t := range transfers {
+		receipt, err := s.transfer(t, now)
+		if err != nil {
+			rollback()
+			return nil, &storage.BatchError{Index: i, Err: err}
+		}
+		receipts = append(receipts, receipt)
+	}
+	return receipts, nil
+}
+
+// transfer проверяет ограничения отправителя и кошельки и выполняет перевод.
+// Непустой t.Fee списывается с отправителя следом за переводом. Вызывается
+// под s.mu.
+func (s *Storage) transfer(t models.TransferRequest, now time.Time) (models.Receipt, error) {
+	tx := models.Transaction{From: t.From, To: t.To, Amount: t.Amount}
+	if t.Conversion != nil {
+		tx.DestinationAmount = &t.Conversion.Amount
+		tx.Rate = t.Conversion.Rate
+	}
+	debit := t.Amount
+	if t.Fee != nil {
+		if t.Fee.Amount.Currency != t.Amount.Currency {
+			return models.Receipt{}, money.ErrCurrencyMismatch
+		}
+		debit.Amount += t.Fee.Amount.Amount
+	}
+
+	if err := s.checkLimits(t.From, t.Check); err != nil {
+		return models.Receipt{}, err
+	}
+
+	//ПРОВЕРКА КОШЕЛЬКОВ
+	if err := s.checkSender(t.From, debit, now); err != nil {
+		return models.Receipt{}, err
+	}
+	if err := s.checkWallet(t.To, tx.Credit().Currency); err != nil {
+		return models.Receipt{}, err
+	}
+	if t.Fee != nil {
+		if err := s.checkWallet(t.Fee.Wallet, t.Fee.Amount.Currency); err != nil {
+			return models.Receipt{}, fmt.Errorf("%w: %s: %v", storage.ErrFeeWallet, t.Fee.Wallet, err)
+		}
+	}
+	//^ПРОВЕРКА КОШЕЛЬКОВ
+
+	tx, err := s.moveFunds(tx, now)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	receipt := models.Receipt{Transaction: tx}
+
+	if t.Fee != nil {
+		feeTx, err := s.moveFunds(models.Transaction{
+			From:   t.From,
+			To:     t.Fee.Wallet,
+			Amount: t.Fee.Amount,
+			FeeOf:  &tx.ID,
+		}, now)
+		if err != nil {
+			return models.Receipt{}, err
+		}
+		receipt.Fee = &feeTx
+	}
+
+	receipt.SenderBalance = s.wallets[t.From].Balance
+	return receipt, nil
+}
+
+// checkWallet проверяет, что кошелек существует, открыт и ведется в валюте
+// операции. Вызывается под s.mu.
+func (s *Storage) checkWallet(address, currency string) error {
+	wallet, ok := s.wallets[address]
+	if !ok {
+		return storage.ErrWalletNotFound
+	}
+	if wallet.ClosedAt != nil {
+		return storage.ErrWalletClosed
+	}
+	if wallet.Balance.Currency != currency {
+		return money.ErrCurrencyMismatch
+	}
+	return nil
+}
+
+// checkSender дополнительно к checkWallet проверяет, что доступного баланса
+// (за вычетом блокировок) хватает на сумму. Вызывается под s.mu.
+func (s *Storage) checkSender(address string, amount money.Money, now time.Time) error {
+	if err := s.checkWallet(address, amount.Currency); err != nil {
+		return err
+	}
+	if s.wallets[address].Balance.Amount-s.heldAmount(address, now) < amount.Amount {
+		return storage.ErrInsufficientFunds
+	}
+	return nil
+}
+
+// moveFunds переносит сумму между кошельками, записывает транзакцию и проводки
+// журнала и возвращает tx с заполненными ID и Timestamp. С отправителя
+// списывается tx.Amount, получателю зачисляется tx.Credit(); разница валют
+// проводится через storage.FXAccount. Вид записи журнала определяют
+// RefundOf и FeeOf. Проверки кошельков и достаточности средств — на
+// вызывающем. Вызывается под s.mu.
+func (s *Storage) moveFunds(tx models.Transaction, now time.Time) (models.Transaction, error) {
+	sender, receiver := s.wallets[tx.From], s.wallets[tx.To]
+	newReceiverBalance, err := receiver.Balance.Add(tx.Credit())
+	if err != nil {
+		return models.Transaction{}, err
+	}
+	sender.Balance.Amount -= tx.Amount.Amount
+	receiver.Balance = newReceiverBalance
+	s.wallets[tx.From] = sender
+	s.wallets[tx.To] = receiver
+
+	tx.ID = s.nextTransactionID()
+	tx.Timestamp = now.Format(time.RFC3339Nano)
+	s.transactions = append(s.transactions, tx)
+
+	id := tx.ID
+	s.postEntry(storage.EntryKind(tx), &id, now, storage.TransferPostings(tx)...)
+	return tx, nil
+}
+
+func (s *Storage) nextTransactionID() int64 {
+	if len(s.transactions) == 0 {
+		return 1
+	}
+	return s.transactions[len(s.transactions)-1].ID + 1
+}
+
+// GetBalance возвращает учетный и доступный баланс кошелька.
+func (s *Storage) GetBalance(ctx context.Context, address string) (models.Balance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return models.Balance{}, err
+	}
+
+	wallet, ok := s.wallets[address]
+	if !ok {
+		return models.Balance{}, storage.ErrWalletNotFound
+	}
+	held := s.heldAmount(address, time.Now().UTC())
+	return models.Balance{
+		Total:     wallet.Balance,
+		Available: money.New(wallet.Balance.Amount-held, wallet.Balance.Currency),
+	}, nil
+}
+
+// GetTransaction возвращает транзакцию по идентификатору.
+func (s *Storage) GetTransaction(ctx context.Context, id int64) (models.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return models.Transaction{}, err
+	}
+
+	tx, ok := s.transaction(id)
+	if !ok {
+		return models.Transaction{}, storage.ErrTransactionNotFound
+	}
+	return tx, nil
+}
+
+// transaction ищет транзакцию по ID. Вызывается под s.mu.
+func (s *Storage) transaction(id int64) (models.Transaction, bool) {
+	// идентификаторы растут в порядке создания, поэтому срез отсортирован по ID
+	i := sort.Search(len(s.transactions), func(i int) bool { return s.transactions[i].ID >= id })
+	if i == len(s.transactions) || s.transactions[i].ID != id {
+		return models.Transaction{}, false
+	}
+	return s.transactions[i], true
+}
+
+// ListTransactions возвращает транзакции по фильтру, от новых к старым.
+func (s *Storage) ListTransactions(ctx context.Context, filter storage.TransactionFilter) ([]models.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.filterTransactions(filter)
+}
+
+// EachTransaction передает fn транзакции по фильтру, от новых к старым.
+// Выборка копируется под мьютексом, а fn вызывается уже без него, чтобы
+// медленный получатель (например, выгрузка клиенту) не блокировал переводы.
+func (s *Storage) EachTransaction(ctx context.Context, filter storage.TransactionFilter, fn func(models.Transaction) error) error {
+	s.mu.Lock()
+	if err := ctx.Err(); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	transactions, err := s.filterTransactions(filter)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range transactions {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OutgoingSince считает исходящие переводы кошелька начиная с since.
+func (s *Storage) OutgoingSince(ctx context.Context, address string, since time.Time) (storage.Outgoing, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return storage.Outgoing{}, err
+	}
+	return s.outgoingSince(address, since)
+}
+
+// checkLimits вызывает непустую проверку ограничений отправителя from.
+// Вызывается под s.mu, поэтому проверки и списания идут по очереди.
+func (s *Storage) checkLimits(from string, check models.LimitCheck) error {
+	if check == nil {
+		return nil
+	}
+	return check(func(since time.Time) (storage.Outgoing, error) {
+		return s.outgoingSince(from, since)
+	})
+}
+
+// outgoingSince считает исходящие переводы кошелька начиная с since.
+// Вызывается под s.mu.
+func (s *Storage) outgoingSince(address string, since time.Time) (storage.Outgoing, error) {
+	var out storage.Outgoing
+	// транзакции создаются под s.mu по порядку, поэтому время не убывает с ID
+	for i := len(s.transactions) - 1; i >= 0; i-- {
+		tx := s.transactions[i]
+		createdAt, err := time.Parse(time.RFC3339Nano, tx.Timestamp)
+		if err != nil {
+			return storage.Outgoing{}, fmt.Errorf("transaction %d: parse timestamp: %w", tx.ID, err)
+		}
+		if createdAt.Before(since) {
+			break
+		}
+		if tx.From != address || tx.RefundOf != nil || tx.FeeOf != nil {
+			continue
+		}
+		out.Count++
+		out.Amount += tx.Amount.Amount
+	}
+	return out, nil
+}
+
+// filterTransactions отбирает транзакции по фильтру. Вызывается под s.mu.
+func (s *Storage) filterTransactions(filter storage.TransactionFilter) ([]models.Transaction, error) {
+	end := len(s.transactions)
+	if filter.BeforeID > 0 {
+		end = sort.Search(len(s.transactions), func(i int) bool { return s.transactions[i].ID >= filter.BeforeID })
+	}
+
+	var transactions []models.Transaction
+	for i := end - 1; i >= 0 && (filter.Limit == 0 || len(transactions) < filter.Limit); i-- {
+		tx := s.transactions[i]
+		ok, err := matchTransaction(tx, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			transactions = append(transactions, tx)
+		}
+	}
+	return transactions, nil
+}
+
+// matchTransaction проверяет транзакцию на соответствие фильтру (кроме курсора и лимита).
+func matchTransaction(tx models.Transaction, filter storage.TransactionFilter) (bool, error) {
+	switch {
+	case filter.Wallet == "":
+	case filter.Direction == storage.DirectionIn:
+		if tx.To != filter.Wallet {
+			return false, nil
+		}
+	case filter.Direction == storage.DirectionOut:
+		if tx.From != filter.Wallet {
+			return false, nil
+		}
+	default:
+		if tx.From != filter.Wallet && tx.To != filter.Wallet {
+			return false, nil
+		}
+	}
+
+	if filter.Currency != "" && tx.Amount.Currency != filter.Currency {
+		return false, nil
+	}
+	if filter.MinAmount > 0 && tx.Amount.Amount < filter.MinAmount {
+		return false, nil
+	}
+	if filter.MaxAmount > 0 && tx.Amount.Amount > filter.MaxAmount {
+		return false, nil
+	}
+
+	if filter.FromTime.IsZero() && filter.ToTime.IsZero() {
+		return true, nil
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, tx.Timestamp)
+	if err != nil {
+		return false, fmt.Errorf("transaction %d: parse timestamp: %w", tx.ID, err)
+	}
+	if !filter.FromTime.IsZero() && createdAt.Before(filter.FromTime) {
+		return false, nil
+	}
+	if !filter.ToTime.IsZero() && !createdAt.Before(filter.ToTime) {
+		return false, nil
+	}
+	return true, nil
+}
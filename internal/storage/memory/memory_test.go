@@ -0,0 +1,150 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/storage"
+	"paymentSystem/internal/storage/storagetest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var ctx = context.Background()
+
+func newTestStorage(t *testing.T, snapshotPath string) *Storage {
+	st := NewStorage(snapshotPath, slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	require.NoError(t, st.Init(ctx))
+	return st
+}
+
+// rub возвращает сумму в рублях, заданную в минимальных единицах (копейках).
+func rub(amount int64) money.Money {
+	return money.New(amount, "RUB")
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return newTestStorage(t, "")
+	})
+}
+
+func TestInit_SeedsWallets(t *testing.T) {
+	st := newTestStorage(t, "")
+
+	balance, err := st.GetBalance(ctx, "wallet-1")
+	require.NoError(t, err)
+	assert.Equal(t, rub(10000), balance.Total)
+
+	// Повторная инициализация идемпотентна
+	require.NoError(t, st.Init(ctx))
+	wallets, err := st.ListWallets(ctx, 100, 0)
+	require.NoError(t, err)
+	assert.Len(t, wallets, 10)
+}
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+
+	st := newTestStorage(t, path)
+	require.NoError(t, st.CreateWallet(ctx, models.Wallet{
+		Address: "usd", Balance: money.New(150, "USD"), Owner: "bob", CreatedAt: time.Now().UTC(),
+	}))
+	receipt, err := st.Transfer(ctx, models.TransferRequest{From: "wallet-1", To: "wallet-2", Amount: rub(2550)})
+	require.NoError(t, err)
+	require.NoError(t, st.CreateIdempotencyKey(ctx, models.IdempotencyRecord{
+		Key: "key-1", Fingerprint: "fp", CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour),
+	}))
+	hold, err := st.CreateHold(ctx, models.Hold{
+		Wallet: "wallet-1", Destination: "wallet-3", Amount: rub(1000),
+		CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	require.NoError(t, st.Close())
+
+	restored := newTestStorage(t, path)
+
+	balance, err := restored.GetBalance(ctx, "wallet-1")
+	require.NoError(t, err)
+	assert.Equal(t, rub(7450), balance.Total)
+	assert.Equal(t, rub(6450), balance.Available)
+
+	restoredHold, err := restored.GetHold(ctx, hold.ID)
+	require.NoError(t, err)
+	assert.Equal(t, hold.Amount, restoredHold.Amount)
+	assert.Equal(t, storage.HoldActive, restoredHold.Status)
+
+	wallet, err := restored.GetWallet(ctx, "usd")
+	require.NoError(t, err)
+	assert.Equal(t, money.New(150, "USD"), wallet.Balance)
+	assert.Equal(t, "bob", wallet.Owner)
+
+	tx, err := restored.GetTransaction(ctx, receipt.ID)
+	require.NoError(t, err)
+	assert.Equal(t, receipt.Transaction, tx)
+
+	_, err = restored.GetIdempotencyKey(ctx, "key-1")
+	assert.NoError(t, err)
+
+	// Новые транзакции продолжают нумерацию
+	next, err := restored.Transfer(ctx, models.TransferRequest{From: "wallet-2", To: "wallet-1", Amount: rub(50)})
+	require.NoError(t, err)
+	assert.Equal(t, receipt.ID+1, next.ID)
+
+	report, err := restored.VerifyLedger(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.OK(), "%+v", report)
+}
+
+func TestSnapshot_MissingFileStartsEmpty(t *testing.T) {
+	st := newTestStorage(t, filepath.Join(t.TempDir(), "missing.json"))
+
+	wallets, err := st.ListWallets(ctx, 100, 0)
+	require.NoError(t, err)
+	assert.Len(t, wallets, 10)
+}
+
+func TestSnapshot_CorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	require.NoError(t, os.WriteFile(path, []byte("{not json"), 0o600))
+
+	st := NewStorage(path, slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	assert.Error(t, st.Init(ctx))
+}
+
+func TestVerifyLedger_DetectsTamperedBalance(t *testing.T) {
+	st := newTestStorage(t, "")
+	require.NoError(t, st.CreateWallet(ctx, models.Wallet{Address: "wallet-a", Balance: rub(10000), CreatedAt: time.Now()}))
+
+	wallet := st.wallets["wallet-a"]
+	wallet.Balance.Amount++
+	st.wallets["wallet-a"] = wallet
+
+	report, err := st.VerifyLedger(ctx)
+	require.NoError(t, err)
+	require.Len(t, report.Discrepancies, 1)
+	assert.Equal(t, models.LedgerDiscrepancy{
+		Address:     "wallet-a",
+		Balance:     rub(10001),
+		PostingsSum: rub(10000),
+	}, report.Discrepancies[0])
+}
+
+func TestVerifyLedger_DetectsUnbalancedEntry(t *testing.T) {
+	st := newTestStorage(t, "")
+	st.entries = append(st.entries, journalEntry{
+		ID:       999,
+		Kind:     storage.EntryTransfer,
+		Postings: []models.Posting{{Account: "x", Amount: rub(5)}},
+	})
+
+	report, err := st.VerifyLedger(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{999}, report.UnbalancedEntries)
+}
@@ -0,0 +1,104 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/storage"
+	"slices"
+	"time"
+)
+
+// Refund возвращает сумму по транзакции отдельной транзакцией-возвратом.
+func (s *Storage) Refund(ctx context.Context, id int64, amount money.Money) (models.Receipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return models.Receipt{}, err
+	}
+
+	original, ok := s.transaction(id)
+	if !ok {
+		return models.Receipt{}, storage.ErrTransactionNotFound
+	}
+	if original.RefundOf != nil {
+		return models.Receipt{}, storage.ErrRefundOfRefund
+	}
+	if original.FeeOf != nil {
+		return models.Receipt{}, storage.ErrRefundOfFee
+	}
+	if amount.Currency != original.Amount.Currency {
+		return models.Receipt{}, money.ErrCurrencyMismatch
+	}
+
+	var refunded int64
+	for _, refund := range s.refunds(id) {
+		refunded += refund.Credit().Amount
+	}
+	if refunded+amount.Amount > original.Amount.Amount {
+		return models.Receipt{}, storage.ErrRefundExceedsAmount
+	}
+
+	// деньги возвращает получатель исходной транзакции, в своей валюте
+	debit, err := storage.RefundDebit(original, refunded, amount)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	refund := models.Transaction{
+		From:     original.To,
+		To:       original.From,
+		Amount:   debit,
+		RefundOf: &id,
+	}
+	if debit.Currency != amount.Currency {
+		refund.DestinationAmount = &amount
+		refund.Rate = storage.RefundRate(debit, amount)
+	}
+	now := time.Now().UTC()
+	err = s.checkSender(refund.From, debit, now)
+	if errors.Is(err, storage.ErrInsufficientFunds) {
+		return models.Receipt{}, storage.ErrRefundInsufficientFunds
+	}
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	if err := s.checkWallet(refund.To, amount.Currency); err != nil {
+		return models.Receipt{}, err
+	}
+
+	refund, err = s.moveFunds(refund, now)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+
+	return models.Receipt{
+		Transaction:   refund,
+		SenderBalance: s.wallets[refund.From].Balance,
+	}, nil
+}
+
+// ListRefunds возвращает возвраты по транзакции в порядке создания.
+func (s *Storage) ListRefunds(ctx context.Context, id int64) ([]models.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.refunds(id), nil
+}
+
+// refunds отбирает возвраты по транзакции. Вызывается под s.mu.
+func (s *Storage) refunds(id int64) []models.Transaction {
+	var refunds []models.Transaction
+	// возврат всегда создается позже исходной транзакции
+	for i := len(s.transactions) - 1; i >= 0 && s.transactions[i].ID > id; i-- {
+		if refund := s.transactions[i]; refund.RefundOf != nil && *refund.RefundOf == id {
+			refunds = append(refunds, refund)
+		}
+	}
+	slices.Reverse(refunds)
+	return refunds
+}
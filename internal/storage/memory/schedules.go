@@ -0,0 +1,168 @@
+package memory
+
+import (
+	"context"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/storage"
+	"sort"
+	"time"
+)
+
+// CreateSchedule сохраняет запланированный перевод.
+func (s *Storage) CreateSchedule(ctx context.Context, schedule models.Schedule) (models.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return models.Schedule{}, err
+	}
+
+	for _, address := range []string{schedule.From, schedule.To} {
+		if err := s.checkWallet(address, schedule.Amount.Currency); err != nil {
+			return models.Schedule{}, err
+		}
+	}
+
+	// идентификаторы совпадают с позицией в срезе + 1
+	schedule.ID = int64(len(s.schedules)) + 1
+	schedule.Status = storage.ScheduleActive
+	schedule.Attempts = 0
+	schedule.NextRunAt = schedule.NextRunAt.UTC()
+	schedule.CreatedAt = schedule.CreatedAt.UTC()
+	schedule.Runs = nil
+	s.schedules = append(s.schedules, schedule)
+	return schedule, nil
+}
+
+// GetSchedule возвращает запланированный перевод по идентификатору.
+func (s *Storage) GetSchedule(ctx context.Context, id int64) (models.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return models.Schedule{}, err
+	}
+
+	schedule, ok := s.schedule(id)
+	if !ok {
+		return models.Schedule{}, storage.ErrScheduleNotFound
+	}
+	return *schedule, nil
+}
+
+// CancelSchedule отменяет активный запланированный перевод.
+func (s *Storage) CancelSchedule(ctx context.Context, id int64) (models.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return models.Schedule{}, err
+	}
+
+	schedule, ok := s.schedule(id)
+	if !ok {
+		return models.Schedule{}, storage.ErrScheduleNotFound
+	}
+	if schedule.Status != storage.ScheduleActive {
+		return models.Schedule{}, storage.ErrScheduleNotActive
+	}
+	schedule.Status = storage.ScheduleCancelled
+	return *schedule, nil
+}
+
+// DueSchedules возвращает активные переводы, время запуска которых наступило.
+func (s *Storage) DueSchedules(ctx context.Context, now time.Time, limit int) ([]models.Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var due []models.Schedule
+	for _, schedule := range s.schedules {
+		if schedule.Status == storage.ScheduleActive && !schedule.NextRunAt.After(now) {
+			due = append(due, schedule)
+		}
+	}
+	// срез упорядочен по ID, стабильная сортировка сохраняет его при равном времени
+	sort.SliceStable(due, func(i, j int) bool {
+		return due[i].NextRunAt.Before(due[j].NextRunAt)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+// RecordScheduleRun сохраняет исход запуска и обновляет перевод.
+func (s *Storage) RecordScheduleRun(ctx context.Context, schedule models.Schedule, run models.ScheduleRun) (models.ScheduleRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return models.ScheduleRun{}, err
+	}
+
+	if err := s.checkScheduleDue(schedule.ID, run.ScheduledAt); err != nil {
+		return models.ScheduleRun{}, err
+	}
+	return s.recordScheduleRun(schedule, run), nil
+}
+
+// checkScheduleDue проверяет, что перевод id активен и ждет срабатывания
+// scheduledAt: повторная запись того же срабатывания и запись после отмены
+// получают ErrScheduleNotDue. Вызывается под s.mu.
+func (s *Storage) checkScheduleDue(id int64, scheduledAt time.Time) error {
+	current, ok := s.schedule(id)
+	if !ok {
+		return storage.ErrScheduleNotFound
+	}
+	if current.Status != storage.ScheduleActive || !current.NextRunAt.Equal(scheduledAt) {
+		return storage.ErrScheduleNotDue
+	}
+	return nil
+}
+
+// recordScheduleRun записывает запуск, прошедший checkScheduleDue.
+// Вызывается под s.mu.
+func (s *Storage) recordScheduleRun(schedule models.Schedule, run models.ScheduleRun) models.ScheduleRun {
+	current, _ := s.schedule(schedule.ID)
+	current.NextRunAt = schedule.NextRunAt.UTC()
+	current.Status = schedule.Status
+	current.Attempts = schedule.Attempts
+
+	run.ID = int64(len(s.scheduleRuns)) + 1
+	run.ScheduleID = schedule.ID
+	run.ScheduledAt = run.ScheduledAt.UTC()
+	run.ExecutedAt = run.ExecutedAt.UTC()
+	s.scheduleRuns = append(s.scheduleRuns, run)
+	return run
+}
+
+// ListScheduleRuns возвращает запуски запланированного перевода.
+func (s *Storage) ListScheduleRuns(ctx context.Context, id int64) ([]models.ScheduleRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var runs []models.ScheduleRun
+	for _, run := range s.scheduleRuns {
+		if run.ScheduleID == id {
+			runs = append(runs, run)
+		}
+	}
+	return runs, nil
+}
+
+// schedule возвращает указатель на запланированный перевод в срезе.
+// Вызывается под s.mu.
+func (s *Storage) schedule(id int64) (*models.Schedule, bool) {
+	if id < 1 || id > int64(len(s.schedules)) {
+		return nil, false
+	}
+	return &s.schedules[id-1], true
+}
@@ -0,0 +1,122 @@
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+)
+
+// snapshot — формат JSON-файла с состоянием хранилища.
+type snapshot struct {
+	Wallets         []models.Wallet            `json:"wallets"`
+	Transactions    []models.Transaction       `json:"transactions"`
+	Entries         []journalEntry             `json:"journal_entries"`
+	IdempotencyKeys []models.IdempotencyRecord `json:"idempotency_keys"`
+	Holds           []models.Hold              `json:"holds"`
+	Schedules       []models.Schedule          `json:"schedules"`
+	ScheduleRuns    []models.ScheduleRun       `json:"schedule_runs"`
+	APIKeys         []apiKey                   `json:"api_keys"`
+}
+
+// loadSnapshot читает состояние из файла снимка. Отсутствующий файл
+// не считается ошибкой: хранилище стартует пустым.
+func (s *Storage) loadSnapshot() error {
+	if s.snapshotPath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.snapshotPath)
+	if errors.Is(err, os.ErrNotExist) {
+		s.logger.Info("snapshot not found, starting empty", "path", s.snapshotPath)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("decode %s: %w", s.snapshotPath, err)
+	}
+
+	for _, w := range snap.Wallets {
+		s.wallets[w.Address] = w
+	}
+	s.transactions = snap.Transactions
+	s.entries = snap.Entries
+	s.holds = snap.Holds
+	for i := range s.holds {
+		// снимки до появления комиссий блокировок не содержат fee
+		if s.holds[i].Fee.Currency == "" {
+			s.holds[i].Fee = money.New(0, s.holds[i].Amount.Currency)
+		}
+	}
+	s.schedules = snap.Schedules
+	s.scheduleRuns = snap.ScheduleRuns
+	s.apiKeys = snap.APIKeys
+	for _, r := range snap.IdempotencyKeys {
+		s.idempotency[r.Key] = r
+	}
+
+	s.logger.Info("snapshot loaded",
+		"path", s.snapshotPath,
+		"wallets", len(snap.Wallets),
+		"transactions", len(snap.Transactions),
+	)
+	return nil
+}
+
+// Close сохраняет снимок состояния, если задан путь к файлу.
+// Файл записывается во временный и затем переименовывается,
+// чтобы прерванная запись не повредила предыдущий снимок.
+func (s *Storage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.snapshotPath == "" {
+		return nil
+	}
+
+	snap := snapshot{
+		Wallets:         s.sortedWallets(),
+		Transactions:    s.transactions,
+		Entries:         s.entries,
+		Holds:           s.holds,
+		Schedules:       s.schedules,
+		ScheduleRuns:    s.scheduleRuns,
+		APIKeys:         s.apiKeys,
+		IdempotencyKeys: make([]models.IdempotencyRecord, 0, len(s.idempotency)),
+	}
+	for _, r := range s.idempotency {
+		snap.IdempotencyKeys = append(snap.IdempotencyKeys, r)
+	}
+
+	data, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.snapshotPath), filepath.Base(s.snapshotPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.snapshotPath); err != nil {
+		return err
+	}
+
+	s.logger.Info("snapshot saved", "path", s.snapshotPath)
+	return nil
+}
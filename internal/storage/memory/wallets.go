@@ -0,0 +1,105 @@
+package memory
+
+import (
+	"context"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/storage"
+	"sort"
+	"time"
+)
+
+// CreateWallet добавляет новый кошелек. Ненулевой начальный баланс
+// проводится в журнале против системного счета.
+func (s *Storage) CreateWallet(ctx context.Context, wallet models.Wallet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if _, ok := s.wallets[wallet.Address]; ok {
+		return storage.ErrWalletExists
+	}
+	wallet.ClosedAt = nil
+	s.wallets[wallet.Address] = wallet
+	s.postOpeningEntry(wallet.Address, wallet.Balance, wallet.CreatedAt)
+	return nil
+}
+
+// GetWallet возвращает кошелек по адресу.
+func (s *Storage) GetWallet(ctx context.Context, address string) (models.Wallet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return models.Wallet{}, err
+	}
+
+	wallet, ok := s.wallets[address]
+	if !ok {
+		return models.Wallet{}, storage.ErrWalletNotFound
+	}
+	return wallet, nil
+}
+
+// ListWallets возвращает страницу кошельков в порядке создания.
+func (s *Storage) ListWallets(ctx context.Context, limit, offset int) ([]models.Wallet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	wallets := s.sortedWallets()
+	if offset >= len(wallets) {
+		return []models.Wallet{}, nil
+	}
+	wallets = wallets[offset:]
+	if limit < len(wallets) {
+		wallets = wallets[:limit]
+	}
+	return wallets, nil
+}
+
+// CloseWallet помечает кошелек закрытым, если на нем не осталось средств.
+func (s *Storage) CloseWallet(ctx context.Context, address string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	wallet, ok := s.wallets[address]
+	if !ok {
+		return storage.ErrWalletNotFound
+	}
+	if wallet.ClosedAt != nil {
+		return storage.ErrWalletClosed
+	}
+	if wallet.Balance.Amount != 0 {
+		return storage.ErrWalletNotEmpty
+	}
+
+	now := time.Now().UTC()
+	wallet.ClosedAt = &now
+	s.wallets[address] = wallet
+	return nil
+}
+
+// sortedWallets возвращает кошельки, упорядоченные по времени создания и адресу.
+func (s *Storage) sortedWallets() []models.Wallet {
+	wallets := make([]models.Wallet, 0, len(s.wallets))
+	for _, w := range s.wallets {
+		wallets = append(wallets, w)
+	}
+	sort.Slice(wallets, func(i, j int) bool {
+		if !wallets[i].CreatedAt.Equal(wallets[j].CreatedAt) {
+			return wallets[i].CreatedAt.Before(wallets[j].CreatedAt)
+		}
+		return wallets[i].Address < wallets[j].Address
+	})
+	return wallets
+}
@@ -0,0 +1,353 @@
+// Пакет migrate применяет версионные миграции схемы базы данных.
+//
+// Миграции нумеруются по возрастанию и выполняются по одной в отдельной
+// транзакции. Примененные версии записываются в таблицу schema_migrations,
+// поэтому изменения схемы можно выкатывать на уже существующие базы.
+//
+// Миграции задаются SQL-файлами вида 0001_initial.up.sql / 0001_initial.down.sql
+// (см. Load) или функциями Go, если изменение нельзя выразить одним SQL.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrDatabaseTooNew возвращается, если база мигрирована более новой версией приложения
+	ErrDatabaseTooNew = errors.New("database schema is newer than this build")
+
+	// ErrIrreversible возвращается при откате миграции без Down
+	ErrIrreversible = errors.New("migration cannot be rolled back")
+)
+
+// Migration — один шаг изменения схемы.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, tx *sql.Tx) error
+	// Down откатывает Up; nil означает необратимую миграцию.
+	Down func(ctx context.Context, tx *sql.Tx) error
+}
+
+// Dialect описывает особенности конкретной СУБД.
+type Dialect struct {
+	// Placeholder возвращает обозначение n-го параметра запроса (n с 1).
+	Placeholder func(n int) string
+	// Setup выполняется на соединении перед миграциями, Teardown — после.
+	Setup, Teardown []string
+	// Lock выполняется в начале каждой транзакции миграции, чтобы
+	// параллельно запущенные экземпляры не применяли одну миграцию дважды.
+	Lock string
+}
+
+// QuestionPlaceholder — параметры вида ? (SQLite).
+func QuestionPlaceholder(int) string { return "?" }
+
+// DollarPlaceholder — параметры вида $1 (PostgreSQL).
+func DollarPlaceholder(n int) string { return "$" + strconv.Itoa(n) }
+
+// Status описывает состояние одной миграции.
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+type Migrator struct {
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+	logger     *slog.Logger
+}
+
+// New проверяет набор миграций и создает Migrator. Версии должны быть
+// положительными и уникальными; порядок в срезе не важен.
+func New(db *sql.DB, dialect Dialect, migrations []Migration, logger *slog.Logger) (*Migrator, error) {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	for i, m := range sorted {
+		if m.Version <= 0 {
+			return nil, fmt.Errorf("migration %q: version must be positive", m.Name)
+		}
+		if m.Up == nil {
+			return nil, fmt.Errorf("migration %d: missing up", m.Version)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("duplicate migration version %d", m.Version)
+		}
+	}
+
+	return &Migrator{
+		db:         db,
+		dialect:    dialect,
+		migrations: sorted,
+		logger:     logger,
+	}, nil
+}
+
+// Latest возвращает последнюю версию, известную приложению.
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version возвращает текущую версию схемы базы (0 — миграции не применялись).
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	var version int
+	err := m.withConn(ctx, func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		version = maxVersion(applied)
+		return nil
+	})
+	return version, err
+}
+
+// Up применяет все еще не примененные миграции.
+// Если база новее приложения, возвращает ErrDatabaseTooNew и ничего не меняет.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withConn(ctx, func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if err := m.checkNotTooNew(applied); err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if _, ok := applied[migration.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, migration); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Down откатывает steps последних примененных миграций.
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withConn(ctx, func(ctx context.Context, conn *sql.Conn) error {
+		for i := 0; i < steps; i++ {
+			applied, err := m.applied(ctx, conn)
+			if err != nil {
+				return err
+			}
+			if err := m.checkNotTooNew(applied); err != nil {
+				return err
+			}
+
+			version := maxVersion(applied)
+			if version == 0 {
+				return nil
+			}
+			migration, ok := m.find(version)
+			if !ok {
+				return fmt.Errorf("migration %d is applied but unknown to this build", version)
+			}
+			if err := m.revert(ctx, conn, migration); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Status возвращает все известные миграции с отметкой о применении.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.withConn(ctx, func(ctx context.Context, conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			status := Status{Version: migration.Version, Name: migration.Name}
+			if at, ok := applied[migration.Version]; ok {
+				at := at
+				status.AppliedAt = &at
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
+
+// withConn выполняет fn на выделенном соединении: настройки Setup
+// (например, PRAGMA в SQLite) действуют только на соединение.
+func (m *Migrator) withConn(ctx context.Context, fn func(ctx context.Context, conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for _, stmt := range m.dialect.Setup {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%s: %w", stmt, err)
+		}
+	}
+	defer func() {
+		for _, stmt := range m.dialect.Teardown {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				m.logger.Error("migration teardown failed", "stmt", stmt, "err", err)
+			}
+		}
+	}()
+
+	if err := m.ensureTable(ctx, conn); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	return fn(ctx, conn)
+}
+
+func (m *Migrator) ensureTable(ctx context.Context, conn *sql.Conn) error {
+	tx, err := m.begin(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+		    version INTEGER NOT NULL PRIMARY KEY,
+		    name TEXT NOT NULL,
+		    applied_at TIMESTAMP NOT NULL
+		)`)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// begin открывает транзакцию и берет блокировку миграций.
+func (m *Migrator) begin(ctx context.Context, conn *sql.Conn) (*sql.Tx, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if m.dialect.Lock != "" {
+		if _, err := tx.ExecContext(ctx, m.dialect.Lock); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("acquire migration lock: %w", err)
+		}
+	}
+	return tx, nil
+}
+
+// applied возвращает примененные версии со временем применения.
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+func (m *Migrator) checkNotTooNew(applied map[int]time.Time) error {
+	if version := maxVersion(applied); version > m.Latest() {
+		return fmt.Errorf("%w: database is at version %d, this build knows up to %d",
+			ErrDatabaseTooNew, version, m.Latest())
+	}
+	return nil
+}
+
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	tx, err := m.begin(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// другой экземпляр мог применить миграцию, пока мы ждали блокировку
+	var exists int
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM schema_migrations WHERE version = "+m.dialect.Placeholder(1),
+		migration.Version).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists > 0 {
+		return nil
+	}
+
+	m.logger.Info("applying migration", "version", migration.Version, "name", migration.Name)
+	if err := migration.Up(ctx, tx); err != nil {
+		return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO schema_migrations (version, name, applied_at) VALUES (%s, %s, %s)",
+		m.dialect.Placeholder(1), m.dialect.Placeholder(2), m.dialect.Placeholder(3)),
+		migration.Version, migration.Name, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *Migrator) revert(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	if migration.Down == nil {
+		return fmt.Errorf("%w: %d_%s", ErrIrreversible, migration.Version, migration.Name)
+	}
+
+	tx, err := m.begin(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	m.logger.Info("reverting migration", "version", migration.Version, "name", migration.Name)
+	if err := migration.Down(ctx, tx); err != nil {
+		return fmt.Errorf("revert %d_%s: %w", migration.Version, migration.Name, err)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version = "+m.dialect.Placeholder(1), migration.Version)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// find возвращает миграцию по версии.
+func (m *Migrator) find(version int) (Migration, bool) {
+	i := sort.Search(len(m.migrations), func(i int) bool { return m.migrations[i].Version >= version })
+	if i == len(m.migrations) || m.migrations[i].Version != version {
+		return Migration{}, false
+	}
+	return m.migrations[i], true
+}
+
+func maxVersion(applied map[int]time.Time) int {
+	version := 0
+	for v := range applied {
+		if v > version {
+			version = v
+		}
+	}
+	return version
+}
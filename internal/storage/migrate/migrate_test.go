@@ -0,0 +1,151 @@
+//go:build cgo
+
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var ctx = context.Background()
+
+var testDialect = Dialect{Placeholder: QuestionPlaceholder}
+
+func openDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newMigrator(t *testing.T, db *sql.DB, migrations []Migration) *Migrator {
+	m, err := New(db, testDialect, migrations, slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	require.NoError(t, err)
+	return m
+}
+
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	var n int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n))
+	return n > 0
+}
+
+var testMigrations = []Migration{
+	{Version: 2, Name: "b", Up: Exec("CREATE TABLE b (id INTEGER)"), Down: Exec("DROP TABLE b")},
+	{Version: 1, Name: "a", Up: Exec("CREATE TABLE a (id INTEGER)"), Down: Exec("DROP TABLE a")},
+}
+
+func TestUpDown(t *testing.T) {
+	db := openDB(t)
+	m := newMigrator(t, db, testMigrations)
+
+	version, err := m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, version)
+
+	require.NoError(t, m.Up(ctx))
+	version, err = m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+	assert.True(t, tableExists(t, db, "a"))
+	assert.True(t, tableExists(t, db, "b"))
+
+	// Повторный запуск ничего не делает
+	require.NoError(t, m.Up(ctx))
+
+	require.NoError(t, m.Down(ctx, 1))
+	version, err = m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, version)
+	assert.False(t, tableExists(t, db, "b"))
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.NotNil(t, statuses[0].AppliedAt)
+	assert.Nil(t, statuses[1].AppliedAt)
+
+	// Откат глубже начальной версии останавливается на нуле
+	require.NoError(t, m.Down(ctx, 5))
+	assert.False(t, tableExists(t, db, "a"))
+}
+
+func TestUp_FailedMigrationRollsBack(t *testing.T) {
+	db := openDB(t)
+	m := newMigrator(t, db, append(testMigrations[:1:1],
+		Migration{Version: 1, Name: "a", Up: Exec("CREATE TABLE a (id INTEGER)")},
+		Migration{Version: 3, Name: "broken", Up: Exec("CREATE TABLE c (id INTEGER); SELECT * FROM missing")},
+	))
+
+	assert.Error(t, m.Up(ctx))
+
+	version, err := m.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+	assert.False(t, tableExists(t, db, "c"))
+}
+
+func TestUp_RefusesNewerDatabase(t *testing.T) {
+	db := openDB(t)
+	require.NoError(t, newMigrator(t, db, testMigrations).Up(ctx))
+
+	older := newMigrator(t, db, testMigrations[1:])
+	assert.ErrorIs(t, older.Up(ctx), ErrDatabaseTooNew)
+	assert.ErrorIs(t, older.Down(ctx, 1), ErrDatabaseTooNew)
+	assert.True(t, tableExists(t, db, "b"))
+}
+
+func TestDown_Irreversible(t *testing.T) {
+	db := openDB(t)
+	m := newMigrator(t, db, []Migration{{Version: 1, Name: "a", Up: Exec("CREATE TABLE a (id INTEGER)")}})
+	require.NoError(t, m.Up(ctx))
+
+	assert.ErrorIs(t, m.Down(ctx, 1), ErrIrreversible)
+	assert.True(t, tableExists(t, db, "a"))
+}
+
+func TestNew_Validates(t *testing.T) {
+	_, err := New(nil, testDialect, []Migration{testMigrations[0], testMigrations[0]}, nil)
+	assert.Error(t, err)
+
+	_, err = New(nil, testDialect, []Migration{{Version: 0, Name: "zero", Up: Exec("")}}, nil)
+	assert.Error(t, err)
+
+	_, err = New(nil, testDialect, []Migration{{Version: 1, Name: "no_up"}}, nil)
+	assert.Error(t, err)
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(fstest.MapFS{
+		"0001_create_a.up.sql":   {Data: []byte("CREATE TABLE a (id INTEGER)")},
+		"0001_create_a.down.sql": {Data: []byte("DROP TABLE a")},
+		"0002_create_b.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER)")},
+	})
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, 1, migrations[0].Version)
+	assert.Equal(t, "create_a", migrations[0].Name)
+	assert.NotNil(t, migrations[0].Down)
+	assert.Nil(t, migrations[1].Down)
+
+	_, err = Load(fstest.MapFS{"0001_a.down.sql": {Data: []byte("")}})
+	assert.Error(t, err)
+
+	_, err = Load(fstest.MapFS{"create_a.sql": {Data: []byte("")}})
+	assert.Error(t, err)
+
+	_, err = Load(fstest.MapFS{
+		"0001_a.up.sql":   {Data: []byte("")},
+		"0001_b.down.sql": {Data: []byte("")},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,155 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/storage"
+	"time"
+)
+
+// apiKeyColumns — колонки api_keys в порядке scanAPIKey.
+const apiKeyColumns = `id, name, prefix, wallets, roles, permissions, created_at, rotated_at, revoked_at`
+
+// CreateAPIKey сохраняет API-ключ.
+func (s *Storage) CreateAPIKey(ctx context.Context, key models.APIKey, hash string) (models.APIKey, error) {
+	wallets, err := json.Marshal(key.Wallets)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	roles, err := json.Marshal(key.Roles)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	permissions, err := json.Marshal(key.Permissions)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+
+	key.CreatedAt = key.CreatedAt.UTC()
+	key.RotatedAt = nil
+	key.RevokedAt = nil
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO api_keys (name, prefix, key_hash, wallets, roles, permissions, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`,
+		key.Name, key.Prefix, hash, string(wallets), string(roles), string(permissions), key.CreatedAt).Scan(&key.ID)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	return key, nil
+}
+
+// GetAPIKey возвращает API-ключ по идентификатору.
+func (s *Storage) GetAPIKey(ctx context.Context, id int64) (models.APIKey, error) {
+	return scanAPIKey(s.db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE id = $1", id))
+}
+
+// GetAPIKeyByHash возвращает API-ключ по хешу.
+func (s *Storage) GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error) {
+	return scanAPIKey(s.db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = $1", hash))
+}
+
+// ListAPIKeys возвращает все API-ключи в порядке выпуска.
+func (s *Storage) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RotateAPIKey заменяет хеш действующего API-ключа.
+func (s *Storage) RotateAPIKey(ctx context.Context, id int64, hash, prefix string, at time.Time) (models.APIKey, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	key, err := scanAPIKey(tx.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE id = $1 FOR UPDATE", id))
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	if key.RevokedAt != nil {
+		return models.APIKey{}, storage.ErrAPIKeyRevoked
+	}
+
+	at = at.UTC()
+	key.Prefix = prefix
+	key.RotatedAt = &at
+	if _, err := tx.ExecContext(ctx, "UPDATE api_keys SET key_hash = $1, prefix = $2, rotated_at = $3 WHERE id = $4", hash, prefix, at, id); err != nil {
+		return models.APIKey{}, err
+	}
+	return key, tx.Commit()
+}
+
+// RevokeAPIKey отзывает API-ключ.
+func (s *Storage) RevokeAPIKey(ctx context.Context, id int64, at time.Time) (models.APIKey, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	key, err := scanAPIKey(tx.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE id = $1 FOR UPDATE", id))
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	if key.RevokedAt != nil {
+		return models.APIKey{}, storage.ErrAPIKeyRevoked
+	}
+
+	at = at.UTC()
+	key.RevokedAt = &at
+	if _, err := tx.ExecContext(ctx, "UPDATE api_keys SET revoked_at = $1 WHERE id = $2", at, id); err != nil {
+		return models.APIKey{}, err
+	}
+	return key, tx.Commit()
+}
+
+// scanAPIKey читает API-ключ из строки с колонками apiKeyColumns.
+func scanAPIKey(row rowScanner) (models.APIKey, error) {
+	var key models.APIKey
+	var wallets, roles, permissions string
+	var rotatedAt, revokedAt sql.NullTime
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &wallets, &roles, &permissions, &key.CreatedAt, &rotatedAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.APIKey{}, storage.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	if err := json.Unmarshal([]byte(wallets), &key.Wallets); err != nil {
+		return models.APIKey{}, fmt.Errorf("api key %d: decode wallets: %w", key.ID, err)
+	}
+	if err := json.Unmarshal([]byte(roles), &key.Roles); err != nil {
+		return models.APIKey{}, fmt.Errorf("api key %d: decode roles: %w", key.ID, err)
+	}
+	if err := json.Unmarshal([]byte(permissions), &key.Permissions); err != nil {
+		return models.APIKey{}, fmt.Errorf("api key %d: decode permissions: %w", key.ID, err)
+	}
+	key.CreatedAt = key.CreatedAt.UTC()
+	if rotatedAt.Valid {
+		t := rotatedAt.Time.UTC()
+		key.RotatedAt = &t
+	}
+	if revokedAt.Valid {
+		t := revokedAt.Time.UTC()
+		key.RevokedAt = &t
+	}
+	return key, nil
+}
@@ -0,0 +1,216 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/storage"
+	"time"
+)
+
+// postEntry записывает в журнал сбалансированную запись с проводками.
+func postEntry(ctx context.Context, tx *sql.Tx, kind string, transactionID *int64, at time.Time, postings ...models.Posting) error {
+	sums := map[string]int64{}
+	for _, p := range postings {
+		sums[p.Amount.Currency] += p.Amount.Amount
+	}
+	for currency, sum := range sums {
+		if sum != 0 {
+			return fmt.Errorf("unbalanced %s entry: %s postings sum to %d", kind, currency, sum)
+		}
+	}
+
+	var entryID int64
+	err := tx.QueryRowContext(ctx, "INSERT INTO journal_entries (kind, transaction_id, created_at) VALUES ($1, $2, $3) RETURNING id",
+		kind, transactionID, at).Scan(&entryID)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range postings {
+		_, err := tx.ExecContext(ctx, "INSERT INTO postings (entry_id, account, amount, currency) VALUES ($1, $2, $3, $4)",
+			entryID, p.Account, p.Amount.Amount, p.Amount.Currency)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// postOpeningEntry проводит начальный остаток кошелька против системного счета.
+func postOpeningEntry(ctx context.Context, tx *sql.Tx, address string, balance money.Money, at time.Time) error {
+	if balance.Amount == 0 {
+		return nil
+	}
+	return postEntry(ctx, tx, storage.EntryOpening, nil, at,
+		models.Posting{Account: address, Amount: balance},
+		models.Posting{Account: storage.EquityAccount, Amount: money.New(-balance.Amount, balance.Currency)},
+	)
+}
+
+// backfillOpeningEntries создает записи начальных остатков для кошельков без проводок.
+func (s *Storage) backfillOpeningEntries(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT address, balance, currency
+		FROM wallets
+		WHERE balance != 0
+		  AND NOT EXISTS (SELECT 1 FROM postings WHERE postings.account = wallets.address)`)
+	if err != nil {
+		return err
+	}
+	var wallets []models.Wallet
+	for rows.Next() {
+		var w models.Wallet
+		if err := rows.Scan(&w.Address, &w.Balance.Amount, &w.Balance.Currency); err != nil {
+			rows.Close()
+			return err
+		}
+		wallets = append(wallets, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, w := range wallets {
+		if err := postOpeningEntry(ctx, tx, w.Address, w.Balance, now); err != nil {
+			return fmt.Errorf("opening entry for %s: %w", w.Address, err)
+		}
+	}
+	if len(wallets) > 0 {
+		s.logger.Info("ledger opening entries created", "wallets", len(wallets))
+	}
+	return nil
+}
+
+// VerifyLedger сверяет хранимые балансы с суммами проводок.
+func (s *Storage) VerifyLedger(ctx context.Context) (models.LedgerReport, error) {
+	report := models.LedgerReport{
+		Discrepancies:     []models.LedgerDiscrepancy{},
+		UnbalancedEntries: []int64{},
+	}
+
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM wallets").Scan(&report.WalletsChecked); err != nil {
+		return report, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT w.address, w.balance, w.currency, COALESCE(SUM(p.amount), 0)::BIGINT
+		FROM wallets w
+		LEFT JOIN postings p ON p.account = w.address AND p.currency = w.currency
+		GROUP BY w.address, w.balance, w.currency
+		HAVING w.balance != COALESCE(SUM(p.amount), 0)
+		ORDER BY w.address`)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var d models.LedgerDiscrepancy
+		if err := rows.Scan(&d.Address, &d.Balance.Amount, &d.Balance.Currency, &d.PostingsSum.Amount); err != nil {
+			return report, err
+		}
+		d.PostingsSum.Currency = d.Balance.Currency
+		report.Discrepancies = append(report.Discrepancies, d)
+	}
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+
+	entries, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT entry_id
+		FROM postings
+		GROUP BY entry_id, currency
+		HAVING SUM(amount) != 0
+		ORDER BY entry_id`)
+	if err != nil {
+		return report, err
+	}
+	defer entries.Close()
+
+	for entries.Next() {
+		var id int64
+		if err := entries.Scan(&id); err != nil {
+			return report, err
+		}
+		report.UnbalancedEntries = append(report.UnbalancedEntries, id)
+	}
+	return report, entries.Err()
+}
+
+// GetStatement читает остаток на начало периода и проводки кошелька за период
+// в одном снимке базы (REPEATABLE READ), чтобы новые переводы не разъехались с остатком.
+func (s *Storage) GetStatement(ctx context.Context, address string, from, to time.Time) (models.Statement, error) {
+	tx, err := s.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return models.Statement{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	statement := models.Statement{Address: address}
+	var currency string
+	err = tx.QueryRowContext(ctx, "SELECT currency FROM wallets WHERE address = $1", address).Scan(&currency)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Statement{}, storage.ErrWalletNotFound
+	}
+	if err != nil {
+		return models.Statement{}, err
+	}
+	statement.OpeningBalance = money.New(0, currency)
+
+	if !from.IsZero() {
+		err = tx.QueryRowContext(ctx, `
+			SELECT COALESCE(SUM(p.amount), 0)
+			FROM postings p
+			JOIN journal_entries e ON e.id = p.entry_id
+			WHERE p.account = $1 AND p.currency = $2 AND e.created_at < $3`,
+			address, currency, from).Scan(&statement.OpeningBalance.Amount)
+		if err != nil {
+			return models.Statement{}, err
+		}
+	}
+
+	query := `
+		SELECT e.id, e.kind, e.transaction_id, e.created_at, p.amount,
+		       COALESCE((SELECT o.account FROM postings o
+		                 WHERE o.entry_id = e.id AND o.account != p.account ORDER BY o.id LIMIT 1), '')
+		FROM postings p
+		JOIN journal_entries e ON e.id = p.entry_id
+		WHERE p.account = $1 AND p.currency = $2`
+	args := []any{address, currency}
+	if !from.IsZero() {
+		args = append(args, from)
+		query += fmt.Sprintf(" AND e.created_at >= $%d", len(args))
+	}
+	if !to.IsZero() {
+		args = append(args, to)
+		query += fmt.Sprintf(" AND e.created_at < $%d", len(args))
+	}
+	query += " ORDER BY e.id, p.id"
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return models.Statement{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line models.StatementLine
+		var transactionID sql.NullInt64
+		line.Amount.Currency = currency
+		if err := rows.Scan(&line.EntryID, &line.Kind, &transactionID, &line.Timestamp, &line.Amount.Amount, &line.Counterparty); err != nil {
+			return models.Statement{}, err
+		}
+		if transactionID.Valid {
+			line.TransactionID = &transactionID.Int64
+		}
+		line.Timestamp = line.Timestamp.UTC()
+		statement.Lines = append(statement.Lines, line)
+	}
+	return statement, rows.Err()
+}
@@ -0,0 +1,30 @@
+package postgres
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"paymentSystem/internal/storage/migrate"
+	"strconv"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var dialect = migrate.Dialect{
+	Placeholder: migrate.DollarPlaceholder,
+	Lock:        "SELECT pg_advisory_xact_lock(" + strconv.Itoa(initLockID) + ")",
+}
+
+// Migrator возвращает мигратор схемы PostgreSQL.
+func (s *Storage) Migrator() (*migrate.Migrator, error) {
+	files, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := migrate.Load(files)
+	if err != nil {
+		return nil, fmt.Errorf("load migrations: %w", err)
+	}
+	return migrate.New(s.db, dialect, migrations, s.logger)
+}
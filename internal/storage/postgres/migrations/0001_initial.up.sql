@@ -0,0 +1,48 @@
+-- Исходная схема; суммы хранятся в минимальных единицах валюты (BIGINT).
+CREATE TABLE IF NOT EXISTS wallets (
+    address TEXT NOT NULL PRIMARY KEY,
+    balance BIGINT NOT NULL,
+    currency TEXT NOT NULL DEFAULT 'RUB',
+    owner TEXT NOT NULL DEFAULT '',
+    label TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ,
+    closed_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id BIGSERIAL PRIMARY KEY,
+    from_address TEXT NOT NULL REFERENCES wallets(address),
+    to_address TEXT NOT NULL REFERENCES wallets(address),
+    amount BIGINT NOT NULL,
+    currency TEXT NOT NULL DEFAULT 'RUB',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key TEXT NOT NULL PRIMARY KEY,
+    fingerprint TEXT NOT NULL,
+    status INTEGER NOT NULL DEFAULT 0,
+    response BYTEA,
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id BIGSERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,
+    transaction_id BIGINT REFERENCES transactions(id),
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS postings (
+    id BIGSERIAL PRIMARY KEY,
+    entry_id BIGINT NOT NULL REFERENCES journal_entries(id),
+    account TEXT NOT NULL,
+    amount BIGINT NOT NULL,
+    currency TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_postings_account ON postings(account);
+CREATE INDEX IF NOT EXISTS idx_postings_entry_id ON postings(entry_id);
@@ -0,0 +1,4 @@
+-- Индексы для фильтра истории по кошельку. Вместе с id в ключе индекса
+-- позволяют выбирать страницу keyset-пагинации (id < курсор) без сортировки.
+CREATE INDEX IF NOT EXISTS idx_transactions_from_address ON transactions(from_address, id);
+CREATE INDEX IF NOT EXISTS idx_transactions_to_address ON transactions(to_address, id);
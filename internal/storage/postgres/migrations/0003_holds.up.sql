@@ -0,0 +1,17 @@
+-- Блокировки средств (двухфазные платежи). Активные блокировки уменьшают
+-- доступный баланс кошелька; при списании создается перевод transaction_id.
+CREATE TABLE IF NOT EXISTS holds (
+    id BIGSERIAL PRIMARY KEY,
+    wallet TEXT NOT NULL REFERENCES wallets(address),
+    destination TEXT NOT NULL REFERENCES wallets(address),
+    amount BIGINT NOT NULL,
+    currency TEXT NOT NULL,
+    captured_amount BIGINT NOT NULL DEFAULT 0,
+    status TEXT NOT NULL,
+    transaction_id BIGINT REFERENCES transactions(id),
+    created_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_holds_wallet_status ON holds(wallet, status);
+CREATE INDEX IF NOT EXISTS idx_holds_status_expires_at ON holds(status, expires_at);
@@ -0,0 +1,4 @@
+-- Связь возврата с исходной транзакцией.
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS refund_of BIGINT REFERENCES transactions(id);
+
+CREATE INDEX IF NOT EXISTS idx_transactions_refund_of ON transactions(refund_of);
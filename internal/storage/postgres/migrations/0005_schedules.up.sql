@@ -0,0 +1,28 @@
+-- Запланированные переводы: разовые (cron пуст) и повторяющиеся по cron-выражению.
+-- attempts — число неудачных попыток текущего запуска.
+CREATE TABLE IF NOT EXISTS schedules (
+    id BIGSERIAL PRIMARY KEY,
+    from_address TEXT NOT NULL REFERENCES wallets(address),
+    to_address TEXT NOT NULL REFERENCES wallets(address),
+    amount BIGINT NOT NULL,
+    currency TEXT NOT NULL,
+    cron TEXT NOT NULL DEFAULT '',
+    next_run_at TIMESTAMPTZ NOT NULL,
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_schedules_status_next_run_at ON schedules(status, next_run_at);
+
+-- Исходы запусков запланированных переводов
+CREATE TABLE IF NOT EXISTS schedule_runs (
+    id BIGSERIAL PRIMARY KEY,
+    schedule_id BIGINT NOT NULL REFERENCES schedules(id),
+    status TEXT NOT NULL,
+    transaction_id BIGINT REFERENCES transactions(id),
+    error TEXT NOT NULL DEFAULT '',
+    executed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_schedule_runs_schedule_id ON schedule_runs(schedule_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_transactions_fee_of;
+ALTER TABLE transactions DROP COLUMN IF EXISTS fee_of;
@@ -0,0 +1,4 @@
+-- Связь комиссии с переводом, за который она списана.
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fee_of BIGINT REFERENCES transactions(id);
+
+CREATE INDEX IF NOT EXISTS idx_transactions_fee_of ON transactions(fee_of);
@@ -0,0 +1,3 @@
+ALTER TABLE transactions DROP COLUMN IF EXISTS rate;
+ALTER TABLE transactions DROP COLUMN IF EXISTS dest_currency;
+ALTER TABLE transactions DROP COLUMN IF EXISTS dest_amount;
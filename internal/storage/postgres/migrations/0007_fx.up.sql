@@ -0,0 +1,5 @@
+-- Конвертация при переводе между валютами: сумма, зачисленная получателю
+-- в его валюте, и примененный курс. У переводов в одной валюте — NULL.
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS dest_amount BIGINT;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS dest_currency TEXT;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS rate TEXT;
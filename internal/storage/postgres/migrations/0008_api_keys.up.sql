@@ -0,0 +1,12 @@
+-- API-ключи. Хранится только SHA-256 ключа; wallets и permissions — JSON-массивы.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    wallets JSONB NOT NULL,
+    permissions JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    rotated_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
@@ -0,0 +1,2 @@
+-- Роли API-ключа — JSON-массив; права ролей задаются в конфигурации.
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS roles JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_schedule_runs_schedule_id_scheduled_at;
+ALTER TABLE schedule_runs DROP COLUMN IF EXISTS scheduled_at;
@@ -0,0 +1,530 @@
+// Пакет postgres содержит реализацию интерфейса storage.Storage для PostgreSQL
+// Реализует:
+// - Версионные миграции схемы и сидирование тестовых кошельков
+// - Операции с кошельками и транзакциями
+//
+// В отличие от SQLite, где запись сериализуется на уровне файла,
+// PostgreSQL допускает параллельные транзакции, поэтому Transfer
+// блокирует строки обоих кошельков через SELECT ... FOR UPDATE.
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/storage"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// DriverName — имя драйвера database/sql для sql.Open.
+const DriverName = "pgx"
+
+// initLockID — ключ advisory-блокировки, под которой выполняются миграции
+// и сидирование, чтобы несколько экземпляров приложения не делали этого одновременно.
+const initLockID = 7_310_001
+
+// uniqueViolation — код ошибки PostgreSQL при нарушении уникальности.
+const uniqueViolation = "23505"
+
+type Storage struct {
+	db     *sql.DB
+	logger *slog.Logger
+}
+
+func NewStorage(db *sql.DB, logger *slog.Logger) *Storage {
+	return &Storage{db: db, logger: logger}
+}
+
+// Init применяет миграции и создает тестовые данные при первом запуске.
+func (s *Storage) Init(ctx context.Context) error {
+	migrator, err := s.Migrator()
+	if err != nil {
+		return err
+	}
+	if err := migrator.Up(ctx); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", initLockID); err != nil {
+		return fmt.Errorf("acquire init lock: %w", err)
+	}
+	if err := s.seedWallets(ctx, tx); err != nil {
+		return err
+	}
+	if err := s.backfillOpeningEntries(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// seedWallets добавляет тестовые кошельки при первом запуске.
+func (s *Storage) seedWallets(ctx context.Context, tx *sql.Tx) error {
+	const count = 10
+	var existing int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM wallets").Scan(&existing); err != nil {
+		return fmt.Errorf("failed to check wallets: %w", err)
+	}
+	if existing > 0 {
+		return nil
+	}
+
+	balance, err := money.Parse("100", money.DefaultCurrency)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for i := 1; i <= count; i++ {
+		address := "wallet-" + strconv.Itoa(i)
+		_, err := tx.ExecContext(ctx, "INSERT INTO wallets (address, balance, currency, created_at) VALUES ($1, $2, $3, $4)",
+			address, balance.Amount, balance.Currency, now)
+		if err != nil {
+			return fmt.Errorf("failed to insert wallet %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// lockedWallet — строка кошелька, заблокированная на время транзакции.
+type lockedWallet struct {
+	balance  int64
+	currency string
+	closed   bool
+}
+
+// lockWallets блокирует строки кошельков в порядке адресов, поэтому встречные
+// операции A→B и B→A не приводят к взаимной блокировке.
+func lockWallets(ctx context.Context, tx *sql.Tx, addresses ...string) (map[string]lockedWallet, error) {
+	placeholders := make([]string, len(addresses))
+	args := make([]any, len(addresses))
+	for i, address := range addresses {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+		args[i] = address
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT address, balance, currency, closed_at IS NOT NULL
+		FROM wallets
+		WHERE address IN (`+strings.Join(placeholders, ", ")+`)
+		ORDER BY address
+		FOR UPDATE`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	wallets := map[string]lockedWallet{}
+	for rows.Next() {
+		var address string
+		var w lockedWallet
+		if err := rows.Scan(&address, &w.balance, &w.currency, &w.closed); err != nil {
+			return nil, err
+		}
+		wallets[address] = w
+	}
+	return wallets, rows.Err()
+}
+
+// checkWallet проверяет, что кошелек найден, открыт и ведется в валюте операции.
+func checkWallet(w lockedWallet, ok bool, currency string) error {
+	if !ok {
+		return storage.ErrWalletNotFound
+	}
+	if w.closed {
+		return storage.ErrWalletClosed
+	}
+	if w.currency != currency {
+		return money.ErrCurrencyMismatch
+	}
+	return nil
+}
+
+// Transfer выполняет денежный перевод между кошельками.
+func (s *Storage) Transfer(ctx context.Context, transfer models.TransferRequest) (models.Receipt, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Receipt{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	addresses := []string{transfer.From, transfer.To}
+	if transfer.Fee != nil {
+		addresses = append(addresses, transfer.Fee.Wallet)
+	}
+	wallets, err := lockWallets(ctx, tx, addresses...)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+
+	receipt, err := applyTransfer(ctx, tx, wallets, transfer, time.Now().UTC())
+	if err != nil {
+		return models.Receipt{}, err
+	}
+
+	if transfer.Schedule != nil {
+		run := transfer.Schedule.Run
+		run.TransactionID = &receipt.ID
+		if _, err := recordScheduleRun(ctx, tx, transfer.Schedule.Schedule, run); err != nil {
+			return models.Receipt{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Receipt{}, err
+	}
+	return receipt, nil
+}
+
+// TransferBatch выполняет пакет переводов в одной транзакции. Строки всех
+// кошельков пакета блокируются заранее одним запросом в порядке адресов.
+func (s *Storage) TransferBatch(ctx context.Context, transfers []models.TransferRequest) ([]models.Receipt, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	seen := map[string]bool{}
+	var addresses []string
+	for _, t := range transfers {
+		batch := []string{t.From, t.To}
+		if t.Fee != nil {
+			batch = append(batch, t.Fee.Wallet)
+		}
+		for _, address := range batch {
+			if !seen[address] {
+				seen[address] = true
+				addresses = append(addresses, address)
+			}
+		}
+	}
+	wallets, err := lockWallets(ctx, tx, addresses...)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	receipts := make([]models.Receipt, 0, len(transfers))
+	for i, t := range transfers {
+		receipt, err := applyTransfer(ctx, tx, wallets, t, now)
+		if err != nil {
+			return nil, &storage.BatchError{Index: i, Err: err}
+		}
+		receipts = append(receipts, receipt)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return receipts, nil
+}
+
+// applyTransfer проверяет ограничения отправителя и кошельки и выполняет
+// перевод внутри транзакции tx.
+// wallets — заблокированные строки кошельков; их балансы обновляются,
+// чтобы следующие переводы той же транзакции видели актуальные остатки.
+// Непустой t.Fee списывается с отправителя следом за переводом.
+func applyTransfer(ctx context.Context, tx *sql.Tx, wallets map[string]lockedWallet, t models.TransferRequest, now time.Time) (models.Receipt, error) {
+	transaction := models.Transaction{From: t.From, To: t.To, Amount: t.Amount}
+	if t.Conversion != nil {
+		transaction.DestinationAmount = &t.Conversion.Amount
+		transaction.Rate = t.Conversion.Rate
+	}
+	debit := t.Amount.Amount
+	if t.Fee != nil {
+		if t.Fee.Amount.Currency != t.Amount.Currency {
+			return models.Receipt{}, money.ErrCurrencyMismatch
+		}
+		debit += t.Fee.Amount.Amount
+	}
+
+	if err := checkLimits(ctx, tx, t.From, t.Check); err != nil {
+		return models.Receipt{}, err
+	}
+
+	//ПРОВЕРКА КОШЕЛЬКОВ
+	sender, ok := wallets[t.From]
+	if err := checkWallet(sender, ok, t.Amount.Currency); err != nil {
+		return models.Receipt{}, err
+	}
+	held, err := heldAmount(ctx, tx, t.From, now)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	if sender.balance-held < debit {
+		return models.Receipt{}, storage.ErrInsufficientFunds
+	}
+	receiver, ok := wallets[t.To]
+	if err := checkWallet(receiver, ok, transaction.Credit().Currency); err != nil {
+		return models.Receipt{}, err
+	}
+	if t.Fee != nil {
+		feeWallet, ok := wallets[t.Fee.Wallet]
+		if err := checkWallet(feeWallet, ok, t.Fee.Amount.Currency); err != nil {
+			return models.Receipt{}, fmt.Errorf("%w: %s: %v", storage.ErrFeeWallet, t.Fee.Wallet, err)
+		}
+	}
+	//^ПРОВЕРКА КОШЕЛЬКОВ
+
+	transaction, err = moveFunds(ctx, tx, transaction, now)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	sender.balance -= transaction.Amount.Amount
+	receiver.balance += transaction.Credit().Amount
+	wallets[t.From] = sender
+	wallets[t.To] = receiver
+
+	receipt := models.Receipt{Transaction: transaction}
+
+	if t.Fee != nil {
+		fee, err := moveFunds(ctx, tx, models.Transaction{
+			From:   t.From,
+			To:     t.Fee.Wallet,
+			Amount: t.Fee.Amount,
+			FeeOf:  &transaction.ID,
+		}, now)
+		if err != nil {
+			return models.Receipt{}, err
+		}
+		sender.balance -= fee.Amount.Amount
+		wallets[t.From] = sender
+		// кошелек комиссий может совпадать с получателем, поэтому строка
+		// читается после обновления
+		feeWallet := wallets[t.Fee.Wallet]
+		feeWallet.balance += fee.Amount.Amount
+		wallets[t.Fee.Wallet] = feeWallet
+		sender = wallets[t.From]
+
+		receipt.Fee = &fee
+	}
+
+	receipt.SenderBalance = money.New(sender.balance, sender.currency)
+	return receipt, nil
+}
+
+// moveFunds переносит сумму между кошельками, записывает транзакцию и проводки
+// журнала и возвращает t с заполненными ID и Timestamp. С отправителя
+// списывается t.Amount, получателю зачисляется t.Credit(); разница валют
+// проводится через storage.FXAccount. Вид записи журнала определяют
+// RefundOf и FeeOf. Строки кошельков должны быть заблокированы вызывающим.
+func moveFunds(ctx context.Context, tx *sql.Tx, t models.Transaction, now time.Time) (models.Transaction, error) {
+	credit := t.Credit()
+	if _, err := tx.ExecContext(ctx, "UPDATE wallets SET balance = balance - $1 WHERE address = $2", t.Amount.Amount, t.From); err != nil {
+		return models.Transaction{}, err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE wallets SET balance = balance + $1 WHERE address = $2", credit.Amount, t.To); err != nil {
+		return models.Transaction{}, err
+	}
+
+	var destAmount sql.NullInt64
+	var destCurrency, rate sql.NullString
+	if t.DestinationAmount != nil {
+		destAmount = sql.NullInt64{Int64: credit.Amount, Valid: true}
+		destCurrency = sql.NullString{String: credit.Currency, Valid: true}
+		rate = sql.NullString{String: t.Rate, Valid: true}
+	}
+	err := tx.QueryRowContext(ctx, `
+		INSERT INTO transactions (from_address, to_address, amount, currency, dest_amount, dest_currency, rate, created_at, refund_of, fee_of)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING id`, t.From, t.To, t.Amount.Amount, t.Amount.Currency, destAmount, destCurrency, rate, now, t.RefundOf, t.FeeOf).Scan(&t.ID)
+	if err != nil {
+		return models.Transaction{}, err
+	}
+	t.Timestamp = now.Format(time.RFC3339Nano)
+
+	err = postEntry(ctx, tx, storage.EntryKind(t), &t.ID, now, storage.TransferPostings(t)...)
+	return t, err
+}
+
+// GetBalance возвращает учетный и доступный баланс кошелька.
+func (s *Storage) GetBalance(ctx context.Context, address string) (models.Balance, error) {
+	var balance models.Balance
+	var held int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT balance, currency,
+		       COALESCE((SELECT SUM(amount + fee) FROM holds
+		                 WHERE wallet = wallets.address AND status = $1 AND expires_at > $2), 0)
+		FROM wallets
+		WHERE address = $3`, storage.HoldActive, time.Now().UTC(), address).
+		Scan(&balance.Total.Amount, &balance.Total.Currency, &held)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Balance{}, storage.ErrWalletNotFound
+	}
+	balance.Available = money.New(balance.Total.Amount-held, balance.Total.Currency)
+	return balance, err
+}
+
+// GetTransaction возвращает транзакцию по идентификатору.
+func (s *Storage) GetTransaction(ctx context.Context, id int64) (models.Transaction, error) {
+	return scanTransaction(s.db.QueryRowContext(ctx, "SELECT "+transactionColumns+" FROM transactions WHERE id = $1", id))
+}
+
+// transactionColumns — колонки transactions в порядке scanTransaction.
+const transactionColumns = `id, from_address, to_address, amount, currency, dest_amount, dest_currency, rate, created_at, refund_of, fee_of`
+
+// scanTransaction читает транзакцию из строки с колонками transactionColumns.
+func scanTransaction(row rowScanner) (models.Transaction, error) {
+	var tx models.Transaction
+	var createdAt time.Time
+	var refundOf, feeOf, destAmount sql.NullInt64
+	var destCurrency, rate sql.NullString
+	err := row.Scan(&tx.ID, &tx.From, &tx.To, &tx.Amount.Amount, &tx.Amount.Currency,
+		&destAmount, &destCurrency, &rate, &createdAt, &refundOf, &feeOf)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Transaction{}, storage.ErrTransactionNotFound
+	}
+	if err != nil {
+		return models.Transaction{}, err
+	}
+	tx.Timestamp = createdAt.UTC().Format(time.RFC3339Nano)
+	if destAmount.Valid {
+		credit := money.New(destAmount.Int64, destCurrency.String)
+		tx.DestinationAmount = &credit
+		tx.Rate = rate.String
+	}
+	if refundOf.Valid {
+		tx.RefundOf = &refundOf.Int64
+	}
+	if feeOf.Valid {
+		tx.FeeOf = &feeOf.Int64
+	}
+	return tx, nil
+}
+
+// ListTransactions возвращает транзакции по фильтру, от новых к старым.
+func (s *Storage) ListTransactions(ctx context.Context, filter storage.TransactionFilter) ([]models.Transaction, error) {
+	var transactions []models.Transaction
+	err := s.EachTransaction(ctx, filter, func(tx models.Transaction) error {
+		transactions = append(transactions, tx)
+		return nil
+	})
+	return transactions, err
+}
+
+// EachTransaction построчно читает транзакции по фильтру, от новых к старым.
+// Пагинация keyset по первичному ключу: курсор BeforeID превращается
+// в условие id < $n, поэтому глубина страницы не влияет на стоимость запроса.
+func (s *Storage) EachTransaction(ctx context.Context, filter storage.TransactionFilter, fn func(models.Transaction) error) error {
+	var where []string
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	switch {
+	case filter.Wallet == "":
+	case filter.Direction == storage.DirectionIn:
+		where = append(where, "to_address = "+arg(filter.Wallet))
+	case filter.Direction == storage.DirectionOut:
+		where = append(where, "from_address = "+arg(filter.Wallet))
+	default:
+		p := arg(filter.Wallet)
+		where = append(where, "(from_address = "+p+" OR to_address = "+p+")")
+	}
+	if filter.BeforeID > 0 {
+		where = append(where, "id < "+arg(filter.BeforeID))
+	}
+	if !filter.FromTime.IsZero() {
+		where = append(where, "created_at >= "+arg(filter.FromTime))
+	}
+	if !filter.ToTime.IsZero() {
+		where = append(where, "created_at < "+arg(filter.ToTime))
+	}
+	if filter.Currency != "" {
+		where = append(where, "currency = "+arg(filter.Currency))
+	}
+	if filter.MinAmount > 0 {
+		where = append(where, "amount >= "+arg(filter.MinAmount))
+	}
+	if filter.MaxAmount > 0 {
+		where = append(where, "amount <= "+arg(filter.MaxAmount))
+	}
+
+	query := "SELECT " + transactionColumns + " FROM transactions"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT " + arg(filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		tx, err := scanTransaction(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// OutgoingSince считает исходящие переводы кошелька начиная с since.
+func (s *Storage) OutgoingSince(ctx context.Context, address string, since time.Time) (storage.Outgoing, error) {
+	return outgoingSince(ctx, s.db, address, since)
+}
+
+// queryRower — *sql.DB или *sql.Tx.
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// checkLimits вызывает непустую проверку ограничений отправителя from
+// в транзакции tx. Строка отправителя должна быть заблокирована
+// (lockWallets): одновременные списания одного отправителя, в том числе
+// с разных экземпляров сервиса, ждут друг друга, а следующая проверка
+// видит переводы, зафиксированные предыдущей.
+func checkLimits(ctx context.Context, tx *sql.Tx, from string, check models.LimitCheck) error {
+	if check == nil {
+		return nil
+	}
+	return check(func(since time.Time) (storage.Outgoing, error) {
+		return outgoingSince(ctx, tx, from, since)
+	})
+}
+
+// outgoingSince считает исходящие переводы кошелька начиная с since.
+func outgoingSince(ctx context.Context, q queryRower, address string, since time.Time) (storage.Outgoing, error) {
+	var out storage.Outgoing
+	err := q.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(amount), 0) FROM transactions
+		WHERE from_address = $1 AND created_at >= $2 AND refund_of IS NULL AND fee_of IS NULL`,
+		address, since,
+	).Scan(&out.Count, &out.Amount)
+	if err != nil {
+		return storage.Outgoing{}, fmt.Errorf("outgoing since: %w", err)
+	}
+	return out, nil
+}
+
+// isUniqueViolation сообщает, что ошибка вызвана нарушением уникального ключа.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
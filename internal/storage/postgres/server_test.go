@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// testBinEnv — переменная окружения с каталогом initdb и pg_ctl, если их
+// нет в PATH.
+const testBinEnv = "PAYMENT_TEST_POSTGRES_BIN"
+
+// testDSN — DSN сервера для тестов; пустой, если PostgreSQL недоступен.
+var testDSN string
+
+// skipReason объясняет, почему тесты PostgreSQL пропускаются.
+var skipReason string
+
+// TestMain подключает тесты к серверу из testDSNEnv, а без него запускает
+// временный сервер initdb/pg_ctl в отдельном каталоге и останавливает его
+// после тестов.
+func TestMain(m *testing.M) {
+	testDSN = os.Getenv(testDSNEnv)
+	if testDSN != "" {
+		os.Exit(m.Run())
+	}
+
+	dsn, stop, err := startServer()
+	if err != nil {
+		skipReason = fmt.Sprintf("%s is not set and a local server could not be started: %v", testDSNEnv, err)
+		os.Exit(m.Run())
+	}
+	testDSN = dsn
+	code := m.Run()
+	stop()
+	os.Exit(code)
+}
+
+// requirePostgres пропускает тест, если PostgreSQL недоступен.
+func requirePostgres(t *testing.T) {
+	t.Helper()
+	if testDSN == "" {
+		t.Skip(skipReason)
+	}
+}
+
+// startServer создает кластер во временном каталоге и запускает сервер на
+// свободном порту loopback. stop останавливает сервер и удаляет каталог.
+func startServer() (dsn string, stop func(), err error) {
+	initdb, err := lookPostgres("initdb")
+	if err != nil {
+		return "", nil, err
+	}
+	pgCtl, err := lookPostgres("pg_ctl")
+	if err != nil {
+		return "", nil, err
+	}
+	if os.Geteuid() == 0 {
+		return "", nil, errors.New("PostgreSQL cannot be run as root")
+	}
+
+	dir, err := os.MkdirTemp("", "payment-postgres-")
+	if err != nil {
+		return "", nil, err
+	}
+	data := filepath.Join(dir, "data")
+	logFile := filepath.Join(dir, "server.log")
+
+	out, err := exec.Command(initdb, "-D", data, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--no-sync").CombinedOutput()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("initdb: %v: %s", err, out)
+	}
+
+	port, err := freePort()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+	// fsync отключен: данные кластера не переживают тестов
+	options := fmt.Sprintf("-h 127.0.0.1 -p %d -k %s -F", port, dir)
+	out, err = exec.Command(pgCtl, "-D", data, "-l", logFile, "-o", options, "-w", "start").CombinedOutput()
+	if err != nil {
+		serverLog, _ := os.ReadFile(logFile)
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("pg_ctl start: %v: %s%s", err, out, serverLog)
+	}
+
+	stop = func() {
+		_ = exec.Command(pgCtl, "-D", data, "-m", "immediate", "-w", "stop").Run()
+		os.RemoveAll(dir)
+	}
+	return fmt.Sprintf("postgres://postgres@127.0.0.1:%d/postgres?sslmode=disable", port), stop, nil
+}
+
+// lookPostgres ищет программу PostgreSQL в testBinEnv, в PATH и в каталогах
+// пакетов Debian и Ubuntu (/usr/lib/postgresql/<версия>/bin), начиная
+// с новейшей версии.
+func lookPostgres(name string) (string, error) {
+	if dir := os.Getenv(testBinEnv); dir != "" {
+		return exec.LookPath(filepath.Join(dir, name))
+	}
+	if path, err := exec.LookPath(name); err == nil {
+		return path, nil
+	}
+	candidates, _ := filepath.Glob(filepath.Join("/usr/lib/postgresql", "*", "bin", name))
+	slices.SortFunc(candidates, func(a, b string) int {
+		return postgresVersion(b) - postgresVersion(a)
+	})
+	for _, path := range candidates {
+		if path, err := exec.LookPath(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s not found in PATH, %s or /usr/lib/postgresql", name, testBinEnv)
+}
+
+// postgresVersion возвращает мажорную версию из пути
+// /usr/lib/postgresql/<версия>/bin/<программа>.
+func postgresVersion(path string) int {
+	version, _ := strconv.Atoi(filepath.Base(filepath.Dir(filepath.Dir(path))))
+	return version
+}
+
+// freePort возвращает свободный TCP-порт на loopback.
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/storage"
+	"time"
+)
+
+const walletColumns = "address, balance, currency, owner, label, created_at, closed_at"
+
+// CreateWallet добавляет новый кошелек. Ненулевой начальный баланс
+// проводится в журнале против системного счета.
+func (s *Storage) CreateWallet(ctx context.Context, wallet models.Wallet) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO wallets (address, balance, currency, owner, label, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		wallet.Address, wallet.Balance.Amount, wallet.Balance.Currency, wallet.Owner, wallet.Label, wallet.CreatedAt)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return storage.ErrWalletExists
+		}
+		return err
+	}
+
+	if err := postOpeningEntry(ctx, tx, wallet.Address, wallet.Balance, wallet.CreatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetWallet возвращает кошелек по адресу.
+func (s *Storage) GetWallet(ctx context.Context, address string) (models.Wallet, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+walletColumns+" FROM wallets WHERE address = $1", address)
+	wallet, err := scanWallet(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Wallet{}, storage.ErrWalletNotFound
+	}
+	return wallet, err
+}
+
+// ListWallets возвращает страницу кошельков в порядке создания.
+func (s *Storage) ListWallets(ctx context.Context, limit, offset int) ([]models.Wallet, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+walletColumns+`
+		FROM wallets
+		ORDER BY created_at, address
+		LIMIT $1 OFFSET $2`, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	wallets := []models.Wallet{}
+	for rows.Next() {
+		wallet, err := scanWallet(rows)
+		if err != nil {
+			return nil, err
+		}
+		wallets = append(wallets, wallet)
+	}
+	return wallets, rows.Err()
+}
+
+// CloseWallet помечает кошелек закрытым, если на нем не осталось средств.
+func (s *Storage) CloseWallet(ctx context.Context, address string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var balance int64
+	var closedAt sql.NullTime
+	err = tx.QueryRowContext(ctx, "SELECT balance, closed_at FROM wallets WHERE address = $1 FOR UPDATE", address).
+		Scan(&balance, &closedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrWalletNotFound
+		}
+		return err
+	}
+	if closedAt.Valid {
+		return storage.ErrWalletClosed
+	}
+	if balance != 0 {
+		return storage.ErrWalletNotEmpty
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE wallets SET closed_at = $1 WHERE address = $2", time.Now().UTC(), address); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanWallet(row rowScanner) (models.Wallet, error) {
+	var wallet models.Wallet
+	var createdAt, closedAt sql.NullTime
+	err := row.Scan(&wallet.Address, &wallet.Balance.Amount, &wallet.Balance.Currency,
+		&wallet.Owner, &wallet.Label, &createdAt, &closedAt)
+	if err != nil {
+		return models.Wallet{}, err
+	}
+	wallet.CreatedAt = createdAt.Time.UTC()
+	if closedAt.Valid {
+		closed := closedAt.Time.UTC()
+		wallet.ClosedAt = &closed
+	}
+	return wallet, nil
+}
@@ -0,0 +1,214 @@
+//go:build cgo
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/storage"
+	"time"
+)
+
+// holdColumns — колонки holds в порядке scanHold.
+const holdColumns = `id, wallet, destination, amount, currency, fee, captured_amount, status, transaction_id, created_at, expires_at`
+
+// heldAmount возвращает сумму активных неистекших блокировок кошелька
+// вместе с зарезервированными комиссиями.
+func heldAmount(ctx context.Context, tx *sql.Tx, address string, now time.Time) (int64, error) {
+	var held int64
+	err := tx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(amount + fee), 0)
+		FROM holds
+		WHERE wallet = ? AND status = ? AND expires_at > ?`,
+		address, storage.HoldActive, now).Scan(&held)
+	return held, err
+}
+
+// CreateHold блокирует сумму на кошельке.
+func (s *Storage) CreateHold(ctx context.Context, hold models.Hold) (models.Hold, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Hold{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if hold.Fee.Currency == "" {
+		hold.Fee = money.New(0, hold.Amount.Currency)
+	}
+	if hold.Fee.Currency != hold.Amount.Currency {
+		return models.Hold{}, money.ErrCurrencyMismatch
+	}
+	reserve := money.New(hold.Amount.Amount+hold.Fee.Amount, hold.Amount.Currency)
+	if _, err := checkSender(ctx, tx, hold.Wallet, reserve, time.Now().UTC()); err != nil {
+		return models.Hold{}, err
+	}
+	if err := checkReceiver(ctx, tx, hold.Destination, hold.Amount.Currency); err != nil {
+		return models.Hold{}, err
+	}
+
+	hold.Status = storage.HoldActive
+	hold.CapturedAmount = money.New(0, hold.Amount.Currency)
+	hold.TransactionID = nil
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO holds (wallet, destination, amount, currency, fee, status, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		hold.Wallet, hold.Destination, hold.Amount.Amount, hold.Amount.Currency, hold.Fee.Amount, hold.Status,
+		hold.CreatedAt.UTC(), hold.ExpiresAt.UTC())
+	if err != nil {
+		return models.Hold{}, err
+	}
+	if hold.ID, err = res.LastInsertId(); err != nil {
+		return models.Hold{}, err
+	}
+
+	return hold, tx.Commit()
+}
+
+// GetHold возвращает блокировку по идентификатору.
+func (s *Storage) GetHold(ctx context.Context, id int64) (models.Hold, error) {
+	return scanHold(s.db.QueryRowContext(ctx, "SELECT "+holdColumns+" FROM holds WHERE id = ?", id))
+}
+
+// CaptureHold списывает блокировку переводом на кошелек назначения
+// и комиссией за него.
+func (s *Storage) CaptureHold(ctx context.Context, id int64, amount money.Money, fee *models.Fee, check models.LimitCheck) (models.Hold, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Hold{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	hold, err := activeHold(ctx, tx, id, now)
+	if err != nil {
+		return models.Hold{}, err
+	}
+	if amount.Currency != hold.Amount.Currency {
+		return models.Hold{}, money.ErrCurrencyMismatch
+	}
+	if amount.Amount > hold.Amount.Amount {
+		return models.Hold{}, storage.ErrCaptureExceedsHold
+	}
+	charged := money.New(0, amount.Currency)
+	if fee != nil {
+		if fee.Amount.Currency != amount.Currency {
+			return models.Hold{}, money.ErrCurrencyMismatch
+		}
+		charged = fee.Amount
+	}
+	if err := checkLimits(ctx, tx, hold.Wallet, check); err != nil {
+		return models.Hold{}, err
+	}
+
+	// резерв блокировки освобождается вместе со списанием, поэтому
+	// с доступным балансом сравнивается только превышение над резервом
+	reserved := hold.Amount.Amount + hold.Fee.Amount
+	excess := money.New(amount.Amount+charged.Amount-reserved, amount.Currency)
+	if _, err := checkSender(ctx, tx, hold.Wallet, excess, now); err != nil {
+		return models.Hold{}, err
+	}
+	if err := checkReceiver(ctx, tx, hold.Destination, amount.Currency); err != nil {
+		return models.Hold{}, err
+	}
+	if fee != nil {
+		if err := checkReceiver(ctx, tx, fee.Wallet, fee.Amount.Currency); err != nil {
+			return models.Hold{}, fmt.Errorf("%w: %s: %v", storage.ErrFeeWallet, fee.Wallet, err)
+		}
+	}
+
+	transaction, err := moveFunds(ctx, tx, models.Transaction{From: hold.Wallet, To: hold.Destination, Amount: amount}, now)
+	if err != nil {
+		return models.Hold{}, err
+	}
+	if fee != nil {
+		_, err = moveFunds(ctx, tx, models.Transaction{
+			From:   hold.Wallet,
+			To:     fee.Wallet,
+			Amount: fee.Amount,
+			FeeOf:  &transaction.ID,
+		}, now)
+		if err != nil {
+			return models.Hold{}, err
+		}
+	}
+
+	hold.Status = storage.HoldCaptured
+	hold.CapturedAmount = amount
+	hold.Fee = charged
+	hold.TransactionID = &transaction.ID
+	_, err = tx.ExecContext(ctx, "UPDATE holds SET status = ?, captured_amount = ?, fee = ?, transaction_id = ? WHERE id = ?",
+		hold.Status, amount.Amount, charged.Amount, transaction.ID, id)
+	if err != nil {
+		return models.Hold{}, err
+	}
+
+	return hold, tx.Commit()
+}
+
+// VoidHold снимает активную блокировку.
+func (s *Storage) VoidHold(ctx context.Context, id int64) (models.Hold, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Hold{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	hold, err := activeHold(ctx, tx, id, time.Now().UTC())
+	if err != nil {
+		return models.Hold{}, err
+	}
+
+	hold.Status = storage.HoldVoided
+	if _, err := tx.ExecContext(ctx, "UPDATE holds SET status = ? WHERE id = ?", hold.Status, id); err != nil {
+		return models.Hold{}, err
+	}
+	return hold, tx.Commit()
+}
+
+// ExpireHolds помечает истекшими активные блокировки с expires_at <= before.
+func (s *Storage) ExpireHolds(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, "UPDATE holds SET status = ? WHERE status = ? AND expires_at <= ?",
+		storage.HoldExpired, storage.HoldActive, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// activeHold читает блокировку в транзакции и проверяет, что она активна и не истекла.
+func activeHold(ctx context.Context, tx *sql.Tx, id int64, now time.Time) (models.Hold, error) {
+	hold, err := scanHold(tx.QueryRowContext(ctx, "SELECT "+holdColumns+" FROM holds WHERE id = ?", id))
+	if err != nil {
+		return models.Hold{}, err
+	}
+	if hold.Status != storage.HoldActive || !hold.ExpiresAt.After(now) {
+		return models.Hold{}, storage.ErrHoldNotActive
+	}
+	return hold, nil
+}
+
+// scanHold читает блокировку из строки с колонками holdColumns.
+func scanHold(row rowScanner) (models.Hold, error) {
+	var hold models.Hold
+	var transactionID sql.NullInt64
+	err := row.Scan(&hold.ID, &hold.Wallet, &hold.Destination, &hold.Amount.Amount, &hold.Amount.Currency,
+		&hold.Fee.Amount, &hold.CapturedAmount.Amount, &hold.Status, &transactionID, &hold.CreatedAt, &hold.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Hold{}, storage.ErrHoldNotFound
+	}
+	if err != nil {
+		return models.Hold{}, err
+	}
+	hold.Fee.Currency = hold.Amount.Currency
+	hold.CapturedAmount.Currency = hold.Amount.Currency
+	if transactionID.Valid {
+		hold.TransactionID = &transactionID.Int64
+	}
+	hold.CreatedAt = hold.CreatedAt.UTC()
+	hold.ExpiresAt = hold.ExpiresAt.UTC()
+	return hold, nil
+}
@@ -0,0 +1,73 @@
+//go:build cgo
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/storage"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// CreateIdempotencyKey резервирует ключ идемпотентности.
+func (s *Storage) CreateIdempotencyKey(ctx context.Context, record models.IdempotencyRecord) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO idempotency_keys (key, fingerprint, status, response, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		record.Key, record.Fingerprint, record.Status, record.Response,
+		record.CreatedAt.UTC(), record.ExpiresAt.UTC())
+	if err != nil {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey {
+			return storage.ErrIdempotencyKeyExists
+		}
+		return err
+	}
+	return nil
+}
+
+// GetIdempotencyKey возвращает сохраненную запись по ключу.
+func (s *Storage) GetIdempotencyKey(ctx context.Context, key string) (models.IdempotencyRecord, error) {
+	var record models.IdempotencyRecord
+	err := s.db.QueryRowContext(ctx, `
+		SELECT key, fingerprint, status, response, created_at, expires_at
+		FROM idempotency_keys
+		WHERE key = ?`, key).
+		Scan(&record.Key, &record.Fingerprint, &record.Status, &record.Response, &record.CreatedAt, &record.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.IdempotencyRecord{}, storage.ErrIdempotencyKeyNotFound
+	}
+	return record, err
+}
+
+// CompleteIdempotencyKey сохраняет статус и тело ответа.
+func (s *Storage) CompleteIdempotencyKey(ctx context.Context, key string, status int, response []byte) error {
+	res, err := s.db.ExecContext(ctx, "UPDATE idempotency_keys SET status = ?, response = ? WHERE key = ?", status, response, key)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return storage.ErrIdempotencyKeyNotFound
+	}
+	return nil
+}
+
+// DeleteIdempotencyKey удаляет ключ, например после внутренней ошибки,
+// чтобы клиент мог повторить запрос.
+func (s *Storage) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE key = ?", key)
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys удаляет истекшие ключи.
+func (s *Storage) DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, "DELETE FROM idempotency_keys WHERE expires_at < ?", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,241 @@
+//go:build cgo
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/storage/migrate"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// dialect отключает проверку внешних ключей на время миграций: PRAGMA
+// foreign_keys не меняется внутри транзакции, а пересоздание таблиц
+// (см. migrateMoneyColumns) иначе нарушило бы ссылки.
+var dialect = migrate.Dialect{
+	Placeholder: migrate.QuestionPlaceholder,
+	Setup:       []string{"PRAGMA foreign_keys = OFF"},
+	Teardown:    []string{"PRAGMA foreign_keys = ON"},
+}
+
+// goMigrations возвращает миграции, которым нужна логика на Go. Они доводят
+// до текущей схемы базы, созданные до появления версионных миграций;
+// на новых базах ничего не делают.
+func (s *Storage) goMigrations() []migrate.Migration {
+	return []migrate.Migration{
+		{Version: 2, Name: "money_minor_units", Up: s.migrateMoneyColumns, Down: noop},
+		{Version: 3, Name: "wallet_metadata", Up: addWalletMetadataColumns, Down: noop},
+	}
+}
+
+// noop используется как откат миграций, которые не меняют схему 0001:
+// откатывать нечего, а отсутствие Down запретило бы откат ниже.
+func noop(context.Context, *sql.Tx) error { return nil }
+
+// Migrator возвращает мигратор схемы SQLite.
+func (s *Storage) Migrator() (*migrate.Migrator, error) {
+	files, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := migrate.Load(files)
+	if err != nil {
+		return nil, fmt.Errorf("load migrations: %w", err)
+	}
+	return migrate.New(s.db, dialect, append(migrations, s.goMigrations()...), s.logger)
+}
+
+// Схема таблиц на момент миграции 0002; суммы в минимальных единицах (INTEGER).
+const (
+	walletsTableV2 = `
+		CREATE TABLE wallets_new (
+		    address TEXT NOT NULL PRIMARY KEY,
+		    balance INTEGER NOT NULL,
+		    currency TEXT NOT NULL DEFAULT 'RUB',
+		    owner TEXT NOT NULL DEFAULT '',
+		    label TEXT NOT NULL DEFAULT '',
+		    created_at DATETIME,
+		    closed_at DATETIME
+		);`
+
+	transactionsTableV2 = `
+		CREATE TABLE transactions_new (
+		    id INTEGER PRIMARY KEY AUTOINCREMENT,
+		    from_address TEXT NOT NULL,
+		    to_address TEXT NOT NULL,
+		    amount INTEGER NOT NULL,
+		    currency TEXT NOT NULL DEFAULT 'RUB',
+		    created_at DATETIME CURRENT_TIMESTAMP,
+		    FOREIGN KEY (from_address) REFERENCES wallets(address),
+		    FOREIGN KEY (to_address) REFERENCES wallets(address)
+		);`
+)
+
+// migrateMoneyColumns переводит базы, созданные до перехода на целые суммы,
+// с REAL-колонок на INTEGER в минимальных единицах валюты.
+//
+// REAL-колонки накапливают погрешность (0.1+0.2 хранится как
+// 0.30000000000000004), поэтому значения округляются до копейки; каждое
+// значение, изменившееся при округлении, записывается в журнал.
+func (s *Storage) migrateMoneyColumns(ctx context.Context, tx *sql.Tx) error {
+	var columnType string
+	err := tx.QueryRowContext(ctx, "SELECT type FROM pragma_table_info('wallets') WHERE name = 'balance'").Scan(&columnType)
+	if err != nil {
+		return fmt.Errorf("failed to inspect wallets table: %w", err)
+	}
+	if !strings.EqualFold(columnType, "REAL") {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, walletsTableV2+transactionsTableV2); err != nil {
+		return err
+	}
+
+	if err := s.copyLegacyWallets(ctx, tx); err != nil {
+		return fmt.Errorf("convert wallet balances: %w", err)
+	}
+	if err := s.copyLegacyTransactions(ctx, tx); err != nil {
+		return fmt.Errorf("convert transaction amounts: %w", err)
+	}
+
+	for _, stmt := range []string{
+		"DROP TABLE transactions",
+		"DROP TABLE wallets",
+		"ALTER TABLE wallets_new RENAME TO wallets",
+		"ALTER TABLE transactions_new RENAME TO transactions",
+	} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%s: %w", stmt, err)
+		}
+	}
+	return nil
+}
+
+// copyLegacyWallets переносит кошельки в wallets_new, конвертируя балансы.
+func (s *Storage) copyLegacyWallets(ctx context.Context, tx *sql.Tx) error {
+	rows, err := tx.QueryContext(ctx, "SELECT address, balance FROM wallets")
+	if err != nil {
+		return err
+	}
+	var wallets []models.Wallet
+	for rows.Next() {
+		var address string
+		var balance float64
+		if err := rows.Scan(&address, &balance); err != nil {
+			rows.Close()
+			return err
+		}
+		converted, err := s.convertLegacyAmount(balance, "wallet", address)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("wallet %s balance %v: %w", address, balance, err)
+		}
+		wallets = append(wallets, models.Wallet{Address: address, Balance: converted})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, w := range wallets {
+		_, err := tx.ExecContext(ctx, "INSERT INTO wallets_new (address, balance, currency) VALUES (?, ?, ?)",
+			w.Address, w.Balance.Amount, w.Balance.Currency)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyLegacyTransactions переносит историю в transactions_new, сохраняя идентификаторы.
+func (s *Storage) copyLegacyTransactions(ctx context.Context, tx *sql.Tx) error {
+	type legacyTransaction struct {
+		id        int64
+		from, to  string
+		amount    money.Money
+		createdAt sql.NullString
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT id, from_address, to_address, amount, created_at FROM transactions")
+	if err != nil {
+		return err
+	}
+	var transactions []legacyTransaction
+	for rows.Next() {
+		var t legacyTransaction
+		var amount float64
+		if err := rows.Scan(&t.id, &t.from, &t.to, &amount, &t.createdAt); err != nil {
+			rows.Close()
+			return err
+		}
+		t.amount, err = s.convertLegacyAmount(amount, "transaction", t.id)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("transaction %d amount %v: %w", t.id, amount, err)
+		}
+		transactions = append(transactions, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, t := range transactions {
+		_, err := tx.ExecContext(ctx, `INSERT INTO transactions_new (id, from_address, to_address, amount, currency, created_at)
+			VALUES (?, ?, ?, ?, ?, ?)`, t.id, t.from, t.to, t.amount.Amount, t.amount.Currency, t.createdAt)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// convertLegacyAmount округляет сумму из REAL-колонки до копейки и пишет
+// в журнал, если значение при этом изменилось.
+func (s *Storage) convertLegacyAmount(f float64, kind string, id any) (money.Money, error) {
+	rounded, err := money.RoundFloat(f, money.DefaultCurrency)
+	if err != nil {
+		return money.Money{}, err
+	}
+	if _, err := money.FromFloat(f, money.DefaultCurrency); err != nil {
+		s.logger.Warn("legacy amount rounded", kind, id, "stored", f, "migrated", rounded.String())
+	}
+	return rounded, nil
+}
+
+// addWalletMetadataColumns добавляет владельца, метку и даты создания/закрытия
+// в таблицу кошельков, созданную более ранней версией.
+func addWalletMetadataColumns(ctx context.Context, tx *sql.Tx) error {
+	columns := []struct{ name, definition string }{
+		{"owner", "TEXT NOT NULL DEFAULT ''"},
+		{"label", "TEXT NOT NULL DEFAULT ''"},
+		{"created_at", "DATETIME"},
+		{"closed_at", "DATETIME"},
+	}
+
+	for _, c := range columns {
+		var exists int
+		err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_table_info('wallets') WHERE name = ?", c.name).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "ALTER TABLE wallets ADD COLUMN "+c.name+" "+c.definition); err != nil {
+			return fmt.Errorf("add column %s: %w", c.name, err)
+		}
+	}
+
+	_, err := tx.ExecContext(ctx, "UPDATE wallets SET created_at = ? WHERE created_at IS NULL", time.Now())
+	return err
+}
@@ -0,0 +1,54 @@
+-- Исходная схема. IF NOT EXISTS позволяет принять базы, созданные
+-- до появления миграций: их таблицы доводятся миграциями 0002 и 0003.
+-- Суммы хранятся в минимальных единицах валюты (INTEGER).
+CREATE TABLE IF NOT EXISTS wallets (
+    address TEXT NOT NULL PRIMARY KEY,
+    balance INTEGER NOT NULL,
+    currency TEXT NOT NULL DEFAULT 'RUB',
+    owner TEXT NOT NULL DEFAULT '',
+    label TEXT NOT NULL DEFAULT '',
+    created_at DATETIME,
+    closed_at DATETIME
+);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    from_address TEXT NOT NULL,
+    to_address TEXT NOT NULL,
+    amount INTEGER NOT NULL,
+    currency TEXT NOT NULL DEFAULT 'RUB',
+    created_at DATETIME CURRENT_TIMESTAMP,
+    FOREIGN KEY (from_address) REFERENCES wallets(address),
+    FOREIGN KEY (to_address) REFERENCES wallets(address)
+);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key TEXT NOT NULL PRIMARY KEY,
+    fingerprint TEXT NOT NULL,
+    status INTEGER NOT NULL DEFAULT 0,
+    response BLOB,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    kind TEXT NOT NULL,
+    transaction_id INTEGER,
+    created_at DATETIME NOT NULL,
+    FOREIGN KEY (transaction_id) REFERENCES transactions(id)
+);
+
+CREATE TABLE IF NOT EXISTS postings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    entry_id INTEGER NOT NULL,
+    account TEXT NOT NULL,
+    amount INTEGER NOT NULL,
+    currency TEXT NOT NULL,
+    FOREIGN KEY (entry_id) REFERENCES journal_entries(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_postings_account ON postings(account);
+CREATE INDEX IF NOT EXISTS idx_postings_entry_id ON postings(entry_id);
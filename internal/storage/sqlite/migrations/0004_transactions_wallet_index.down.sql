@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_transactions_to_address;
+DROP INDEX IF EXISTS idx_transactions_from_address;
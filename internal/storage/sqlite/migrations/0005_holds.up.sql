@@ -0,0 +1,20 @@
+-- Блокировки средств (двухфазные платежи). Активные блокировки уменьшают
+-- доступный баланс кошелька; при списании создается перевод transaction_id.
+CREATE TABLE IF NOT EXISTS holds (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    wallet TEXT NOT NULL,
+    destination TEXT NOT NULL,
+    amount INTEGER NOT NULL,
+    currency TEXT NOT NULL,
+    captured_amount INTEGER NOT NULL DEFAULT 0,
+    status TEXT NOT NULL,
+    transaction_id INTEGER,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    FOREIGN KEY (wallet) REFERENCES wallets(address),
+    FOREIGN KEY (destination) REFERENCES wallets(address),
+    FOREIGN KEY (transaction_id) REFERENCES transactions(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_holds_wallet_status ON holds(wallet, status);
+CREATE INDEX IF NOT EXISTS idx_holds_status_expires_at ON holds(status, expires_at);
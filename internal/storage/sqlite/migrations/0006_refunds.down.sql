@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_transactions_refund_of;
+ALTER TABLE transactions DROP COLUMN refund_of;
@@ -0,0 +1,5 @@
+-- Связь возврата с исходной транзакцией. Внешний ключ не объявляется:
+-- SQLite не удаляет колонку, участвующую во внешнем ключе, и откат был бы невозможен.
+ALTER TABLE transactions ADD COLUMN refund_of INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_transactions_refund_of ON transactions(refund_of);
@@ -0,0 +1,32 @@
+-- Запланированные переводы: разовые (cron пуст) и повторяющиеся по cron-выражению.
+-- attempts — число неудачных попыток текущего запуска.
+CREATE TABLE IF NOT EXISTS schedules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    from_address TEXT NOT NULL,
+    to_address TEXT NOT NULL,
+    amount INTEGER NOT NULL,
+    currency TEXT NOT NULL,
+    cron TEXT NOT NULL DEFAULT '',
+    next_run_at DATETIME NOT NULL,
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+    FOREIGN KEY (from_address) REFERENCES wallets(address),
+    FOREIGN KEY (to_address) REFERENCES wallets(address)
+);
+
+CREATE INDEX IF NOT EXISTS idx_schedules_status_next_run_at ON schedules(status, next_run_at);
+
+-- Исходы запусков запланированных переводов
+CREATE TABLE IF NOT EXISTS schedule_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    schedule_id INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    transaction_id INTEGER,
+    error TEXT NOT NULL DEFAULT '',
+    executed_at DATETIME NOT NULL,
+    FOREIGN KEY (schedule_id) REFERENCES schedules(id),
+    FOREIGN KEY (transaction_id) REFERENCES transactions(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_schedule_runs_schedule_id ON schedule_runs(schedule_id);
@@ -0,0 +1,5 @@
+-- Связь комиссии с переводом, за который она списана. Внешний ключ не
+-- объявляется по той же причине, что и для refund_of.
+ALTER TABLE transactions ADD COLUMN fee_of INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_transactions_fee_of ON transactions(fee_of);
@@ -0,0 +1,3 @@
+ALTER TABLE transactions DROP COLUMN rate;
+ALTER TABLE transactions DROP COLUMN dest_currency;
+ALTER TABLE transactions DROP COLUMN dest_amount;
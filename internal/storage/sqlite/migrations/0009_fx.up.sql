@@ -0,0 +1,5 @@
+-- Конвертация при переводе между валютами: сумма, зачисленная получателю
+-- в его валюте, и примененный курс. У переводов в одной валюте — NULL.
+ALTER TABLE transactions ADD COLUMN dest_amount INTEGER;
+ALTER TABLE transactions ADD COLUMN dest_currency TEXT;
+ALTER TABLE transactions ADD COLUMN rate TEXT;
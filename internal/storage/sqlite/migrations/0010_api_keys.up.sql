@@ -0,0 +1,12 @@
+-- API-ключи. Хранится только SHA-256 ключа; wallets и permissions — JSON-массивы.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    wallets TEXT NOT NULL,
+    permissions TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    rotated_at DATETIME,
+    revoked_at DATETIME
+);
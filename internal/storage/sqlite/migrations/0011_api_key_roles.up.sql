@@ -0,0 +1,2 @@
+-- Роли API-ключа — JSON-массив; права ролей задаются в конфигурации.
+ALTER TABLE api_keys ADD COLUMN roles TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1,3 @@
+-- Комиссия блокировки: у активной — зарезервированная на всю сумму,
+-- у списанной — взятая при списании.
+ALTER TABLE holds ADD COLUMN fee INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,8 @@
+-- Срабатывание, к которому относится запуск. Уникальный ключ не дает
+-- записать одно срабатывание дважды; у прежних запусков срабатыванием
+-- считается время выполнения.
+ALTER TABLE schedule_runs ADD COLUMN scheduled_at DATETIME;
+
+UPDATE schedule_runs SET scheduled_at = executed_at WHERE scheduled_at IS NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_schedule_runs_schedule_id_scheduled_at ON schedule_runs(schedule_id, scheduled_at);
@@ -0,0 +1,105 @@
+//go:build cgo
+
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/storage"
+	"time"
+)
+
+// Refund возвращает сумму по транзакции отдельной транзакцией-возвратом.
+func (s *Storage) Refund(ctx context.Context, id int64, amount money.Money) (models.Receipt, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Receipt{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	original, err := scanTransaction(tx.QueryRowContext(ctx, "SELECT "+transactionColumns+" FROM transactions WHERE id = ?", id))
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	if original.RefundOf != nil {
+		return models.Receipt{}, storage.ErrRefundOfRefund
+	}
+	if original.FeeOf != nil {
+		return models.Receipt{}, storage.ErrRefundOfFee
+	}
+	if amount.Currency != original.Amount.Currency {
+		return models.Receipt{}, money.ErrCurrencyMismatch
+	}
+
+	var refunded int64
+	err = tx.QueryRowContext(ctx, "SELECT COALESCE(SUM(COALESCE(dest_amount, amount)), 0) FROM transactions WHERE refund_of = ?", id).Scan(&refunded)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	if refunded+amount.Amount > original.Amount.Amount {
+		return models.Receipt{}, storage.ErrRefundExceedsAmount
+	}
+
+	// деньги возвращает получатель исходной транзакции, в своей валюте
+	debit, err := storage.RefundDebit(original, refunded, amount)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	refund := models.Transaction{
+		From:     original.To,
+		To:       original.From,
+		Amount:   debit,
+		RefundOf: &id,
+	}
+	if refund.Amount.Currency != amount.Currency {
+		refund.DestinationAmount = &amount
+		refund.Rate = storage.RefundRate(refund.Amount, amount)
+	}
+	now := time.Now().UTC()
+	balance, err := checkSender(ctx, tx, refund.From, refund.Amount, now)
+	if errors.Is(err, storage.ErrInsufficientFunds) {
+		return models.Receipt{}, storage.ErrRefundInsufficientFunds
+	}
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	if err := checkReceiver(ctx, tx, refund.To, amount.Currency); err != nil {
+		return models.Receipt{}, err
+	}
+
+	refund, err = moveFunds(ctx, tx, refund, now)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Receipt{}, err
+	}
+
+	return models.Receipt{
+		Transaction:   refund,
+		SenderBalance: money.New(balance-refund.Amount.Amount, refund.Amount.Currency),
+	}, nil
+}
+
+// ListRefunds возвращает возвраты по транзакции в порядке создания.
+func (s *Storage) ListRefunds(ctx context.Context, id int64) ([]models.Transaction, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+transactionColumns+" FROM transactions WHERE refund_of = ? ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var refunds []models.Transaction
+	for rows.Next() {
+		refund, err := scanTransaction(rows)
+		if err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, refund)
+	}
+	return refunds, rows.Err()
+}
@@ -0,0 +1,201 @@
+//go:build cgo
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/storage"
+	"time"
+)
+
+// scheduleColumns — колонки schedules в порядке scanSchedule.
+const scheduleColumns = `id, from_address, to_address, amount, currency, cron, next_run_at, status, attempts, created_at`
+
+// CreateSchedule сохраняет запланированный перевод.
+func (s *Storage) CreateSchedule(ctx context.Context, schedule models.Schedule) (models.Schedule, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Schedule{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, address := range []string{schedule.From, schedule.To} {
+		if err := checkReceiver(ctx, tx, address, schedule.Amount.Currency); err != nil {
+			return models.Schedule{}, err
+		}
+	}
+
+	schedule.Status = storage.ScheduleActive
+	schedule.Attempts = 0
+	schedule.NextRunAt = schedule.NextRunAt.UTC()
+	schedule.CreatedAt = schedule.CreatedAt.UTC()
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO schedules (from_address, to_address, amount, currency, cron, next_run_at, status, attempts, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		schedule.From, schedule.To, schedule.Amount.Amount, schedule.Amount.Currency, schedule.Cron,
+		schedule.NextRunAt, schedule.Status, schedule.Attempts, schedule.CreatedAt)
+	if err != nil {
+		return models.Schedule{}, err
+	}
+	if schedule.ID, err = res.LastInsertId(); err != nil {
+		return models.Schedule{}, err
+	}
+
+	return schedule, tx.Commit()
+}
+
+// GetSchedule возвращает запланированный перевод по идентификатору.
+func (s *Storage) GetSchedule(ctx context.Context, id int64) (models.Schedule, error) {
+	return scanSchedule(s.db.QueryRowContext(ctx, "SELECT "+scheduleColumns+" FROM schedules WHERE id = ?", id))
+}
+
+// CancelSchedule отменяет активный запланированный перевод.
+func (s *Storage) CancelSchedule(ctx context.Context, id int64) (models.Schedule, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Schedule{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	schedule, err := scanSchedule(tx.QueryRowContext(ctx, "SELECT "+scheduleColumns+" FROM schedules WHERE id = ?", id))
+	if err != nil {
+		return models.Schedule{}, err
+	}
+	if schedule.Status != storage.ScheduleActive {
+		return models.Schedule{}, storage.ErrScheduleNotActive
+	}
+
+	schedule.Status = storage.ScheduleCancelled
+	if _, err := tx.ExecContext(ctx, "UPDATE schedules SET status = ? WHERE id = ?", schedule.Status, id); err != nil {
+		return models.Schedule{}, err
+	}
+	return schedule, tx.Commit()
+}
+
+// DueSchedules возвращает активные переводы, время запуска которых наступило.
+func (s *Storage) DueSchedules(ctx context.Context, now time.Time, limit int) ([]models.Schedule, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+scheduleColumns+`
+		FROM schedules
+		WHERE status = ? AND next_run_at <= ?
+		ORDER BY next_run_at, id
+		LIMIT ?`,
+		storage.ScheduleActive, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []models.Schedule
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, rows.Err()
+}
+
+// RecordScheduleRun сохраняет исход запуска и обновляет перевод.
+func (s *Storage) RecordScheduleRun(ctx context.Context, schedule models.Schedule, run models.ScheduleRun) (models.ScheduleRun, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.ScheduleRun{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	run, err = recordScheduleRun(ctx, tx, schedule, run)
+	if err != nil {
+		return models.ScheduleRun{}, err
+	}
+	return run, tx.Commit()
+}
+
+// recordScheduleRun записывает запуск внутри транзакции tx. Условие на
+// next_run_at пропускает только первую запись срабатывания run.ScheduledAt:
+// повторная запись того же срабатывания и запись после отмены получают
+// ErrScheduleNotDue.
+func recordScheduleRun(ctx context.Context, tx *sql.Tx, schedule models.Schedule, run models.ScheduleRun) (models.ScheduleRun, error) {
+	res, err := tx.ExecContext(ctx, `
+		UPDATE schedules SET next_run_at = ?, status = ?, attempts = ?
+		WHERE id = ? AND status = ? AND next_run_at = ?`,
+		schedule.NextRunAt.UTC(), schedule.Status, schedule.Attempts, schedule.ID, storage.ScheduleActive, run.ScheduledAt.UTC())
+	if err != nil {
+		return models.ScheduleRun{}, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return models.ScheduleRun{}, err
+	}
+	if n == 0 {
+		if _, err := scanSchedule(tx.QueryRowContext(ctx, "SELECT "+scheduleColumns+" FROM schedules WHERE id = ?", schedule.ID)); err != nil {
+			return models.ScheduleRun{}, err
+		}
+		return models.ScheduleRun{}, storage.ErrScheduleNotDue
+	}
+
+	run.ScheduleID = schedule.ID
+	run.ScheduledAt = run.ScheduledAt.UTC()
+	run.ExecutedAt = run.ExecutedAt.UTC()
+	res, err = tx.ExecContext(ctx, `
+		INSERT INTO schedule_runs (schedule_id, status, transaction_id, error, scheduled_at, executed_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		run.ScheduleID, run.Status, run.TransactionID, run.Error, run.ScheduledAt, run.ExecutedAt)
+	if err != nil {
+		return models.ScheduleRun{}, err
+	}
+	if run.ID, err = res.LastInsertId(); err != nil {
+		return models.ScheduleRun{}, err
+	}
+	return run, nil
+}
+
+// ListScheduleRuns возвращает запуски запланированного перевода.
+func (s *Storage) ListScheduleRuns(ctx context.Context, id int64) ([]models.ScheduleRun, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, schedule_id, status, transaction_id, error, scheduled_at, executed_at
+		FROM schedule_runs
+		WHERE schedule_id = ?
+		ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []models.ScheduleRun
+	for rows.Next() {
+		var run models.ScheduleRun
+		var transactionID sql.NullInt64
+		if err := rows.Scan(&run.ID, &run.ScheduleID, &run.Status, &transactionID, &run.Error, &run.ScheduledAt, &run.ExecutedAt); err != nil {
+			return nil, err
+		}
+		if transactionID.Valid {
+			run.TransactionID = &transactionID.Int64
+		}
+		run.ScheduledAt = run.ScheduledAt.UTC()
+		run.ExecutedAt = run.ExecutedAt.UTC()
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// scanSchedule читает запланированный перевод из строки с колонками scheduleColumns.
+func scanSchedule(row rowScanner) (models.Schedule, error) {
+	var schedule models.Schedule
+	err := row.Scan(&schedule.ID, &schedule.From, &schedule.To, &schedule.Amount.Amount, &schedule.Amount.Currency,
+		&schedule.Cron, &schedule.NextRunAt, &schedule.Status, &schedule.Attempts, &schedule.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Schedule{}, storage.ErrScheduleNotFound
+	}
+	if err != nil {
+		return models.Schedule{}, err
+	}
+	schedule.NextRunAt = schedule.NextRunAt.UTC()
+	schedule.CreatedAt = schedule.CreatedAt.UTC()
+	return schedule, nil
+}
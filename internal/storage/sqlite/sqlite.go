@@ -1,6 +1,8 @@
+//go:build cgo
+
 // Пакет sqlite содержит реализацию интерфейса storage.Storage для SQLite
 // Реализует:
-// - Инициализацию базы данных и создание таблиц
+// - Инициализацию базы данных и версионные миграции схемы
 // - Сидирование тестовых кошельков при первом запуске
 // - Операции с кошельками и транзакциями
 //
@@ -9,14 +11,17 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	_ "github.com/mattn/go-sqlite3"
 	"log/slog"
 	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
 	"paymentSystem/internal/storage"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -25,67 +30,77 @@ type Storage struct {
 	logger *slog.Logger
 }
 
+// connParams — настройки каждого соединения пула. busy_timeout заставляет
+// писателя ждать освобождения базы вместо ошибки "database is locked",
+// txlock=immediate берет блокировку записи в начале транзакции, чтобы две
+// читающие транзакции не столкнулись при переходе к записи, а WAL не дает
+// писателю блокировать читателей. Внешние ключи включаются на каждом
+// соединении, а не на одном из пула.
+const connParams = "_busy_timeout=5000&_txlock=immediate&_journal_mode=WAL&_foreign_keys=on"
+
+// Open открывает базу SQLite по пути path с настройками для параллельных
+// запросов. Параметры, уже заданные в path после "?", дополняются.
+func Open(path string) (*sql.DB, error) {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return sql.Open("sqlite3", path+sep+connParams)
+}
+
 func NewStorage(db *sql.DB, logger *slog.Logger) *Storage {
 	return &Storage{db: db, logger: logger}
 }
 
-// Init инициализирует базу данных при первом запуске.
-func (s *Storage) Init() error {
-	if _, err := s.db.Exec("PRAGMA foreign_keys = ON"); err != nil {
-		return fmt.Errorf("PRAGMA foreign_keys = ON: %v", err)
+// Init применяет миграции и заполняет базу при первом запуске.
+func (s *Storage) Init(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, "PRAGMA foreign_keys = ON"); err != nil {
+		return fmt.Errorf("PRAGMA foreign_keys = ON: %w", err)
 	}
 
-	if err := s.createTables(); err != nil {
-		return fmt.Errorf("create tables: %v", err)
+	migrator, err := s.Migrator()
+	if err != nil {
+		return err
 	}
-	return s.seedWallets()
-}
-
-// createTables создает необходимые таблицы в базе данных.
-func (s *Storage) createTables() error {
-	_, err := s.db.Exec(`
-		CREATE TABLE IF NOT EXISTS wallets (
-		    address TEXT NOT NULL PRIMARY KEY,
-		    balance REAL NOT NULL
-		);
-
-		CREATE TABLE IF NOT EXISTS transactions (
-		    id INTEGER PRIMARY KEY AUTOINCREMENT,
-		    from_address TEXT NOT NULL,
-		    to_address TEXT NOT NULL,
-		    amount REAL NOT NULL,
-		    created_at DATETIME CURRENT_TIMESTAMP,
-		    FOREIGN KEY (from_address) REFERENCES wallets(address),
-		    FOREIGN KEY (to_address) REFERENCES wallets(address)
-		);
-	`)
-	return err
+	if err := migrator.Up(ctx); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	if err := s.seedWallets(ctx); err != nil {
+		return err
+	}
+	return s.backfillOpeningEntries(ctx)
 }
 
 // seedWallets добавляет тестовые кошельки при первом запуске.
-func (s *Storage) seedWallets() error {
+func (s *Storage) seedWallets(ctx context.Context) error {
 	const count = 10
 	var existing int
-	err := s.db.QueryRow("SELECT COUNT(*) FROM wallets").Scan(&existing)
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM wallets").Scan(&existing)
 	if err != nil {
-		return fmt.Errorf("failet to check wallets: %v", err)
+		return fmt.Errorf("failet to check wallets: %w", err)
 	}
 
 	if existing > 0 {
 		return nil
 	}
 
-	tx, err := s.db.Begin()
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failet to begin transaction: %v", err)
+		return fmt.Errorf("failet to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
+	balance, err := money.Parse("100", money.DefaultCurrency)
+	if err != nil {
+		return err
+	}
+
 	for i := 1; i <= count; i++ {
 		address := "wallet-" + strconv.Itoa(i)
-		_, err = tx.Exec("INSERT INTO wallets (address, balance) VALUES (?, ?)", address, 100)
+		_, err = tx.ExecContext(ctx, "INSERT INTO wallets (address, balance, currency, created_at) VALUES (?, ?, ?, ?)",
+			address, balance.Amount, balance.Currency, time.Now())
 		if err != nil {
-			return fmt.Errorf("failet to insert wallet %d: %v", i, err)
+			return fmt.Errorf("failet to insert wallet %d: %w", i, err)
 		}
 	}
 
@@ -93,80 +108,377 @@ func (s *Storage) seedWallets() error {
 }
 
 // Transfer выполняет денежный перевод между кошельками.
-func (s *Storage) Transfer(from, to string, amount float64) error {
-	tx, err := s.db.Begin()
+func (s *Storage) Transfer(ctx context.Context, transfer models.TransferRequest) (models.Receipt, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failet to begin transaction: %v", err)
+		return models.Receipt{}, fmt.Errorf("failet to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
+	receipt, err := applyTransfer(ctx, tx, transfer, time.Now().UTC())
+	if err != nil {
+		return models.Receipt{}, err
+	}
+
+	if transfer.Schedule != nil {
+		run := transfer.Schedule.Run
+		run.TransactionID = &receipt.ID
+		if _, err := recordScheduleRun(ctx, tx, transfer.Schedule.Schedule, run); err != nil {
+			return models.Receipt{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return models.Receipt{}, err
+	}
+	return receipt, nil
+}
+
+// TransferBatch выполняет пакет переводов в одной транзакции.
+func (s *Storage) TransferBatch(ctx context.Context, transfers []models.TransferRequest) ([]models.Receipt, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	receipts := make([]models.Receipt, 0, len(transfers))
+	for i, t := range transfers {
+		receipt, err := applyTransfer(ctx, tx, t, now)
+		if err != nil {
+			return nil, &storage.BatchError{Index: i, Err: err}
+		}
+		receipts = append(receipts, receipt)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return receipts, nil
+}
+
+// applyTransfer проверяет ограничения отправителя и кошельки и выполняет
+// перевод внутри транзакции tx. Непустой t.Fee списывается с отправителя
+// следом за переводом.
+func applyTransfer(ctx context.Context, tx *sql.Tx, t models.TransferRequest, now time.Time) (models.Receipt, error) {
+	transaction := models.Transaction{From: t.From, To: t.To, Amount: t.Amount}
+	if t.Conversion != nil {
+		transaction.DestinationAmount = &t.Conversion.Amount
+		transaction.Rate = t.Conversion.Rate
+	}
+	debit := t.Amount
+	if t.Fee != nil {
+		if t.Fee.Amount.Currency != t.Amount.Currency {
+			return models.Receipt{}, money.ErrCurrencyMismatch
+		}
+		debit.Amount += t.Fee.Amount.Amount
+	}
+
+	if err := checkLimits(ctx, tx, t.From, t.Check); err != nil {
+		return models.Receipt{}, err
+	}
+
 	//ПРОВЕРКА КОШЕЛЬКОВ
-	var balance float64
-	err = tx.QueryRow("SELECT balance FROM wallets WHERE address = ?", from).Scan(&balance)
+	balance, err := checkSender(ctx, tx, t.From, debit, now)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	if err := checkReceiver(ctx, tx, t.To, transaction.Credit().Currency); err != nil {
+		return models.Receipt{}, err
+	}
+	if t.Fee != nil {
+		if err := checkReceiver(ctx, tx, t.Fee.Wallet, t.Fee.Amount.Currency); err != nil {
+			return models.Receipt{}, fmt.Errorf("%w: %s: %v", storage.ErrFeeWallet, t.Fee.Wallet, err)
+		}
+	}
+	//^ПРОВЕРКА КОШЕЛЬКОВ
+
+	transaction, err = moveFunds(ctx, tx, transaction, now)
+	if err != nil {
+		return models.Receipt{}, err
+	}
+	receipt := models.Receipt{
+		Transaction:   transaction,
+		SenderBalance: money.New(balance-debit.Amount, debit.Currency),
+	}
+
+	if t.Fee != nil {
+		fee, err := moveFunds(ctx, tx, models.Transaction{
+			From:   t.From,
+			To:     t.Fee.Wallet,
+			Amount: t.Fee.Amount,
+			FeeOf:  &transaction.ID,
+		}, now)
+		if err != nil {
+			return models.Receipt{}, err
+		}
+		receipt.Fee = &fee
+	}
+	return receipt, nil
+}
+
+// checkSender проверяет, что кошелек отправителя существует, открыт, ведется
+// в валюте перевода и его доступного баланса (за вычетом блокировок) хватает
+// на сумму. Возвращает учетный баланс до списания.
+func checkSender(ctx context.Context, tx *sql.Tx, address string, amount money.Money, now time.Time) (int64, error) {
+	var balance int64
+	var currency string
+	var closedAt sql.NullTime
+	err := tx.QueryRowContext(ctx, "SELECT balance, currency, closed_at FROM wallets WHERE address = ?", address).
+		Scan(&balance, &currency, &closedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			return storage.ErrWalletNotFound
+			return 0, storage.ErrWalletNotFound
 		}
-		return err
+		return 0, err
 	}
-	if balance < amount {
-		return storage.ErrInsufficientFunds
+	if closedAt.Valid {
+		return 0, storage.ErrWalletClosed
 	}
-	var toExists bool
-	err = tx.QueryRow("Select 1 FROM wallets WHERE address = ?", to).Scan(&toExists)
+	if currency != amount.Currency {
+		return 0, money.ErrCurrencyMismatch
+	}
+	held, err := heldAmount(ctx, tx, address, now)
+	if err != nil {
+		return 0, err
+	}
+	if balance-held < amount.Amount {
+		return 0, storage.ErrInsufficientFunds
+	}
+	return balance, nil
+}
+
+// checkReceiver проверяет, что кошелек получателя существует, открыт
+// и ведется в валюте перевода.
+func checkReceiver(ctx context.Context, tx *sql.Tx, address, currency string) error {
+	var walletCurrency string
+	var closedAt sql.NullTime
+	err := tx.QueryRowContext(ctx, "SELECT currency, closed_at FROM wallets WHERE address = ?", address).
+		Scan(&walletCurrency, &closedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return storage.ErrWalletNotFound
 		}
 		return err
 	}
-	//^ПРОВЕРКА КОШЕЛЬКОВ
+	if closedAt.Valid {
+		return storage.ErrWalletClosed
+	}
+	if walletCurrency != currency {
+		return money.ErrCurrencyMismatch
+	}
+	return nil
+}
 
-	_, err = tx.Exec("UPDATE wallets SET balance = balance - ? WHERE address = ?", amount, from)
+// moveFunds переносит сумму между кошельками, записывает транзакцию и проводки
+// журнала и возвращает t с заполненными ID и Timestamp. С отправителя
+// списывается t.Amount, получателю зачисляется t.Credit(); разница валют
+// проводится через storage.FXAccount. Вид записи журнала определяют
+// RefundOf и FeeOf. Проверки кошельков и достаточности средств — на вызывающем.
+func moveFunds(ctx context.Context, tx *sql.Tx, t models.Transaction, now time.Time) (models.Transaction, error) {
+	credit := t.Credit()
+	_, err := tx.ExecContext(ctx, "UPDATE wallets SET balance = balance - ? WHERE address = ?", t.Amount.Amount, t.From)
 	if err != nil {
-		return err
+		return models.Transaction{}, err
 	}
 
-	_, err = tx.Exec("UPDATE wallets SET balance = balance + ? WHERE address = ?", amount, to)
+	_, err = tx.ExecContext(ctx, "UPDATE wallets SET balance = balance + ? WHERE address = ?", credit.Amount, t.To)
 	if err != nil {
-		return err
+		return models.Transaction{}, err
 	}
 
-	_, err = tx.Exec("INSERT INTO transactions (from_address, to_address, amount, created_at) VALUES (?, ?, ?, ?)", from, to, amount, time.Now())
+	var destAmount sql.NullInt64
+	var destCurrency, rate sql.NullString
+	if t.DestinationAmount != nil {
+		destAmount = sql.NullInt64{Int64: credit.Amount, Valid: true}
+		destCurrency = sql.NullString{String: credit.Currency, Valid: true}
+		rate = sql.NullString{String: t.Rate, Valid: true}
+	}
+	res, err := tx.ExecContext(ctx, `INSERT INTO transactions (from_address, to_address, amount, currency, dest_amount, dest_currency, rate, created_at, refund_of, fee_of)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.From, t.To, t.Amount.Amount, t.Amount.Currency, destAmount, destCurrency, rate, now, t.RefundOf, t.FeeOf)
+	if err != nil {
+		return models.Transaction{}, err
+	}
+	if t.ID, err = res.LastInsertId(); err != nil {
+		return models.Transaction{}, err
+	}
+	t.Timestamp = now.Format(time.RFC3339Nano)
 
-	return tx.Commit()
+	err = postEntry(ctx, tx, storage.EntryKind(t), &t.ID, now, storage.TransferPostings(t)...)
+	return t, err
 }
 
-// GetBalance возвращает текущий баланс кошелька.
-func (s *Storage) GetBalance(address string) (float64, error) {
-	var balance float64
-	err := s.db.QueryRow("SELECT balance FROM wallets WHERE address = ?", address).Scan(&balance)
+// GetBalance возвращает учетный и доступный баланс кошелька.
+func (s *Storage) GetBalance(ctx context.Context, address string) (models.Balance, error) {
+	var balance models.Balance
+	var held int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT balance, currency,
+		       COALESCE((SELECT SUM(amount + fee) FROM holds
+		                 WHERE wallet = wallets.address AND status = ? AND expires_at > ?), 0)
+		FROM wallets
+		WHERE address = ?`, storage.HoldActive, time.Now().UTC(), address).
+		Scan(&balance.Total.Amount, &balance.Total.Currency, &held)
 	if errors.Is(err, sql.ErrNoRows) {
-		return balance, storage.ErrWalletNotFound
+		return models.Balance{}, storage.ErrWalletNotFound
 	}
+	balance.Available = money.New(balance.Total.Amount-held, balance.Total.Currency)
 	return balance, err
 }
 
-// GetLastNTransactions возвращает последние N транзакций.
-func (s *Storage) GetLastNTransactions(n int) ([]models.Transaction, error) {
+// GetTransaction возвращает транзакцию по идентификатору.
+func (s *Storage) GetTransaction(ctx context.Context, id int64) (models.Transaction, error) {
+	return scanTransaction(s.db.QueryRowContext(ctx, "SELECT "+transactionColumns+" FROM transactions WHERE id = ?", id))
+}
+
+// transactionColumns — колонки transactions в порядке scanTransaction.
+const transactionColumns = `id, from_address, to_address, amount, currency, dest_amount, dest_currency, rate, created_at, refund_of, fee_of`
+
+// scanTransaction читает транзакцию из строки с колонками transactionColumns.
+func scanTransaction(row rowScanner) (models.Transaction, error) {
+	var tx models.Transaction
+	var refundOf, feeOf, destAmount sql.NullInt64
+	var destCurrency, rate sql.NullString
+	err := row.Scan(&tx.ID, &tx.From, &tx.To, &tx.Amount.Amount, &tx.Amount.Currency,
+		&destAmount, &destCurrency, &rate, &tx.Timestamp, &refundOf, &feeOf)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Transaction{}, storage.ErrTransactionNotFound
+	}
+	if err != nil {
+		return models.Transaction{}, err
+	}
+	if destAmount.Valid {
+		credit := money.New(destAmount.Int64, destCurrency.String)
+		tx.DestinationAmount = &credit
+		tx.Rate = rate.String
+	}
+	if refundOf.Valid {
+		tx.RefundOf = &refundOf.Int64
+	}
+	if feeOf.Valid {
+		tx.FeeOf = &feeOf.Int64
+	}
+	return tx, nil
+}
+
+// ListTransactions возвращает транзакции по фильтру, от новых к старым.
+func (s *Storage) ListTransactions(ctx context.Context, filter storage.TransactionFilter) ([]models.Transaction, error) {
 	var transactions []models.Transaction
-	rows, err := s.db.Query(`
-		SELECT from_address, to_address, amount,created_at 
-		FROM transactions
-		ORDER BY created_at DESC
-		LIMIT ?`, n)
+	err := s.EachTransaction(ctx, filter, func(tx models.Transaction) error {
+		transactions = append(transactions, tx)
+		return nil
+	})
+	return transactions, err
+}
+
+// EachTransaction построчно читает транзакции по фильтру, от новых к старым.
+// Пагинация keyset по первичному ключу: курсор BeforeID превращается
+// в условие id < ?, поэтому глубина страницы не влияет на стоимость запроса.
+func (s *Storage) EachTransaction(ctx context.Context, filter storage.TransactionFilter, fn func(models.Transaction) error) error {
+	var where []string
+	var args []any
+
+	switch {
+	case filter.Wallet == "":
+	case filter.Direction == storage.DirectionIn:
+		where = append(where, "to_address = ?")
+		args = append(args, filter.Wallet)
+	case filter.Direction == storage.DirectionOut:
+		where = append(where, "from_address = ?")
+		args = append(args, filter.Wallet)
+	default:
+		where = append(where, "(from_address = ? OR to_address = ?)")
+		args = append(args, filter.Wallet, filter.Wallet)
+	}
+	if filter.BeforeID > 0 {
+		where = append(where, "id < ?")
+		args = append(args, filter.BeforeID)
+	}
+	if !filter.FromTime.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, filter.FromTime.UTC())
+	}
+	if !filter.ToTime.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, filter.ToTime.UTC())
+	}
+	if filter.Currency != "" {
+		where = append(where, "currency = ?")
+		args = append(args, filter.Currency)
+	}
+	if filter.MinAmount > 0 {
+		where = append(where, "amount >= ?")
+		args = append(args, filter.MinAmount)
+	}
+	if filter.MaxAmount > 0 {
+		where = append(where, "amount <= ?")
+		args = append(args, filter.MaxAmount)
+	}
+
+	query := "SELECT " + transactionColumns + " FROM transactions"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var tx models.Transaction
-		if err = rows.Scan(&tx.From, &tx.To, &tx.Amount, &tx.Timestamp); err != nil {
-			return transactions, err
+		tx, err := scanTransaction(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(tx); err != nil {
+			return err
 		}
-		transactions = append(transactions, tx)
 	}
 
-	return transactions, nil
+	return rows.Err()
+}
+
+// OutgoingSince считает исходящие переводы кошелька начиная с since.
+func (s *Storage) OutgoingSince(ctx context.Context, address string, since time.Time) (storage.Outgoing, error) {
+	return outgoingSince(ctx, s.db, address, since)
+}
+
+// queryRower — *sql.DB или *sql.Tx.
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// checkLimits вызывает непустую проверку ограничений отправителя from
+// в транзакции tx. Транзакции открываются с _txlock=immediate и сразу
+// берут блокировку записи базы, поэтому проверки и списания одного
+// отправителя, в том числе из разных процессов, идут по очереди.
+func checkLimits(ctx context.Context, tx *sql.Tx, from string, check models.LimitCheck) error {
+	if check == nil {
+		return nil
+	}
+	return check(func(since time.Time) (storage.Outgoing, error) {
+		return outgoingSince(ctx, tx, from, since)
+	})
+}
+
+// outgoingSince считает исходящие переводы кошелька начиная с since.
+func outgoingSince(ctx context.Context, q queryRower, address string, since time.Time) (storage.Outgoing, error) {
+	var out storage.Outgoing
+	err := q.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(amount), 0) FROM transactions
+		WHERE from_address = ? AND created_at >= ? AND refund_of IS NULL AND fee_of IS NULL`,
+		address, since.UTC(),
+	).Scan(&out.Count, &out.Amount)
+	if err != nil {
+		return storage.Outgoing{}, fmt.Errorf("outgoing since: %w", err)
+	}
+	return out, nil
 }
@@ -1,192 +1,309 @@
+//go:build cgo
+
 package sqlite
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
 	"errors"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"io"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
 	"paymentSystem/internal/storage"
+	"paymentSystem/internal/storage/migrate"
+	"paymentSystem/internal/storage/storagetest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
+var ctx = context.Background()
+
 type StorageTestSuite struct {
 	suite.Suite
 	db      *sql.DB
 	storage storage.Storage
-	logger  *slog.Logger
 }
 
 func (s *StorageTestSuite) SetupTest() {
-	db, err := sql.Open("sqlite3", ":memory:")
-	require.NoError(s.T(), err)
-	s.db = db
+	s.db, s.storage = newTestStorage(s.T())
+}
 
-	s.logger = slog.New(slog.NewTextHandler(os.Stdout, nil))
-	s.storage = NewStorage(db, s.logger)
-	require.NoError(s.T(), s.storage.Init())
+// newTestStorage создает инициализированное хранилище во временном файле,
+// открытом так же, как в сервере: параллельные запросы идут через пул
+// соединений, а не ждут очереди к единственному.
+func newTestStorage(t *testing.T) (*sql.DB, storage.Storage) {
+	db, err := Open(filepath.Join(t.TempDir(), "payments.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	st := NewStorage(db, slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	require.NoError(t, st.Init(ctx))
+	return db, st
 }
 
-func (s *StorageTestSuite) TearDownTest() {
-	s.db.Close()
+// rub возвращает сумму в рублях, заданную в минимальных единицах (копейках).
+func rub(amount int64) money.Money {
+	return money.New(amount, "RUB")
 }
 
-func (s *StorageTestSuite) createTestWallet(address string, balance float64) {
-	_, err := s.db.Exec("INSERT INTO wallets (address, balance) VALUES (?, ?)", address, balance)
+func (s *StorageTestSuite) createTestWallet(address string, balance money.Money) {
+	err := s.storage.CreateWallet(ctx, models.Wallet{Address: address, Balance: balance, CreatedAt: time.Now().UTC()})
 	require.NoError(s.T(), err)
 }
 
+// transfer выполняет перевод, отбрасывая квитанцию.
+func transfer(st storage.Storage, from, to string, amount money.Money) error {
+	_, err := st.Transfer(ctx, models.TransferRequest{From: from, To: to, Amount: amount})
+	return err
+}
+
 func TestStorageSuite(t *testing.T) {
 	suite.Run(t, new(StorageTestSuite))
 }
 
-func (s *StorageTestSuite) TestTransfer_Successful() {
-	// Arrange
-	s.createTestWallet("wallet-52", 100.0)
-	s.createTestWallet("wallet-53", 100.0)
-
-	// Act
-	err := s.storage.Transfer("wallet-52", "wallet-53", 50.0)
-
-	// Assert
-	assert.NoError(s.T(), err)
-
-	balance1, err := s.storage.GetBalance("wallet-52")
-	assert.NoError(s.T(), err)
-	assert.Equal(s.T(), 50.0, balance1)
-
-	balance2, err := s.storage.GetBalance("wallet-53")
-	assert.NoError(s.T(), err)
-	assert.Equal(s.T(), 150.0, balance2)
-
-	// Проверяем запись транзакции
-	transactions, err := s.storage.GetLastNTransactions(1)
-	assert.NoError(s.T(), err)
-	require.Len(s.T(), transactions, 1)
-
-	tx := transactions[0]
-	assert.Equal(s.T(), "wallet-52", tx.From)
-	assert.Equal(s.T(), "wallet-53", tx.To)
-	assert.Equal(s.T(), 50.0, tx.Amount)
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		_, st := newTestStorage(t)
+		return st
+	})
 }
 
-func (s *StorageTestSuite) TestTransfer_InsufficientMoney() {
-	// Arrange
-	s.createTestWallet("sender", 100.0)
-	s.createTestWallet("receiver", 100.0)
-
-	// Act
-	err := s.storage.Transfer("sender", "receiver", 150.0)
-
-	// Assert
-	assert.Error(s.T(), err)
-	assert.Contains(s.T(), err.Error(), "insufficient funds")
-
-	// Проверяем, что балансы не изменились
-	senderBalance, _ := s.storage.GetBalance("sender")
-	assert.Equal(s.T(), 100.0, senderBalance)
-
-	receiverBalance, _ := s.storage.GetBalance("receiver")
-	assert.Equal(s.T(), 100.0, receiverBalance)
-
-	// Проверяем отсутствие транзакций
-	transactions, _ := s.storage.GetLastNTransactions(10)
-	assert.Empty(s.T(), transactions)
+// createLegacySchema создает таблицы в формате до перехода на целые суммы.
+func createLegacySchema(t *testing.T, db *sql.DB) {
+	_, err := db.Exec(`
+		CREATE TABLE wallets (
+		    address TEXT NOT NULL PRIMARY KEY,
+		    balance REAL NOT NULL
+		);
+		CREATE TABLE transactions (
+		    id INTEGER PRIMARY KEY AUTOINCREMENT,
+		    from_address TEXT NOT NULL,
+		    to_address TEXT NOT NULL,
+		    amount REAL NOT NULL,
+		    created_at DATETIME CURRENT_TIMESTAMP,
+		    FOREIGN KEY (from_address) REFERENCES wallets(address),
+		    FOREIGN KEY (to_address) REFERENCES wallets(address)
+		);`)
+	require.NoError(t, err)
 }
 
-func (s *StorageTestSuite) TestTransfer_NonexistentWallets() {
-	testCases := []struct {
-		name string
-		from string
-		to   string
-	}{
-		{"Nonexistent sender", "invalid-sender", "valid-receiver"},
-		{"Nonexistent receiver", "valid-sender", "invalid-receiver"},
-	}
+func TestInit_MigratesLegacyRealColumns(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	createLegacySchema(t, db)
+	_, err = db.Exec(`INSERT INTO wallets (address, balance) VALUES ('a', 0.1), ('b', 99.99)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO transactions (from_address, to_address, amount, created_at)
+		VALUES ('a', 'b', 33.33, '2024-01-01 00:00:00')`)
+	require.NoError(t, err)
+
+	s := NewStorage(db, slog.New(slog.NewTextHandler(os.Stdout, nil)))
+	require.NoError(t, s.Init(ctx))
+
+	// Для перенесенных балансов созданы начальные проводки
+	report, err := s.VerifyLedger(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.OK(), "%+v", report)
+
+	balance, err := s.GetBalance(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, rub(10), balance.Total)
+
+	balance, err = s.GetBalance(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, rub(9999), balance.Total)
+
+	transactions, err := s.ListTransactions(ctx, storage.TransactionFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, transactions, 1)
+	assert.Equal(t, rub(3333), transactions[0].Amount)
+
+	// Повторная инициализация не должна ничего менять
+	require.NoError(t, s.Init(ctx))
+	balance, err = s.GetBalance(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, rub(9999), balance.Total)
+}
 
-	for _, tc := range testCases {
-		s.T().Run(tc.name, func(t *testing.T) {
-			// Arrange
-			if tc.from == "valid-sender" {
-				s.createTestWallet("valid-sender", 100.0)
-			}
-			if tc.to == "valid-receiver" {
-				s.createTestWallet("valid-receiver", 100.0)
-			}
-
-			// Act
-			err := s.storage.Transfer(tc.from, tc.to, 50.0)
-
-			// Assert
-			assert.Error(t, err)
-			assert.Contains(t, err.Error(), "wallet not found")
-		})
+func TestInit_RoundsDriftedLegacyAmounts(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	createLegacySchema(t, db)
+	a, b := 0.1, 0.2
+	_, err = db.Exec(`INSERT INTO wallets (address, balance) VALUES ('a', ?), ('b', ?), ('c', 99.99)`, a+b, 10.000000001)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO transactions (from_address, to_address, amount, created_at)
+		VALUES ('a', 'b', ?, '2024-01-01 00:00:00')`, 33.330000000000005)
+	require.NoError(t, err)
+
+	var logs bytes.Buffer
+	s := NewStorage(db, slog.New(slog.NewTextHandler(&logs, nil)))
+	require.NoError(t, s.Init(ctx))
+
+	// Накопленная погрешность округляется до копейки, а не прерывает миграцию
+	for address, want := range map[string]money.Money{"a": rub(30), "b": rub(1000), "c": rub(9999)} {
+		balance, err := s.GetBalance(ctx, address)
+		require.NoError(t, err)
+		assert.Equal(t, want, balance.Total, address)
 	}
+	transactions, err := s.ListTransactions(ctx, storage.TransactionFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, transactions, 1)
+	assert.Equal(t, rub(3333), transactions[0].Amount)
+
+	report, err := s.VerifyLedger(ctx)
+	require.NoError(t, err)
+	assert.True(t, report.OK(), "%+v", report)
+
+	// В журнал попадают только измененные значения
+	assert.Equal(t, 3, strings.Count(logs.String(), "legacy amount rounded"))
+	assert.Contains(t, logs.String(), "wallet=a stored=0.30000000000000004 migrated=0.30")
+	assert.Contains(t, logs.String(), "wallet=b stored=10.000000001 migrated=10.00")
+	assert.Contains(t, logs.String(), "transaction=1")
+	assert.NotContains(t, logs.String(), "wallet=c")
 }
 
-func (s *StorageTestSuite) TestGetBalance_WalletNotFound() {
-	// Act
-	balance, err := s.storage.GetBalance("nonexistent-wallet")
+func TestInit_RefusesNewerSchema(t *testing.T) {
+	db, st := newTestStorage(t)
+	_, err := db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (999, 'future', ?)", time.Now())
+	require.NoError(t, err)
 
-	// Assert
-	assert.Error(s.T(), err)
-	assert.True(s.T(), errors.Is(err, storage.ErrWalletNotFound))
-	assert.Zero(s.T(), balance)
+	assert.ErrorIs(t, st.Init(ctx), migrate.ErrDatabaseTooNew)
 }
 
-func (s *StorageTestSuite) TestGetLastNTransactions() {
-	// Arrange
-	s.createTestWallet("wallet-a", 100.0)
-	s.createTestWallet("wallet-b", 100.0)
-	s.createTestWallet("wallet-c", 100.0)
+func TestMigrator_DownAndUp(t *testing.T) {
+	db, st := newTestStorage(t)
+	migrator, err := st.(*Storage).Migrator()
+	require.NoError(t, err)
+
+	version, err := migrator.Version(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, migrator.Latest(), version)
+
+	require.NoError(t, migrator.Down(ctx, migrator.Latest()))
+	var tables int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'wallets'").Scan(&tables))
+	assert.Zero(t, tables)
+
+	// Init снова применяет миграции и сидирует кошельки
+	require.NoError(t, st.Init(ctx))
+	balance, err := st.GetBalance(ctx, "wallet-1")
+	require.NoError(t, err)
+	assert.Equal(t, rub(10000), balance.Total)
+}
 
-	// Выполняем несколько транзакций с задержкой для разных timestamp
-	s.Require().NoError(s.storage.Transfer("wallet-a", "wallet-b", 10.0))
-	time.Sleep(10 * time.Millisecond)
-	s.Require().NoError(s.storage.Transfer("wallet-b", "wallet-c", 20.0))
-	time.Sleep(10 * time.Millisecond)
-	s.Require().NoError(s.storage.Transfer("wallet-c", "wallet-a", 5.0))
+// TestLimitCheck_AcrossInstances проверяет, что проверки ограничений двух
+// экземпляров сервиса с общей базой идут по очереди.
+func TestLimitCheck_AcrossInstances(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payments.db")
+	instances := make([]storage.Storage, 2)
+	for i := range instances {
+		db, err := Open(path)
+		require.NoError(t, err)
+		t.Cleanup(func() { db.Close() })
+		instances[i] = NewStorage(db, slog.New(slog.NewTextHandler(io.Discard, nil)))
+		require.NoError(t, instances[i].Init(ctx))
+	}
+	require.NoError(t, instances[0].CreateWallet(ctx, models.Wallet{Address: "sender", Balance: rub(10000), CreatedAt: time.Now().UTC()}))
+	require.NoError(t, instances[0].CreateWallet(ctx, models.Wallet{Address: "receiver", Balance: rub(0), CreatedAt: time.Now().UTC()}))
+
+	// за час с отправителя можно перевести не больше 1000
+	check := func(outgoing func(since time.Time) (storage.Outgoing, error)) error {
+		out, err := outgoing(time.Now().Add(-time.Hour))
+		if err != nil {
+			return err
+		}
+		if out.Amount+600 > 1000 {
+			return errors.New("limit exceeded")
+		}
+		return nil
+	}
 
-	// Act
-	transactions, err := s.storage.GetLastNTransactions(2)
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = instances[i%2].Transfer(ctx, models.TransferRequest{From: "sender", To: "receiver", Amount: rub(600), Check: check})
+		}()
+	}
+	wg.Wait()
 
-	// Assert
-	assert.NoError(s.T(), err)
-	require.Len(s.T(), transactions, 2)
+	balance, err := instances[1].GetBalance(ctx, "receiver")
+	require.NoError(t, err)
+	assert.Equal(t, rub(600), balance.Total)
+}
 
-	// Проверяем порядок (последние транзакции должны быть первыми)
-	assert.Equal(s.T(), "wallet-c", transactions[0].From)
-	assert.Equal(s.T(), "wallet-a", transactions[0].To)
-	assert.Equal(s.T(), 5.0, transactions[0].Amount)
+func (s *StorageTestSuite) TestInit_SeedsWallets() {
+	balance, err := s.storage.GetBalance(ctx, "wallet-1")
+	s.Require().NoError(err)
+	assert.Equal(s.T(), rub(10000), balance.Total)
 
-	assert.Equal(s.T(), "wallet-b", transactions[1].From)
-	assert.Equal(s.T(), "wallet-c", transactions[1].To)
-	assert.Equal(s.T(), 20.0, transactions[1].Amount)
+	// Повторная инициализация идемпотентна
+	s.Require().NoError(s.storage.Init(ctx))
+	wallets, err := s.storage.ListWallets(ctx, 100, 0)
+	s.Require().NoError(err)
+	assert.Len(s.T(), wallets, 10)
 }
 
-func (s *StorageTestSuite) TestGetLastNTransactions_MoreThanExist() {
-	// Arrange
-	s.createTestWallet("wallet-a", 100.0)
-	s.createTestWallet("wallet-b", 100.0)
-	s.Require().NoError(s.storage.Transfer("wallet-a", "wallet-b", 10.0))
-
-	// Act
-	transactions, err := s.storage.GetLastNTransactions(10)
+func (s *StorageTestSuite) TestVerifyLedger_Consistent() {
+	s.createTestWallet("wallet-a", rub(10000))
+	s.createTestWallet("wallet-b", rub(0))
+	s.Require().NoError(transfer(s.storage, "wallet-a", "wallet-b", rub(2550)))
+	s.Require().NoError(transfer(s.storage, "wallet-b", "wallet-1", rub(50)))
+
+	report, err := s.storage.VerifyLedger(ctx)
+	s.Require().NoError(err)
+	assert.True(s.T(), report.OK(), "%+v", report)
+	assert.Equal(s.T(), 12, report.WalletsChecked)
+
+	// Каждый перевод порождает сбалансированную пару проводок
+	var postings int
+	s.Require().NoError(s.db.QueryRow(`
+		SELECT COUNT(*) FROM postings p
+		JOIN journal_entries e ON e.id = p.entry_id
+		WHERE e.kind = 'transfer'`).Scan(&postings))
+	assert.Equal(s.T(), 4, postings)
+}
 
-	// Assert
-	assert.NoError(s.T(), err)
-	assert.Len(s.T(), transactions, 1)
+func (s *StorageTestSuite) TestVerifyLedger_DetectsTamperedBalance() {
+	s.createTestWallet("wallet-a", rub(10000))
+	_, err := s.db.Exec("UPDATE wallets SET balance = balance + 1 WHERE address = 'wallet-a'")
+	s.Require().NoError(err)
+
+	report, err := s.storage.VerifyLedger(ctx)
+	s.Require().NoError(err)
+	s.Require().Len(report.Discrepancies, 1)
+	assert.Equal(s.T(), models.LedgerDiscrepancy{
+		Address:     "wallet-a",
+		Balance:     rub(10001),
+		PostingsSum: rub(10000),
+	}, report.Discrepancies[0])
 }
 
-func (s *StorageTestSuite) TestGetLastNTransactions_Empty() {
-	// Act
-	transactions, err := s.storage.GetLastNTransactions(5)
+func (s *StorageTestSuite) TestVerifyLedger_DetectsUnbalancedEntry() {
+	_, err := s.db.Exec("INSERT INTO journal_entries (id, kind, created_at) VALUES (999, 'transfer', ?)", time.Now())
+	s.Require().NoError(err)
+	_, err = s.db.Exec("INSERT INTO postings (entry_id, account, amount, currency) VALUES (999, 'x', 5, 'RUB')")
+	s.Require().NoError(err)
 
-	// Assert
-	assert.NoError(s.T(), err)
-	assert.Empty(s.T(), transactions)
+	report, err := s.storage.VerifyLedger(ctx)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), []int64{999}, report.UnbalancedEntries)
 }
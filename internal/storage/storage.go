@@ -1,20 +1,319 @@
 package storage
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"math/big"
+	"paymentSystem/internal/fx"
 	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"time"
 )
 
+// EquityAccount — системный счет, против которого проводятся начальные остатки
+// кошельков, чтобы каждая запись журнала оставалась сбалансированной.
+const EquityAccount = "system:equity"
+
+// FXAccount — системный счет конвертации. Перевод между валютами проводится
+// через него: счет принимает сумму в валюте отправителя и отдает сумму в
+// валюте получателя, и проводки записи сходятся в каждой валюте отдельно.
+const FXAccount = "system:fx"
+
+// Типы записей журнала
+const (
+	EntryOpening  = "opening"
+	EntryTransfer = "transfer"
+	EntryRefund   = "refund"
+	EntryFee      = "fee"
+)
+
+// Статусы блокировок средств
+const (
+	HoldActive   = "active"
+	HoldCaptured = "captured"
+	HoldVoided   = "voided"
+	HoldExpired  = "expired"
+)
+
+// Статусы запланированных переводов
+const (
+	ScheduleActive    = "active"
+	ScheduleCompleted = "completed"
+	ScheduleFailed    = "failed"
+	ScheduleCancelled = "cancelled"
+)
+
+// Исходы запусков запланированных переводов
+const (
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+	// RunRetrying — попытка не удалась, перевод будет повторен.
+	RunRetrying = "retrying"
+)
+
+// Направления перевода относительно кошелька из фильтра
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+// TransactionFilter задает выборку истории транзакций.
+// Нулевые поля выборку не ограничивают.
+type TransactionFilter struct {
+	// Wallet оставляет переводы, в которых кошелек — отправитель или получатель.
+	Wallet string
+	// Direction уточняет Wallet: DirectionIn — входящие, DirectionOut — исходящие.
+	Direction string
+	// FromTime и ToTime ограничивают время создания: FromTime <= t < ToTime.
+	FromTime time.Time
+	ToTime   time.Time
+	// Currency, MinAmount и MaxAmount ограничивают сумму перевода
+	// в минимальных единицах валюты (границы включаются).
+	Currency  string
+	MinAmount int64
+	MaxAmount int64
+	// BeforeID — курсор keyset-пагинации: только транзакции с ID < BeforeID.
+	BeforeID int64
+	// Limit — максимальное число транзакций в ответе.
+	// EachTransaction считает 0 отсутствием ограничения.
+	Limit int
+}
+
+// Outgoing — сводка исходящих переводов кошелька за период.
+type Outgoing = models.Outgoing
+
 // Файл возможно избыточен для такого проекта,
 // но в случае добавления новой DB легко масштабировать
 var (
-	ErrWalletNotFound    = errors.New("wallet not found")
-	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrWalletNotFound      = errors.New("wallet not found")
+	ErrInsufficientFunds   = errors.New("insufficient funds")
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrWalletExists        = errors.New("wallet already exists")
+	ErrWalletClosed        = errors.New("wallet is closed")
+	ErrWalletNotEmpty      = errors.New("wallet balance is not zero")
+
+	ErrRefundExceedsAmount     = errors.New("refund exceeds refundable amount")
+	ErrRefundOfRefund          = errors.New("refund transactions cannot be refunded")
+	ErrRefundInsufficientFunds = errors.New("recipient has insufficient funds for refund")
+	ErrRefundOfFee             = errors.New("fee transactions cannot be refunded")
+
+	// ErrFeeWallet — кошелек комиссий не найден, закрыт или ведется в другой
+	// валюте. Это ошибка конфигурации, а не запроса.
+	ErrFeeWallet = errors.New("fee wallet is unavailable")
+
+	ErrHoldNotFound       = errors.New("hold not found")
+	ErrHoldNotActive      = errors.New("hold is not active")
+	ErrCaptureExceedsHold = errors.New("capture amount exceeds hold")
+
+	ErrScheduleNotFound  = errors.New("schedule not found")
+	ErrScheduleNotActive = errors.New("schedule is not active")
+	// ErrScheduleNotDue — срабатывание уже записано другим запуском или
+	// перевод больше не активен.
+	ErrScheduleNotDue = errors.New("schedule run is not due")
+
+	ErrIdempotencyKeyExists   = errors.New("idempotency key already exists")
+	ErrIdempotencyKeyNotFound = errors.New("idempotency key not found")
+
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	ErrAPIKeyRevoked  = errors.New("api key is revoked")
 )
 
+// BatchError сообщает, на каком переводе пакета прервалась атомарная операция.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("transfer %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// EntryKind возвращает вид записи журнала для транзакции.
+func EntryKind(t models.Transaction) string {
+	switch {
+	case t.RefundOf != nil:
+		return EntryRefund
+	case t.FeeOf != nil:
+		return EntryFee
+	}
+	return EntryTransfer
+}
+
+// TransferPostings возвращает проводки транзакции: списание с отправителя,
+// зачисление получателю и, при конвертации, обмен на счете FXAccount.
+// Проводка получателя идет второй — по ней выписка определяет контрагента.
+func TransferPostings(t models.Transaction) []models.Posting {
+	credit := t.Credit()
+	postings := []models.Posting{
+		{Account: t.From, Amount: money.New(-t.Amount.Amount, t.Amount.Currency)},
+		{Account: t.To, Amount: credit},
+	}
+	if credit.Currency != t.Amount.Currency {
+		postings = append(postings,
+			models.Posting{Account: FXAccount, Amount: t.Amount},
+			models.Posting{Account: FXAccount, Amount: money.New(-credit.Amount, credit.Currency)},
+		)
+	}
+	return postings
+}
+
+// RefundDebit возвращает сумму, которую получатель транзакции original
+// возвращает при возврате amount, если до этого по ней уже вернули refunded
+// (обе суммы — в валюте отправителя). Без конвертации это сама сумма amount.
+// При конвертации доля зачисленной суммы считается накопленным итогом с
+// округлением вниз, поэтому полный возврат списывает ровно зачисленное;
+// если доля меньше минимальной единицы — fx.ErrAmountTooSmall.
+func RefundDebit(original models.Transaction, refunded int64, amount money.Money) (money.Money, error) {
+	if original.DestinationAmount == nil {
+		return amount, nil
+	}
+	credited := *original.DestinationAmount
+	share := func(n int64) int64 {
+		v := new(big.Int).Mul(big.NewInt(n), big.NewInt(credited.Amount))
+		return v.Quo(v, big.NewInt(original.Amount.Amount)).Int64()
+	}
+	debit := share(refunded+amount.Amount) - share(refunded)
+	if debit <= 0 {
+		return money.Money{}, fx.ErrAmountTooSmall
+	}
+	return money.New(debit, credited.Currency), nil
+}
+
+// RefundRate возвращает курс возврата: сколько единиц валюты отправителя
+// исходной транзакции приходится на единицу возвращаемой получателем суммы.
+func RefundRate(debit, credit money.Money) string {
+	return fx.FormatRate(new(big.Rat).SetFrac64(credit.Amount, debit.Amount))
+}
+
+// Storage — хранилище кошельков и транзакций. Все методы принимают контекст
+// запроса: отмена или истечение дедлайна прерывает операцию, и метод
+// возвращает ошибку, для которой errors.Is(err, ctx.Err()) истинно.
 type Storage interface {
-	Init() error
-	GetBalance(address string) (float64, error)
-	Transfer(from, to string, amount float64) error
-	GetLastNTransactions(n int) ([]models.Transaction, error)
+	Init(ctx context.Context) error
+	// GetBalance возвращает учетный и доступный баланс кошелька: доступный
+	// меньше учетного на сумму активных неистекших блокировок.
+	GetBalance(ctx context.Context, address string) (models.Balance, error)
+	// Transfer выполняет перевод и возвращает квитанцию с созданной транзакцией.
+	// Списать можно только доступный баланс. Непустой Conversion зачисляет
+	// получателю Conversion.Amount в его валюте вместо Amount и записывает их
+	// с курсом в транзакцию. Непустой Fee в той же транзакции списывает
+	// с отправителя комиссию на Fee.Wallet отдельной транзакцией с FeeOf = ID
+	// перевода (Receipt.Fee); доступного баланса должно хватать на сумму
+	// и комиссию вместе. Если кошелек комиссий недоступен — ErrFeeWallet.
+	// Непустой Check вызывается после блокировки отправителя, до движения
+	// средств; его ошибка отменяет перевод и возвращается как есть.
+	// Непустой Schedule в той же транзакции записывает запуск по правилам
+	// RecordScheduleRun с TransactionID перевода; если срабатывание уже
+	// записано, перевод не выполняется и возвращается ErrScheduleNotDue.
+	Transfer(ctx context.Context, transfer models.TransferRequest) (models.Receipt, error)
+	// TransferBatch выполняет переводы по порядку в одной транзакции: либо все,
+	// либо ни одного. Каждый перевод проверяется по правилам Transfer с учетом
+	// предыдущих переводов пакета; ошибка возвращается как *BatchError
+	// с индексом перевода.
+	TransferBatch(ctx context.Context, transfers []models.TransferRequest) ([]models.Receipt, error)
+	GetTransaction(ctx context.Context, id int64) (models.Transaction, error)
+	// ListTransactions возвращает транзакции, подходящие под фильтр,
+	// от новых к старым (по убыванию ID).
+	ListTransactions(ctx context.Context, filter TransactionFilter) ([]models.Transaction, error)
+	// EachTransaction передает fn транзакции по фильтру в том же порядке, что
+	// ListTransactions, не загружая выборку в память целиком; Limit == 0 снимает
+	// ограничение. Ошибка fn прерывает обход и возвращается как есть.
+	EachTransaction(ctx context.Context, filter TransactionFilter, fn func(models.Transaction) error) error
+	// OutgoingSince считает переводы с кошелька address, созданные не раньше
+	// since. Возвраты и комиссии не учитываются.
+	OutgoingSince(ctx context.Context, address string, since time.Time) (Outgoing, error)
+	// Refund переводит amount обратно от получателя транзакции id к отправителю
+	// новой транзакцией с RefundOf = id. Сумма всех возвратов не превышает
+	// сумму исходной транзакции (ErrRefundExceedsAmount); возврат возврата
+	// и комиссии запрещен (ErrRefundOfRefund, ErrRefundOfFee), комиссия при
+	// возврате перевода не возвращается; если доступного баланса получателя
+	// не хватает — ErrRefundInsufficientFunds. amount задается в валюте
+	// отправителя исходной транзакции; при конвертации получатель возвращает
+	// сумму по курсу исходной транзакции (RefundDebit). SenderBalance
+	// квитанции — баланс получателя исходной транзакции.
+	Refund(ctx context.Context, id int64, amount money.Money) (models.Receipt, error)
+	// ListRefunds возвращает возвраты по транзакции id в порядке создания.
+	ListRefunds(ctx context.Context, id int64) ([]models.Transaction, error)
+
+	CreateWallet(ctx context.Context, wallet models.Wallet) error
+	GetWallet(ctx context.Context, address string) (models.Wallet, error)
+	// ListWallets возвращает кошельки, упорядоченные по дате создания.
+	ListWallets(ctx context.Context, limit, offset int) ([]models.Wallet, error)
+	// CloseWallet закрывает кошелек; закрыть можно только кошелек с нулевым балансом.
+	CloseWallet(ctx context.Context, address string) error
+
+	// CreateHold блокирует hold.Amount и комиссию hold.Fee на кошельке
+	// hold.Wallet до hold.ExpiresAt и возвращает блокировку с присвоенным ID.
+	// Сумма с комиссией должна быть доступна; кошелек назначения проверяется
+	// так же, как при переводе.
+	CreateHold(ctx context.Context, hold models.Hold) (models.Hold, error)
+	GetHold(ctx context.Context, id int64) (models.Hold, error)
+	// CaptureHold переводит amount (не больше суммы блокировки) на кошелек
+	// назначения, списывает непустую комиссию fee так же, как Transfer,
+	// и закрывает блокировку; остаток освобождается. Сумма с комиссией
+	// сверх резерва блокировки покрывается доступным балансом. Истекшую
+	// или уже закрытую блокировку списать нельзя — ErrHoldNotActive.
+	// Непустой check проверяет списание так же, как Check в Transfer.
+	CaptureHold(ctx context.Context, id int64, amount money.Money, fee *models.Fee, check models.LimitCheck) (models.Hold, error)
+	// VoidHold снимает активную блокировку без перевода.
+	VoidHold(ctx context.Context, id int64) (models.Hold, error)
+	// ExpireHolds помечает истекшими активные блокировки с ExpiresAt <= before.
+	ExpireHolds(ctx context.Context, before time.Time) (int64, error)
+
+	// CreateSchedule сохраняет запланированный перевод со статусом
+	// ScheduleActive и возвращает его с присвоенным ID. Оба кошелька должны
+	// существовать, быть открытыми и вести счет в валюте перевода.
+	CreateSchedule(ctx context.Context, schedule models.Schedule) (models.Schedule, error)
+	GetSchedule(ctx context.Context, id int64) (models.Schedule, error)
+	// CancelSchedule отменяет активный запланированный перевод.
+	CancelSchedule(ctx context.Context, id int64) (models.Schedule, error)
+	// DueSchedules возвращает до limit активных переводов с NextRunAt <= now
+	// в порядке NextRunAt.
+	DueSchedules(ctx context.Context, now time.Time, limit int) ([]models.Schedule, error)
+	// RecordScheduleRun сохраняет исход запуска и одновременно обновляет
+	// NextRunAt, Status и Attempts перевода schedule. Запуск записывается,
+	// только если перевод активен и его NextRunAt равен run.ScheduledAt,
+	// иначе — ErrScheduleNotDue: так каждое срабатывание записывается
+	// не больше одного раза, а отмененный во время запуска перевод остается
+	// отмененным.
+	RecordScheduleRun(ctx context.Context, schedule models.Schedule, run models.ScheduleRun) (models.ScheduleRun, error)
+	// ListScheduleRuns возвращает запуски перевода id в порядке выполнения.
+	ListScheduleRuns(ctx context.Context, id int64) ([]models.ScheduleRun, error)
+
+	// VerifyLedger сверяет балансы кошельков с суммами проводок
+	// и проверяет, что каждая запись журнала сбалансирована.
+	VerifyLedger(ctx context.Context) (models.LedgerReport, error)
+	// GetStatement возвращает остаток кошелька на момент from и проводки по нему
+	// за период from <= t < to в порядке записи в журнал; нулевые границы период
+	// не ограничивают. Заполняются OpeningBalance и у строк — EntryID, Kind,
+	// TransactionID, Counterparty, Amount и Timestamp; остатки рассчитывает вызывающий.
+	GetStatement(ctx context.Context, address string, from, to time.Time) (models.Statement, error)
+
+	// CreateIdempotencyKey резервирует ключ; если он уже существует — ErrIdempotencyKeyExists.
+	CreateIdempotencyKey(ctx context.Context, record models.IdempotencyRecord) error
+	GetIdempotencyKey(ctx context.Context, key string) (models.IdempotencyRecord, error)
+	// CompleteIdempotencyKey сохраняет ответ на запрос, выполненный с ключом.
+	CompleteIdempotencyKey(ctx context.Context, key string, status int, response []byte) error
+	DeleteIdempotencyKey(ctx context.Context, key string) error
+	// DeleteExpiredIdempotencyKeys удаляет ключи, истекшие до момента before.
+	DeleteExpiredIdempotencyKeys(ctx context.Context, before time.Time) (int64, error)
+
+	// CreateAPIKey сохраняет API-ключ с хешем hash и возвращает его
+	// с присвоенным ID.
+	CreateAPIKey(ctx context.Context, key models.APIKey, hash string) (models.APIKey, error)
+	GetAPIKey(ctx context.Context, id int64) (models.APIKey, error)
+	// GetAPIKeyByHash ищет ключ по хешу, в том числе отозванный.
+	GetAPIKeyByHash(ctx context.Context, hash string) (models.APIKey, error)
+	// ListAPIKeys возвращает все ключи в порядке выпуска.
+	ListAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	// RotateAPIKey заменяет хеш и префикс действующего ключа; прежнее значение
+	// ключа перестает действовать. Отозванный ключ — ErrAPIKeyRevoked.
+	RotateAPIKey(ctx context.Context, id int64, hash, prefix string, at time.Time) (models.APIKey, error)
+	// RevokeAPIKey отзывает ключ; повторный отзыв — ErrAPIKeyRevoked.
+	RevokeAPIKey(ctx context.Context, id int64, at time.Time) (models.APIKey, error)
 }
@@ -0,0 +1,1749 @@
+// Пакет storagetest содержит общий набор тестов поведения storage.Storage.
+//
+// Каждая реализация хранилища запускает его из своих тестов:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) storage.Storage {
+//			// создать и инициализировать пустое хранилище
+//		})
+//	}
+//
+// Так новые бэкенды проверяются по одному и тому же контракту.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"paymentSystem/internal/fx"
+	"paymentSystem/internal/models"
+	"paymentSystem/internal/money"
+	"paymentSystem/internal/storage"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+// Factory создает новое инициализированное хранилище для одного теста.
+// Освобождение ресурсов регистрируется через t.Cleanup.
+type Factory func(t *testing.T) storage.Storage
+
+// Run запускает набор тестов контракта против хранилища из фабрики.
+func Run(t *testing.T, newStorage Factory) {
+	suite.Run(t, &Suite{newStorage: newStorage})
+}
+
+// Suite — набор тестов контракта; запускается через Run.
+type Suite struct {
+	suite.Suite
+	newStorage Factory
+	storage    storage.Storage
+	ctx        context.Context
+}
+
+func (s *Suite) SetupTest() {
+	s.ctx = context.Background()
+	s.storage = s.newStorage(s.T())
+}
+
+// rub возвращает сумму в рублях, заданную в минимальных единицах (копейках).
+func rub(amount int64) money.Money {
+	return money.New(amount, "RUB")
+}
+
+func (s *Suite) createWallet(address string, balance money.Money) {
+	err := s.storage.CreateWallet(s.ctx, models.Wallet{Address: address, Balance: balance, CreatedAt: time.Now().UTC()})
+	s.Require().NoError(err)
+}
+
+func (s *Suite) transfer(from, to string, amount money.Money) error {
+	_, err := s.storage.Transfer(s.ctx, models.TransferRequest{From: from, To: to, Amount: amount})
+	return err
+}
+
+func (s *Suite) balance(address string) money.Money {
+	balance, err := s.storage.GetBalance(s.ctx, address)
+	s.Require().NoError(err)
+	return balance.Total
+}
+
+func (s *Suite) TestTransfer_Successful() {
+	// Arrange
+	s.createWallet("wallet-52", rub(10000))
+	s.createWallet("wallet-53", rub(10000))
+
+	// Act
+	receipt, err := s.storage.Transfer(s.ctx, models.TransferRequest{From: "wallet-52", To: "wallet-53", Amount: rub(5000)})
+
+	// Assert
+	s.Require().NoError(err)
+	assert.NotZero(s.T(), receipt.ID)
+	assert.Equal(s.T(), "wallet-52", receipt.From)
+	assert.Equal(s.T(), "wallet-53", receipt.To)
+	assert.Equal(s.T(), rub(5000), receipt.Amount)
+	assert.Equal(s.T(), rub(5000), receipt.SenderBalance)
+
+	assert.Equal(s.T(), rub(5000), s.balance("wallet-52"))
+	assert.Equal(s.T(), rub(15000), s.balance("wallet-53"))
+
+	// Проверяем запись транзакции
+	transactions, err := s.storage.ListTransactions(s.ctx, storage.TransactionFilter{Limit: 1})
+	s.Require().NoError(err)
+	s.Require().Len(transactions, 1)
+
+	tx := transactions[0]
+	assert.Equal(s.T(), receipt.ID, tx.ID)
+	assert.Equal(s.T(), "wallet-52", tx.From)
+	assert.Equal(s.T(), "wallet-53", tx.To)
+	assert.Equal(s.T(), rub(5000), tx.Amount)
+
+	// Транзакция доступна по ID из квитанции
+	byID, err := s.storage.GetTransaction(s.ctx, receipt.ID)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), tx, byID)
+}
+
+func (s *Suite) TestTransfer_InsufficientFunds() {
+	// Arrange
+	s.createWallet("sender", rub(10000))
+	s.createWallet("receiver", rub(10000))
+
+	// Act
+	err := s.transfer("sender", "receiver", rub(15000))
+
+	// Assert
+	assert.ErrorIs(s.T(), err, storage.ErrInsufficientFunds)
+
+	// Проверяем, что балансы не изменились
+	assert.Equal(s.T(), rub(10000), s.balance("sender"))
+	assert.Equal(s.T(), rub(10000), s.balance("receiver"))
+
+	// Проверяем отсутствие транзакций
+	transactions, err := s.storage.ListTransactions(s.ctx, storage.TransactionFilter{Limit: 10})
+	s.Require().NoError(err)
+	assert.Empty(s.T(), transactions)
+}
+
+func (s *Suite) TestTransfer_UnknownWallet() {
+	s.createWallet("valid-sender", rub(10000))
+	s.createWallet("valid-receiver", rub(10000))
+
+	testCases := []struct {
+		name string
+		from string
+		to   string
+	}{
+		{"Nonexistent sender", "invalid-sender", "valid-receiver"},
+		{"Nonexistent receiver", "valid-sender", "invalid-receiver"},
+	}
+
+	for _, tc := range testCases {
+		s.Run(tc.name, func() {
+			err := s.transfer(tc.from, tc.to, rub(5000))
+			assert.ErrorIs(s.T(), err, storage.ErrWalletNotFound)
+		})
+	}
+
+	assert.Equal(s.T(), rub(10000), s.balance("valid-sender"))
+	assert.Equal(s.T(), rub(10000), s.balance("valid-receiver"))
+}
+
+func (s *Suite) TestTransfer_CurrencyMismatch() {
+	s.createWallet("sender", rub(10000))
+	s.createWallet("receiver", rub(0))
+
+	err := s.transfer("sender", "receiver", money.New(100, "USD"))
+	assert.ErrorIs(s.T(), err, money.ErrCurrencyMismatch)
+}
+
+func (s *Suite) TestTransfer_ClosedWallet() {
+	s.createWallet("sender", rub(10000))
+	s.createWallet("closed", rub(0))
+	s.Require().NoError(s.storage.CloseWallet(s.ctx, "closed"))
+
+	assert.ErrorIs(s.T(), s.transfer("sender", "closed", rub(100)), storage.ErrWalletClosed)
+	assert.ErrorIs(s.T(), s.transfer("closed", "sender", rub(100)), storage.ErrWalletClosed)
+}
+
+// TestTransfer_ConcurrentAtomicity запускает встречные переводы параллельно
+// и проверяет, что деньги не создаются и не теряются, а баланс не уходит в минус.
+func (s *Suite) TestTransfer_ConcurrentAtomicity() {
+	s.createWallet("wallet-a", rub(1000))
+	s.createWallet("wallet-b", rub(1000))
+
+	const workers = 40
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < workers; i++ {
+		from, to := "wallet-a", "wallet-b"
+		if i%4 == 0 {
+			from, to = to, from
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.transfer(from, to, rub(150))
+			if err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+				return
+			}
+			assert.ErrorIs(s.T(), err, storage.ErrInsufficientFunds)
+		}()
+	}
+	wg.Wait()
+
+	a, b := s.balance("wallet-a"), s.balance("wallet-b")
+	assert.GreaterOrEqual(s.T(), a.Amount, int64(0))
+	assert.GreaterOrEqual(s.T(), b.Amount, int64(0))
+	assert.Equal(s.T(), int64(2000), a.Amount+b.Amount)
+
+	transactions, err := s.storage.ListTransactions(s.ctx, storage.TransactionFilter{Limit: workers * 2})
+	s.Require().NoError(err)
+	assert.Len(s.T(), transactions, succeeded)
+
+	report, err := s.storage.VerifyLedger(s.ctx)
+	s.Require().NoError(err)
+	assert.True(s.T(), report.OK(), "%+v", report)
+}
+
+// TestTransfer_ConcurrentNoOverdraft проверяет, что параллельные списания
+// с одного кошелька не уводят баланс в минус.
+func (s *Suite) TestTransfer_ConcurrentNoOverdraft() {
+	s.createWallet("sender", rub(1000))
+	s.createWallet("receiver", rub(0))
+
+	const workers = 20
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.transfer("sender", "receiver", rub(100)); err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(s.T(), 10, succeeded)
+	assert.Equal(s.T(), rub(0), s.balance("sender"))
+	assert.Equal(s.T(), rub(1000), s.balance("receiver"))
+}
+
+// TestTransfer_ConcurrentAllSucceed проверяет, что параллельные переводы,
+// на которые хватает средств, выполняются все, а не отклоняются из-за
+// конкуренции за базу.
+func (s *Suite) TestTransfer_ConcurrentAllSucceed() {
+	s.createWallet("sender", rub(100000))
+	s.createWallet("receiver", rub(0))
+
+	const workers = 50
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(s.T(), s.transfer("sender", "receiver", rub(100)))
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(s.T(), rub(95000), s.balance("sender"))
+	assert.Equal(s.T(), rub(5000), s.balance("receiver"))
+}
+
+// TestTransfer_CanceledContext проверяет, что отмененный запрос
+// не выполняет перевод и возвращает ошибку контекста.
+func (s *Suite) TestTransfer_CanceledContext() {
+	s.createWallet("sender", rub(1000))
+	s.createWallet("receiver", rub(0))
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	cancel()
+
+	_, err := s.storage.Transfer(ctx, models.TransferRequest{From: "sender", To: "receiver", Amount: rub(100)})
+	assert.ErrorIs(s.T(), err, context.Canceled)
+
+	_, err = s.storage.ListTransactions(ctx, storage.TransactionFilter{Limit: 10})
+	assert.ErrorIs(s.T(), err, context.Canceled)
+
+	assert.Equal(s.T(), rub(1000), s.balance("sender"))
+	assert.Equal(s.T(), rub(0), s.balance("receiver"))
+}
+
+func (s *Suite) TestGetBalance_WalletNotFound() {
+	// Act
+	balance, err := s.storage.GetBalance(s.ctx, "nonexistent-wallet")
+
+	// Assert
+	assert.ErrorIs(s.T(), err, storage.ErrWalletNotFound)
+	assert.Zero(s.T(), balance)
+}
+
+func (s *Suite) TestGetTransaction_NotFound() {
+	_, err := s.storage.GetTransaction(s.ctx, 12345)
+	assert.ErrorIs(s.T(), err, storage.ErrTransactionNotFound)
+}
+
+func (s *Suite) TestListTransactions_Ordering() {
+	// Arrange
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(10000))
+	s.createWallet("wallet-c", rub(10000))
+
+	s.Require().NoError(s.transfer("wallet-a", "wallet-b", rub(1000)))
+	s.Require().NoError(s.transfer("wallet-b", "wallet-c", rub(2000)))
+	s.Require().NoError(s.transfer("wallet-c", "wallet-a", rub(500)))
+
+	// Act
+	transactions, err := s.storage.ListTransactions(s.ctx, storage.TransactionFilter{Limit: 2})
+
+	// Assert
+	s.Require().NoError(err)
+	s.Require().Len(transactions, 2)
+
+	// Проверяем порядок (последние транзакции должны быть первыми)
+	assert.Equal(s.T(), "wallet-c", transactions[0].From)
+	assert.Equal(s.T(), "wallet-a", transactions[0].To)
+	assert.Equal(s.T(), rub(500), transactions[0].Amount)
+
+	assert.Equal(s.T(), "wallet-b", transactions[1].From)
+	assert.Equal(s.T(), "wallet-c", transactions[1].To)
+	assert.Equal(s.T(), rub(2000), transactions[1].Amount)
+
+	assert.Greater(s.T(), transactions[0].ID, transactions[1].ID)
+}
+
+func (s *Suite) TestListTransactions_MoreThanExist() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(10000))
+	s.Require().NoError(s.transfer("wallet-a", "wallet-b", rub(1000)))
+
+	transactions, err := s.storage.ListTransactions(s.ctx, storage.TransactionFilter{Limit: 10})
+
+	s.Require().NoError(err)
+	assert.Len(s.T(), transactions, 1)
+}
+
+func (s *Suite) TestListTransactions_Empty() {
+	transactions, err := s.storage.ListTransactions(s.ctx, storage.TransactionFilter{Limit: 5})
+
+	s.Require().NoError(err)
+	assert.Empty(s.T(), transactions)
+}
+
+func (s *Suite) TestListTransactions_CursorPagination() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(10000))
+	for i := 1; i <= 5; i++ {
+		s.Require().NoError(s.transfer("wallet-a", "wallet-b", rub(int64(i*100))))
+	}
+
+	// Листаем по две транзакции, передавая ID последней как курсор
+	var amounts []int64
+	var beforeID int64
+	for page := 0; page < 10; page++ {
+		transactions, err := s.storage.ListTransactions(s.ctx, storage.TransactionFilter{BeforeID: beforeID, Limit: 2})
+		s.Require().NoError(err)
+		if len(transactions) == 0 {
+			break
+		}
+		for _, tx := range transactions {
+			amounts = append(amounts, tx.Amount.Amount)
+		}
+		beforeID = transactions[len(transactions)-1].ID
+	}
+
+	assert.Equal(s.T(), []int64{500, 400, 300, 200, 100}, amounts)
+}
+
+func (s *Suite) TestListTransactions_WalletAndDirection() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(10000))
+	s.createWallet("wallet-c", rub(10000))
+
+	s.Require().NoError(s.transfer("wallet-a", "wallet-b", rub(100)))
+	s.Require().NoError(s.transfer("wallet-b", "wallet-c", rub(200)))
+	s.Require().NoError(s.transfer("wallet-c", "wallet-a", rub(300)))
+
+	list := func(filter storage.TransactionFilter) []int64 {
+		filter.Limit = 10
+		transactions, err := s.storage.ListTransactions(s.ctx, filter)
+		s.Require().NoError(err)
+		var amounts []int64
+		for _, tx := range transactions {
+			amounts = append(amounts, tx.Amount.Amount)
+		}
+		return amounts
+	}
+
+	assert.Equal(s.T(), []int64{300, 100}, list(storage.TransactionFilter{Wallet: "wallet-a"}))
+	assert.Equal(s.T(), []int64{300}, list(storage.TransactionFilter{Wallet: "wallet-a", Direction: storage.DirectionIn}))
+	assert.Equal(s.T(), []int64{100}, list(storage.TransactionFilter{Wallet: "wallet-a", Direction: storage.DirectionOut}))
+	assert.Empty(s.T(), list(storage.TransactionFilter{Wallet: "unknown"}))
+}
+
+func (s *Suite) TestListTransactions_AmountAndTime() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(10000))
+
+	s.Require().NoError(s.transfer("wallet-a", "wallet-b", rub(100)))
+	s.Require().NoError(s.transfer("wallet-a", "wallet-b", rub(200)))
+	s.Require().NoError(s.transfer("wallet-a", "wallet-b", rub(300)))
+
+	transactions, err := s.storage.ListTransactions(s.ctx, storage.TransactionFilter{
+		Currency: "RUB", MinAmount: 150, MaxAmount: 300, Limit: 10,
+	})
+	s.Require().NoError(err)
+	s.Require().Len(transactions, 2)
+	assert.Equal(s.T(), rub(300), transactions[0].Amount)
+	assert.Equal(s.T(), rub(200), transactions[1].Amount)
+
+	transactions, err = s.storage.ListTransactions(s.ctx, storage.TransactionFilter{Currency: "USD", Limit: 10})
+	s.Require().NoError(err)
+	assert.Empty(s.T(), transactions)
+
+	now := time.Now()
+	transactions, err = s.storage.ListTransactions(s.ctx, storage.TransactionFilter{
+		FromTime: now.Add(-time.Hour), ToTime: now.Add(time.Hour), Limit: 10,
+	})
+	s.Require().NoError(err)
+	assert.Len(s.T(), transactions, 3)
+
+	transactions, err = s.storage.ListTransactions(s.ctx, storage.TransactionFilter{FromTime: now.Add(time.Hour), Limit: 10})
+	s.Require().NoError(err)
+	assert.Empty(s.T(), transactions)
+
+	transactions, err = s.storage.ListTransactions(s.ctx, storage.TransactionFilter{ToTime: now.Add(-time.Hour), Limit: 10})
+	s.Require().NoError(err)
+	assert.Empty(s.T(), transactions)
+}
+
+func (s *Suite) TestEachTransaction() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(10000))
+	for i := 1; i <= 3; i++ {
+		s.Require().NoError(s.transfer("wallet-a", "wallet-b", rub(int64(i*100))))
+	}
+
+	// Без лимита обходятся все транзакции в порядке ListTransactions
+	var amounts []int64
+	err := s.storage.EachTransaction(s.ctx, storage.TransactionFilter{Wallet: "wallet-b"}, func(tx models.Transaction) error {
+		amounts = append(amounts, tx.Amount.Amount)
+		return nil
+	})
+	s.Require().NoError(err)
+	assert.Equal(s.T(), []int64{300, 200, 100}, amounts)
+
+	// Ошибка обработчика прерывает обход
+	errStop := fmt.Errorf("stop")
+	calls := 0
+	err = s.storage.EachTransaction(s.ctx, storage.TransactionFilter{}, func(models.Transaction) error {
+		calls++
+		return errStop
+	})
+	assert.ErrorIs(s.T(), err, errStop)
+	assert.Equal(s.T(), 1, calls)
+}
+
+func (s *Suite) TestOutgoingSince() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(10000))
+	s.createWallet("fees", rub(0))
+
+	s.Require().NoError(s.transfer("wallet-a", "wallet-b", rub(100)))
+	receipt, err := s.storage.Transfer(s.ctx, models.TransferRequest{
+		From: "wallet-a", To: "wallet-b", Amount: rub(200),
+		Fee: &models.Fee{Wallet: "fees", Amount: rub(10)},
+	})
+	s.Require().NoError(err)
+	s.Require().NoError(s.transfer("wallet-b", "wallet-a", rub(400)))
+	_, err = s.storage.Refund(s.ctx, receipt.ID, rub(50))
+	s.Require().NoError(err)
+
+	// входящие переводы, возвраты и комиссии не учитываются
+	out, err := s.storage.OutgoingSince(s.ctx, "wallet-a", time.Now().Add(-time.Hour))
+	s.Require().NoError(err)
+	assert.Equal(s.T(), storage.Outgoing{Count: 2, Amount: 300}, out)
+
+	out, err = s.storage.OutgoingSince(s.ctx, "wallet-a", time.Now().Add(time.Hour))
+	s.Require().NoError(err)
+	assert.Equal(s.T(), storage.Outgoing{}, out)
+
+	out, err = s.storage.OutgoingSince(s.ctx, "unknown", time.Time{})
+	s.Require().NoError(err)
+	assert.Equal(s.T(), storage.Outgoing{}, out)
+}
+
+// errLimit — отказ проверки ограничений в тестах
+var errLimit = errors.New("limit exceeded")
+
+// outgoingLimit возвращает проверку, как у сервиса: за последний час
+// с отправителя переводится не больше max вместе с amount.
+func outgoingLimit(max int64, amount money.Money) models.LimitCheck {
+	return func(outgoing func(since time.Time) (storage.Outgoing, error)) error {
+		out, err := outgoing(time.Now().Add(-time.Hour))
+		if err != nil {
+			return err
+		}
+		if out.Amount+amount.Amount > max {
+			return errLimit
+		}
+		return nil
+	}
+}
+
+// limitedTransfer — перевод с проверкой outgoingLimit
+func limitedTransfer(from, to string, amount money.Money, max int64) models.TransferRequest {
+	return models.TransferRequest{From: from, To: to, Amount: amount, Check: outgoingLimit(max, amount)}
+}
+
+// TestTransfer_LimitCheck проверяет, что проверка ограничений видит историю
+// отправителя без комиссий, а ее отказ отменяет перевод.
+func (s *Suite) TestTransfer_LimitCheck() {
+	s.createWallet("sender", rub(10000))
+	s.createWallet("receiver", rub(0))
+	s.createWallet("fees", rub(0))
+
+	first := limitedTransfer("sender", "receiver", rub(600), 1000)
+	first.Fee = &models.Fee{Wallet: "fees", Amount: rub(100)}
+	_, err := s.storage.Transfer(s.ctx, first)
+	s.Require().NoError(err)
+
+	_, err = s.storage.Transfer(s.ctx, limitedTransfer("sender", "receiver", rub(401), 1000))
+	assert.ErrorIs(s.T(), err, errLimit)
+	assert.Equal(s.T(), rub(9300), s.balance("sender"))
+
+	_, err = s.storage.Transfer(s.ctx, limitedTransfer("sender", "receiver", rub(400), 1000))
+	s.Require().NoError(err)
+	assert.Equal(s.T(), rub(1000), s.balance("receiver"))
+}
+
+// TestTransferBatch_LimitCheckSeesEarlierTransfers проверяет, что проверка
+// перевода пакета учитывает предыдущие переводы того же пакета.
+func (s *Suite) TestTransferBatch_LimitCheckSeesEarlierTransfers() {
+	s.createWallet("sender", rub(10000))
+	s.createWallet("other", rub(10000))
+	s.createWallet("receiver", rub(0))
+
+	_, err := s.storage.TransferBatch(s.ctx, []models.TransferRequest{
+		limitedTransfer("sender", "receiver", rub(600), 1000),
+		limitedTransfer("other", "receiver", rub(600), 1000),
+		limitedTransfer("sender", "receiver", rub(600), 1000),
+	})
+
+	var batchErr *storage.BatchError
+	s.Require().ErrorAs(err, &batchErr)
+	assert.Equal(s.T(), 2, batchErr.Index)
+	assert.ErrorIs(s.T(), err, errLimit)
+	assert.Equal(s.T(), rub(10000), s.balance("sender"))
+	assert.Equal(s.T(), rub(0), s.balance("receiver"))
+}
+
+// TestTransfer_ConcurrentLimitCheck проверяет, что одновременные переводы
+// одного отправителя проверяются по очереди и вместе не превышают лимит.
+func (s *Suite) TestTransfer_ConcurrentLimitCheck() {
+	s.createWallet("sender", rub(10000))
+	s.createWallet("receiver", rub(0))
+
+	const workers = 10
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.storage.Transfer(s.ctx, limitedTransfer("sender", "receiver", rub(600), 1000))
+			if err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+				return
+			}
+			assert.ErrorIs(s.T(), err, errLimit)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(s.T(), 1, succeeded)
+	assert.Equal(s.T(), rub(600), s.balance("receiver"))
+}
+
+func (s *Suite) TestCreateAndGetWallet() {
+	wallet := models.Wallet{
+		Address:   "new-wallet",
+		Balance:   rub(0),
+		Owner:     "alice",
+		Label:     "savings",
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	s.Require().NoError(s.storage.CreateWallet(s.ctx, wallet))
+
+	got, err := s.storage.GetWallet(s.ctx, "new-wallet")
+	s.Require().NoError(err)
+	assert.Equal(s.T(), wallet.Address, got.Address)
+	assert.Equal(s.T(), wallet.Balance, got.Balance)
+	assert.Equal(s.T(), "alice", got.Owner)
+	assert.Equal(s.T(), "savings", got.Label)
+	assert.True(s.T(), wallet.CreatedAt.Equal(got.CreatedAt))
+	assert.Nil(s.T(), got.ClosedAt)
+
+	assert.ErrorIs(s.T(), s.storage.CreateWallet(s.ctx, wallet), storage.ErrWalletExists)
+
+	_, err = s.storage.GetWallet(s.ctx, "missing")
+	assert.ErrorIs(s.T(), err, storage.ErrWalletNotFound)
+}
+
+func (s *Suite) TestListWallets_Pagination() {
+	base := time.Now().UTC().Add(time.Hour)
+	for i := 0; i < 5; i++ {
+		err := s.storage.CreateWallet(s.ctx, models.Wallet{
+			Address:   fmt.Sprintf("page-%d", i),
+			Balance:   rub(0),
+			CreatedAt: base.Add(time.Duration(i) * time.Second),
+		})
+		s.Require().NoError(err)
+	}
+
+	all, err := s.storage.ListWallets(s.ctx, 1000, 0)
+	s.Require().NoError(err)
+	total := len(all)
+	s.Require().GreaterOrEqual(total, 5)
+
+	var paged []models.Wallet
+	for offset := 0; offset < total; offset += 3 {
+		page, err := s.storage.ListWallets(s.ctx, 3, offset)
+		s.Require().NoError(err)
+		paged = append(paged, page...)
+	}
+	s.Require().Len(paged, total)
+
+	seen := map[string]bool{}
+	for _, w := range paged {
+		assert.False(s.T(), seen[w.Address], "duplicate wallet %s", w.Address)
+		seen[w.Address] = true
+	}
+
+	// Созданные последними кошельки идут в конце в порядке создания
+	for i := 0; i < 5; i++ {
+		assert.Equal(s.T(), fmt.Sprintf("page-%d", i), all[total-5+i].Address)
+	}
+}
+
+func (s *Suite) TestCloseWallet() {
+	s.createWallet("empty", rub(0))
+	s.createWallet("funded", rub(100))
+
+	assert.ErrorIs(s.T(), s.storage.CloseWallet(s.ctx, "funded"), storage.ErrWalletNotEmpty)
+	assert.ErrorIs(s.T(), s.storage.CloseWallet(s.ctx, "missing"), storage.ErrWalletNotFound)
+
+	s.Require().NoError(s.storage.CloseWallet(s.ctx, "empty"))
+	wallet, err := s.storage.GetWallet(s.ctx, "empty")
+	s.Require().NoError(err)
+	assert.NotNil(s.T(), wallet.ClosedAt)
+
+	assert.ErrorIs(s.T(), s.storage.CloseWallet(s.ctx, "empty"), storage.ErrWalletClosed)
+}
+
+func (s *Suite) TestIdempotencyKeys() {
+	now := time.Now().UTC()
+	record := models.IdempotencyRecord{
+		Key:         "key-1",
+		Fingerprint: "fp",
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(time.Hour),
+	}
+	s.Require().NoError(s.storage.CreateIdempotencyKey(s.ctx, record))
+	assert.ErrorIs(s.T(), s.storage.CreateIdempotencyKey(s.ctx, record), storage.ErrIdempotencyKeyExists)
+
+	s.Require().NoError(s.storage.CompleteIdempotencyKey(s.ctx, "key-1", 200, []byte(`{"status":"success"}`)))
+
+	got, err := s.storage.GetIdempotencyKey(s.ctx, "key-1")
+	s.Require().NoError(err)
+	assert.Equal(s.T(), "fp", got.Fingerprint)
+	assert.Equal(s.T(), 200, got.Status)
+	assert.JSONEq(s.T(), `{"status":"success"}`, string(got.Response))
+
+	_, err = s.storage.GetIdempotencyKey(s.ctx, "missing")
+	assert.ErrorIs(s.T(), err, storage.ErrIdempotencyKeyNotFound)
+
+	expired := record
+	expired.Key = "key-2"
+	expired.ExpiresAt = now.Add(-time.Minute)
+	s.Require().NoError(s.storage.CreateIdempotencyKey(s.ctx, expired))
+
+	n, err := s.storage.DeleteExpiredIdempotencyKeys(s.ctx, now)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), int64(1), n)
+
+	_, err = s.storage.GetIdempotencyKey(s.ctx, "key-2")
+	assert.ErrorIs(s.T(), err, storage.ErrIdempotencyKeyNotFound)
+	_, err = s.storage.GetIdempotencyKey(s.ctx, "key-1")
+	assert.NoError(s.T(), err)
+
+	s.Require().NoError(s.storage.DeleteIdempotencyKey(s.ctx, "key-1"))
+	_, err = s.storage.GetIdempotencyKey(s.ctx, "key-1")
+	assert.ErrorIs(s.T(), err, storage.ErrIdempotencyKeyNotFound)
+}
+
+func (s *Suite) TestVerifyLedger_Consistent() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	s.Require().NoError(s.transfer("wallet-a", "wallet-b", rub(2550)))
+	s.Require().NoError(s.transfer("wallet-b", "wallet-a", rub(50)))
+
+	report, err := s.storage.VerifyLedger(s.ctx)
+	s.Require().NoError(err)
+	assert.True(s.T(), report.OK(), "%+v", report)
+	assert.GreaterOrEqual(s.T(), report.WalletsChecked, 2)
+}
+
+func (s *Suite) TestGetStatement() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	s.Require().NoError(s.transfer("wallet-a", "wallet-b", rub(2500)))
+	s.Require().NoError(s.transfer("wallet-b", "wallet-a", rub(500)))
+
+	statement, err := s.storage.GetStatement(s.ctx, "wallet-a", time.Time{}, time.Time{})
+	s.Require().NoError(err)
+	assert.Equal(s.T(), "wallet-a", statement.Address)
+	assert.Equal(s.T(), rub(0), statement.OpeningBalance)
+	s.Require().Len(statement.Lines, 3)
+
+	opening, out, in := statement.Lines[0], statement.Lines[1], statement.Lines[2]
+	assert.Equal(s.T(), storage.EntryOpening, opening.Kind)
+	assert.Equal(s.T(), storage.EquityAccount, opening.Counterparty)
+	assert.Equal(s.T(), rub(10000), opening.Amount)
+	assert.Nil(s.T(), opening.TransactionID)
+
+	assert.Equal(s.T(), storage.EntryTransfer, out.Kind)
+	assert.Equal(s.T(), "wallet-b", out.Counterparty)
+	assert.Equal(s.T(), rub(-2500), out.Amount)
+	s.Require().NotNil(out.TransactionID)
+	assert.Less(s.T(), opening.EntryID, out.EntryID)
+
+	assert.Equal(s.T(), "wallet-b", in.Counterparty)
+	assert.Equal(s.T(), rub(500), in.Amount)
+	assert.False(s.T(), in.Timestamp.IsZero())
+
+	// Период в будущем: все проводки уходят в остаток на начало
+	future := time.Now().Add(time.Hour)
+	statement, err = s.storage.GetStatement(s.ctx, "wallet-a", future, future.Add(time.Hour))
+	s.Require().NoError(err)
+	assert.Equal(s.T(), rub(8000), statement.OpeningBalance)
+	assert.Empty(s.T(), statement.Lines)
+
+	// Период в прошлом: проводок еще нет
+	past := time.Now().Add(-time.Hour)
+	statement, err = s.storage.GetStatement(s.ctx, "wallet-a", time.Time{}, past)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), rub(0), statement.OpeningBalance)
+	assert.Empty(s.T(), statement.Lines)
+}
+
+func (s *Suite) TestGetStatement_WalletNotFound() {
+	_, err := s.storage.GetStatement(s.ctx, "nonexistent-wallet", time.Time{}, time.Time{})
+	assert.ErrorIs(s.T(), err, storage.ErrWalletNotFound)
+}
+
+func (s *Suite) createHold(wallet, destination string, amount money.Money, ttl time.Duration) models.Hold {
+	now := time.Now().UTC()
+	hold, err := s.storage.CreateHold(s.ctx, models.Hold{
+		Wallet:      wallet,
+		Destination: destination,
+		Amount:      amount,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+	})
+	s.Require().NoError(err)
+	return hold
+}
+
+func (s *Suite) TestCreateHold_ReducesAvailableBalance() {
+	// Arrange
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+
+	// Act
+	hold := s.createHold("wallet-a", "wallet-b", rub(3000), time.Hour)
+
+	// Assert
+	assert.NotZero(s.T(), hold.ID)
+	assert.Equal(s.T(), storage.HoldActive, hold.Status)
+	assert.Equal(s.T(), rub(0), hold.CapturedAmount)
+
+	balance, err := s.storage.GetBalance(s.ctx, "wallet-a")
+	s.Require().NoError(err)
+	assert.Equal(s.T(), rub(10000), balance.Total)
+	assert.Equal(s.T(), rub(7000), balance.Available)
+
+	got, err := s.storage.GetHold(s.ctx, hold.ID)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), hold.Amount, got.Amount)
+	assert.Equal(s.T(), "wallet-b", got.Destination)
+	assert.Nil(s.T(), got.TransactionID)
+
+	// Перевод и новая блокировка видят только доступный баланс
+	assert.ErrorIs(s.T(), s.transfer("wallet-a", "wallet-b", rub(7001)), storage.ErrInsufficientFunds)
+	_, err = s.storage.CreateHold(s.ctx, models.Hold{
+		Wallet: "wallet-a", Destination: "wallet-b", Amount: rub(7001),
+		CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour),
+	})
+	assert.ErrorIs(s.T(), err, storage.ErrInsufficientFunds)
+	s.Require().NoError(s.transfer("wallet-a", "wallet-b", rub(7000)))
+}
+
+func (s *Suite) TestCreateHold_Errors() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-usd", money.New(0, "USD"))
+
+	create := func(destination string, amount money.Money) error {
+		_, err := s.storage.CreateHold(s.ctx, models.Hold{
+			Wallet: "wallet-a", Destination: destination, Amount: amount,
+			CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour),
+		})
+		return err
+	}
+	assert.ErrorIs(s.T(), create("nonexistent-wallet", rub(100)), storage.ErrWalletNotFound)
+	assert.ErrorIs(s.T(), create("wallet-usd", rub(100)), money.ErrCurrencyMismatch)
+	assert.ErrorIs(s.T(), create("wallet-a", money.New(100, "USD")), money.ErrCurrencyMismatch)
+
+	_, err := s.storage.GetHold(s.ctx, 12345)
+	assert.ErrorIs(s.T(), err, storage.ErrHoldNotFound)
+}
+
+func (s *Suite) TestCaptureHold_Partial() {
+	// Arrange
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	hold := s.createHold("wallet-a", "wallet-b", rub(3000), time.Hour)
+
+	// Act
+	captured, err := s.storage.CaptureHold(s.ctx, hold.ID, rub(2000), nil, nil)
+
+	// Assert
+	s.Require().NoError(err)
+	assert.Equal(s.T(), storage.HoldCaptured, captured.Status)
+	assert.Equal(s.T(), rub(2000), captured.CapturedAmount)
+	s.Require().NotNil(captured.TransactionID)
+
+	tx, err := s.storage.GetTransaction(s.ctx, *captured.TransactionID)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), "wallet-a", tx.From)
+	assert.Equal(s.T(), "wallet-b", tx.To)
+	assert.Equal(s.T(), rub(2000), tx.Amount)
+
+	// Остаток блокировки освобождается
+	balance, err := s.storage.GetBalance(s.ctx, "wallet-a")
+	s.Require().NoError(err)
+	assert.Equal(s.T(), rub(8000), balance.Total)
+	assert.Equal(s.T(), rub(8000), balance.Available)
+	assert.Equal(s.T(), rub(2000), s.balance("wallet-b"))
+
+	got, err := s.storage.GetHold(s.ctx, hold.ID)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), captured, got)
+
+	// Повторное списание невозможно
+	_, err = s.storage.CaptureHold(s.ctx, hold.ID, rub(1000), nil, nil)
+	assert.ErrorIs(s.T(), err, storage.ErrHoldNotActive)
+
+	report, err := s.storage.VerifyLedger(s.ctx)
+	s.Require().NoError(err)
+	assert.True(s.T(), report.OK(), "%+v", report)
+}
+
+func (s *Suite) TestCaptureHold_ExceedsHold() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	hold := s.createHold("wallet-a", "wallet-b", rub(3000), time.Hour)
+
+	_, err := s.storage.CaptureHold(s.ctx, hold.ID, rub(3001), nil, nil)
+	assert.ErrorIs(s.T(), err, storage.ErrCaptureExceedsHold)
+	_, err = s.storage.CaptureHold(s.ctx, hold.ID, money.New(3000, "USD"), nil, nil)
+	assert.ErrorIs(s.T(), err, money.ErrCurrencyMismatch)
+	_, err = s.storage.CaptureHold(s.ctx, 12345, rub(1), nil, nil)
+	assert.ErrorIs(s.T(), err, storage.ErrHoldNotFound)
+
+	// Неудачные попытки не меняют блокировку
+	captured, err := s.storage.CaptureHold(s.ctx, hold.ID, rub(3000), nil, nil)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), rub(3000), captured.CapturedAmount)
+	assert.Equal(s.T(), rub(7000), s.balance("wallet-a"))
+}
+
+func (s *Suite) TestCaptureHold_WithFee() {
+	// Arrange
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	s.createWallet("fees", rub(0))
+	now := time.Now().UTC()
+	hold, err := s.storage.CreateHold(s.ctx, models.Hold{
+		Wallet: "wallet-a", Destination: "wallet-b", Amount: rub(3000), Fee: rub(100),
+		CreatedAt: now, ExpiresAt: now.Add(time.Hour),
+	})
+	s.Require().NoError(err)
+	assert.Equal(s.T(), rub(100), hold.Fee)
+
+	// Блокировка резервирует сумму вместе с комиссией
+	balance, err := s.storage.GetBalance(s.ctx, "wallet-a")
+	s.Require().NoError(err)
+	assert.Equal(s.T(), rub(6900), balance.Available)
+	assert.ErrorIs(s.T(), s.transfer("wallet-a", "wallet-b", rub(6901)), storage.ErrInsufficientFunds)
+
+	// Act
+	captured, err := s.storage.CaptureHold(s.ctx, hold.ID, rub(2000), &models.Fee{Wallet: "fees", Amount: rub(80)}, nil)
+
+	// Assert
+	s.Require().NoError(err)
+	assert.Equal(s.T(), rub(2000), captured.CapturedAmount)
+	assert.Equal(s.T(), rub(80), captured.Fee)
+	assert.Equal(s.T(), rub(7920), s.balance("wallet-a"))
+	assert.Equal(s.T(), rub(2000), s.balance("wallet-b"))
+	assert.Equal(s.T(), rub(80), s.balance("fees"))
+
+	balance, err = s.storage.GetBalance(s.ctx, "wallet-a")
+	s.Require().NoError(err)
+	assert.Equal(s.T(), rub(7920), balance.Available)
+
+	statement, err := s.storage.GetStatement(s.ctx, "fees", time.Time{}, time.Time{})
+	s.Require().NoError(err)
+	s.Require().Len(statement.Lines, 1)
+	s.Require().NotNil(statement.Lines[0].TransactionID)
+	feeTx, err := s.storage.GetTransaction(s.ctx, *statement.Lines[0].TransactionID)
+	s.Require().NoError(err)
+	s.Require().NotNil(feeTx.FeeOf)
+	assert.Equal(s.T(), *captured.TransactionID, *feeTx.FeeOf)
+
+	got, err := s.storage.GetHold(s.ctx, hold.ID)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), captured, got)
+
+	report, err := s.storage.VerifyLedger(s.ctx)
+	s.Require().NoError(err)
+	assert.True(s.T(), report.OK(), "%+v", report)
+}
+
+func (s *Suite) TestCaptureHold_FeeBeyondReserve() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	s.createWallet("fees", rub(0))
+	hold := s.createHold("wallet-a", "wallet-b", rub(3000), time.Hour)
+	s.Require().NoError(s.transfer("wallet-a", "wallet-b", rub(7000)))
+
+	// комиссия не зарезервирована, а доступного баланса не осталось
+	_, err := s.storage.CaptureHold(s.ctx, hold.ID, rub(3000), &models.Fee{Wallet: "fees", Amount: rub(1)}, nil)
+	assert.ErrorIs(s.T(), err, storage.ErrInsufficientFunds)
+	_, err = s.storage.CaptureHold(s.ctx, hold.ID, rub(2999), &models.Fee{Wallet: "nonexistent-wallet", Amount: rub(1)}, nil)
+	assert.ErrorIs(s.T(), err, storage.ErrFeeWallet)
+
+	// сумма с комиссией укладывается в резерв
+	captured, err := s.storage.CaptureHold(s.ctx, hold.ID, rub(2999), &models.Fee{Wallet: "fees", Amount: rub(1)}, nil)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), rub(1), captured.Fee)
+	assert.Equal(s.T(), rub(0), s.balance("wallet-a"))
+	assert.Equal(s.T(), rub(1), s.balance("fees"))
+}
+
+func (s *Suite) TestCaptureHold_LimitCheck() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	s.Require().NoError(s.transfer("wallet-a", "wallet-b", rub(600)))
+	hold := s.createHold("wallet-a", "wallet-b", rub(3000), time.Hour)
+
+	_, err := s.storage.CaptureHold(s.ctx, hold.ID, rub(500), nil, outgoingLimit(1000, rub(500)))
+	assert.ErrorIs(s.T(), err, errLimit)
+	got, err := s.storage.GetHold(s.ctx, hold.ID)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), storage.HoldActive, got.Status)
+
+	captured, err := s.storage.CaptureHold(s.ctx, hold.ID, rub(400), nil, outgoingLimit(1000, rub(400)))
+	s.Require().NoError(err)
+	assert.Equal(s.T(), storage.HoldCaptured, captured.Status)
+	assert.Equal(s.T(), rub(1000), s.balance("wallet-b"))
+}
+
+func (s *Suite) TestVoidHold() {
+	// Arrange
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	hold := s.createHold("wallet-a", "wallet-b", rub(3000), time.Hour)
+
+	// Act
+	voided, err := s.storage.VoidHold(s.ctx, hold.ID)
+
+	// Assert
+	s.Require().NoError(err)
+	assert.Equal(s.T(), storage.HoldVoided, voided.Status)
+
+	balance, err := s.storage.GetBalance(s.ctx, "wallet-a")
+	s.Require().NoError(err)
+	assert.Equal(s.T(), rub(10000), balance.Available)
+
+	_, err = s.storage.VoidHold(s.ctx, hold.ID)
+	assert.ErrorIs(s.T(), err, storage.ErrHoldNotActive)
+	_, err = s.storage.CaptureHold(s.ctx, hold.ID, rub(3000), nil, nil)
+	assert.ErrorIs(s.T(), err, storage.ErrHoldNotActive)
+}
+
+func (s *Suite) TestExpireHolds() {
+	// Arrange
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	stale := s.createHold("wallet-a", "wallet-b", rub(1000), time.Millisecond)
+	fresh := s.createHold("wallet-a", "wallet-b", rub(2000), time.Hour)
+	time.Sleep(5 * time.Millisecond)
+
+	// Истекшая блокировка не уменьшает доступный баланс еще до ExpireHolds
+	balance, err := s.storage.GetBalance(s.ctx, "wallet-a")
+	s.Require().NoError(err)
+	assert.Equal(s.T(), rub(8000), balance.Available)
+	_, err = s.storage.CaptureHold(s.ctx, stale.ID, rub(1000), nil, nil)
+	assert.ErrorIs(s.T(), err, storage.ErrHoldNotActive)
+
+	// Act
+	n, err := s.storage.ExpireHolds(s.ctx, time.Now())
+
+	// Assert
+	s.Require().NoError(err)
+	assert.Equal(s.T(), int64(1), n)
+
+	got, err := s.storage.GetHold(s.ctx, stale.ID)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), storage.HoldExpired, got.Status)
+	got, err = s.storage.GetHold(s.ctx, fresh.ID)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), storage.HoldActive, got.Status)
+
+	n, err = s.storage.ExpireHolds(s.ctx, time.Now())
+	s.Require().NoError(err)
+	assert.Zero(s.T(), n)
+}
+
+func (s *Suite) TestCaptureHold_ConcurrentWithTransfer() {
+	// Блокировка и перевод конкурируют за одни и те же средства:
+	// после всех операций баланс не уходит в минус
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	hold := s.createHold("wallet-a", "wallet-b", rub(6000), time.Hour)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, _ = s.storage.CaptureHold(s.ctx, hold.ID, rub(6000), nil, nil)
+	}()
+	go func() {
+		defer wg.Done()
+		_ = s.transfer("wallet-a", "wallet-b", rub(6000))
+	}()
+	wg.Wait()
+
+	assert.Equal(s.T(), rub(4000), s.balance("wallet-a"))
+	assert.Equal(s.T(), rub(6000), s.balance("wallet-b"))
+}
+
+func (s *Suite) TestRefund_PartialAndFull() {
+	// Arrange
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	receipt, err := s.storage.Transfer(s.ctx, models.TransferRequest{From: "wallet-a", To: "wallet-b", Amount: rub(3000)})
+	s.Require().NoError(err)
+	id := receipt.ID
+
+	// Act
+	first, err := s.storage.Refund(s.ctx, id, rub(1000))
+	s.Require().NoError(err)
+	second, err := s.storage.Refund(s.ctx, id, rub(2000))
+	s.Require().NoError(err)
+
+	// Assert
+	assert.Equal(s.T(), "wallet-b", first.From)
+	assert.Equal(s.T(), "wallet-a", first.To)
+	s.Require().NotNil(first.RefundOf)
+	assert.Equal(s.T(), id, *first.RefundOf)
+	assert.Equal(s.T(), rub(2000), first.SenderBalance)
+	assert.Equal(s.T(), rub(0), second.SenderBalance)
+
+	assert.Equal(s.T(), rub(10000), s.balance("wallet-a"))
+	assert.Equal(s.T(), rub(0), s.balance("wallet-b"))
+
+	refunds, err := s.storage.ListRefunds(s.ctx, id)
+	s.Require().NoError(err)
+	s.Require().Len(refunds, 2)
+	assert.Equal(s.T(), first.ID, refunds[0].ID)
+	assert.Equal(s.T(), second.ID, refunds[1].ID)
+	assert.Equal(s.T(), rub(2000), refunds[1].Amount)
+
+	got, err := s.storage.GetTransaction(s.ctx, second.ID)
+	s.Require().NoError(err)
+	s.Require().NotNil(got.RefundOf)
+	assert.Equal(s.T(), id, *got.RefundOf)
+
+	original, err := s.storage.GetTransaction(s.ctx, id)
+	s.Require().NoError(err)
+	assert.Nil(s.T(), original.RefundOf)
+
+	// Сумма возвратов исчерпана
+	_, err = s.storage.Refund(s.ctx, id, rub(1))
+	assert.ErrorIs(s.T(), err, storage.ErrRefundExceedsAmount)
+
+	report, err := s.storage.VerifyLedger(s.ctx)
+	s.Require().NoError(err)
+	assert.True(s.T(), report.OK(), "%+v", report)
+}
+
+func (s *Suite) TestRefund_Errors() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	s.createWallet("wallet-c", rub(0))
+	receipt, err := s.storage.Transfer(s.ctx, models.TransferRequest{From: "wallet-a", To: "wallet-b", Amount: rub(3000)})
+	s.Require().NoError(err)
+	id := receipt.ID
+
+	_, err = s.storage.Refund(s.ctx, 12345, rub(100))
+	assert.ErrorIs(s.T(), err, storage.ErrTransactionNotFound)
+	_, err = s.storage.Refund(s.ctx, id, rub(3001))
+	assert.ErrorIs(s.T(), err, storage.ErrRefundExceedsAmount)
+	_, err = s.storage.Refund(s.ctx, id, money.New(100, "USD"))
+	assert.ErrorIs(s.T(), err, money.ErrCurrencyMismatch)
+
+	// Получатель уже потратил деньги
+	s.Require().NoError(s.transfer("wallet-b", "wallet-c", rub(2500)))
+	_, err = s.storage.Refund(s.ctx, id, rub(1000))
+	assert.ErrorIs(s.T(), err, storage.ErrRefundInsufficientFunds)
+
+	refund, err := s.storage.Refund(s.ctx, id, rub(500))
+	s.Require().NoError(err)
+	_, err = s.storage.Refund(s.ctx, refund.ID, rub(100))
+	assert.ErrorIs(s.T(), err, storage.ErrRefundOfRefund)
+
+	refunds, err := s.storage.ListRefunds(s.ctx, refund.ID)
+	s.Require().NoError(err)
+	assert.Empty(s.T(), refunds)
+}
+
+func (s *Suite) TestRefund_ConcurrentNeverExceedsOriginal() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(10000))
+	receipt, err := s.storage.Transfer(s.ctx, models.TransferRequest{From: "wallet-a", To: "wallet-b", Amount: rub(1000)})
+	s.Require().NoError(err)
+
+	const workers = 10
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			_, _ = s.storage.Refund(s.ctx, receipt.ID, rub(300))
+		}()
+	}
+	wg.Wait()
+
+	refunds, err := s.storage.ListRefunds(s.ctx, receipt.ID)
+	s.Require().NoError(err)
+	assert.Len(s.T(), refunds, 3)
+	assert.Equal(s.T(), rub(9900), s.balance("wallet-a"))
+}
+
+func (s *Suite) TestTransferBatch_AllApplied() {
+	// Arrange
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	s.createWallet("wallet-c", rub(0))
+
+	// Act: второй перевод тратит деньги, полученные в первом
+	receipts, err := s.storage.TransferBatch(s.ctx, []models.TransferRequest{
+		{From: "wallet-a", To: "wallet-b", Amount: rub(3000)},
+		{From: "wallet-b", To: "wallet-c", Amount: rub(2000)},
+		{From: "wallet-a", To: "wallet-c", Amount: rub(1000)},
+	})
+
+	// Assert
+	s.Require().NoError(err)
+	s.Require().Len(receipts, 3)
+	assert.Equal(s.T(), rub(7000), receipts[0].SenderBalance)
+	assert.Equal(s.T(), rub(1000), receipts[1].SenderBalance)
+	assert.Equal(s.T(), rub(6000), receipts[2].SenderBalance)
+	assert.Less(s.T(), receipts[0].ID, receipts[1].ID)
+
+	assert.Equal(s.T(), rub(6000), s.balance("wallet-a"))
+	assert.Equal(s.T(), rub(1000), s.balance("wallet-b"))
+	assert.Equal(s.T(), rub(3000), s.balance("wallet-c"))
+
+	report, err := s.storage.VerifyLedger(s.ctx)
+	s.Require().NoError(err)
+	assert.True(s.T(), report.OK(), "%+v", report)
+}
+
+func (s *Suite) TestTransferBatch_RollsBackOnError() {
+	// Arrange
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	before, err := s.storage.ListTransactions(s.ctx, storage.TransactionFilter{})
+	s.Require().NoError(err)
+
+	// Act
+	_, err = s.storage.TransferBatch(s.ctx, []models.TransferRequest{
+		{From: "wallet-a", To: "wallet-b", Amount: rub(6000)},
+		{From: "wallet-a", To: "wallet-b", Amount: rub(6000)},
+	})
+
+	// Assert
+	var batchErr *storage.BatchError
+	s.Require().ErrorAs(err, &batchErr)
+	assert.Equal(s.T(), 1, batchErr.Index)
+	assert.ErrorIs(s.T(), err, storage.ErrInsufficientFunds)
+
+	assert.Equal(s.T(), rub(10000), s.balance("wallet-a"))
+	assert.Equal(s.T(), rub(0), s.balance("wallet-b"))
+	after, err := s.storage.ListTransactions(s.ctx, storage.TransactionFilter{})
+	s.Require().NoError(err)
+	assert.Equal(s.T(), len(before), len(after))
+
+	// Отмененный пакет не оставляет следов в журнале
+	s.Require().NoError(s.transfer("wallet-a", "wallet-b", rub(100)))
+	report, err := s.storage.VerifyLedger(s.ctx)
+	s.Require().NoError(err)
+	assert.True(s.T(), report.OK(), "%+v", report)
+}
+
+func (s *Suite) TestTransferBatch_UnknownWallet() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+
+	_, err := s.storage.TransferBatch(s.ctx, []models.TransferRequest{
+		{From: "wallet-a", To: "wallet-b", Amount: rub(100)},
+		{From: "wallet-a", To: "nonexistent-wallet", Amount: rub(100)},
+	})
+
+	var batchErr *storage.BatchError
+	s.Require().ErrorAs(err, &batchErr)
+	assert.Equal(s.T(), 1, batchErr.Index)
+	assert.ErrorIs(s.T(), err, storage.ErrWalletNotFound)
+	assert.Equal(s.T(), rub(10000), s.balance("wallet-a"))
+}
+
+func (s *Suite) TestTransfer_WithFee() {
+	// Arrange
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	s.createWallet("fees", rub(0))
+
+	// Act
+	receipt, err := s.storage.Transfer(s.ctx, models.TransferRequest{
+		From: "wallet-a", To: "wallet-b", Amount: rub(5000),
+		Fee: &models.Fee{Wallet: "fees", Amount: rub(150)},
+	})
+
+	// Assert
+	s.Require().NoError(err)
+	assert.Equal(s.T(), rub(5000), receipt.Amount)
+	assert.Equal(s.T(), rub(4850), receipt.SenderBalance)
+	s.Require().NotNil(receipt.Fee)
+	assert.Equal(s.T(), "wallet-a", receipt.Fee.From)
+	assert.Equal(s.T(), "fees", receipt.Fee.To)
+	assert.Equal(s.T(), rub(150), receipt.Fee.Amount)
+	s.Require().NotNil(receipt.Fee.FeeOf)
+	assert.Equal(s.T(), receipt.ID, *receipt.Fee.FeeOf)
+
+	assert.Equal(s.T(), rub(4850), s.balance("wallet-a"))
+	assert.Equal(s.T(), rub(5000), s.balance("wallet-b"))
+	assert.Equal(s.T(), rub(150), s.balance("fees"))
+
+	// Комиссия — отдельная строка истории
+	feeTx, err := s.storage.GetTransaction(s.ctx, receipt.Fee.ID)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), "fees", feeTx.To)
+	assert.Equal(s.T(), rub(150), feeTx.Amount)
+	assert.Equal(s.T(), receipt.Fee.FeeOf, feeTx.FeeOf)
+	transfer, err := s.storage.GetTransaction(s.ctx, receipt.ID)
+	s.Require().NoError(err)
+	assert.Nil(s.T(), transfer.FeeOf)
+
+	statement, err := s.storage.GetStatement(s.ctx, "wallet-a", time.Time{}, time.Time{})
+	s.Require().NoError(err)
+	s.Require().Len(statement.Lines, 3)
+	assert.Equal(s.T(), storage.EntryTransfer, statement.Lines[1].Kind)
+	assert.Equal(s.T(), storage.EntryFee, statement.Lines[2].Kind)
+	assert.Equal(s.T(), rub(-150), statement.Lines[2].Amount)
+
+	report, err := s.storage.VerifyLedger(s.ctx)
+	s.Require().NoError(err)
+	assert.True(s.T(), report.OK(), "%+v", report)
+}
+
+func (s *Suite) TestTransfer_FeeRequiresFunds() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	s.createWallet("fees", rub(0))
+
+	// сумма перевода доступна, сумма с комиссией — нет
+	_, err := s.storage.Transfer(s.ctx, models.TransferRequest{
+		From: "wallet-a", To: "wallet-b", Amount: rub(10000),
+		Fee: &models.Fee{Wallet: "fees", Amount: rub(1)},
+	})
+
+	assert.ErrorIs(s.T(), err, storage.ErrInsufficientFunds)
+	assert.Equal(s.T(), rub(10000), s.balance("wallet-a"))
+	assert.Equal(s.T(), rub(0), s.balance("fees"))
+}
+
+func (s *Suite) TestTransfer_FeeWalletUnavailable() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	s.createWallet("fees-usd", money.New(0, "USD"))
+
+	for _, wallet := range []string{"nonexistent-wallet", "fees-usd"} {
+		_, err := s.storage.Transfer(s.ctx, models.TransferRequest{
+			From: "wallet-a", To: "wallet-b", Amount: rub(100),
+			Fee: &models.Fee{Wallet: wallet, Amount: rub(1)},
+		})
+		assert.ErrorIs(s.T(), err, storage.ErrFeeWallet, wallet)
+	}
+
+	// перевод не выполнен и без комиссии
+	assert.Equal(s.T(), rub(10000), s.balance("wallet-a"))
+	assert.Equal(s.T(), rub(0), s.balance("wallet-b"))
+}
+
+func (s *Suite) TestRefund_FeeNotRefunded() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	s.createWallet("fees", rub(0))
+	receipt, err := s.storage.Transfer(s.ctx, models.TransferRequest{
+		From: "wallet-a", To: "wallet-b", Amount: rub(3000),
+		Fee: &models.Fee{Wallet: "fees", Amount: rub(30)},
+	})
+	s.Require().NoError(err)
+
+	// возврат перевода не возвращает комиссию
+	_, err = s.storage.Refund(s.ctx, receipt.ID, rub(3000))
+	s.Require().NoError(err)
+	assert.Equal(s.T(), rub(9970), s.balance("wallet-a"))
+	assert.Equal(s.T(), rub(30), s.balance("fees"))
+
+	// а саму комиссию вернуть нельзя
+	_, err = s.storage.Refund(s.ctx, receipt.Fee.ID, rub(30))
+	assert.ErrorIs(s.T(), err, storage.ErrRefundOfFee)
+}
+
+func (s *Suite) TestTransferBatch_WithFees() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	s.createWallet("fees", rub(0))
+
+	receipts, err := s.storage.TransferBatch(s.ctx, []models.TransferRequest{
+		{From: "wallet-a", To: "wallet-b", Amount: rub(3000), Fee: &models.Fee{Wallet: "fees", Amount: rub(30)}},
+		{From: "wallet-b", To: "fees", Amount: rub(1000), Fee: &models.Fee{Wallet: "fees", Amount: rub(10)}},
+		{From: "wallet-a", To: "wallet-b", Amount: rub(1000)},
+	})
+
+	s.Require().NoError(err)
+	s.Require().Len(receipts, 3)
+	assert.Equal(s.T(), rub(6970), receipts[0].SenderBalance)
+	assert.Equal(s.T(), rub(1990), receipts[1].SenderBalance)
+	assert.Nil(s.T(), receipts[2].Fee)
+	assert.Equal(s.T(), rub(5970), s.balance("wallet-a"))
+	assert.Equal(s.T(), rub(2990), s.balance("wallet-b"))
+	assert.Equal(s.T(), rub(1040), s.balance("fees"))
+
+	// комиссия последнего перевода не помещается в остаток — пакет откатывается
+	_, err = s.storage.TransferBatch(s.ctx, []models.TransferRequest{
+		{From: "wallet-b", To: "wallet-a", Amount: rub(2990), Fee: &models.Fee{Wallet: "fees", Amount: rub(1)}},
+	})
+	assert.ErrorIs(s.T(), err, storage.ErrInsufficientFunds)
+	assert.Equal(s.T(), rub(2990), s.balance("wallet-b"))
+	assert.Equal(s.T(), rub(1040), s.balance("fees"))
+}
+
+// createSchedule создает перевод и возвращает его перечитанным из хранилища,
+// как его видит планировщик: NextRunAt хранится с точностью базы.
+func (s *Suite) createSchedule(from, to string, amount money.Money, cron string, nextRunAt time.Time) models.Schedule {
+	created, err := s.storage.CreateSchedule(s.ctx, models.Schedule{
+		From: from, To: to, Amount: amount, Cron: cron,
+		NextRunAt: nextRunAt, CreatedAt: time.Now(),
+	})
+	s.Require().NoError(err)
+	schedule, err := s.storage.GetSchedule(s.ctx, created.ID)
+	s.Require().NoError(err)
+	return schedule
+}
+
+func (s *Suite) TestTransfer_WithConversion() {
+	// Arrange
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-usd", money.New(0, "USD"))
+
+	// Act
+	receipt, err := s.storage.Transfer(s.ctx, models.TransferRequest{
+		From: "wallet-a", To: "wallet-usd", Amount: rub(9250),
+		Conversion: &models.Conversion{Amount: money.New(100, "USD"), Rate: "0.0108108108"},
+	})
+
+	// Assert
+	s.Require().NoError(err)
+	assert.Equal(s.T(), rub(9250), receipt.Amount)
+	s.Require().NotNil(receipt.DestinationAmount)
+	assert.Equal(s.T(), money.New(100, "USD"), *receipt.DestinationAmount)
+	assert.Equal(s.T(), rub(750), receipt.SenderBalance)
+
+	assert.Equal(s.T(), rub(750), s.balance("wallet-a"))
+	assert.Equal(s.T(), money.New(100, "USD"), s.balance("wallet-usd"))
+
+	transfer, err := s.storage.GetTransaction(s.ctx, receipt.ID)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), rub(9250), transfer.Amount)
+	assert.Equal(s.T(), receipt.DestinationAmount, transfer.DestinationAmount)
+	assert.Equal(s.T(), "0.0108108108", transfer.Rate)
+
+	// У каждой стороны выписка в своей валюте, контрагент — другой кошелек
+	statement, err := s.storage.GetStatement(s.ctx, "wallet-usd", time.Time{}, time.Time{})
+	s.Require().NoError(err)
+	s.Require().Len(statement.Lines, 1)
+	assert.Equal(s.T(), money.New(100, "USD"), statement.Lines[0].Amount)
+	assert.Equal(s.T(), "wallet-a", statement.Lines[0].Counterparty)
+	statement, err = s.storage.GetStatement(s.ctx, "wallet-a", time.Time{}, time.Time{})
+	s.Require().NoError(err)
+	s.Require().Len(statement.Lines, 2)
+	assert.Equal(s.T(), rub(-9250), statement.Lines[1].Amount)
+	assert.Equal(s.T(), "wallet-usd", statement.Lines[1].Counterparty)
+
+	report, err := s.storage.VerifyLedger(s.ctx)
+	s.Require().NoError(err)
+	assert.True(s.T(), report.OK(), "%+v", report)
+}
+
+func (s *Suite) TestTransfer_CurrencyMismatchWithoutConversion() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-usd", money.New(0, "USD"))
+
+	err := s.transfer("wallet-a", "wallet-usd", rub(100))
+
+	assert.ErrorIs(s.T(), err, money.ErrCurrencyMismatch)
+	assert.Equal(s.T(), rub(10000), s.balance("wallet-a"))
+}
+
+func (s *Suite) TestRefund_WithConversion() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-usd", money.New(0, "USD"))
+	receipt, err := s.storage.Transfer(s.ctx, models.TransferRequest{
+		From: "wallet-a", To: "wallet-usd", Amount: rub(10000),
+		Conversion: &models.Conversion{Amount: money.New(108, "USD"), Rate: "0.0108"},
+	})
+	s.Require().NoError(err)
+	id := receipt.ID
+
+	// доля меньше цента не возвращается
+	_, err = s.storage.Refund(s.ctx, id, rub(1))
+	assert.ErrorIs(s.T(), err, fx.ErrAmountTooSmall)
+
+	// возврат в валюте отправителя, получатель платит по курсу перевода
+	refund, err := s.storage.Refund(s.ctx, id, rub(5000))
+	s.Require().NoError(err)
+	assert.Equal(s.T(), money.New(54, "USD"), refund.Amount)
+	s.Require().NotNil(refund.DestinationAmount)
+	assert.Equal(s.T(), rub(5000), *refund.DestinationAmount)
+	assert.NotEmpty(s.T(), refund.Rate)
+	assert.Equal(s.T(), money.New(54, "USD"), refund.SenderBalance)
+
+	_, err = s.storage.Refund(s.ctx, id, rub(3333))
+	s.Require().NoError(err)
+
+	// остаток списывает ровно зачисленное, без накопления округлений
+	_, err = s.storage.Refund(s.ctx, id, rub(1667))
+	s.Require().NoError(err)
+	_, err = s.storage.Refund(s.ctx, id, rub(1))
+	assert.ErrorIs(s.T(), err, storage.ErrRefundExceedsAmount)
+
+	assert.Equal(s.T(), rub(10000), s.balance("wallet-a"))
+	assert.Equal(s.T(), money.New(0, "USD"), s.balance("wallet-usd"))
+
+	refunds, err := s.storage.ListRefunds(s.ctx, id)
+	s.Require().NoError(err)
+	s.Require().Len(refunds, 3)
+	assert.Equal(s.T(), rub(5000), refunds[0].Credit())
+	assert.Equal(s.T(), money.New(54, "USD"), refunds[0].Amount)
+
+	report, err := s.storage.VerifyLedger(s.ctx)
+	s.Require().NoError(err)
+	assert.True(s.T(), report.OK(), "%+v", report)
+}
+
+func (s *Suite) TestCreateSchedule() {
+	// Arrange
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	runAt := time.Now().Add(time.Hour)
+
+	// Act
+	schedule := s.createSchedule("wallet-a", "wallet-b", rub(500), "@daily", runAt)
+
+	// Assert
+	assert.NotZero(s.T(), schedule.ID)
+	assert.Equal(s.T(), storage.ScheduleActive, schedule.Status)
+
+	got, err := s.storage.GetSchedule(s.ctx, schedule.ID)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), "wallet-a", got.From)
+	assert.Equal(s.T(), "wallet-b", got.To)
+	assert.Equal(s.T(), rub(500), got.Amount)
+	assert.Equal(s.T(), "@daily", got.Cron)
+	assert.Equal(s.T(), 0, got.Attempts)
+	assert.WithinDuration(s.T(), runAt, got.NextRunAt, time.Millisecond)
+
+	_, err = s.storage.GetSchedule(s.ctx, schedule.ID+100)
+	assert.ErrorIs(s.T(), err, storage.ErrScheduleNotFound)
+}
+
+func (s *Suite) TestCreateSchedule_Errors() {
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-usd", money.New(0, "USD"))
+
+	create := func(to string) error {
+		_, err := s.storage.CreateSchedule(s.ctx, models.Schedule{
+			From: "wallet-a", To: to, Amount: rub(100), NextRunAt: time.Now(), CreatedAt: time.Now(),
+		})
+		return err
+	}
+	assert.ErrorIs(s.T(), create("nonexistent-wallet"), storage.ErrWalletNotFound)
+	assert.ErrorIs(s.T(), create("wallet-usd"), money.ErrCurrencyMismatch)
+}
+
+func (s *Suite) TestDueSchedules() {
+	// Arrange
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	now := time.Now()
+	later := s.createSchedule("wallet-a", "wallet-b", rub(100), "", now.Add(-time.Minute))
+	earlier := s.createSchedule("wallet-a", "wallet-b", rub(100), "", now.Add(-time.Hour))
+	s.createSchedule("wallet-a", "wallet-b", rub(100), "", now.Add(time.Hour))
+	cancelled := s.createSchedule("wallet-a", "wallet-b", rub(100), "", now.Add(-time.Hour))
+	_, err := s.storage.CancelSchedule(s.ctx, cancelled.ID)
+	s.Require().NoError(err)
+
+	// Act
+	due, err := s.storage.DueSchedules(s.ctx, now, 10)
+
+	// Assert: только наступившие активные, по времени запуска
+	s.Require().NoError(err)
+	s.Require().Len(due, 2)
+	assert.Equal(s.T(), earlier.ID, due[0].ID)
+	assert.Equal(s.T(), later.ID, due[1].ID)
+
+	due, err = s.storage.DueSchedules(s.ctx, now, 1)
+	s.Require().NoError(err)
+	assert.Len(s.T(), due, 1)
+}
+
+func (s *Suite) TestRecordScheduleRun() {
+	// Arrange
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	schedule := s.createSchedule("wallet-a", "wallet-b", rub(100), "@hourly", time.Now())
+	fired := schedule.NextRunAt
+	receipt, err := s.storage.Transfer(s.ctx, models.TransferRequest{From: "wallet-a", To: "wallet-b", Amount: rub(100)})
+	s.Require().NoError(err)
+
+	// Act
+	next := time.Now().Add(time.Hour)
+	schedule.NextRunAt = next
+	schedule.Attempts = 1
+	run, err := s.storage.RecordScheduleRun(s.ctx, schedule, models.ScheduleRun{
+		Status: storage.RunSucceeded, TransactionID: &receipt.ID, ScheduledAt: fired, ExecutedAt: time.Now(),
+	})
+	s.Require().NoError(err)
+	got, err := s.storage.GetSchedule(s.ctx, schedule.ID)
+	s.Require().NoError(err)
+	_, err = s.storage.RecordScheduleRun(s.ctx, schedule, models.ScheduleRun{
+		Status: storage.RunRetrying, Error: "insufficient funds", ScheduledAt: got.NextRunAt, ExecutedAt: time.Now(),
+	})
+	s.Require().NoError(err)
+
+	// Assert
+	assert.NotZero(s.T(), run.ID)
+	assert.Equal(s.T(), schedule.ID, run.ScheduleID)
+	assert.WithinDuration(s.T(), next, got.NextRunAt, time.Millisecond)
+	assert.Equal(s.T(), 1, got.Attempts)
+
+	runs, err := s.storage.ListScheduleRuns(s.ctx, schedule.ID)
+	s.Require().NoError(err)
+	s.Require().Len(runs, 2)
+	assert.Equal(s.T(), storage.RunSucceeded, runs[0].Status)
+	assert.True(s.T(), fired.Equal(runs[0].ScheduledAt))
+	s.Require().NotNil(runs[0].TransactionID)
+	assert.Equal(s.T(), receipt.ID, *runs[0].TransactionID)
+	assert.Equal(s.T(), storage.RunRetrying, runs[1].Status)
+	assert.Equal(s.T(), "insufficient funds", runs[1].Error)
+	assert.Nil(s.T(), runs[1].TransactionID)
+
+	// Срабатывание записывается один раз
+	_, err = s.storage.RecordScheduleRun(s.ctx, schedule, models.ScheduleRun{
+		Status: storage.RunFailed, ScheduledAt: fired, ExecutedAt: time.Now(),
+	})
+	assert.ErrorIs(s.T(), err, storage.ErrScheduleNotDue)
+	runs, err = s.storage.ListScheduleRuns(s.ctx, schedule.ID)
+	s.Require().NoError(err)
+	assert.Len(s.T(), runs, 2)
+
+	_, err = s.storage.RecordScheduleRun(s.ctx, models.Schedule{ID: schedule.ID + 100}, models.ScheduleRun{
+		Status: storage.RunFailed, ExecutedAt: time.Now(),
+	})
+	assert.ErrorIs(s.T(), err, storage.ErrScheduleNotFound)
+}
+
+func (s *Suite) TestTransfer_Scheduled() {
+	// Arrange
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	schedule := s.createSchedule("wallet-a", "wallet-b", rub(100), "", time.Now())
+	completed := schedule
+	completed.Status = storage.ScheduleCompleted
+	transfer := models.TransferRequest{
+		From: "wallet-a", To: "wallet-b", Amount: rub(100),
+		Schedule: &models.ScheduledTransfer{
+			Schedule: completed,
+			Run:      models.ScheduleRun{Status: storage.RunSucceeded, ScheduledAt: schedule.NextRunAt, ExecutedAt: time.Now()},
+		},
+	}
+
+	// Act
+	receipt, err := s.storage.Transfer(s.ctx, transfer)
+	s.Require().NoError(err)
+	// второй экземпляр планировщика выполняет то же срабатывание
+	_, again := s.storage.Transfer(s.ctx, transfer)
+
+	// Assert: перевод и запуск записаны вместе, повтор не списывает деньги
+	assert.ErrorIs(s.T(), again, storage.ErrScheduleNotDue)
+	assert.Equal(s.T(), rub(9900), s.balance("wallet-a"))
+	assert.Equal(s.T(), rub(100), s.balance("wallet-b"))
+
+	got, err := s.storage.GetSchedule(s.ctx, schedule.ID)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), storage.ScheduleCompleted, got.Status)
+
+	runs, err := s.storage.ListScheduleRuns(s.ctx, schedule.ID)
+	s.Require().NoError(err)
+	s.Require().Len(runs, 1)
+	assert.Equal(s.T(), storage.RunSucceeded, runs[0].Status)
+	s.Require().NotNil(runs[0].TransactionID)
+	assert.Equal(s.T(), receipt.ID, *runs[0].TransactionID)
+}
+
+func (s *Suite) TestCancelSchedule() {
+	// Arrange
+	s.createWallet("wallet-a", rub(10000))
+	s.createWallet("wallet-b", rub(0))
+	schedule := s.createSchedule("wallet-a", "wallet-b", rub(100), "", time.Now())
+
+	// Act
+	cancelled, err := s.storage.CancelSchedule(s.ctx, schedule.ID)
+
+	// Assert
+	s.Require().NoError(err)
+	assert.Equal(s.T(), storage.ScheduleCancelled, cancelled.Status)
+
+	_, err = s.storage.CancelSchedule(s.ctx, schedule.ID)
+	assert.ErrorIs(s.T(), err, storage.ErrScheduleNotActive)
+	_, err = s.storage.CancelSchedule(s.ctx, schedule.ID+100)
+	assert.ErrorIs(s.T(), err, storage.ErrScheduleNotFound)
+
+	// Запуск, завершившийся после отмены, не записывается и не возобновляет перевод
+	fired := schedule.NextRunAt
+	schedule.NextRunAt = time.Now().Add(time.Hour)
+	_, err = s.storage.RecordScheduleRun(s.ctx, schedule, models.ScheduleRun{
+		Status: storage.RunRetrying, Error: "insufficient funds", ScheduledAt: fired, ExecutedAt: time.Now(),
+	})
+	assert.ErrorIs(s.T(), err, storage.ErrScheduleNotDue)
+	got, err := s.storage.GetSchedule(s.ctx, schedule.ID)
+	s.Require().NoError(err)
+	assert.Equal(s.T(), storage.ScheduleCancelled, got.Status)
+}
+
+func (s *Suite) TestAPIKeys() {
+	// Arrange
+	created, err := s.storage.CreateAPIKey(s.ctx, models.APIKey{
+		Name:        "merchant",
+		Prefix:      "psk_aaaa",
+		Wallets:     []string{"wallet-a", "wallet-b"},
+		Roles:       []string{"customer"},
+		Permissions: []string{"send", "balance:read"},
+		CreatedAt:   time.Now(),
+	}, "hash-1")
+	s.Require().NoError(err)
+	other, err := s.storage.CreateAPIKey(s.ctx, models.APIKey{
+		Name: "auditor", Prefix: "psk_bbbb", Wallets: []string{"*"}, Roles: []string{"auditor"}, CreatedAt: time.Now(),
+	}, "hash-2")
+	s.Require().NoError(err)
+
+	// Act
+	byHash, err := s.storage.GetAPIKeyByHash(s.ctx, "hash-1")
+
+	// Assert
+	s.Require().NoError(err)
+	assert.Equal(s.T(), created.ID, byHash.ID)
+	assert.Equal(s.T(), "merchant", byHash.Name)
+	assert.Equal(s.T(), []string{"wallet-a", "wallet-b"}, byHash.Wallets)
+	assert.Equal(s.T(), []string{"customer"}, byHash.Roles)
+	assert.Equal(s.T(), []string{"send", "balance:read"}, byHash.Permissions)
+	assert.Nil(s.T(), byHash.RevokedAt)
+
+	keys, err := s.storage.ListAPIKeys(s.ctx)
+	s.Require().NoError(err)
+	s.Require().Len(keys, 2)
+	assert.Equal(s.T(), created.ID, keys[0].ID)
+	assert.Equal(s.T(), other.ID, keys[1].ID)
+	assert.Equal(s.T(), []string{"auditor"}, keys[1].Roles)
+	assert.Empty(s.T(), keys[1].Permissions)
+
+	_, err = s.storage.GetAPIKeyByHash(s.ctx, "unknown")
+	assert.ErrorIs(s.T(), err, storage.ErrAPIKeyNotFound)
+	_, err = s.storage.GetAPIKey(s.ctx, other.ID+100)
+	assert.ErrorIs(s.T(), err, storage.ErrAPIKeyNotFound)
+}
+
+func (s *Suite) TestRotateAndRevokeAPIKey() {
+	key, err := s.storage.CreateAPIKey(s.ctx, models.APIKey{
+		Name: "merchant", Prefix: "psk_aaaa", Wallets: []string{"wallet-a"}, Permissions: []string{"send"}, CreatedAt: time.Now(),
+	}, "hash-1")
+	s.Require().NoError(err)
+
+	// Ротация: прежнее значение ключа больше не находится
+	rotated, err := s.storage.RotateAPIKey(s.ctx, key.ID, "hash-2", "psk_cccc", time.Now())
+	s.Require().NoError(err)
+	assert.Equal(s.T(), "psk_cccc", rotated.Prefix)
+	s.Require().NotNil(rotated.RotatedAt)
+	_, err = s.storage.GetAPIKeyByHash(s.ctx, "hash-1")
+	assert.ErrorIs(s.T(), err, storage.ErrAPIKeyNotFound)
+	byHash, err := s.storage.GetAPIKeyByHash(s.ctx, "hash-2")
+	s.Require().NoError(err)
+	assert.Equal(s.T(), key.ID, byHash.ID)
+
+	// Отзыв: ключ находится, но помечен отозванным
+	revoked, err := s.storage.RevokeAPIKey(s.ctx, key.ID, time.Now())
+	s.Require().NoError(err)
+	s.Require().NotNil(revoked.RevokedAt)
+	byHash, err = s.storage.GetAPIKeyByHash(s.ctx, "hash-2")
+	s.Require().NoError(err)
+	assert.NotNil(s.T(), byHash.RevokedAt)
+
+	_, err = s.storage.RevokeAPIKey(s.ctx, key.ID, time.Now())
+	assert.ErrorIs(s.T(), err, storage.ErrAPIKeyRevoked)
+	_, err = s.storage.RotateAPIKey(s.ctx, key.ID, "hash-3", "psk_dddd", time.Now())
+	assert.ErrorIs(s.T(), err, storage.ErrAPIKeyRevoked)
+	_, err = s.storage.RevokeAPIKey(s.ctx, key.ID+100, time.Now())
+	assert.ErrorIs(s.T(), err, storage.ErrAPIKeyNotFound)
+}